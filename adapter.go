@@ -3,7 +3,10 @@ package migrate
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Adapter is the interface that wraps the methods required to track information
@@ -26,6 +29,48 @@ type Adapter interface {
 	InsertSchemaVersion(ctx context.Context, db *sql.DB, version int, upgrade bool, comment string) error
 }
 
+// Direction describes how a row in the version table changed the version.
+type Direction string
+
+const (
+	// DirectionApplied means the migration was applied by running Up.
+	DirectionApplied Direction = "applied"
+
+	// DirectionReverted means the migration was reverted by running Down.
+	DirectionReverted Direction = "reverted"
+
+	// DirectionBaseline means the version was recorded without running the
+	// migration, because the schema already existed, such as when loading a
+	// snapshot.
+	DirectionBaseline Direction = "baseline"
+
+	// DirectionSkipped means the migration was deliberately not run, but its
+	// version was recorded so later migrations can be applied.
+	DirectionSkipped Direction = "skipped"
+)
+
+// upgrade returns true if the direction leaves the migration in place.
+func (d Direction) upgrade() bool {
+	return d != DirectionReverted
+}
+
+// DirectionInserter is an optional interface for adapters that can record
+// why a version was inserted, rather than just whether it was an upgrade. If
+// the adapter implements it, it's used instead of InsertSchemaVersion.
+type DirectionInserter interface {
+	InsertSchemaVersionDirection(ctx context.Context, db *sql.DB, version int, direction Direction, comment string) error
+}
+
+// insertVersion inserts a version with the adapter, using the direction if
+// the adapter supports it.
+func insertVersion(ctx context.Context, db *sql.DB, adapter Adapter, version int, direction Direction, comment string) error {
+	recordReplay(ctx, ReplayEvent{Kind: ReplayInsertVersion, Version: version, Direction: direction, Comment: comment})
+	if di, ok := adapter.(DirectionInserter); ok {
+		return di.InsertSchemaVersionDirection(ctx, db, version, direction, comment)
+	}
+	return adapter.InsertSchemaVersion(ctx, db, version, direction.upgrade(), comment)
+}
+
 // LogFunc is the log function type used by migration logging.
 type LogFunc func(format string, v ...interface{})
 
@@ -41,11 +86,52 @@ type TableAdapter struct {
 	// Log is the function to use for adapter logging.
 	LogFunc LogFunc
 
+	// Dialect is the SQL dialect of the database. It's used by helpers that
+	// inspect SQL, such as AnalyzeLocks.
+	Dialect Dialect
+
+	// TableName is the name of the table used to track migration versions.
+	// It defaults to schema_versions if empty. Set this if more than one set
+	// of migrations shares the database (see Combine).
+	TableName string
+
+	// SkipPrepare stops PrepareSchemaVersions from creating the version
+	// table. Instead, it checks that the table already exists and returns a
+	// *MissingTableError if it doesn't. This is useful when the table is
+	// created by a DBA, and the database user used for migrations doesn't
+	// have permission to create tables.
+	SkipPrepare bool
+
+	// IDColumn adds an auto-incrementing id column to the version table, and
+	// uses it to find the most recent version instead of created_at, which
+	// can be ambiguous when several rows are inserted in the same second. If
+	// the table already exists without the column, PrepareSchemaVersions
+	// adds it, numbering the existing rows in the order the database stores
+	// them (the order they were inserted, for a table that has only been
+	// appended to). SQLite tables use the built-in rowid instead, so existing
+	// SQLite tables aren't changed. This is only supported for DialectMySQL,
+	// DialectPostgreSQL and DialectSQLite.
+	IDColumn bool
+
+	// DirectionColumn stores a Direction like "applied" or "reverted" in a
+	// direction column, instead of storing a boolean in the upgrade column.
+	// This makes the history easier to read, and records cases like loading
+	// a snapshot, which are otherwise recorded as upgrades. The direction is
+	// inserted using PlaceholderUpgrade. It can't be changed for an existing
+	// table.
+	DirectionColumn bool
+
 	// CreateTableOptions can be used to specify arbitrary SQL to include at
 	// the end of the CREATE TABLE statement (to specify a CHARSET for a MySQL
 	// table, for instance).
 	CreateTableOptions string
 
+	// OnCluster is the name of a ClickHouse cluster. If it's set, the version
+	// table is created with ON CLUSTER, so it's created on every node. Use
+	// OnClusterRewriter to do the same for the DDL in migrations. This is
+	// only supported for DialectClickHouse.
+	OnCluster string
+
 	// PlaceholderVersion specifies the placeholder to use in the INSERT query
 	// for the version number, the first value in the insert. This would be
 	// something like ? for MySQL or $1 for PostgreSQL.
@@ -60,6 +146,85 @@ type TableAdapter struct {
 	// for the comment, the third value in the insert. This would be something
 	// like ? for MySQL or $3 for PostgreSQL.
 	PlaceholderComment string
+
+	// Now is used to get the time to record in the created_at column when a
+	// version is inserted. If it's nil, the database's CURRENT_TIMESTAMP is
+	// used instead. Since the current version is the most recently created
+	// row, this can be set to time.Now to avoid ambiguity when more than one
+	// migration is applied in the same second, and CURRENT_TIMESTAMP only has
+	// second precision. With MySQL, the created_at column must also be
+	// changed to TIMESTAMP(6), or the fractional seconds are discarded.
+	Now func() time.Time
+
+	// PlaceholderCreatedAt specifies the placeholder to use in the INSERT
+	// query for created_at when Now is set, the fourth value in the insert.
+	// This would be something like ? for MySQL or $4 for PostgreSQL.
+	PlaceholderCreatedAt string
+
+	// FailuresTableName is the name of a table to record failed migrations
+	// in. If it's empty, failures aren't recorded. The table is created the
+	// first time a failure is recorded. Each row records the version, the
+	// direction, the comment and the text of the error.
+	FailuresTableName string
+
+	// PlaceholderError specifies the placeholder to use in the INSERT query
+	// for the error text, the fourth value in the insert into the failures
+	// table. This would be something like ? for MySQL or $4 for PostgreSQL.
+	PlaceholderError string
+
+	// CheckpointsTableName is the name of a table to record the progress of
+	// migrations with Checkpoints in. If it's empty, progress isn't
+	// recorded, and every step is run each time a migration is applied. The
+	// table is created the first time a migration with Checkpoints is run.
+	// The step is inserted using PlaceholderUpgrade.
+	CheckpointsTableName string
+
+	// CommentCodec encodes the comments inserted into the version table, and
+	// the comments and errors inserted into the failures table, such as by
+	// encrypting them. VersionStore decodes them when reading the history.
+	// If it's nil, they're stored as they are.
+	CommentCodec CommentCodec
+
+	// TeamColumn adds a team column to the version table, and records the
+	// Team of each migration in it, so schema changes can be attributed to
+	// the teams that own them with SummarizeTeams. The team is inserted
+	// after the other values, using the dialect's placeholder. It can't be
+	// changed for an existing table.
+	TeamColumn bool
+
+	// MetadataColumn adds a metadata column to the version table, and
+	// records the Migrator's Metadata in it as a JSON object, so each row
+	// can be traced back to the deploy that inserted it. The metadata is
+	// inserted after the other values, using the dialect's placeholder. It
+	// can't be changed for an existing table.
+	MetadataColumn bool
+
+	// ChecksumColumn adds a checksum column to the version table, and
+	// records the Checksum of each migration in it, so the SQL that was
+	// applied can be verified later, such as with CompareHistories. The
+	// checksum is inserted after the other values, using the dialect's
+	// placeholder. For an existing table, BackfillChecksums adds the column
+	// and fills it in for the rows that were already inserted.
+	ChecksumColumn bool
+}
+
+// NewClickHouseAdapter creates a TableAdapter compatible with
+// https://github.com/ClickHouse/clickhouse-go/. The version table uses the
+// MergeTree engine. For a replicated cluster, set OnCluster, and change
+// CreateTableOptions to use ReplicatedMergeTree so that every node sees the
+// same versions. The log parameter can be set to log.Printf or a compatible
+// function, or nil if you don't want to log.
+func NewClickHouseAdapter(log LogFunc) *TableAdapter {
+	return &TableAdapter{
+		LogFunc:              log,
+		Dialect:              DialectClickHouse,
+		CreateTableOptions:   " ENGINE = MergeTree ORDER BY created_at",
+		PlaceholderVersion:   "?",
+		PlaceholderUpgrade:   "?",
+		PlaceholderComment:   "?",
+		PlaceholderCreatedAt: "?",
+		PlaceholderError:     "?",
+	}
 }
 
 // NewMySQLAdapter creates a TableAdapter compatible with
@@ -68,11 +233,14 @@ type TableAdapter struct {
 // log.Printf or a compatible function, or nil if you don't want to log.
 func NewMySQLAdapter(log LogFunc) *TableAdapter {
 	return &TableAdapter{
-		LogFunc:            log,
-		CreateTableOptions: " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
-		PlaceholderVersion: "?",
-		PlaceholderUpgrade: "?",
-		PlaceholderComment: "?",
+		LogFunc:              log,
+		Dialect:              DialectMySQL,
+		CreateTableOptions:   " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		PlaceholderVersion:   "?",
+		PlaceholderUpgrade:   "?",
+		PlaceholderComment:   "?",
+		PlaceholderCreatedAt: "?",
+		PlaceholderError:     "?",
 	}
 }
 
@@ -81,10 +249,13 @@ func NewMySQLAdapter(log LogFunc) *TableAdapter {
 // log.Printf or a compatible function, or nil if you don't want to log.
 func NewPostgreSQLAdapter(log LogFunc) *TableAdapter {
 	return &TableAdapter{
-		LogFunc:            log,
-		PlaceholderVersion: "$1",
-		PlaceholderUpgrade: "$2",
-		PlaceholderComment: "$3",
+		LogFunc:              log,
+		Dialect:              DialectPostgreSQL,
+		PlaceholderVersion:   "$1",
+		PlaceholderUpgrade:   "$2",
+		PlaceholderComment:   "$3",
+		PlaceholderCreatedAt: "$4",
+		PlaceholderError:     "$4",
 	}
 }
 
@@ -93,10 +264,13 @@ func NewPostgreSQLAdapter(log LogFunc) *TableAdapter {
 // a compatible function, or nil if you don't want to log.
 func NewSQLiteAdapter(log LogFunc) *TableAdapter {
 	return &TableAdapter{
-		LogFunc:            log,
-		PlaceholderVersion: "?",
-		PlaceholderUpgrade: "?",
-		PlaceholderComment: "?",
+		LogFunc:              log,
+		Dialect:              DialectSQLite,
+		PlaceholderVersion:   "?",
+		PlaceholderUpgrade:   "?",
+		PlaceholderComment:   "?",
+		PlaceholderCreatedAt: "?",
+		PlaceholderError:     "?",
 	}
 }
 
@@ -108,23 +282,140 @@ func (t *TableAdapter) Log(format string, v ...interface{}) {
 	}
 }
 
+// table returns the name of the version table.
+func (t *TableAdapter) table() string {
+	if t.TableName == "" {
+		return "schema_versions"
+	}
+	return t.TableName
+}
+
+// WithTableName returns a copy of the adapter that uses the given table name
+// to track migration versions.
+func (t *TableAdapter) WithTableName(name string) *TableAdapter {
+	c := *t
+	c.TableName = name
+	return &c
+}
+
+// MissingTableError is returned by PrepareSchemaVersions when SkipPrepare is
+// set and the version table can't be queried.
+type MissingTableError struct {
+	// Table is the name of the version table.
+	Table string
+
+	// Err is the error returned when querying the table.
+	Err error
+}
+
+func (e *MissingTableError) Error() string {
+	return fmt.Sprintf("version table %s does not exist or cannot be read: %s", e.Table, e.Err)
+}
+
+// Unwrap returns the error returned when querying the table.
+func (e *MissingTableError) Unwrap() error {
+	return e.Err
+}
+
 // PrepareSchemaVersions ensures that the schema_versions table exists.
 func (t *TableAdapter) PrepareSchemaVersions(ctx context.Context, db *sql.DB) error {
+	if t.SkipPrepare {
+		var version int
+		row := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT version FROM %s WHERE 1 = 0`, t.table()))
+		if err := row.Scan(&version); err != nil && err != sql.ErrNoRows {
+			return &MissingTableError{Table: t.table(), Err: err}
+		}
+		return nil
+	}
+	if t.OnCluster != "" && t.Dialect != DialectClickHouse {
+		return fmt.Errorf("ON CLUSTER is not supported for dialect %q", t.Dialect)
+	}
+	if t.IDColumn {
+		return t.prepareIDColumn(ctx, db)
+	}
+	if t.Dialect == DialectClickHouse {
+		return t.prepareClickHouse(ctx, db)
+	}
 	_, err := db.ExecContext(ctx, fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS schema_versions (
+		CREATE TABLE IF NOT EXISTS %s (
 			version INT NOT NULL PRIMARY KEY,
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			upgrade TINYINT NOT NULL,
-			comment TEXT NOT NULL
+			%s,
+			comment TEXT NOT NULL%s
+		)%s
+	`, t.table(), t.directionColumn(), t.optionalColumns(), t.CreateTableOptions))
+	return err
+}
+
+// prepareIDColumn creates the version table with an id column, or adds the
+// column to an existing table that doesn't have one.
+func (t *TableAdapter) prepareIDColumn(ctx context.Context, db *sql.DB) error {
+	idType, err := TypeBigAutoID.SQL(t.Dialect)
+	if err != nil {
+		return fmt.Errorf("id column is not supported for dialect %q", t.Dialect)
+	}
+	var addColumn string
+	switch t.Dialect {
+	case DialectMySQL:
+		addColumn = fmt.Sprintf(`ALTER TABLE %s DROP PRIMARY KEY, ADD COLUMN id %s FIRST`, t.table(), idType)
+	case DialectPostgreSQL:
+		name := t.table()
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		addColumn = fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s, ADD COLUMN id %s`,
+			t.table(), t.Dialect.quoteIdent(strings.Trim(name, `"`)+"_pkey"), idType)
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id %s,
+			version INT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			%s,
+			comment TEXT NOT NULL%s
 		)%s
-	`, t.CreateTableOptions))
+	`, t.table(), idType, t.directionColumn(), t.optionalColumns(), t.CreateTableOptions))
+	if err != nil || addColumn == "" {
+		return err
+	}
+	columns, err := t.columns(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if strings.EqualFold(c, "id") {
+			return nil
+		}
+	}
+	t.Log("Adding id column to %s", t.table())
+	_, err = db.ExecContext(ctx, addColumn)
 	return err
 }
 
+// columns returns the names of the columns in the version table.
+func (t *TableAdapter) columns(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s WHERE 1 = 0`, t.table()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// orderColumn returns the column used to find the most recent version.
+func (t *TableAdapter) orderColumn() string {
+	if !t.IDColumn {
+		return "created_at"
+	} else if t.Dialect == DialectSQLite {
+		return "rowid"
+	}
+	return "id"
+}
+
 // QuerySchemaVersion returns the current schema version.
 func (t *TableAdapter) QuerySchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
 	var currentVersion int
-	row := db.QueryRowContext(ctx, `SELECT version FROM schema_versions ORDER BY created_at DESC LIMIT 1`)
+	row := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT version FROM %s ORDER BY %s DESC LIMIT 1`, t.table(), t.orderColumn()))
 	if err := row.Scan(&currentVersion); err == sql.ErrNoRows {
 		return 0, nil
 	} else if err != nil {
@@ -133,10 +424,144 @@ func (t *TableAdapter) QuerySchemaVersion(ctx context.Context, db *sql.DB) (int,
 	return currentVersion, nil
 }
 
+// directionColumn returns the definition of the column used to record the
+// direction of each version.
+func (t *TableAdapter) directionColumn() string {
+	if t.DirectionColumn {
+		return "direction VARCHAR(16) NOT NULL"
+	}
+	return "upgrade TINYINT NOT NULL"
+}
+
+// teamColumn returns the definition of the team column, with a leading comma,
+// or an empty string if TeamColumn isn't set.
+func (t *TableAdapter) teamColumn() string {
+	if !t.TeamColumn {
+		return ""
+	}
+	if t.Dialect == DialectClickHouse {
+		return ",\n\t\t\tteam String"
+	}
+	return ",\n\t\t\tteam VARCHAR(255) NOT NULL DEFAULT ''"
+}
+
+// metadataColumn returns the definition of the metadata column, with a
+// leading comma, or an empty string if MetadataColumn isn't set.
+func (t *TableAdapter) metadataColumn() string {
+	if !t.MetadataColumn {
+		return ""
+	}
+	if t.Dialect == DialectClickHouse {
+		return ",\n\t\t\tmetadata String"
+	}
+	return ",\n\t\t\tmetadata TEXT"
+}
+
+// checksumColumn returns the definition of the checksum column, with a
+// leading comma, or an empty string if ChecksumColumn isn't set.
+func (t *TableAdapter) checksumColumn() string {
+	if !t.ChecksumColumn {
+		return ""
+	}
+	if t.Dialect == DialectClickHouse {
+		return ",\n\t\t\tchecksum String"
+	}
+	return ",\n\t\t\tchecksum VARCHAR(64) NOT NULL DEFAULT ''"
+}
+
+// optionalColumns returns the definitions of the optional columns of the
+// version table, each with a leading comma.
+func (t *TableAdapter) optionalColumns() string {
+	return t.teamColumn() + t.metadataColumn() + t.checksumColumn()
+}
+
 // InsertSchemaVersion inserts a new version into the schema_versions table.
 func (t *TableAdapter) InsertSchemaVersion(ctx context.Context, db *sql.DB, version int, upgrade bool, comment string) error {
-	_, err := db.ExecContext(ctx, fmt.Sprintf(`
-		INSERT INTO schema_versions (version, upgrade, comment) VALUES (%s, %s, %s)
-	`, t.PlaceholderVersion, t.PlaceholderUpgrade, t.PlaceholderComment), version, upgrade, comment)
+	direction := DirectionApplied
+	if !upgrade {
+		direction = DirectionReverted
+	}
+	return t.InsertSchemaVersionDirection(ctx, db, version, direction, comment)
+}
+
+// InsertSchemaVersionDirection inserts a new version into the schema_versions
+// table. If DirectionColumn isn't set, the direction is stored as a boolean in
+// the upgrade column.
+func (t *TableAdapter) InsertSchemaVersionDirection(ctx context.Context, db *sql.DB, version int, direction Direction, comment string) error {
+	column, value := "upgrade", interface{}(direction.upgrade())
+	if t.DirectionColumn {
+		column, value = "direction", string(direction)
+	}
+	comment, err := t.encodeComment(comment)
+	if err != nil {
+		return err
+	}
+	columns := []string{"version", column, "comment"}
+	placeholders := []string{t.PlaceholderVersion, t.PlaceholderUpgrade, t.PlaceholderComment}
+	args := []interface{}{version, value, comment}
+	if t.Now != nil {
+		columns = append(columns, "created_at")
+		placeholders = append(placeholders, t.PlaceholderCreatedAt)
+		args = append(args, t.Now())
+	}
+	if t.TeamColumn {
+		columns = append(columns, "team")
+		placeholders = append(placeholders, t.Dialect.placeholder(len(args)+1))
+		args = append(args, teamFromContext(ctx))
+	}
+	if t.MetadataColumn {
+		metadata := metadataFromContext(ctx)
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, "metadata")
+		placeholders = append(placeholders, t.Dialect.placeholder(len(args)+1))
+		args = append(args, string(b))
+	}
+	if t.ChecksumColumn {
+		columns = append(columns, "checksum")
+		placeholders = append(placeholders, t.Dialect.placeholder(len(args)+1))
+		args = append(args, checksumFromContext(ctx))
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s) VALUES (%s)
+	`, t.table(), strings.Join(columns, ", "), strings.Join(placeholders, ", ")), args...)
+	return err
+}
+
+// RecordFailure inserts a row into the failures table, if FailuresTableName
+// is set.
+func (t *TableAdapter) RecordFailure(ctx context.Context, db *sql.DB, failure *MigrationError) error {
+	if t.FailuresTableName == "" {
+		return nil
+	}
+	comment, err := t.encodeComment(failure.Comment)
+	if err != nil {
+		return err
+	}
+	errorText, err := t.encodeComment(failure.Err.Error())
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version INT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			upgrade BOOLEAN NOT NULL,
+			comment TEXT NOT NULL,
+			error TEXT NOT NULL
+		)%s
+	`, t.FailuresTableName, t.CreateTableOptions))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, upgrade, comment, error) VALUES (%s, %s, %s, %s)
+	`, t.FailuresTableName, t.PlaceholderVersion, t.PlaceholderUpgrade, t.PlaceholderComment, t.PlaceholderError),
+		failure.Version, failure.Upgrade, comment, errorText)
 	return err
 }
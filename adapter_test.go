@@ -1,6 +1,11 @@
 package migrate
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestTableAdapterFuncs(t *testing.T) {
 	tests := []struct {
@@ -8,32 +13,54 @@ func TestTableAdapterFuncs(t *testing.T) {
 		Func     func(log LogFunc) *TableAdapter
 		Expected TableAdapter
 	}{
+		{
+			Name: "ClickHouse",
+			Func: NewClickHouseAdapter,
+			Expected: TableAdapter{
+				Dialect:              DialectClickHouse,
+				CreateTableOptions:   " ENGINE = MergeTree ORDER BY created_at",
+				PlaceholderVersion:   "?",
+				PlaceholderUpgrade:   "?",
+				PlaceholderComment:   "?",
+				PlaceholderCreatedAt: "?",
+				PlaceholderError:     "?",
+			},
+		},
 		{
 			Name: "MySQL",
 			Func: NewMySQLAdapter,
 			Expected: TableAdapter{
-				CreateTableOptions: " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
-				PlaceholderVersion: "?",
-				PlaceholderUpgrade: "?",
-				PlaceholderComment: "?",
+				Dialect:              DialectMySQL,
+				CreateTableOptions:   " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+				PlaceholderVersion:   "?",
+				PlaceholderUpgrade:   "?",
+				PlaceholderComment:   "?",
+				PlaceholderCreatedAt: "?",
+				PlaceholderError:     "?",
 			},
 		},
 		{
 			Name: "PostgreSQL",
 			Func: NewPostgreSQLAdapter,
 			Expected: TableAdapter{
-				PlaceholderVersion: "$1",
-				PlaceholderUpgrade: "$2",
-				PlaceholderComment: "$3",
+				Dialect:              DialectPostgreSQL,
+				PlaceholderVersion:   "$1",
+				PlaceholderUpgrade:   "$2",
+				PlaceholderComment:   "$3",
+				PlaceholderCreatedAt: "$4",
+				PlaceholderError:     "$4",
 			},
 		},
 		{
 			Name: "SQLite",
 			Func: NewSQLiteAdapter,
 			Expected: TableAdapter{
-				PlaceholderVersion: "?",
-				PlaceholderUpgrade: "?",
-				PlaceholderComment: "?",
+				Dialect:              DialectSQLite,
+				PlaceholderVersion:   "?",
+				PlaceholderUpgrade:   "?",
+				PlaceholderComment:   "?",
+				PlaceholderCreatedAt: "?",
+				PlaceholderError:     "?",
 			},
 		},
 	}
@@ -44,6 +71,9 @@ func TestTableAdapterFuncs(t *testing.T) {
 				t.Error("adapter unexpectedly nil")
 				return
 			}
+			if a.Dialect != tt.Expected.Dialect {
+				t.Errorf("expected Dialect to be %q, got %q", tt.Expected.Dialect, a.Dialect)
+			}
 			if a.CreateTableOptions != tt.Expected.CreateTableOptions {
 				t.Errorf("expected CreateTableOptions to be %q, got %q", tt.Expected.CreateTableOptions, a.CreateTableOptions)
 			}
@@ -53,6 +83,194 @@ func TestTableAdapterFuncs(t *testing.T) {
 			if a.PlaceholderComment != tt.Expected.PlaceholderComment {
 				t.Errorf("expected PlaceholderComment to be %q, got %q", tt.Expected.PlaceholderComment, a.PlaceholderComment)
 			}
+			if a.PlaceholderCreatedAt != tt.Expected.PlaceholderCreatedAt {
+				t.Errorf("expected PlaceholderCreatedAt to be %q, got %q", tt.Expected.PlaceholderCreatedAt, a.PlaceholderCreatedAt)
+			}
+			if a.PlaceholderError != tt.Expected.PlaceholderError {
+				t.Errorf("expected PlaceholderError to be %q, got %q", tt.Expected.PlaceholderError, a.PlaceholderError)
+			}
 		})
 	}
 }
+
+func TestTableAdapterSkipPrepare(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.SkipPrepare = true
+	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		QueryLogs: []MockQueryLog{
+			{Query: "SELECT version FROM schema_versions WHERE 1 = 0"},
+		},
+	})
+
+	md.QueryErr = errors.New("relation does not exist")
+	err := Up(ctx, db, adapter, nil)
+	var missing *MissingTableError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected a *MissingTableError, got %v", err)
+	}
+	if missing.Table != "schema_versions" || missing.Err != md.QueryErr {
+		t.Errorf("unexpected error fields: %#v", missing)
+	}
+	expected := "error preparing schema versions: version table schema_versions does not exist or cannot be read: relation does not exist"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err)
+	}
+}
+
+func TestTableAdapterNow(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.Now = func() time.Time { return now }
+	if err := adapter.InsertSchemaVersion(ctx, db, 1, true, "example comment"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 {
+		t.Fatalf("expected 1 query, got %#v", md.ExecLogs)
+	}
+	l := md.ExecLogs[0]
+	if q := normalizeQuery(l.Query); q != "INSERT INTO schema_versions (version, upgrade, comment, created_at) VALUES ($1, $2, $3, $4)" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if len(l.Args) != 4 || l.Args[3].Value != now {
+		t.Errorf("expected created_at to be %v, got %#v", now, l.Args)
+	}
+}
+
+func TestTableAdapterIDColumn(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf).WithTableName("public.schema_versions")
+	adapter.IDColumn = true
+	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 2 || !strings.Contains(md.ExecLogs[0].Query, "id BIGSERIAL PRIMARY KEY,") {
+		t.Fatalf("expected table to be created with an id column, got %#v", md.ExecLogs)
+	}
+	// The mock database returns a table without an id column.
+	expected := `ALTER TABLE public.schema_versions DROP CONSTRAINT IF EXISTS "schema_versions_pkey", ADD COLUMN id BIGSERIAL PRIMARY KEY`
+	if q := md.ExecLogs[1].Query; q != expected {
+		t.Errorf("expected id column to be added with %q, got %q", expected, q)
+	}
+	if _, err := adapter.QuerySchemaVersion(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := md.QueryLogs[len(md.QueryLogs)-1].Query; q != "SELECT version FROM public.schema_versions ORDER BY id DESC LIMIT 1" {
+		t.Errorf("expected version to be ordered by id, got %q", q)
+	}
+
+	md.Reset()
+	adapter = NewSQLiteAdapter(t.Logf)
+	adapter.IDColumn = true
+	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 || !strings.Contains(md.ExecLogs[0].Query, "id INTEGER PRIMARY KEY AUTOINCREMENT,") {
+		t.Errorf("expected only the table to be created, got %#v", md.ExecLogs)
+	}
+	if _, err := adapter.QuerySchemaVersion(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := md.QueryLogs[len(md.QueryLogs)-1].Query; q != "SELECT version FROM schema_versions ORDER BY rowid DESC LIMIT 1" {
+		t.Errorf("expected version to be ordered by rowid, got %q", q)
+	}
+}
+
+func TestTableAdapterTeamColumn(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.TeamColumn = true
+	adapter.Now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+	migrations := []Migration{{Comment: "example comment", UpQueries: []string{"example query"}, Team: "payments"}}
+	if err := Up(WithoutQueryComments(ctx), db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || !strings.Contains(md.ExecLogs[0].Query, "team VARCHAR(255) NOT NULL DEFAULT ''") {
+		t.Fatalf("expected table to be created with a team column, got %#v", md.ExecLogs)
+	}
+	l := md.ExecLogs[2]
+	if q := normalizeQuery(l.Query); q != "INSERT INTO schema_versions (version, upgrade, comment, created_at, team) VALUES ($1, $2, $3, $4, $5)" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if len(l.Args) != 5 || l.Args[4].Value != "payments" {
+		t.Errorf("expected team to be payments, got %#v", l.Args)
+	}
+}
+
+func TestTableAdapterMetadataColumn(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewMySQLAdapter(t.Logf)
+	adapter.MetadataColumn = true
+	m := &Migrator{
+		DB:         db,
+		Adapter:    adapter,
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		Metadata:   map[string]string{"deploy": "42", "sha": "abc123"},
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || !strings.Contains(md.ExecLogs[0].Query, "metadata TEXT") {
+		t.Fatalf("expected table to be created with a metadata column, got %#v", md.ExecLogs)
+	}
+	l := md.ExecLogs[2]
+	if q := normalizeQuery(l.Query); q != "INSERT INTO schema_versions (version, upgrade, comment, metadata) VALUES (?, ?, ?, ?)" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if len(l.Args) != 4 || l.Args[3].Value != `{"deploy":"42","sha":"abc123"}` {
+		t.Errorf("expected metadata to be JSON, got %#v", l.Args)
+	}
+
+	if err := adapter.InsertSchemaVersion(ctx, db, 2, true, "example comment"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if l := md.ExecLogs[3]; len(l.Args) != 4 || l.Args[3].Value != "{}" {
+		t.Errorf("expected empty metadata outside a run, got %#v", l.Args)
+	}
+}
+
+func TestTableAdapterDirectionColumn(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewMySQLAdapter(t.Logf)
+	adapter.DirectionColumn = true
+	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := adapter.InsertSchemaVersion(ctx, db, 2, false, "example comment"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := adapter.InsertSchemaVersionDirection(ctx, db, 1, DirectionBaseline, "example comment"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 {
+		t.Fatalf("expected 3 queries, got %#v", md.ExecLogs)
+	}
+	if !strings.Contains(md.ExecLogs[0].Query, "direction VARCHAR(16) NOT NULL,") {
+		t.Errorf("expected table to have a direction column, got %q", md.ExecLogs[0].Query)
+	}
+	for i, direction := range []Direction{DirectionReverted, DirectionBaseline} {
+		l := md.ExecLogs[i+1]
+		if q := normalizeQuery(l.Query); q != "INSERT INTO schema_versions (version, direction, comment) VALUES (?, ?, ?)" {
+			t.Errorf("unexpected query %q", q)
+		}
+		if len(l.Args) != 3 || l.Args[1].Value != string(direction) {
+			t.Errorf("expected direction to be %q, got %#v", direction, l.Args)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+var (
+	// ErrLockHeld is wrapped in a *LockError when LockTimeout is negative
+	// and the lock is held by another connection.
+	ErrLockHeld = errors.New("lock is held by another connection")
+
+	// ErrLockTimeout is wrapped in a *LockError when the lock is still held
+	// by another connection after waiting for LockTimeout.
+	ErrLockTimeout = errors.New("timed out waiting for lock")
+)
+
+// LockError is returned when the Migrator can't acquire its advisory lock,
+// such as when the context is cancelled while waiting for another process to
+// release it. Err is ErrLockHeld or ErrLockTimeout if the lock was held by
+// another connection for too long.
+type LockError struct {
+	// Name is the name of the lock.
+	Name string
+
+	// Err is the error returned while acquiring the lock.
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("error acquiring lock %s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the error returned while acquiring the lock.
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// advisoryLock holds the queries used for an advisory lock. Each query takes
+// arg as its only argument.
+type advisoryLock struct {
+	name string
+	arg  interface{}
+
+	// lock waits until the lock is acquired, and unlock releases it.
+	lock, unlock string
+
+	// tryLock returns 1 if the lock was acquired, or 0 if it's held by
+	// another connection.
+	tryLock string
+
+	// staleHolder returns the ID of the connection holding the lock, if it
+	// has been idle for at least the number of seconds passed as a second
+	// argument. kill is a format string for terminating a connection.
+	staleHolder, kill string
+}
+
+// newAdvisoryLock returns the lock queries for the dialect. PostgreSQL locks
+// are identified by an integer, so the name is hashed.
+func newAdvisoryLock(dialect Dialect, name string) (*advisoryLock, error) {
+	switch dialect {
+	case DialectPostgreSQL:
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		return &advisoryLock{
+			name:    name,
+			arg:     int64(h.Sum64()),
+			lock:    "SELECT pg_advisory_lock($1)",
+			unlock:  "SELECT pg_advisory_unlock($1)",
+			tryLock: "SELECT pg_try_advisory_lock($1)::int",
+			staleHolder: "SELECT l.pid FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid " +
+				"WHERE l.locktype = 'advisory' AND l.granted AND ((l.classid::bigint << 32) | l.objid::bigint) = $1 " +
+				"AND a.state = 'idle' AND a.state_change < now() - $2 * interval '1 second'",
+			kill: "SELECT pg_terminate_backend(%d)",
+		}, nil
+	case DialectMySQL:
+		return &advisoryLock{
+			name:    name,
+			arg:     name,
+			lock:    "SELECT GET_LOCK(?, -1)",
+			unlock:  "SELECT RELEASE_LOCK(?)",
+			tryLock: "SELECT GET_LOCK(?, 0)",
+			staleHolder: "SELECT ID FROM information_schema.PROCESSLIST " +
+				"WHERE ID = IS_USED_LOCK(?) AND COMMAND = 'Sleep' AND TIME >= ?",
+			kill: "KILL %d",
+		}, nil
+	default:
+		return nil, fmt.Errorf("advisory locks are not supported for dialect %q", dialect)
+	}
+}
+
+// acquireLock acquires the lock on db, waiting for it as configured by the
+// LockTimeout, LockPollInterval and LockStaleAfter options.
+func (m *Migrator) acquireLock(ctx context.Context, db *sql.DB, l *advisoryLock) error {
+	m.Adapter.Log("Acquiring lock %s", l.name)
+	if m.LockTimeout == 0 && m.LockStaleAfter <= 0 {
+		if _, err := db.ExecContext(ctx, l.lock, l.arg); err != nil {
+			return &LockError{Name: l.name, Err: err}
+		}
+		return nil
+	}
+	interval := m.LockPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	var deadline time.Time
+	if m.LockTimeout > 0 {
+		deadline = time.Now().Add(m.LockTimeout)
+	}
+	stolen := false
+	for {
+		var acquired sql.NullInt64
+		if err := db.QueryRowContext(ctx, l.tryLock, l.arg).Scan(&acquired); err != nil {
+			return &LockError{Name: l.name, Err: err}
+		}
+		if acquired.Int64 == 1 {
+			return nil
+		}
+		// A lock is only stolen once, so that a holder that can't be
+		// terminated doesn't cause a busy loop. After stealing it, the lock
+		// is tried again after waiting for the holder to go away.
+		justStolen := false
+		if m.LockStaleAfter > 0 && !stolen {
+			var err error
+			if stolen, err = m.stealLock(ctx, db, l); err != nil {
+				return &LockError{Name: l.name, Err: fmt.Errorf("error stealing stale lock: %w", err)}
+			}
+			justStolen = stolen
+		}
+		if m.LockTimeout < 0 && !justStolen {
+			return &LockError{Name: l.name, Err: ErrLockHeld}
+		}
+		wait := interval
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return &LockError{Name: l.name, Err: ErrLockTimeout}
+			}
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &LockError{Name: l.name, Err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+}
+
+// stealLock terminates the connection holding the lock if it has been idle
+// for at least LockStaleAfter. It returns true if a connection was
+// terminated.
+func (m *Migrator) stealLock(ctx context.Context, db *sql.DB, l *advisoryLock) (bool, error) {
+	var holder int64
+	err := db.QueryRowContext(ctx, l.staleHolder, l.arg, int64(m.LockStaleAfter/time.Second)).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	m.Adapter.Log("Stealing stale lock %s from connection %d", l.name, holder)
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(l.kill, holder)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// VersionAllocator is a numbering scheme for the IDs at the start of
+// migration file names, like the 0001 in "0001_create_users.up.sql". It's
+// used by FSLoader to check the IDs of existing files, and by migrate-gen to
+// choose the ID of a new migration, so every repository that uses the same
+// allocator numbers its migrations the same way. Custom schemes can be
+// enforced by implementing it.
+type VersionAllocator interface {
+	// Next returns the ID for a new migration, given the IDs of the
+	// existing migrations in ascending order.
+	Next(ids []int64) (int64, error)
+
+	// Validate returns an error if the IDs of the existing migrations, in
+	// ascending order, don't follow the scheme.
+	Validate(ids []int64) error
+}
+
+// SequentialAllocator numbers migrations 1, 2, 3 and so on, with no gaps.
+// This is the scheme FSLoader uses if it doesn't have an Allocator.
+type SequentialAllocator struct{}
+
+// Next returns the ID after the last existing one.
+func (SequentialAllocator) Next(ids []int64) (int64, error) {
+	return int64(len(ids)) + 1, nil
+}
+
+// Validate returns an error if the IDs don't count up from 1.
+func (SequentialAllocator) Validate(ids []int64) error {
+	for i, id := range ids {
+		if id != int64(i)+1 {
+			return fmt.Errorf("migration %d should be numbered %d", id, i+1)
+		}
+	}
+	return nil
+}
+
+// TimestampAllocator numbers migrations with the time they were created,
+// like 20200102150405. This avoids conflicts between branches that add
+// migrations at the same time, since each one gets a different ID. The IDs
+// are only used to order the files, so the versions recorded in the database
+// are still their positions.
+type TimestampAllocator struct {
+	// Layout is the format of the timestamps, as used by time.Format. It
+	// must only produce digits. It defaults to "20060102150405".
+	Layout string
+
+	// Now returns the current time. It defaults to time.Now. The time is
+	// formatted in UTC.
+	Now func() time.Time
+}
+
+func (a TimestampAllocator) layout() string {
+	if a.Layout == "" {
+		return "20060102150405"
+	}
+	return a.Layout
+}
+
+// Next returns the current time as an ID. It returns an error if the time
+// isn't after the newest existing migration, such as when two migrations are
+// created in the same second.
+func (a TimestampAllocator) Next(ids []int64) (int64, error) {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	id, err := strconv.ParseInt(now().UTC().Format(a.layout()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("timestamp layout %q must only produce digits", a.layout())
+	}
+	if len(ids) > 0 && id <= ids[len(ids)-1] {
+		return 0, fmt.Errorf("migration %d is newer than the current time %d", ids[len(ids)-1], id)
+	}
+	return id, nil
+}
+
+// Validate returns an error if any of the IDs isn't a timestamp in the
+// layout.
+func (a TimestampAllocator) Validate(ids []int64) error {
+	for _, id := range ids {
+		if _, err := time.Parse(a.layout(), strconv.FormatInt(id, 10)); err != nil {
+			return fmt.Errorf("migration %d is not a timestamp like %s", id, a.layout())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSequentialAllocator(t *testing.T) {
+	a := SequentialAllocator{}
+	if id, err := a.Next([]int64{1, 2}); err != nil || id != 3 {
+		t.Errorf("expected next id 3, got %d, %v", id, err)
+	}
+	if err := a.Validate([]int64{1, 2, 3}); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := a.Validate([]int64{1, 3}); err == nil || err.Error() != "migration 3 should be numbered 2" {
+		t.Errorf("expected a gap error, got %v", err)
+	}
+}
+
+func TestTimestampAllocator(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*60*60))
+	a := TimestampAllocator{Now: func() time.Time { return now }}
+	if id, err := a.Next([]int64{20200101000000}); err != nil || id != 20200102080405 {
+		t.Errorf("expected next id 20200102080405, got %d, %v", id, err)
+	}
+	if _, err := a.Next([]int64{20200103000000}); err == nil || !strings.Contains(err.Error(), "is newer than the current time") {
+		t.Errorf("expected a clock error, got %v", err)
+	}
+	if err := a.Validate([]int64{20200101000000, 20200102080405}); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := a.Validate([]int64{1, 20200102080405}); err == nil || err.Error() != "migration 1 is not a timestamp like 20060102150405" {
+		t.Errorf("expected a timestamp error, got %v", err)
+	}
+	a.Layout = "2006-01-02"
+	if _, err := a.Next(nil); err == nil || !strings.Contains(err.Error(), "must only produce digits") {
+		t.Errorf("expected a layout error, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Sequence returns a migration function that runs each of the functions in
+// order, stopping at the first one that returns an error. It can be used to
+// follow a migration with assertions:
+//
+//	Up: migrate.Sequence(
+//		migrate.ExecQueries([]string{"DELETE FROM users WHERE deleted"}),
+//		migrate.AssertRowCount("users", "deleted", 0),
+//	),
+func Sequence(funcs ...MigrationFunc) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		for _, f := range funcs {
+			if err := f(ctx, db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AssertRowCount returns a migration function that fails if the number of
+// rows in table matching predicate isn't expected. The predicate is a SQL
+// expression used as the WHERE clause, or it can be empty to count every row.
+// When a migration is run by Prepare, a failed assertion rolls back the
+// transaction.
+func AssertRowCount(table, predicate string, expected int64) MigrationFunc {
+	query := "SELECT COUNT(*) FROM " + table
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+	return AssertQuery(query, func(rows *sql.Rows) error {
+		var count int64
+		if !rows.Next() {
+			return sql.ErrNoRows
+		}
+		if err := rows.Scan(&count); err != nil {
+			return err
+		}
+		if count != expected {
+			return fmt.Errorf("expected %d rows, got %d", expected, count)
+		}
+		return nil
+	})
+}
+
+// AssertQuery returns a migration function that runs a query, and fails if
+// check returns an error for its results. This can be used to validate data
+// invariants after a migration has changed the data.
+func AssertQuery(query string, check func(rows *sql.Rows) error) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		q := rewriteQuery(ctx, query)
+		logQuery(ctx, q, nil)
+		rows, err := db.QueryContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("error with assertion query: %w", err)
+		}
+		defer rows.Close()
+		if err := check(rows); err != nil {
+			return fmt.Errorf("assertion failed for %q: %w", query, err)
+		}
+		return rows.Err()
+	}
+}
@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestAssertRowCount(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 2
+	if err := AssertRowCount("users", "name IS NULL", 2)(ctx, db); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{QueryLogs: []MockQueryLog{{Query: "SELECT COUNT(*) FROM users WHERE name IS NULL"}}})
+
+	err := AssertRowCount("users", "", 0)(ctx, db)
+	expected := `assertion failed for "SELECT COUNT(*) FROM users": expected 0 rows, got 2`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	mockErr := errors.New("mock error")
+	f := Sequence(
+		ExecQueries([]string{"example query"}),
+		AssertQuery("example assertion", func(rows *sql.Rows) error { return mockErr }),
+		ExecQueries([]string{"skipped query"}),
+	)
+	if err := f(ctx, db); !errors.Is(err, mockErr) {
+		t.Errorf("expected mock error, got %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs:  []MockQueryLog{{Query: "example query"}},
+		QueryLogs: []MockQueryLog{{Query: "example assertion"}},
+	})
+}
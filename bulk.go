@@ -0,0 +1,139 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// CopyFS returns a migration function that streams a CSV file from a file
+// system into a PostgreSQL table using COPY FROM STDIN. This is much faster
+// than inserting rows one at a time for large data sets. It relies on the
+// driver supporting COPY through a prepared statement in a transaction, as
+// https://github.com/lib/pq/ does.
+//
+// If columns is nil, the first row of the file is used as the column names.
+// Otherwise the file shouldn't have a header row.
+func CopyFS(fsys fs.FS, name, table string, columns []string) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r := csv.NewReader(f)
+		r.ReuseRecord = true
+		columns := columns
+		if columns == nil {
+			if columns, err = readHeader(r); err != nil {
+				return fmt.Errorf("error reading header of %s: %w", name, err)
+			}
+		}
+
+		err = runInTx(ctx, db, func(conn txConn) error {
+			return copyRows(ctx, conn, r, table, columns)
+		})
+		if err != nil {
+			return fmt.Errorf("error copying %s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+// copyRows executes the COPY statement for each row read from r.
+func copyRows(ctx context.Context, conn txConn, r *csv.Reader, table string, columns []string) error {
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", "))
+	stmt, err := conn.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	args := make([]interface{}, len(columns))
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if len(record) != len(columns) {
+			return fmt.Errorf("expected %d columns, got %d", len(columns), len(record))
+		}
+		for i, v := range record {
+			args[i] = v
+		}
+		logQuery(ctx, query, args)
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	// An Exec with no arguments flushes the buffered rows.
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// LoadDataFS returns a migration function that streams a CSV file from a
+// file system into a MySQL table using LOAD DATA LOCAL INFILE. The file is
+// registered with the driver as a reader handler for the duration of the
+// query, so register and deregister should be the driver's functions for
+// doing this, like mysql.RegisterReaderHandler and
+// mysql.DeregisterReaderHandler from https://github.com/go-sql-driver/mysql/.
+//
+// If columns is nil, the first row of the file is used as the column names.
+// Otherwise the file shouldn't have a header row.
+func LoadDataFS(fsys fs.FS, name, table string, columns []string, register func(string, func() io.Reader), deregister func(string)) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ignore := ""
+		columns := columns
+		if columns == nil {
+			h, err := fsys.Open(name)
+			if err != nil {
+				return err
+			}
+			columns, err = readHeader(csv.NewReader(h))
+			h.Close()
+			if err != nil {
+				return fmt.Errorf("error reading header of %s: %w", name, err)
+			}
+			ignore = " IGNORE 1 LINES"
+		}
+
+		handler := "migrate/" + name
+		register(handler, func() io.Reader { return f })
+		defer deregister(handler)
+		// Backslashes aren't escapes in CSV files, so ESCAPED BY is empty,
+		// and quotes are only escaped by doubling them.
+		query := fmt.Sprintf(
+			`LOAD DATA LOCAL INFILE %s INTO TABLE %s FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n'%s (%s)`,
+			QuoteLiteral(DialectMySQL, "Reader::"+handler), table, ignore, strings.Join(columns, ", "))
+		logQuery(ctx, query, nil)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("error loading %s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+// readHeader reads the first row of a CSV file.
+func readHeader(r *csv.Reader) ([]string, error) {
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), header...), nil
+}
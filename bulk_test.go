@@ -0,0 +1,134 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCopyFS(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"data/users.csv": {Data: []byte("id,name\n1,alice\n2,\"bob, jr\"\n")}}
+	if err := CopyFS(fsys, "data/users.csv", "users", nil)(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	copySQL := "COPY users (id, name) FROM STDIN"
+	md.Check(t, MockData{
+		ExecLogs: []MockQueryLog{
+			{Query: copySQL, Args: []driver.NamedValue{{Ordinal: 1, Value: "1"}, {Ordinal: 2, Value: "alice"}}},
+			{Query: copySQL, Args: []driver.NamedValue{{Ordinal: 1, Value: "2"}, {Ordinal: 2, Value: "bob, jr"}}},
+			{Query: copySQL},
+		},
+	})
+}
+
+func TestCopyFSColumnCount(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		Name     string
+		Data     string
+		Expected string
+	}{
+		{"More", "1,alice,extra\n", "error copying data/users.csv: expected 2 columns, got 3"},
+		{"Fewer", "1\n", "error copying data/users.csv: expected 2 columns, got 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			fsys := fstest.MapFS{"data/users.csv": {Data: []byte(tt.Data)}}
+			err := CopyFS(fsys, "data/users.csv", "users", []string{"id", "name"})(ctx, db)
+			if err == nil || err.Error() != tt.Expected {
+				t.Errorf("expected error %q, got %v", tt.Expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadDataFS(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"users.csv": {Data: []byte("1,alice\n")}}
+	handlers := map[string]func() io.Reader{}
+	register := func(name string, f func() io.Reader) { handlers[name] = f }
+	var deregistered []string
+	deregister := func(name string) { deregistered = append(deregistered, name) }
+	if err := LoadDataFS(fsys, "users.csv", "users", []string{"id", "name"}, register, deregister)(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs: []MockQueryLog{
+			{Query: `LOAD DATA LOCAL INFILE 'Reader::migrate/users.csv' INTO TABLE users FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' (id, name)`},
+		},
+	})
+	if len(deregistered) != 1 || deregistered[0] != "migrate/users.csv" {
+		t.Errorf("expected handler to be deregistered, got %v", deregistered)
+	}
+	if handlers["migrate/users.csv"] == nil {
+		t.Error("expected handler to be registered")
+	}
+}
+
+func TestCopyFSPrepare(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"users.csv": {Data: []byte("1,alice\n")}}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "load users", Up: CopyFS(fsys, "users.csv", "users", []string{"id", "name"})},
+		},
+	}
+	confirm := func(ctx context.Context, db *sql.DB) error { return nil }
+	if err := m.Prepare(WithoutQueryComments(ctx), 1, confirm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.TxLogs) != 0 {
+		t.Errorf("expected no transaction to be begun inside Prepare's, got %v", md.TxLogs)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		if l.Query == "BEGIN" || l.Query == "COMMIT" || strings.HasPrefix(l.Query, "COPY") {
+			queries = append(queries, l.Query)
+		}
+	}
+	copySQL := "COPY users (id, name) FROM STDIN"
+	expected := []string{"BEGIN", copySQL, copySQL, "COMMIT"}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+}
+
+func TestLoadDataFSQuotesName(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	name := `data\o'brien.csv`
+	fsys := fstest.MapFS{name: {Data: []byte("1,alice\n")}}
+	var registered string
+	register := func(name string, f func() io.Reader) { registered = name }
+	deregister := func(name string) {}
+	if err := LoadDataFS(fsys, name, "users", []string{"id", "name"}, register, deregister)(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if registered != "migrate/"+name {
+		t.Errorf("expected the handler to be registered as is, got %q", registered)
+	}
+	expected := `LOAD DATA LOCAL INFILE 'Reader::migrate/data\\o''brien.csv' INTO TABLE users`
+	if len(md.ExecLogs) != 1 || !strings.HasPrefix(md.ExecLogs[0].Query, expected) {
+		t.Errorf("expected query to start with %q, got %#v", expected, md.ExecLogs)
+	}
+}
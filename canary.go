@@ -0,0 +1,159 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Canary rehearses a migration against a copy of the table it changes before
+// it's applied to the real table. The copy has the same structure as the
+// table, and optionally a sample of its rows, so problems like syntax errors
+// or constraint violations are found without touching the real table, and
+// the time the migration takes on the sample can be checked against a limit.
+//
+// The migration must use UpQueries. Each reference to Table in the queries is
+// replaced with CopyTable while the canary runs. References to the table in
+// quoted identifiers aren't replaced, so the queries should refer to it
+// without quotes.
+type Canary struct {
+	// Table is the name of the table the migration changes.
+	Table string
+
+	// CopyTable is the name of the copy of the table. It can include a
+	// schema, to keep the copy in a scratch schema. It defaults to Table
+	// with a _canary suffix. The copy is dropped before and after the
+	// canary runs.
+	CopyTable string
+
+	// SampleRows is the number of rows to copy from the table. If it's zero,
+	// only the structure of the table is copied.
+	SampleRows int
+
+	// MaxDuration is the longest the migration can take on the copy. If
+	// it's zero, the duration isn't checked.
+	MaxDuration time.Duration
+
+	// RejectLocks fails the canary if AnalyzeLocks finds queries in the
+	// migration that are likely to block access to the table.
+	RejectLocks bool
+}
+
+// CanaryResult describes a canary run, returned by Canary.Run.
+type CanaryResult struct {
+	// Rows is the number of rows copied from the table.
+	Rows int64
+
+	// Duration is how long the migration took on the copy.
+	Duration time.Duration
+
+	// Locks are the warnings from AnalyzeLocks for the migration's queries.
+	Locks []LockWarning
+}
+
+// copyTable returns the name of the copy of the table.
+func (c Canary) copyTable() string {
+	if c.CopyTable == "" {
+		return c.Table + "_canary"
+	}
+	return c.CopyTable
+}
+
+// createCopy returns the query used to copy the structure of the table.
+func (c Canary) createCopy(dialect Dialect) (string, error) {
+	switch dialect {
+	case DialectPostgreSQL:
+		return fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", c.copyTable(), c.Table), nil
+	case DialectMySQL:
+		return fmt.Sprintf("CREATE TABLE %s LIKE %s", c.copyTable(), c.Table), nil
+	case DialectSQLite:
+		return fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 0", c.copyTable(), c.Table), nil
+	case DialectClickHouse:
+		return fmt.Sprintf("CREATE TABLE %s AS %s", c.copyTable(), c.Table), nil
+	}
+	return "", fmt.Errorf("canary is not supported for dialect %q", dialect)
+}
+
+// rewriter returns a RewriteFunc that replaces references to the table with
+// the copy.
+func (c Canary) rewriter() RewriteFunc {
+	re := regexp.MustCompile(`(^|[^\w."])` + regexp.QuoteMeta(c.Table) + `\b`)
+	replacement := "${1}" + c.copyTable()
+	return func(ctx context.Context, query string) string {
+		return re.ReplaceAllString(query, replacement)
+	}
+}
+
+// Run copies the table, runs the migration's UpQueries against the copy, and
+// then drops the copy. It returns an error if the migration fails or exceeds
+// the limits of the canary, along with the result of the run.
+func (c Canary) Run(ctx context.Context, db *sql.DB, dialect Dialect, m Migration) (*CanaryResult, error) {
+	if m.Up != nil || m.UpQueries == nil {
+		return nil, errors.New("canary migrations must use UpQueries")
+	}
+	if c.Table == "" {
+		return nil, errors.New("canary table is required")
+	}
+	create, err := c.createCopy(dialect)
+	if err != nil {
+		return nil, err
+	}
+	result := &CanaryResult{Locks: AnalyzeLocks(dialect, m.UpQueries)}
+	if c.RejectLocks && len(result.Locks) > 0 {
+		return result, fmt.Errorf("canary for %s found a risky lock: %s", c.Table, result.Locks[0])
+	}
+
+	drop := fmt.Sprintf("DROP TABLE IF EXISTS %s", c.copyTable())
+	if _, err := db.ExecContext(ctx, drop); err != nil {
+		return result, fmt.Errorf("error dropping canary table %s: %w", c.copyTable(), err)
+	}
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return result, fmt.Errorf("error creating canary table %s: %w", c.copyTable(), err)
+	}
+	defer func() {
+		if _, err := db.ExecContext(withoutCancel(ctx), drop); err != nil {
+			LoggerFromContext(ctx)("Error dropping canary table %s: %s", c.copyTable(), err)
+		}
+	}()
+	if c.SampleRows > 0 {
+		res, err := db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s SELECT * FROM %s LIMIT %d", c.copyTable(), c.Table, c.SampleRows))
+		if err != nil {
+			return result, fmt.Errorf("error copying rows to canary table %s: %w", c.copyTable(), err)
+		}
+		if result.Rows, err = res.RowsAffected(); err != nil {
+			return result, err
+		}
+	}
+
+	start := time.Now()
+	err = ExecQueries(m.UpQueries)(WithRewriter(ctx, c.rewriter()), db)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, fmt.Errorf("canary for %s failed: %w", c.Table, err)
+	}
+	if c.MaxDuration > 0 && result.Duration > c.MaxDuration {
+		return result, fmt.Errorf("canary for %s took %s, longer than %s", c.Table, result.Duration, c.MaxDuration)
+	}
+	return result, nil
+}
+
+// Wrap returns a copy of the migration that runs the canary before applying
+// the migration, using the dialect of the adapter running it. The migration
+// is only applied to the real table if the canary succeeds.
+func (c Canary) Wrap(m Migration) Migration {
+	canary := m
+	up := m.up()
+	m.Up = func(ctx context.Context, db *sql.DB) error {
+		log := LoggerFromContext(ctx)
+		result, err := c.Run(ctx, db, dialectFromContext(ctx), canary)
+		if err != nil {
+			return err
+		}
+		log("Canary for %s ran in %s with %d rows", c.Table, result.Duration, result.Rows)
+		return up(ctx, db)
+	}
+	return m
+}
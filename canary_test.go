@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanaryRun(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.RowsAffected = []int64{0, 0, 100}
+	c := Canary{Table: "users", SampleRows: 100}
+	m := Migration{UpQueries: []string{
+		"ALTER TABLE users ADD COLUMN age INT",
+		"UPDATE users SET age = 0 WHERE user_id IN (SELECT id FROM other_users)",
+	}}
+	result, err := c.Run(WithoutQueryComments(ctx), db, DialectPostgreSQL, m)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if result.Rows != 100 {
+		t.Errorf("expected 100 rows to be copied, got %d", result.Rows)
+	}
+	md.Check(t, MockData{ExecLogs: []MockQueryLog{
+		{Query: "DROP TABLE IF EXISTS users_canary"},
+		{Query: "CREATE TABLE users_canary (LIKE users INCLUDING ALL)"},
+		{Query: "INSERT INTO users_canary SELECT * FROM users LIMIT 100"},
+		{Query: "ALTER TABLE users_canary ADD COLUMN age INT"},
+		{Query: "UPDATE users_canary SET age = 0 WHERE user_id IN (SELECT id FROM other_users)"},
+		{Query: "DROP TABLE IF EXISTS users_canary"},
+	}})
+
+	md.Reset()
+	md.ExecErr = errors.New("mock error")
+	_, err = c.Run(ctx, db, DialectMySQL, m)
+	if err == nil || err.Error() != "error dropping canary table users_canary: mock error" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	c = Canary{Table: "users", RejectLocks: true}
+	m = Migration{UpQueries: []string{"CREATE INDEX users_age ON users (age)"}}
+	if result, err := c.Run(ctx, db, DialectPostgreSQL, m); err == nil || len(result.Locks) != 1 {
+		t.Errorf("expected the lock to be rejected, got %v", err)
+	}
+	if _, err := c.Run(ctx, db, DialectPostgreSQL, Migration{Up: ExecQueries(nil)}); err == nil {
+		t.Error("expected an error for a migration without UpQueries")
+	}
+	if _, err := c.Run(ctx, db, DialectUnknown, Migration{UpQueries: []string{}}); err == nil {
+		t.Error("expected an error for an unknown dialect")
+	}
+}
+
+func TestCanaryWrap(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	c := Canary{Table: "users", CopyTable: "scratch.users", MaxDuration: time.Hour}
+	migrations := []Migration{c.Wrap(Migration{Comment: "add age", UpQueries: []string{"ALTER TABLE users ADD COLUMN age INT"}})}
+	if err := Up(WithoutQueryComments(ctx), db, NewSQLiteAdapter(t.Logf), migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs[1 : len(md.ExecLogs)-1] {
+		queries = append(queries, l.Query)
+	}
+	expected := []string{
+		"DROP TABLE IF EXISTS scratch.users",
+		"CREATE TABLE scratch.users AS SELECT * FROM users WHERE 0",
+		"ALTER TABLE scratch.users ADD COLUMN age INT",
+		"DROP TABLE IF EXISTS scratch.users",
+		"ALTER TABLE users ADD COLUMN age INT",
+	}
+	if strings.Join(queries, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+
+	// The real table isn't changed if the canary fails.
+	md.Reset()
+	c = Canary{Table: "users", RejectLocks: true}
+	migrations = []Migration{c.Wrap(Migration{UpQueries: []string{"CREATE INDEX users_age ON users (age)"}})}
+	if err := Up(WithoutQueryComments(ctx), db, NewPostgreSQLAdapter(t.Logf), migrations); err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, l := range md.ExecLogs {
+		if strings.HasPrefix(l.Query, "CREATE INDEX") {
+			t.Errorf("expected the index not to be created, got %q", l.Query)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// connectionIDQueries return the server's id for the connection they're run
+// on, for the dialects whose statements can be cancelled from another
+// connection.
+var connectionIDQueries = map[Dialect]string{
+	DialectPostgreSQL: "SELECT pg_backend_pid()",
+	DialectMySQL:      "SELECT CONNECTION_ID()",
+}
+
+// cancelQueries cancel the statement running on the connection with the id
+// passed as their only argument.
+var cancelQueries = map[Dialect]string{
+	DialectPostgreSQL: "SELECT pg_cancel_backend($1)",
+	DialectMySQL:      "KILL QUERY %d",
+}
+
+// activeRun is a run of the Migrator that can be cancelled.
+type activeRun struct {
+	cancel context.CancelFunc
+
+	// connID is the server's id for the connection the run is pinned to,
+	// or zero if it isn't pinned or the id isn't known.
+	connID int64
+}
+
+// activeRuns is the set of runs in progress for a Migrator.
+type activeRuns struct {
+	mu   sync.Mutex
+	runs map[*activeRun]bool
+}
+
+// activeRunsMu guards the creation of the activeRuns for each Migrator.
+var activeRunsMu sync.Mutex
+
+// runs returns the runs in progress for the migrator, creating them if
+// needed.
+func (m *Migrator) runs() *activeRuns {
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	if m.active == nil {
+		m.active = &activeRuns{runs: map[*activeRun]bool{}}
+	}
+	return m.active
+}
+
+// startRun returns a context for a run that's cancelled by Cancel, and a
+// function that must be called when the run is finished.
+func (m *Migrator) startRun(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &activeRun{cancel: cancel}
+	a := m.runs()
+	a.mu.Lock()
+	a.runs[r] = true
+	a.mu.Unlock()
+	return context.WithValue(ctx, runKey, r), func() {
+		a.mu.Lock()
+		delete(a.runs, r)
+		a.mu.Unlock()
+		cancel()
+	}
+}
+
+// trackConnection records the server's id for the connection that db is
+// pinned to, so Cancel can cancel its statements. Errors are logged, since
+// the run can continue without it.
+func (m *Migrator) trackConnection(ctx context.Context, db *sql.DB) {
+	r, ok := ctx.Value(runKey).(*activeRun)
+	query, supported := connectionIDQueries[dialectOf(m.Adapter)]
+	if !ok || !supported {
+		return
+	}
+	var id int64
+	if err := db.QueryRowContext(ctx, query).Scan(&id); err != nil {
+		m.Adapter.Log("Error querying connection id, statements can't be cancelled: %s", err)
+		return
+	}
+	a := m.runs()
+	a.mu.Lock()
+	r.connID = id
+	a.mu.Unlock()
+}
+
+// Cancel stops the runs of Up, UpToVersion, UpPhase, UpFromSnapshot,
+// DownToVersion and Prepare that are in progress, by cancelling their
+// contexts. If a run is pinned to a single connection, because LockName, Role
+// or SingleConnection is set, the statement running on that connection is
+// also cancelled, using pg_cancel_backend for PostgreSQL or KILL QUERY for
+// MySQL on another connection from DB. Drivers don't always do this when a
+// context is cancelled, and the MySQL driver closes the connection, leaving
+// the statement running on the server. Statements run by migrations on other
+// connections are only stopped by their contexts.
+//
+// It returns the first error cancelling a statement, after trying to cancel
+// all of them. The runs return errors once they've stopped.
+func (m *Migrator) Cancel(ctx context.Context) error {
+	a := m.runs()
+	a.mu.Lock()
+	runs := make([]activeRun, 0, len(a.runs))
+	for r := range a.runs {
+		runs = append(runs, *r)
+	}
+	a.mu.Unlock()
+	dialect := dialectOf(m.Adapter)
+	var firstErr error
+	for _, r := range runs {
+		if r.connID != 0 {
+			m.Adapter.Log("Cancelling statement on connection %d", r.connID)
+			var err error
+			if dialect == DialectMySQL {
+				_, err = m.runDB().ExecContext(ctx, fmt.Sprintf(cancelQueries[dialect], r.connID))
+			} else {
+				_, err = m.runDB().ExecContext(ctx, cancelQueries[dialect], r.connID)
+			}
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("error cancelling statement on connection %d: %w", r.connID, err)
+			}
+		}
+		r.cancel()
+	}
+	return firstErr
+}
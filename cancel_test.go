@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestMigratorCancel(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		Name    string
+		Adapter *TableAdapter
+		Query   string
+		Args    int
+	}{
+		{"PostgreSQL", NewPostgreSQLAdapter(t.Logf), "SELECT pg_cancel_backend($1)", 1},
+		{"MySQL", NewMySQLAdapter(t.Logf), "KILL QUERY 42", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			md.Reset()
+			md.QueryResults = []MockQueryResult{
+				{Pattern: "pg_backend_pid|CONNECTION_ID", Rows: MockRows{Version: 42}},
+			}
+			m := &Migrator{DB: db, Adapter: tt.Adapter, LockName: "migrate"}
+			m.Migrations = []Migration{{Up: func(mctx context.Context, db *sql.DB) error {
+				if err := m.Cancel(ctx); err != nil {
+					t.Errorf("unexpected err: %v", err)
+				}
+				return mctx.Err()
+			}}}
+			if err := m.Up(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected the run to be cancelled, got %v", err)
+			}
+			var cancelled bool
+			for _, l := range md.ExecLogs {
+				if l.Query == tt.Query && len(l.Args) == tt.Args {
+					cancelled = true
+					if tt.Args > 0 && l.Args[0].Value != int64(42) {
+						t.Errorf("expected connection 42 to be cancelled, got %#v", l.Args)
+					}
+				}
+			}
+			if !cancelled {
+				t.Errorf("expected the statement to be cancelled with %q, got %#v", tt.Query, md.ExecLogs)
+			}
+		})
+	}
+
+	// Runs that aren't pinned to a connection are only cancelled by their
+	// contexts, and there's nothing to cancel once they've finished.
+	md.Reset()
+	m := &Migrator{DB: db, Adapter: NewPostgreSQLAdapter(t.Logf)}
+	m.Migrations = []Migration{{Up: func(mctx context.Context, db *sql.DB) error {
+		m.Cancel(ctx)
+		return mctx.Err()
+	}}}
+	if err := m.Up(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the run to be cancelled, got %v", err)
+	}
+	if err := m.Cancel(ctx); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	for _, l := range md.ExecLogs {
+		if l.Query == "SELECT pg_cancel_backend($1)" {
+			t.Errorf("expected no statements to be cancelled")
+		}
+	}
+}
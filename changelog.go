@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// changelogSQLLength is the maximum length of each query in a changelog.
+const changelogSQLLength = 120
+
+// ChangelogEntry documents a single migration in a changelog.
+type ChangelogEntry struct {
+	// Version is the version of the migration.
+	Version int `json:"version"`
+
+	// Comment is the comment for the migration.
+	Comment string `json:"comment"`
+
+	// Description is the description of the migration, if it has one.
+	Description string `json:"description,omitempty"`
+
+	// Phase is the phase the migration is applied in.
+	Phase Phase `json:"phase"`
+
+	// SQL summarizes the queries used to apply the migration, with comments
+	// and extra whitespace removed, and long queries truncated. It's empty
+	// if the migration is applied with an Up function.
+	SQL []string `json:"sql,omitempty"`
+
+	// Code is true if the migration is applied by an Up function or
+	// Checkpoints, so its SQL isn't known.
+	Code bool `json:"code"`
+
+	// Reversible is true if the migration has a Down function or queries.
+	Reversible bool `json:"reversible"`
+}
+
+// Changelog returns a ChangelogEntry for each of the migrations.
+func Changelog(migrations []Migration) []ChangelogEntry {
+	entries := make([]ChangelogEntry, len(migrations))
+	for i, m := range migrations {
+		e := ChangelogEntry{
+			Version:     i + 1,
+			Comment:     m.Comment,
+			Description: m.Description,
+			Phase:       m.Phase,
+			Code:        m.Up != nil || m.UpQueries == nil,
+			Reversible:  m.Down != nil || m.DownQueries != nil,
+		}
+		if e.Phase == "" {
+			e.Phase = PhasePreDeploy
+		}
+		if !e.Code {
+			for _, q := range m.UpQueries {
+				q = normalizeQuery(q)
+				if len(q) > changelogSQLLength {
+					q = q[:changelogSQLLength-3] + "..."
+				}
+				e.SQL = append(e.SQL, q)
+			}
+		}
+		entries[i] = e
+	}
+	return entries
+}
+
+// ExportChangelog documents the migrations for release notes or compliance
+// records, using the same migrations the application runs. The format is
+// either "json", for a JSON array of ChangelogEntry objects, or "markdown".
+func ExportChangelog(migrations []Migration, format string) ([]byte, error) {
+	entries := Changelog(migrations)
+	switch format {
+	case "json":
+		return json.MarshalIndent(entries, "", "  ")
+	case "markdown":
+		var b bytes.Buffer
+		b.WriteString("# Migrations\n")
+		for _, e := range entries {
+			fmt.Fprintf(&b, "\n## Version %d: %s\n\n", e.Version, e.Comment)
+			if e.Description != "" {
+				b.WriteString(e.Description + "\n\n")
+			}
+			fmt.Fprintf(&b, "- Phase: %s\n", e.Phase)
+			fmt.Fprintf(&b, "- Reversible: %s\n", yesNo(e.Reversible))
+			if e.Code {
+				b.WriteString("- Applied by code\n")
+			}
+			if len(e.SQL) > 0 {
+				b.WriteString("\n```sql\n")
+				for _, q := range e.SQL {
+					b.WriteString(q + ";\n")
+				}
+				b.WriteString("```\n")
+			}
+		}
+		return b.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown changelog format %q", format)
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
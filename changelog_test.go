@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+var changelogMigrations = []Migration{
+	{
+		Comment:     "Create users",
+		Description: "Stores accounts.\nReverting drops every account.",
+		UpQueries:   []string{"CREATE TABLE users (\n\tid INT PRIMARY KEY -- the ID\n)"},
+		DownQueries: []string{"DROP TABLE users"},
+	},
+	{
+		Comment: "Backfill names",
+		Up:      func(ctx context.Context, db *sql.DB) error { return nil },
+		Phase:   PhasePostDeploy,
+	},
+}
+
+func TestExportChangelogJSON(t *testing.T) {
+	b, err := ExportChangelog(changelogMigrations, "json")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := `[
+  {
+    "version": 1,
+    "comment": "Create users",
+    "description": "Stores accounts.\nReverting drops every account.",
+    "phase": "pre-deploy",
+    "sql": [
+      "CREATE TABLE users ( id INT PRIMARY KEY )"
+    ],
+    "code": false,
+    "reversible": true
+  },
+  {
+    "version": 2,
+    "comment": "Backfill names",
+    "phase": "post-deploy",
+    "code": true,
+    "reversible": false
+  }
+]`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+}
+
+func TestExportChangelogMarkdown(t *testing.T) {
+	b, err := ExportChangelog(changelogMigrations, "markdown")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := "# Migrations\n" +
+		"\n## Version 1: Create users\n\nStores accounts.\nReverting drops every account.\n\n- Phase: pre-deploy\n- Reversible: yes\n" +
+		"\n```sql\nCREATE TABLE users ( id INT PRIMARY KEY );\n```\n" +
+		"\n## Version 2: Backfill names\n\n- Phase: post-deploy\n- Reversible: no\n- Applied by code\n"
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+	if _, err := ExportChangelog(changelogMigrations, "html"); err == nil || !strings.Contains(err.Error(), "unknown changelog format") {
+		t.Errorf("expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// checkSampleRows is the maximum number of violating rows kept in each
+// CheckResult.
+const checkSampleRows = 10
+
+// Check is a read-only query that validates an invariant of the data, such as
+// one that a large migration is expected to preserve. Unlike assertions in a
+// migration, checks are run separately with RunChecks, don't change the
+// version of the database, and report every violation rather than stopping at
+// the first one.
+type Check struct {
+	// Name identifies the check in the report.
+	Name string
+
+	// Query should select the rows that violate the invariant, like
+	// "SELECT id FROM orders WHERE total < 0", so the check passes if it
+	// returns no rows. It must not change the database.
+	Query string
+}
+
+// CheckResult is the result of running a Check.
+type CheckResult struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+
+	// Violations is the number of rows returned by the query.
+	Violations int `json:"violations"`
+
+	// Sample contains up to the first 10 rows returned by the query.
+	Sample [][]interface{} `json:"sample,omitempty"`
+
+	// Error is the error running the query, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Passed returns true if the check ran and found no violations.
+func (r CheckResult) Passed() bool {
+	return r.Violations == 0 && r.Error == ""
+}
+
+// CheckReport is returned by RunChecks.
+type CheckReport struct {
+	Results []CheckResult `json:"results"`
+}
+
+// Err returns an error listing the checks that failed, or nil if they all
+// passed.
+func (r CheckReport) Err() error {
+	var failed []string
+	for _, result := range r.Results {
+		switch {
+		case result.Error != "":
+			failed = append(failed, fmt.Sprintf("%s (%s)", result.Name, result.Error))
+		case result.Violations > 0:
+			failed = append(failed, fmt.Sprintf("%s (%d violations)", result.Name, result.Violations))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("checks failed: %s", strings.Join(failed, ", "))
+}
+
+// RunChecks runs each of the checks against the database and reports their
+// results. All the checks are run, even if some of them fail. This can be
+// used after Up to verify a large change before declaring a deploy healthy.
+func RunChecks(ctx context.Context, db *sql.DB, checks []Check) CheckReport {
+	var report CheckReport
+	for _, c := range checks {
+		result := CheckResult{Name: c.Name}
+		if err := runCheck(ctx, db, c, &result); err != nil {
+			result.Error = err.Error()
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// runCheck runs the query for a check, and counts the violations.
+func runCheck(ctx context.Context, db *sql.DB, c Check, result *CheckResult) error {
+	logQuery(ctx, c.Query, nil)
+	rows, err := db.QueryContext(ctx, c.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		result.Violations++
+		if len(result.Sample) >= checkSampleRows {
+			continue
+		}
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Sample = append(result.Sample, values)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestRunChecks(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows = MockRows{Cols: []string{"id", "total"}, Values: [][]driver.Value{{int64(1), []byte("-5")}}}
+	report := RunChecks(ctx, db, []Check{
+		{Name: "negative totals", Query: "SELECT id, total FROM orders WHERE total < 0"},
+		{Name: "orphaned items", Query: "SELECT id FROM items WHERE order_id NOT IN (SELECT id FROM orders)"},
+	})
+	if len(report.Results) != 2 {
+		t.Fatalf("expected 2 results, got %#v", report.Results)
+	}
+	first, second := report.Results[0], report.Results[1]
+	if first.Passed() || first.Violations != 1 || len(first.Sample) != 1 || first.Sample[0][1] != "-5" {
+		t.Errorf("unexpected result %#v", first)
+	}
+	if !second.Passed() {
+		t.Errorf("expected the second check to pass, got %#v", second)
+	}
+	expected := "checks failed: negative totals (1 violations)"
+	if err := report.Err(); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	md.Reset()
+	md.QueryErr = errors.New("mock error")
+	report = RunChecks(ctx, db, []Check{{Name: "broken", Query: "example query"}})
+	expected = "checks failed: broken (mock error)"
+	if err := report.Err(); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
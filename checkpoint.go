@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CheckpointFunc is the type of function used for the steps of a migration
+// with Checkpoints. Each step is run in its own transaction, which is
+// committed after the step returns.
+type CheckpointFunc func(ctx context.Context, tx *sql.Tx) error
+
+// CheckpointRecorder is an optional interface for adapters that can record
+// the progress of migrations with Checkpoints. If the adapter doesn't
+// implement it, every step is run each time the migration is applied.
+type CheckpointRecorder interface {
+	// QueryCheckpoint returns the number of steps of the migration that
+	// have been committed.
+	QueryCheckpoint(ctx context.Context, db *sql.DB, version int) (int, error)
+
+	// RecordCheckpoint records that the first step steps of the migration
+	// have been committed. It's called in the transaction for the step, so
+	// the step and its checkpoint are committed together.
+	RecordCheckpoint(ctx context.Context, tx *sql.Tx, version, step int) error
+
+	// ClearCheckpoints removes the checkpoint for the migration. It's called
+	// after the migration is reverted, so it starts from the first step if
+	// it's applied again.
+	ClearCheckpoints(ctx context.Context, db *sql.DB, version int) error
+}
+
+// runCheckpoints returns a migration function that runs the steps of a
+// migration, skipping the ones that the adapter has recorded as committed.
+func runCheckpoints(adapter Adapter, version int, steps []CheckpointFunc) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		recorder, _ := adapter.(CheckpointRecorder)
+		done := 0
+		if recorder != nil {
+			var err error
+			if done, err = recorder.QueryCheckpoint(ctx, db, version); err != nil {
+				return fmt.Errorf("error querying checkpoint: %w", err)
+			}
+			if done > 0 {
+				adapter.Log("Resuming migration to version %d after step %d", version, done)
+			}
+		}
+		for i := done; i < len(steps); i++ {
+			if err := runCheckpoint(ctx, db, recorder, version, i, steps[i]); err != nil {
+				return fmt.Errorf("error with step %d: %w", i+1, err)
+			}
+		}
+		return nil
+	}
+}
+
+// runCheckpoint runs the step at index i in a transaction, and records it.
+func runCheckpoint(ctx context.Context, db *sql.DB, recorder CheckpointRecorder, version, i int, step CheckpointFunc) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := step(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if recorder != nil {
+		if err := recorder.RecordCheckpoint(ctx, tx, version, i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error recording checkpoint: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// QueryCheckpoint returns the number of committed steps recorded in the
+// checkpoints table, creating the table if needed. It returns zero if
+// CheckpointsTableName isn't set.
+func (t *TableAdapter) QueryCheckpoint(ctx context.Context, db *sql.DB, version int) (int, error) {
+	if t.CheckpointsTableName == "" {
+		return 0, nil
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version INT NOT NULL PRIMARY KEY,
+			step INT NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)%s
+	`, t.CheckpointsTableName, t.CreateTableOptions))
+	if err != nil {
+		return 0, err
+	}
+	var step int
+	row := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT step FROM %s WHERE version = %s`,
+		t.CheckpointsTableName, t.PlaceholderVersion), version)
+	if err := row.Scan(&step); err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return step, nil
+}
+
+// RecordCheckpoint replaces the row for the migration in the checkpoints
+// table, if CheckpointsTableName is set.
+func (t *TableAdapter) RecordCheckpoint(ctx context.Context, tx *sql.Tx, version, step int) error {
+	if t.CheckpointsTableName == "" {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = %s`,
+		t.CheckpointsTableName, t.PlaceholderVersion), version); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (version, step) VALUES (%s, %s)`,
+		t.CheckpointsTableName, t.PlaceholderVersion, t.PlaceholderUpgrade), version, step)
+	return err
+}
+
+// ClearCheckpoints deletes the row for the migration from the checkpoints
+// table, if CheckpointsTableName is set.
+func (t *TableAdapter) ClearCheckpoints(ctx context.Context, db *sql.DB, version int) error {
+	if t.CheckpointsTableName == "" {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = %s`,
+		t.CheckpointsTableName, t.PlaceholderVersion), version)
+	return err
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func checkpointSteps(ran *[]int) []CheckpointFunc {
+	var steps []CheckpointFunc
+	for i := 1; i <= 3; i++ {
+		i := i
+		steps = append(steps, func(ctx context.Context, tx *sql.Tx) error {
+			*ran = append(*ran, i)
+			_, err := tx.ExecContext(ctx, "example step")
+			return err
+		})
+	}
+	return steps
+}
+
+func TestCheckpoints(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var ran []int
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.CheckpointsTableName = "schema_checkpoints"
+	migrations := []Migration{{Comment: "backfill", Checkpoints: checkpointSteps(&ran)}}
+
+	// The first query returns the schema version, and the second returns
+	// the checkpoint, so the first two steps are skipped.
+	md.QueryRows = MockRows{Cols: []string{"version"}, Values: [][]driver.Value{{int64(0)}, {int64(2)}}}
+	if err := Up(WithoutQueryComments(ctx), db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(ran) != 1 || ran[0] != 3 {
+		t.Errorf("expected only step 3 to run, got %v", ran)
+	}
+	if !reflect.DeepEqual(md.TxLogs, []string{"BEGIN", "COMMIT"}) {
+		t.Errorf("expected step 3 to be committed, got %v", md.TxLogs)
+	}
+	if q := md.QueryLogs[1].Query; q != "SELECT step FROM schema_checkpoints WHERE version = $1" {
+		t.Errorf("unexpected checkpoint query %q", q)
+	}
+	checkLogs(t, "md.ExecLogs", md.ExecLogs[2:5], []MockQueryLog{
+		{Query: "example step"},
+		{Query: "DELETE FROM schema_checkpoints WHERE version = $1", Args: []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}},
+		{
+			Query: "INSERT INTO schema_checkpoints (version, step) VALUES ($1, $2)",
+			Args:  []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: int64(3)}},
+		},
+	})
+
+	md.Reset()
+	md.QueryRows.Version = 1
+	migrations[0].Down = ExecQueries([]string{"example down"})
+	if err := DownToVersion(WithoutQueryComments(ctx), db, adapter, 0, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := md.ExecLogs[len(md.ExecLogs)-1].Query; q != "DELETE FROM schema_checkpoints WHERE version = $1" {
+		t.Errorf("expected the checkpoint to be cleared, got %q", q)
+	}
+}
+
+func TestCheckpointsError(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var ran []int
+	steps := checkpointSteps(&ran)
+	steps[1] = func(ctx context.Context, tx *sql.Tx) error {
+		return errors.New("mock error")
+	}
+	adapter := NewSQLiteAdapter(t.Logf)
+	err := Up(ctx, db, adapter, []Migration{{Checkpoints: steps}})
+	expected := "error upgrading database to version 1: error with step 2: mock error"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("expected only step 1 to run, got %v", ran)
+	}
+	if expected := []string{"BEGIN", "COMMIT", "BEGIN", "ROLLBACK"}; !reflect.DeepEqual(md.TxLogs, expected) {
+		t.Errorf("expected step 2 to be rolled back, got %v", md.TxLogs)
+	}
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "INSERT INTO schema_versions") {
+			t.Errorf("expected the version not to be recorded")
+		}
+	}
+}
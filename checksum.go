@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChecksumBackfill describes a version whose rows in the version table are
+// about to be given a checksum by BackfillChecksums.
+type ChecksumBackfill struct {
+	// Version is the version of the migration.
+	Version int
+
+	// Comment is the comment of the migration.
+	Comment string
+
+	// Checksum is the checksum computed from the current migration.
+	Checksum string
+}
+
+// BackfillChecksums fills in the checksum column for rows in the version
+// table that were inserted before the adapter's ChecksumColumn was set, so
+// existing deployments can start verifying their history. The checksums are
+// computed from the migrations as they are now, so they're only correct if
+// the migrations haven't changed since they were applied. The column is
+// added to the version table if it doesn't exist yet. ClickHouse isn't
+// supported.
+//
+// Before any rows are updated, each version that needs a checksum is checked
+// against the migrations: an error is returned if a version doesn't have a
+// migration, or was recorded with a different comment. Then confirm is
+// called with the checksums that are about to be written, and nothing is
+// written if it returns an error, so the checksums can be reviewed first.
+// It returns the number of rows that were updated.
+func BackfillChecksums(ctx context.Context, db *sql.DB, adapter *TableAdapter, migrations []Migration, confirm func(ctx context.Context, backfills []ChecksumBackfill) error) (int64, error) {
+	if !adapter.ChecksumColumn {
+		return 0, errors.New("adapter must use ChecksumColumn to backfill checksums")
+	}
+	if adapter.Dialect == DialectClickHouse {
+		return 0, fmt.Errorf("backfilling checksums is not supported for dialect %q", adapter.Dialect)
+	}
+	if err := adapter.addChecksumColumn(ctx, db); err != nil {
+		return 0, fmt.Errorf("error adding checksum column: %w", err)
+	}
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing versions: %w", err)
+	}
+	var backfills []ChecksumBackfill
+	seen := map[int]bool{}
+	for _, r := range records {
+		if r.Checksum != "" || seen[r.Version] {
+			continue
+		}
+		seen[r.Version] = true
+		if r.Version < 1 || r.Version > len(migrations) {
+			return 0, fmt.Errorf("version %d doesn't have a migration to compute its checksum from", r.Version)
+		}
+		m := migrations[r.Version-1]
+		if r.Comment != m.Comment {
+			return 0, fmt.Errorf("version %d was recorded with comment %q, but the migration's comment is %q", r.Version, r.Comment, m.Comment)
+		}
+		backfills = append(backfills, ChecksumBackfill{Version: r.Version, Comment: m.Comment, Checksum: m.Checksum()})
+	}
+	if len(backfills) == 0 {
+		return 0, nil
+	}
+	if confirm != nil {
+		if err := confirm(ctx, backfills); err != nil {
+			return 0, err
+		}
+	}
+	query := fmt.Sprintf(`UPDATE %s SET checksum = %s WHERE version = %s AND checksum = ''`,
+		adapter.table(), adapter.Dialect.placeholder(1), adapter.Dialect.placeholder(2))
+	var updated int64
+	for _, b := range backfills {
+		result, err := db.ExecContext(ctx, query, b.Checksum, b.Version)
+		if err != nil {
+			return updated, fmt.Errorf("error backfilling checksum for version %d: %w", b.Version, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+	adapter.Log("Backfilled checksums for %d versions", len(backfills))
+	return updated, nil
+}
+
+// addChecksumColumn adds the checksum column to an existing version table
+// that doesn't have one.
+func (t *TableAdapter) addChecksumColumn(ctx context.Context, db *sql.DB) error {
+	columns, err := t.columns(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if strings.EqualFold(c, "checksum") {
+			return nil
+		}
+	}
+	t.Log("Adding checksum column to %s", t.table())
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN checksum VARCHAR(64) NOT NULL DEFAULT ''`, t.table()))
+	return err
+}
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableAdapterChecksumColumn(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.ChecksumColumn = true
+	migrations := []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}}
+	if err := Up(WithoutQueryComments(ctx), db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || !strings.Contains(md.ExecLogs[0].Query, "checksum VARCHAR(64) NOT NULL DEFAULT ''") {
+		t.Fatalf("expected table to be created with a checksum column, got %#v", md.ExecLogs)
+	}
+	l := md.ExecLogs[2]
+	if q := normalizeQuery(l.Query); q != "INSERT INTO schema_versions (version, upgrade, comment, checksum) VALUES ($1, $2, $3, $4)" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if len(l.Args) != 4 || l.Args[3].Value != migrations[0].Checksum() {
+		t.Errorf("expected the migration's checksum, got %#v", l.Args)
+	}
+}
+
+func TestBackfillChecksums(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	migrations := []Migration{
+		{Comment: "create users", UpQueries: []string{"CREATE TABLE users (id INT)"}},
+		{Comment: "add name", UpQueries: []string{"ALTER TABLE users ADD name TEXT"}},
+		{Comment: "add email", UpQueries: []string{"ALTER TABLE users ADD email TEXT"}},
+	}
+	md.QueryResults = []MockQueryResult{
+		{Pattern: `SELECT \* FROM`, Rows: MockRows{Cols: []string{"version", "created_at", "upgrade", "comment"}}},
+		{Pattern: "SELECT 0, version", Rows: MockRows{
+			Cols: []string{"0", "version", "created_at", "upgrade", "comment", "checksum"},
+			Values: [][]driver.Value{
+				{int64(0), int64(1), t1, int64(1), "create users", ""},
+				{int64(0), int64(2), t1, int64(1), "add name", ""},
+				{int64(0), int64(2), t1, int64(0), "add name", ""},
+				{int64(0), int64(3), t1, int64(1), "add email", migrations[2].Checksum()},
+			},
+		}},
+	}
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.ChecksumColumn = true
+
+	var confirmed []ChecksumBackfill
+	_, err := BackfillChecksums(ctx, db, adapter, migrations, func(ctx context.Context, backfills []ChecksumBackfill) error {
+		confirmed = backfills
+		return errors.New("rejected")
+	})
+	if err == nil || err.Error() != "rejected" {
+		t.Fatalf("expected confirm error, got %v", err)
+	}
+	expected := []ChecksumBackfill{
+		{Version: 1, Comment: "create users", Checksum: migrations[0].Checksum()},
+		{Version: 2, Comment: "add name", Checksum: migrations[1].Checksum()},
+	}
+	if !reflect.DeepEqual(confirmed, expected) {
+		t.Errorf("expected backfills %#v, got %#v", expected, confirmed)
+	}
+	if len(md.ExecLogs) != 1 || !strings.Contains(md.ExecLogs[0].Query, "ADD COLUMN checksum") {
+		t.Fatalf("expected only the checksum column to be added, got %#v", md.ExecLogs)
+	}
+
+	md.ExecLogs = nil
+	md.RowsAffected = []int64{0, 2, 1}
+	updated, err := BackfillChecksums(ctx, db, adapter, migrations, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if updated != 3 || len(md.ExecLogs) != 3 {
+		t.Fatalf("expected 3 rows to be updated, got %d with %#v", updated, md.ExecLogs)
+	}
+	l := md.ExecLogs[2]
+	if q := normalizeQuery(l.Query); q != "UPDATE schema_versions SET checksum = $1 WHERE version = $2 AND checksum = ''" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if len(l.Args) != 2 || l.Args[0].Value != migrations[1].Checksum() || l.Args[1].Value != int64(2) {
+		t.Errorf("unexpected args %#v", l.Args)
+	}
+
+	migrations[1].Comment = "add names"
+	if _, err := BackfillChecksums(ctx, db, adapter, migrations, nil); err == nil || !strings.Contains(err.Error(), "version 2 was recorded with comment") {
+		t.Errorf("expected a comment mismatch error, got %v", err)
+	}
+	if _, err := BackfillChecksums(ctx, db, adapter, migrations[:1], nil); err == nil || !strings.Contains(err.Error(), "version 2 doesn't have a migration") {
+		t.Errorf("expected a missing migration error, got %v", err)
+	}
+}
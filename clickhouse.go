@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// prepareClickHouse creates the version table for ClickHouse, which needs
+// its own column types and engine.
+func (t *TableAdapter) prepareClickHouse(ctx context.Context, db *sql.DB) error {
+	onCluster := ""
+	if t.OnCluster != "" {
+		onCluster = " ON CLUSTER " + t.OnCluster
+	}
+	direction := "upgrade UInt8"
+	if t.DirectionColumn {
+		direction = "direction String"
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s%s (
+			version Int32,
+			created_at DateTime64(6) DEFAULT now64(6),
+			%s,
+			comment String%s
+		)%s
+	`, t.table(), onCluster, direction, t.optionalColumns(), t.CreateTableOptions))
+	return err
+}
+
+var onClusterRegexp = regexp.MustCompile(`(?is)^\s*(?:CREATE|ALTER|DROP|TRUNCATE)\s+(?:OR\s+REPLACE\s+)?(?:TEMPORARY\s+)?(?:TABLE|DATABASE|VIEW|MATERIALIZED\s+VIEW|DICTIONARY)\s+(?:IF\s+(?:NOT\s+)?EXISTS\s+)?[^\s(]+`)
+
+var hasOnClusterRegexp = regexp.MustCompile(`(?i)\bON\s+CLUSTER\b`)
+
+// OnClusterRewriter returns a RewriteFunc that adds ON CLUSTER to ClickHouse
+// DDL, so that it's run on every node in a replicated cluster. It handles
+// CREATE, ALTER, DROP and TRUNCATE statements for tables, databases, views
+// and dictionaries, and leaves other queries and queries that already have
+// ON CLUSTER unchanged.
+//
+//	ctx = migrate.WithRewriter(ctx, migrate.OnClusterRewriter("events"))
+func OnClusterRewriter(cluster string) RewriteFunc {
+	return func(ctx context.Context, query string) string {
+		loc := onClusterRegexp.FindStringIndex(query)
+		if loc == nil || hasOnClusterRegexp.MatchString(query) {
+			return query
+		}
+		return query[:loc[1]] + " ON CLUSTER " + cluster + query[loc[1]:]
+	}
+}
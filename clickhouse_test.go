@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClickHouseAdapter(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewClickHouseAdapter(t.Logf)
+	adapter.OnCluster = "events"
+	adapter.CreateTableOptions = " ENGINE = ReplicatedMergeTree ORDER BY created_at"
+	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := "CREATE TABLE IF NOT EXISTS schema_versions ON CLUSTER events ( version Int32, created_at DateTime64(6) DEFAULT now64(6), upgrade UInt8, comment String ) ENGINE = ReplicatedMergeTree ORDER BY created_at"
+	if len(md.ExecLogs) != 1 || normalizeQuery(md.ExecLogs[0].Query) != expected {
+		t.Errorf("expected query %q, got %#v", expected, md.ExecLogs)
+	}
+}
+
+func TestOnClusterUnsupported(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewMySQLAdapter(t.Logf)
+	adapter.OnCluster = "events"
+	err := adapter.PrepareSchemaVersions(ctx, db)
+	if err == nil || err.Error() != `ON CLUSTER is not supported for dialect "mysql"` {
+		t.Errorf("expected unsupported error, got %v", err)
+	}
+	md.Check(t, MockData{})
+}
+
+func TestOnClusterRewriter(t *testing.T) {
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{"CREATE TABLE events (id UInt64) ENGINE = MergeTree ORDER BY id", "CREATE TABLE events ON CLUSTER c (id UInt64) ENGINE = MergeTree ORDER BY id"},
+		{"CREATE TABLE IF NOT EXISTS db.events(id UInt64)", "CREATE TABLE IF NOT EXISTS db.events ON CLUSTER c(id UInt64)"},
+		{"alter table events add column name String", "alter table events ON CLUSTER c add column name String"},
+		{"DROP TABLE IF EXISTS events", "DROP TABLE IF EXISTS events ON CLUSTER c"},
+		{"CREATE MATERIALIZED VIEW daily TO totals AS SELECT 1", "CREATE MATERIALIZED VIEW daily ON CLUSTER c TO totals AS SELECT 1"},
+		{"DROP TABLE events ON CLUSTER other", "DROP TABLE events ON CLUSTER other"},
+		{"INSERT INTO events VALUES (1)", "INSERT INTO events VALUES (1)"},
+	}
+	rewrite := OnClusterRewriter("c")
+	for _, tt := range tests {
+		if q := rewrite(context.Background(), tt.Query); q != tt.Expected {
+			t.Errorf("expected %q to be rewritten to %q, got %q", tt.Query, tt.Expected, q)
+		}
+	}
+}
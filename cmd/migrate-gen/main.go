@@ -0,0 +1,165 @@
+//go:build go1.16
+// +build go1.16
+
+// Command migrate-gen converts a directory of SQL migration files into a Go
+// file containing a []migrate.Migration literal, so the migrations are
+// compiled into the binary without parsing any files at runtime. The files
+// are named and split into statements the same way as migrate.FSLoader.
+// Template files are rendered without any data.
+//
+// It's intended to be run with go generate:
+//
+//	//go:generate go run github.com/noonat/migrate/cmd/migrate-gen -dir migrations -out migrations_gen.go
+//
+// The -scheme flag sets how the files are numbered, either "sequential" (the
+// default) or "timestamp", and the numbers are checked against it. The -new
+// flag creates empty up and down files for a new migration, numbered with
+// the scheme, instead of generating code:
+//
+//	go run github.com/noonat/migrate/cmd/migrate-gen -dir migrations -scheme timestamp -new "add users"
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/noonat/migrate"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("migrate-gen: ")
+	dir := flag.String("dir", "migrations", "directory containing the SQL migration files")
+	out := flag.String("out", "migrations_gen.go", "file to write the generated code to")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name for the generated code (default $GOPACKAGE)")
+	name := flag.String("var", "Migrations", "name of the generated variable")
+	dialect := flag.String("dialect", "", "dialect used to select dialect blocks in the files, like postgres or mysql")
+	scheme := flag.String("scheme", "sequential", "numbering scheme of the files, either sequential or timestamp")
+	newComment := flag.String("new", "", "create files for a new migration with this comment, instead of generating code")
+	flag.Parse()
+
+	allocator, err := newAllocator(*scheme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	loader := migrate.FSLoader{Dialect: migrate.Dialect(*dialect), Allocator: allocator}
+	if *newComment != "" {
+		names, err := newMigration(*dir, loader, *newComment)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+	if *pkg == "" {
+		log.Fatal("-package is required when not run by go generate")
+	}
+
+	migrations, err := loader.Load(os.DirFS(*dir), ".")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := generate(&buf, *pkg, *name, *dir, migrations); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate writes the Go source for the migrations to w.
+func generate(w io.Writer, pkg, name, dir string, migrations []migrate.Migration) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by migrate-gen from %s; DO NOT EDIT.\n\n", dir)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import \"github.com/noonat/migrate\"\n\n")
+	fmt.Fprintf(&b, "// %s are the migrations generated from the files in %s.\n", name, dir)
+	fmt.Fprintf(&b, "var %s = []migrate.Migration{\n", name)
+	for _, m := range migrations {
+		fmt.Fprintf(&b, "{\n")
+		fmt.Fprintf(&b, "Version: %d,\n", m.Version)
+		fmt.Fprintf(&b, "Comment: %s,\n", strconv.Quote(m.Comment))
+		if m.Description != "" {
+			fmt.Fprintf(&b, "Description: %s,\n", strconv.Quote(m.Description))
+		}
+		writeQueries(&b, "UpQueries", m.UpQueries)
+		writeQueries(&b, "DownQueries", m.DownQueries)
+		fmt.Fprintf(&b, "},\n")
+	}
+	fmt.Fprintf(&b, "}\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// writeQueries writes a field containing queries. A nil slice is omitted, so
+// that missing down files are still reported as missing.
+func writeQueries(b *bytes.Buffer, field string, queries []string) {
+	if queries == nil {
+		return
+	}
+	fmt.Fprintf(b, "%s: []string{", field)
+	if len(queries) > 0 {
+		b.WriteString("\n")
+	}
+	for _, q := range queries {
+		fmt.Fprintf(b, "%s,\n", strconv.Quote(q))
+	}
+	fmt.Fprintf(b, "},\n")
+}
+
+// newAllocator returns the allocator for a numbering scheme.
+func newAllocator(scheme string) (migrate.VersionAllocator, error) {
+	switch scheme {
+	case "sequential":
+		return migrate.SequentialAllocator{}, nil
+	case "timestamp":
+		return migrate.TimestampAllocator{}, nil
+	}
+	return nil, fmt.Errorf("unknown numbering scheme %q", scheme)
+}
+
+// newMigration creates empty up and down files for a new migration in dir,
+// numbered by the loader's allocator, and returns their paths.
+func newMigration(dir string, loader migrate.FSLoader, comment string) ([]string, error) {
+	if strings.Contains(comment, ".") {
+		return nil, fmt.Errorf("migration comment %q can't contain a period", comment)
+	}
+	ids, err := loader.IDs(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+	id, err := loader.Allocator.Next(ids)
+	if err != nil {
+		return nil, err
+	}
+	base := fmt.Sprintf("%04d_%s", id, strings.Replace(strings.TrimSpace(comment), " ", "_", -1))
+	var names []string
+	for _, direction := range []string{"up", "down"} {
+		name := filepath.Join(dir, base+"."+direction+".sql")
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return names, err
+		}
+		if err := f.Close(); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
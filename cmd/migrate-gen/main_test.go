@@ -0,0 +1,89 @@
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/noonat/migrate"
+)
+
+func TestGenerate(t *testing.T) {
+	migrations := []migrate.Migration{
+		{
+			Version:     1,
+			Comment:     "create users",
+			UpQueries:   []string{"CREATE TABLE users (\n\tname TEXT\n)", "CREATE INDEX users_name ON users (name)"},
+			DownQueries: []string{"DROP TABLE users"},
+		},
+		{Version: 2, Comment: "no-op", Description: "Reserved for the\nreporting schema.", UpQueries: []string{}},
+	}
+	var b bytes.Buffer
+	if err := generate(&b, "app", "Migrations", "migrations", migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := `// Code generated by migrate-gen from migrations; DO NOT EDIT.
+
+package app
+
+import "github.com/noonat/migrate"
+
+// Migrations are the migrations generated from the files in migrations.
+var Migrations = []migrate.Migration{
+	{
+		Version: 1,
+		Comment: "create users",
+		UpQueries: []string{
+			"CREATE TABLE users (\n\tname TEXT\n)",
+			"CREATE INDEX users_name ON users (name)",
+		},
+		DownQueries: []string{
+			"DROP TABLE users",
+		},
+	},
+	{
+		Version:     2,
+		Comment:     "no-op",
+		Description: "Reserved for the\nreporting schema.",
+		UpQueries:   []string{},
+	},
+}
+`
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestNewMigration(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "0001_create_users.up.sql"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader := migrate.FSLoader{Allocator: migrate.SequentialAllocator{}}
+	names, err := newMigration(dir, loader, "add names")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "0002_add_names.up.sql"), filepath.Join(dir, "0002_add_names.down.sql")}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %q, got %q", expected, names)
+	}
+	if _, err := os.Stat(expected[1]); err != nil {
+		t.Errorf("expected down file to be created: %v", err)
+	}
+
+	loader.Allocator = migrate.TimestampAllocator{}
+	if _, err := newMigration(dir, loader, "add email"); err == nil || !strings.Contains(err.Error(), "is not a timestamp") {
+		t.Errorf("expected a numbering error, got %v", err)
+	}
+	if _, err := newAllocator("random"); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
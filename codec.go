@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CommentCodec encodes the comments stored in a TableAdapter's tables, for
+// organizations that consider migration descriptions sensitive in shared
+// database environments. Comments are encoded before they're inserted into
+// the version and failures tables, along with the error text of failures, and
+// decoded when VersionStore reads the history.
+type CommentCodec interface {
+	// EncodeComment returns the value to store for the comment.
+	EncodeComment(comment string) (string, error)
+
+	// DecodeComment returns the comment for a stored value. Codecs that
+	// can't be reversed, like hashes, return the stored value.
+	DecodeComment(stored string) (string, error)
+}
+
+// HashCommentCodec is a CommentCodec that stores a SHA-256 hash of each
+// comment, prefixed with "sha256:". The comments can't be read back, but the
+// history can still be compared against the migrations, by hashing their
+// comments.
+type HashCommentCodec struct{}
+
+// EncodeComment returns the hash of the comment.
+func (HashCommentCodec) EncodeComment(comment string) (string, error) {
+	sum := sha256.Sum256([]byte(comment))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// DecodeComment returns the stored hash.
+func (HashCommentCodec) DecodeComment(stored string) (string, error) {
+	return stored, nil
+}
+
+// aesCommentPrefix marks comments encrypted by an AESCommentCodec.
+const aesCommentPrefix = "aes:"
+
+// AESCommentCodec is a CommentCodec that encrypts comments with AES-GCM. The
+// encrypted comments are base64 encoded, and prefixed with "aes:". Stored
+// values without the prefix are decoded as they are, so the codec can be
+// enabled for a table that already has plain comments.
+type AESCommentCodec struct {
+	aead cipher.AEAD
+}
+
+// NewAESCommentCodec creates an AESCommentCodec with a 16, 24 or 32 byte key,
+// for AES-128, AES-192 or AES-256.
+func NewAESCommentCodec(key []byte) (*AESCommentCodec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESCommentCodec{aead: aead}, nil
+}
+
+// EncodeComment encrypts the comment with a random nonce.
+func (c *AESCommentCodec) EncodeComment(comment string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(comment), nil)
+	return aesCommentPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecodeComment decrypts a comment encrypted by EncodeComment.
+func (c *AESCommentCodec) DecodeComment(stored string) (string, error) {
+	if !strings.HasPrefix(stored, aesCommentPrefix) {
+		return stored, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(stored[len(aesCommentPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("error decoding comment: %w", err)
+	}
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("error decoding comment: too short")
+	}
+	b, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting comment: %w", err)
+	}
+	return string(b), nil
+}
+
+// encodeComment encodes a comment with the adapter's CommentCodec, if it has
+// one.
+func (t *TableAdapter) encodeComment(comment string) (string, error) {
+	if t.CommentCodec == nil {
+		return comment, nil
+	}
+	s, err := t.CommentCodec.EncodeComment(comment)
+	if err != nil {
+		return "", fmt.Errorf("error encoding comment: %w", err)
+	}
+	return s, nil
+}
+
+// storedComment returns the comment as VersionStore reads it back after it's
+// been stored, so that it can be compared with the history. This is the
+// comment itself, unless the codec can't be reversed.
+func (t *TableAdapter) storedComment(comment string) (string, error) {
+	if t.CommentCodec == nil {
+		return comment, nil
+	}
+	s, err := t.encodeComment(comment)
+	if err != nil {
+		return "", err
+	}
+	if s, err = t.CommentCodec.DecodeComment(s); err != nil {
+		return "", fmt.Errorf("error decoding comment: %w", err)
+	}
+	return s, nil
+}
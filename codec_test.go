@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAESCommentCodec(t *testing.T) {
+	c, err := NewAESCommentCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	encoded, err := c.EncodeComment("add salary column")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "aes:") || strings.Contains(encoded, "salary") {
+		t.Errorf("expected the comment to be encrypted, got %q", encoded)
+	}
+	if decoded, err := c.DecodeComment(encoded); err != nil || decoded != "add salary column" {
+		t.Errorf("expected the comment to be decrypted, got %q, %v", decoded, err)
+	}
+	if decoded, err := c.DecodeComment("plain comment"); err != nil || decoded != "plain comment" {
+		t.Errorf("expected a plain comment to be returned as is, got %q, %v", decoded, err)
+	}
+	other, _ := NewAESCommentCodec([]byte("fedcba9876543210"))
+	if _, err := other.DecodeComment(encoded); err == nil {
+		t.Error("expected decrypting with the wrong key to fail")
+	}
+	if _, err := NewAESCommentCodec([]byte("short")); err == nil {
+		t.Error("expected an invalid key to fail")
+	}
+}
+
+func TestTableAdapterCommentCodec(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewSQLiteAdapter(t.Logf)
+	adapter.CommentCodec = HashCommentCodec{}
+	if err := adapter.InsertSchemaVersion(ctx, db, 1, true, "example comment"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	hashed, _ := HashCommentCodec{}.EncodeComment("example comment")
+	if !strings.HasPrefix(hashed, "sha256:") || len(hashed) != 71 {
+		t.Fatalf("expected a hex SHA-256 hash, got %q", hashed)
+	}
+	if args := md.ExecLogs[0].Args; len(args) != 3 || args[2].Value != hashed {
+		t.Errorf("expected the comment to be hashed, got %#v", args)
+	}
+
+	codec, _ := NewAESCommentCodec([]byte("0123456789abcdef"))
+	encrypted, _ := codec.EncodeComment("example comment")
+	adapter.CommentCodec = codec
+	md.QueryRows = MockRows{
+		Cols:   []string{"0", "version", "created_at", "upgrade", "comment"},
+		Values: [][]driver.Value{{int64(0), int64(1), time.Now(), int64(1), encrypted}},
+	}
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(records) != 1 || records[0].Comment != "example comment" {
+		t.Errorf("expected the comment to be decrypted, got %#v", records)
+	}
+}
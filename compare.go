@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// HistoryComparison is the result of comparing the version tables of two
+// databases, returned by CompareHistories.
+type HistoryComparison struct {
+	// VersionA and VersionB are the current versions of the two databases.
+	VersionA, VersionB int
+
+	// Differences are the versions whose history differs between the
+	// databases, sorted by version.
+	Differences []HistoryDifference
+}
+
+// Equal returns true if the histories of the databases match.
+func (c *HistoryComparison) Equal() bool {
+	return len(c.Differences) == 0
+}
+
+// HistoryDifference describes a version whose history differs between two
+// databases.
+type HistoryDifference struct {
+	// Version is the version of the migration.
+	Version int
+
+	// A and B are the most recent rows for the version in each database, or
+	// nil if the version was never recorded in that database.
+	A, B *VersionRecord
+
+	// Reason describes how the version differs.
+	Reason string
+}
+
+// String returns a one line description of the difference.
+func (d HistoryDifference) String() string {
+	return fmt.Sprintf("version %d: %s", d.Version, d.Reason)
+}
+
+// CompareHistories compares the version tables of two databases that use the
+// same adapter, such as staging and production, so environments that have
+// silently diverged can be found. A version differs if it's only recorded in
+// one of the databases, if it's in place in one database but was reverted in
+// the other, or if it was recorded with a different comment or checksum.
+// Checksums are only compared if the adapter uses ChecksumColumn and both
+// rows have one. Only the most recent row for each version is compared, so a
+// version that was reverted and then applied again matches one that was only
+// applied once.
+func CompareHistories(ctx context.Context, dbA, dbB *sql.DB, adapter *TableAdapter) (*HistoryComparison, error) {
+	a, err := NewVersionStore(dbA, adapter).List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing versions of database A: %w", err)
+	}
+	b, err := NewVersionStore(dbB, adapter).List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing versions of database B: %w", err)
+	}
+	return compareHistories(a, b), nil
+}
+
+// compareHistories compares two histories listed from version tables.
+func compareHistories(a, b []VersionRecord) *HistoryComparison {
+	c := &HistoryComparison{}
+	if len(a) > 0 {
+		c.VersionA = a[len(a)-1].Version
+	}
+	if len(b) > 0 {
+		c.VersionB = b[len(b)-1].Version
+	}
+	latestA, latestB := latestRecords(a), latestRecords(b)
+	versions := make([]int, 0, len(latestA)+len(latestB))
+	for v := range latestA {
+		versions = append(versions, v)
+	}
+	for v := range latestB {
+		if _, ok := latestA[v]; !ok {
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+	for _, v := range versions {
+		ra, rb := latestA[v], latestB[v]
+		var reason string
+		switch {
+		case ra == nil:
+			reason = "only recorded in B"
+		case rb == nil:
+			reason = "only recorded in A"
+		case ra.Direction.upgrade() != rb.Direction.upgrade():
+			reason = fmt.Sprintf("%s in A, but %s in B", ra.Direction, rb.Direction)
+		case ra.Comment != rb.Comment:
+			reason = fmt.Sprintf("comment is %q in A, but %q in B", ra.Comment, rb.Comment)
+		case ra.Checksum != "" && rb.Checksum != "" && ra.Checksum != rb.Checksum:
+			reason = fmt.Sprintf("checksum is %s in A, but %s in B", ra.Checksum, rb.Checksum)
+		default:
+			continue
+		}
+		c.Differences = append(c.Differences, HistoryDifference{Version: v, A: ra, B: rb, Reason: reason})
+	}
+	return c
+}
+
+// latestRecords returns the most recent row for each version in a history.
+func latestRecords(records []VersionRecord) map[int]*VersionRecord {
+	latest := make(map[int]*VersionRecord, len(records))
+	for i := range records {
+		latest[records[i].Version] = &records[i]
+	}
+	return latest
+}
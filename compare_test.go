@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareHistories(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "SELECT 0, version",
+		Rows: MockRows{
+			Cols:   []string{"0", "version", "created_at", "upgrade", "comment"},
+			Values: [][]driver.Value{{int64(0), int64(1), t1, int64(1), "create users"}},
+		},
+	}}
+	c, err := CompareHistories(ctx, db, db, NewSQLiteAdapter(t.Logf))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !c.Equal() || c.VersionA != 1 || c.VersionB != 1 {
+		t.Errorf("expected matching histories at version 1, got %+v", c)
+	}
+}
+
+func TestCompareHistoriesDifferences(t *testing.T) {
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	a := []VersionRecord{
+		{Version: 1, CreatedAt: t1, Direction: DirectionApplied, Comment: "create users"},
+		{Version: 2, CreatedAt: t1, Direction: DirectionApplied, Comment: "add name"},
+		{Version: 3, CreatedAt: t1, Direction: DirectionApplied, Comment: "add index"},
+		{Version: 3, CreatedAt: t1, Direction: DirectionReverted, Comment: "add index"},
+		{Version: 4, CreatedAt: t1, Direction: DirectionApplied, Comment: "add email"},
+		{Version: 6, CreatedAt: t1, Direction: DirectionApplied, Comment: "add team", Checksum: "aaa"},
+		{Version: 7, CreatedAt: t1, Direction: DirectionApplied, Comment: "add role", Checksum: "ccc"},
+	}
+	b := []VersionRecord{
+		{Version: 1, CreatedAt: t1, Direction: DirectionBaseline, Comment: "create users"},
+		{Version: 2, CreatedAt: t1, Direction: DirectionApplied, Comment: "add names"},
+		{Version: 3, CreatedAt: t1, Direction: DirectionApplied, Comment: "add index"},
+		{Version: 5, CreatedAt: t1, Direction: DirectionApplied, Comment: "hotfix"},
+		{Version: 6, CreatedAt: t1, Direction: DirectionApplied, Comment: "add team", Checksum: "bbb"},
+		{Version: 7, CreatedAt: t1, Direction: DirectionApplied, Comment: "add role"},
+	}
+	c := compareHistories(a, b)
+	if c.Equal() || c.VersionA != 7 || c.VersionB != 7 {
+		t.Errorf("expected differing histories at version 7, got %+v", c)
+	}
+	var actual []string
+	for _, d := range c.Differences {
+		actual = append(actual, d.String())
+	}
+	expected := []string{
+		`version 2: comment is "add name" in A, but "add names" in B`,
+		"version 3: reverted in A, but applied in B",
+		"version 4: only recorded in A",
+		"version 5: only recorded in B",
+		"version 6: checksum is aaa in A, but bbb in B",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected differences %q, got %q", expected, actual)
+	}
+	if d := c.Differences[2]; d.A == nil || d.A.Comment != "add email" || d.B != nil {
+		t.Errorf("expected version 4 to only have a row in A, got %+v", d)
+	}
+}
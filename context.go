@@ -0,0 +1,153 @@
+package migrate
+
+import (
+	"context"
+	"time"
+)
+
+// contextKey is the type used for the keys of values the package stores on
+// contexts.
+type contextKey int
+
+const (
+	rewritersKey contextKey = iota
+	migrationKey
+	noQueryCommentsKey
+	queryLogKey
+	replayRecorderKey
+	teamKey
+	runKey
+	metadataKey
+	checksumKey
+	rehearsalKey
+	transactionKey
+)
+
+// MigrationInfo describes the migration being run. It's available to
+// migration functions from the context with MigrationFromContext.
+type MigrationInfo struct {
+	// Version is the version of the migration.
+	Version int
+
+	// Comment is the comment for the migration.
+	Comment string
+
+	// Upgrade is true if the migration is being applied, or false if it's
+	// being reverted.
+	Upgrade bool
+
+	// Dialect is the dialect of the adapter running the migration.
+	Dialect Dialect
+
+	log LogFunc
+}
+
+func withMigration(ctx context.Context, adapter Adapter, version int, upgrade bool, comment string) context.Context {
+	return context.WithValue(ctx, migrationKey, MigrationInfo{
+		Version: version,
+		Comment: comment,
+		Upgrade: upgrade,
+		Dialect: dialectOf(adapter),
+		log:     adapter.Log,
+	})
+}
+
+// MigrationFromContext returns information about the migration being run.
+// The second return value is false if the context doesn't belong to a
+// migration, such as when a MigrationFunc is called directly.
+func MigrationFromContext(ctx context.Context) (MigrationInfo, bool) {
+	info, ok := ctx.Value(migrationKey).(MigrationInfo)
+	return info, ok
+}
+
+// LoggerFromContext returns a function that logs using the adapter running
+// the current migration. If the context doesn't belong to a migration, the
+// returned function does nothing.
+func LoggerFromContext(ctx context.Context) LogFunc {
+	if info, ok := MigrationFromContext(ctx); ok && info.log != nil {
+		return info.log
+	}
+	return func(format string, v ...interface{}) {}
+}
+
+// withTeam returns a context that records the team that owns the migration
+// whose version is being inserted, for adapters that store it.
+func withTeam(ctx context.Context, team string) context.Context {
+	if team == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, teamKey, team)
+}
+
+// teamFromContext returns the team added to the context with withTeam, or an
+// empty string if there isn't one.
+func teamFromContext(ctx context.Context) string {
+	team, _ := ctx.Value(teamKey).(string)
+	return team
+}
+
+// withChecksum returns a context that records the checksum of the migration
+// whose version is being inserted, for adapters that store it.
+func withChecksum(ctx context.Context, checksum string) context.Context {
+	return context.WithValue(ctx, checksumKey, checksum)
+}
+
+// checksumFromContext returns the checksum added to the context with
+// withChecksum, or an empty string if there isn't one.
+func checksumFromContext(ctx context.Context) string {
+	checksum, _ := ctx.Value(checksumKey).(string)
+	return checksum
+}
+
+// withVersionValues returns a context that records the values of the
+// migration that adapters can store with its version, like its team and
+// checksum.
+func withVersionValues(ctx context.Context, m Migration) context.Context {
+	return withChecksum(withTeam(ctx, m.Team), m.Checksum())
+}
+
+// withMetadata returns a context that records the metadata for the run
+// inserting versions, for adapters that store it.
+func withMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	if len(metadata) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey, metadata)
+}
+
+// metadataFromContext returns the metadata added to the context with
+// withMetadata, or nil if there isn't any.
+func metadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey).(map[string]string)
+	return metadata
+}
+
+// withTransaction returns a context that records that the migrations are
+// being run inside a transaction that was begun on the connection, as they
+// are by Prepare.
+func withTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionKey, true)
+}
+
+// inTransaction returns true if the context was returned by withTransaction.
+func inTransaction(ctx context.Context) bool {
+	inTx, _ := ctx.Value(transactionKey).(bool)
+	return inTx
+}
+
+// detachedContext is a context that keeps the values of its parent, but is
+// never cancelled. It's used for cleanup that must run even if the context
+// for a migration run has been cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+
+// withoutCancel returns a context with the values of ctx that is never
+// cancelled.
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMigrationFromContext(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	if _, ok := MigrationFromContext(ctx); ok {
+		t.Error("expected no migration info outside of a migration")
+	}
+	LoggerFromContext(ctx)("should not panic")
+
+	var infos []MigrationInfo
+	var logs []string
+	record := func(ctx context.Context, db *sql.DB) error {
+		info, ok := MigrationFromContext(ctx)
+		if !ok {
+			t.Error("expected migration info")
+		}
+		infos = append(infos, info)
+		LoggerFromContext(ctx)("running version %d", info.Version)
+		return nil
+	}
+	adapter := NewPostgreSQLAdapter(func(format string, v ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, v...))
+	})
+	migrations := []Migration{{Comment: "example comment", Up: record, Down: record}}
+	if err := Up(ctx, db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.QueryRows.Version = 1
+	if err := DownToVersion(ctx, db, adapter, 0, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for i := range infos {
+		infos[i].log = nil
+	}
+	expected := []MigrationInfo{
+		{Version: 1, Comment: "example comment", Upgrade: true, Dialect: DialectPostgreSQL},
+		{Version: 1, Comment: "example comment", Upgrade: false, Dialect: DialectPostgreSQL},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("expected %#v, got %#v", expected, infos)
+	}
+	if logs[2] != "running version 1" {
+		t.Errorf("expected migration to log with the adapter, got %q", logs)
+	}
+}
@@ -0,0 +1,105 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// csvBatchRows is the maximum number of rows LoadCSV inserts per query.
+const csvBatchRows = 500
+
+// LoadCSV returns a migration function that inserts the rows of a CSV file
+// from a file system into a table. This is intended for reference data that
+// is shipped with the application binary. Rows are inserted in batches with
+// multi-row INSERT statements, using the placeholders and parameter limits of
+// the adapter's dialect, and all the batches are inserted in a transaction.
+//
+// If columns is nil, the first row of the file is used as the column names.
+// Otherwise the file shouldn't have a header row. Values are inserted as
+// strings, so the database must be able to convert them to the column types.
+func LoadCSV(fsys fs.FS, path, table string, columns []string) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		f, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r := csv.NewReader(f)
+		columns := columns
+		if columns == nil {
+			if columns, err = readHeader(r); err != nil {
+				return fmt.Errorf("error reading header of %s: %w", path, err)
+			}
+		}
+
+		err = runInTx(ctx, db, func(conn txConn) error {
+			return insertCSV(ctx, conn, dialectFromContext(ctx), r, table, columns)
+		})
+		if err != nil {
+			return fmt.Errorf("error loading %s: %w", path, err)
+		}
+		return nil
+	}
+}
+
+// insertCSV inserts the rows read from r in batches.
+func insertCSV(ctx context.Context, conn txConn, dialect Dialect, r *csv.Reader, table string, columns []string) error {
+	batchRows := dialect.maxParams() / len(columns)
+	if batchRows > csvBatchRows {
+		batchRows = csvBatchRows
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(columns, ", "))
+	args := make([]interface{}, 0, batchRows*len(columns))
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		var b bytes.Buffer
+		b.WriteString(prefix)
+		for i := range args {
+			if i%len(columns) == 0 {
+				if i > 0 {
+					b.WriteString("), ")
+				}
+				b.WriteString("(")
+			} else {
+				b.WriteString(", ")
+			}
+			b.WriteString(dialect.placeholder(i + 1))
+		}
+		b.WriteString(")")
+		logQuery(ctx, b.String(), args)
+		_, err := conn.ExecContext(ctx, b.String(), args...)
+		args = args[:0]
+		return err
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if len(record) != len(columns) {
+			return fmt.Errorf("expected %d columns, got %d", len(columns), len(record))
+		}
+		for _, v := range record {
+			args = append(args, v)
+		}
+		if len(args) == batchRows*len(columns) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
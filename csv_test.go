@@ -0,0 +1,109 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadCSV(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"countries.csv": {Data: []byte("code,name\nnz,New Zealand\nus,United States\n")}}
+	ctx = withMigration(ctx, NewPostgreSQLAdapter(nil), 1, true, "")
+	if err := LoadCSV(fsys, "countries.csv", "countries", nil)(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs: []MockQueryLog{
+			{
+				Query: "INSERT INTO countries (code, name) VALUES ($1, $2), ($3, $4)",
+				Args: []driver.NamedValue{
+					{Ordinal: 1, Value: "nz"},
+					{Ordinal: 2, Value: "New Zealand"},
+					{Ordinal: 3, Value: "us"},
+					{Ordinal: 4, Value: "United States"},
+				},
+			},
+		},
+	})
+}
+
+func TestLoadCSVBatches(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var data bytes.Buffer
+	for i := 0; i < 1001; i++ {
+		fmt.Fprintf(&data, "%d\n", i)
+	}
+	fsys := fstest.MapFS{"ids.csv": {Data: data.Bytes()}}
+	ctx = withMigration(ctx, NewSQLiteAdapter(nil), 1, true, "")
+	if err := LoadCSV(fsys, "ids.csv", "ids", []string{"id"})(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(md.ExecLogs))
+	}
+	for i, n := range []int{500, 500, 1} {
+		if len(md.ExecLogs[i].Args) != n {
+			t.Errorf("expected batch %d to have %d rows, got %d", i, n, len(md.ExecLogs[i].Args))
+		}
+	}
+	if md.ExecLogs[2].Query != "INSERT INTO ids (id) VALUES (?)" {
+		t.Errorf("unexpected query %q", md.ExecLogs[2].Query)
+	}
+}
+
+func TestLoadCSVError(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"bad.csv": {Data: []byte("a,b\n1\n")}}
+	err := LoadCSV(fsys, "bad.csv", "t", nil)(ctx, db)
+	expected := "error loading bad.csv: record on line 2: wrong number of fields"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestLoadCSVPrepare(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"countries.csv": {Data: []byte("nz,New Zealand\n")}}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "load countries", Up: LoadCSV(fsys, "countries.csv", "countries", []string{"code", "name"})},
+		},
+	}
+	confirm := func(ctx context.Context, db *sql.DB) error { return nil }
+	if err := m.Prepare(WithoutQueryComments(ctx), 1, confirm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.TxLogs) != 0 {
+		t.Errorf("expected no transaction to be begun inside Prepare's, got %v", md.TxLogs)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		if l.Query == "BEGIN" || l.Query == "COMMIT" || strings.HasPrefix(l.Query, "INSERT INTO countries") {
+			queries = append(queries, l.Query)
+		}
+	}
+	expected := []string{"BEGIN", "INSERT INTO countries (code, name) VALUES (?, ?)", "COMMIT"}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+}
@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// dependentViewsQuery returns the views and materialized views that depend
+// on a table, directly or through other views, ordered so that each view
+// comes after the ones it depends on.
+const dependentViewsQuery = `
+	WITH RECURSIVE deps (oid, depth) AS (
+		SELECT r.ev_class, 1 FROM pg_depend d
+		JOIN pg_rewrite r ON r.oid = d.objid
+		WHERE d.refobjid = $1::regclass AND r.ev_class <> d.refobjid
+		UNION
+		SELECT r.ev_class, deps.depth + 1 FROM deps
+		JOIN pg_depend d ON d.refobjid = deps.oid
+		JOIN pg_rewrite r ON r.oid = d.objid
+		WHERE r.ev_class <> d.refobjid
+	)
+	SELECT c.oid::regclass::text, c.relkind::text, pg_get_viewdef(c.oid), MAX(deps.depth) FROM deps
+	JOIN pg_class c ON c.oid = deps.oid
+	GROUP BY c.oid, c.relkind
+	ORDER BY MAX(deps.depth), 1
+`
+
+// dependentTriggersQuery returns the triggers on a table.
+const dependentTriggersQuery = `
+	SELECT quote_ident(tgname), pg_get_triggerdef(oid) FROM pg_trigger
+	WHERE tgrelid = $1::regclass AND NOT tgisinternal
+	ORDER BY tgname
+`
+
+// dependentObject is a view or trigger that's dropped and recreated by
+// RecreateDependents.
+type dependentObject struct {
+	drop   string
+	create string
+}
+
+// RecreateDependents returns a migration function that drops the views,
+// materialized views and triggers that depend on a table, runs change, and
+// then creates them again from the definitions they had before. This lets a
+// migration change a table in ways that PostgreSQL rejects while other
+// objects depend on it, like changing the type of a column that a view
+// selects, without having to copy their definitions into the migration.
+//
+// The objects are created again even if change fails, so the table is left
+// the way it was. The definitions are logged before anything is dropped, so
+// they can be restored by hand if creating them fails. Grants, comments and
+// indexes on the views aren't kept, and materialized views are populated
+// again when they're created. The functions that triggers call are kept,
+// since they don't depend on the table. It's only supported for
+// DialectPostgreSQL.
+func RecreateDependents(table string, change MigrationFunc) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		if d := dialectFromContext(ctx); d != DialectPostgreSQL {
+			return fmt.Errorf("recreating dependent objects is not supported for dialect %q", d)
+		}
+		objects, err := queryDependents(ctx, db, table)
+		if err != nil {
+			return fmt.Errorf("error querying objects that depend on %s: %w", table, err)
+		}
+		log := LoggerFromContext(ctx)
+		drops := make([]string, len(objects))
+		var creates []string
+		for i, o := range objects {
+			log("Recreating object that depends on %s: %s", table, o.create)
+			// Objects are dropped in reverse, so views are dropped before the
+			// views they depend on.
+			drops[len(objects)-1-i] = o.drop
+			creates = append(creates, o.create)
+		}
+		if err := ExecQueries(drops)(ctx, db); err != nil {
+			return fmt.Errorf("error dropping objects that depend on %s: %w", table, err)
+		}
+		changeErr := change(ctx, db)
+		if err := ExecQueries(creates)(ctx, db); err != nil {
+			if changeErr != nil {
+				return fmt.Errorf("%w (and error recreating objects that depend on %s: %s)", changeErr, table, err)
+			}
+			return fmt.Errorf("error recreating objects that depend on %s: %w", table, err)
+		}
+		return changeErr
+	}
+}
+
+// queryDependents returns the views and triggers that depend on the table,
+// in the order they should be created.
+func queryDependents(ctx context.Context, db *sql.DB, table string) ([]dependentObject, error) {
+	var objects []dependentObject
+	rows, err := db.QueryContext(ctx, dependentViewsQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, kind, definition string
+		var depth int
+		if err := rows.Scan(&name, &kind, &definition, &depth); err != nil {
+			return nil, err
+		}
+		viewType := "VIEW"
+		if kind == "m" {
+			viewType = "MATERIALIZED VIEW"
+		}
+		objects = append(objects, dependentObject{
+			drop:   fmt.Sprintf("DROP %s %s", viewType, name),
+			create: fmt.Sprintf("CREATE %s %s AS %s", viewType, name, definition),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, dependentTriggersQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		objects = append(objects, dependentObject{
+			drop:   fmt.Sprintf("DROP TRIGGER %s ON %s", name, table),
+			create: definition,
+		})
+	}
+	return objects, rows.Err()
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecreateDependents(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: "FROM pg_depend", Rows: MockRows{
+			Cols: []string{"oid", "relkind", "pg_get_viewdef", "max"},
+			Values: [][]driver.Value{
+				{"active_users", "v", " SELECT id, name FROM users WHERE active;", int64(1)},
+				{"user_counts", "m", " SELECT count(*) FROM active_users;", int64(2)},
+			},
+		}},
+		{Pattern: "FROM pg_trigger", Rows: MockRows{
+			Cols: []string{"tgname", "pg_get_triggerdef"},
+			Values: [][]driver.Value{
+				{"users_audit", "CREATE TRIGGER users_audit AFTER UPDATE ON public.users FOR EACH ROW EXECUTE FUNCTION audit()"},
+			},
+		}},
+	}
+	changeErr := errors.New("change failed")
+	var failChange bool
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{
+			Comment: "change name type",
+			Up: RecreateDependents("users", func(ctx context.Context, db *sql.DB) error {
+				if err := ExecQueries([]string{"ALTER TABLE users ALTER COLUMN name TYPE TEXT"})(ctx, db); err != nil {
+					return err
+				}
+				if failChange {
+					return changeErr
+				}
+				return nil
+			}),
+		}},
+	}
+	expected := []string{
+		"DROP TRIGGER users_audit ON users",
+		"DROP MATERIALIZED VIEW user_counts",
+		"DROP VIEW active_users",
+		"ALTER TABLE users ALTER COLUMN name TYPE TEXT",
+		"CREATE VIEW active_users AS  SELECT id, name FROM users WHERE active;",
+		"CREATE MATERIALIZED VIEW user_counts AS  SELECT count(*) FROM active_users;",
+		"CREATE TRIGGER users_audit AFTER UPDATE ON public.users FOR EACH ROW EXECUTE FUNCTION audit()",
+	}
+	migrationQueries := func() []string {
+		var queries []string
+		for _, l := range md.ExecLogs {
+			if strings.HasPrefix(l.Query, "/* migrate: ") {
+				queries = append(queries, l.Query[strings.Index(l.Query, "*/ ")+3:])
+			}
+		}
+		return queries
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if actual := migrationQueries(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected queries %q, got %q", expected, actual)
+	}
+
+	results := md.QueryResults
+	md.Reset()
+	md.QueryResults = results
+	failChange = true
+	if err := m.Up(ctx); !errors.Is(err, changeErr) {
+		t.Errorf("expected error %v, got %v", changeErr, err)
+	}
+	if actual := migrationQueries(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected objects to be recreated after the change failed, got %q", actual)
+	}
+}
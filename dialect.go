@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL dialect spoken by a database. It's used by
+// helpers that need to behave differently depending on the database, such as
+// AnalyzeLocks.
+type Dialect string
+
+// These are the dialects known to the package. The constructor functions for
+// TableAdapter set the matching dialect on the adapter.
+const (
+	DialectUnknown    Dialect = ""
+	DialectClickHouse Dialect = "clickhouse"
+	DialectMySQL      Dialect = "mysql"
+	DialectPostgreSQL Dialect = "postgres"
+	DialectSQLite     Dialect = "sqlite"
+)
+
+// dialectOf returns the dialect for an adapter, or DialectUnknown if the
+// adapter doesn't specify one. Adapters that wrap another adapter can
+// implement an Unwrap method returning it, so the dialect of the wrapped
+// adapter is used.
+func dialectOf(adapter Adapter) Dialect {
+	for {
+		switch a := adapter.(type) {
+		case *TableAdapter:
+			return a.Dialect
+		case *UserVersionAdapter:
+			return DialectSQLite
+		case interface{ Unwrap() Adapter }:
+			adapter = a.Unwrap()
+		default:
+			return DialectUnknown
+		}
+	}
+}
+
+// dialectFromContext returns the dialect of the adapter running the current
+// migration, or DialectUnknown if there isn't one.
+func dialectFromContext(ctx context.Context) Dialect {
+	info, _ := MigrationFromContext(ctx)
+	return info.Dialect
+}
+
+// placeholder returns the placeholder for the nth (1-based) parameter of a
+// query.
+func (d Dialect) placeholder(n int) string {
+	if d == DialectPostgreSQL {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// maxParams returns the maximum number of parameters the dialect allows in a
+// single query.
+func (d Dialect) maxParams() int {
+	switch d {
+	case DialectPostgreSQL, DialectMySQL:
+		return 65535
+	default:
+		// Older versions of SQLite are limited to 999.
+		return 999
+	}
+}
+
+// quoteIdent quotes an identifier, like a table or role name, for the
+// dialect.
+func (d Dialect) quoteIdent(name string) string {
+	if d == DialectMySQL {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteIdent quotes an identifier, like a table, column or schema name, so it
+// can be safely included in SQL for the dialect, even if it's derived from
+// user input. MySQL identifiers are quoted with backticks, and identifiers
+// for other dialects are quoted with double quotes. Quoted identifiers are
+// case sensitive in PostgreSQL, so names that were created without quotes
+// must be passed in lower case.
+func QuoteIdent(dialect Dialect, name string) string {
+	return dialect.quoteIdent(name)
+}
+
+// QuoteQualifiedIdent quotes each part of a qualified identifier, like a
+// schema and table name, and joins them with dots.
+func QuoteQualifiedIdent(dialect Dialect, parts ...string) string {
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		quoted[i] = dialect.quoteIdent(p)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// QuoteLiteral quotes a string literal for the dialect. Values should
+// normally be passed as query arguments instead, but this can be used for
+// statements that don't accept them, like most DDL. MySQL and ClickHouse
+// treat backslashes in literals as escapes, so they're escaped as well.
+func QuoteLiteral(dialect Dialect, value string) string {
+	if dialect == DialectMySQL || dialect == DialectClickHouse {
+		value = strings.Replace(value, `\`, `\\`, -1)
+	}
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
@@ -0,0 +1,54 @@
+package migrate
+
+import "testing"
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Name     string
+		Expected string
+	}{
+		{DialectPostgreSQL, "tenant_1", `"tenant_1"`},
+		{DialectPostgreSQL, `bad"; DROP TABLE users; --`, `"bad""; DROP TABLE users; --"`},
+		{DialectMySQL, "bad`name", "`bad``name`"},
+		{DialectSQLite, "name", `"name"`},
+	}
+	for _, tt := range tests {
+		if q := QuoteIdent(tt.Dialect, tt.Name); q != tt.Expected {
+			t.Errorf("expected %s identifier %q to be quoted as %s, got %s", tt.Dialect, tt.Name, tt.Expected, q)
+		}
+	}
+	if q := QuoteQualifiedIdent(DialectMySQL, "tenant", "users"); q != "`tenant`.`users`" {
+		t.Errorf("unexpected qualified identifier %s", q)
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	if q := QuoteLiteral(DialectPostgreSQL, `it's a \ test`); q != `'it''s a \ test'` {
+		t.Errorf("unexpected PostgreSQL literal %s", q)
+	}
+	if q := QuoteLiteral(DialectMySQL, `it's a \ test`); q != `'it''s a \\ test'` {
+		t.Errorf("unexpected MySQL literal %s", q)
+	}
+}
+
+type wrappedAdapter struct {
+	Adapter
+}
+
+func (a wrappedAdapter) Unwrap() Adapter {
+	return a.Adapter
+}
+
+func TestDialectOf(t *testing.T) {
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	if d := dialectOf(adapter); d != DialectPostgreSQL {
+		t.Errorf("expected %q, got %q", DialectPostgreSQL, d)
+	}
+	if d := dialectOf(wrappedAdapter{wrappedAdapter{adapter}}); d != DialectPostgreSQL {
+		t.Errorf("expected the wrapped dialect %q, got %q", DialectPostgreSQL, d)
+	}
+	if d := dialectOf(struct{ Adapter }{adapter}); d != DialectUnknown {
+		t.Errorf("expected an unknown dialect, got %q", d)
+	}
+}
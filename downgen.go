@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GeneratedDownComment is prepended to the queries returned by GenerateDown,
+// so that generated queries are easy to recognize in logs and plans.
+const GeneratedDownComment = "/* generated by GenerateDown */ "
+
+var (
+	createTableRegexp = regexp.MustCompile(`(?i)^CREATE (?:TEMP |TEMPORARY )?TABLE (?:IF NOT EXISTS )?([^\s(]+)`)
+	createIndexRegexp = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (?:CONCURRENTLY )?(?:IF NOT EXISTS )?(\S+) ON (?:ONLY )?([^\s(]+)`)
+	createViewRegexp  = regexp.MustCompile(`(?i)^CREATE (MATERIALIZED )?VIEW (?:IF NOT EXISTS )?([^\s(]+)`)
+	addColumnRegexp   = regexp.MustCompile(`(?i)^ALTER TABLE ([^\s(]+) ADD (?:COLUMN )?(?:IF NOT EXISTS )?(\S+) `)
+
+	// addNotColumnRegexp matches ADD clauses that add something other than
+	// a column.
+	addNotColumnRegexp = regexp.MustCompile(`(?i)^(?:CONSTRAINT|INDEX|KEY|UNIQUE|PRIMARY|FOREIGN|CHECK|FULLTEXT|SPATIAL)$`)
+)
+
+// GenerateDown generates queries to revert a list of simple up queries, for
+// use as DownQueries. It understands CREATE TABLE, CREATE INDEX, CREATE VIEW
+// and ALTER TABLE ... ADD COLUMN, which are reverted by dropping what they
+// created, in the reverse order. It returns an error for any other query,
+// including ALTER TABLE queries that make more than one change. Each
+// generated query starts with GeneratedDownComment.
+//
+// This is a best-effort convenience, and the results should be reviewed like
+// any hand-written down migration.
+func GenerateDown(dialect Dialect, upQueries []string) ([]string, error) {
+	down := make([]string, 0, len(upQueries))
+	for i := len(upQueries) - 1; i >= 0; i-- {
+		q, err := generateDownQuery(dialect, upQueries[i])
+		if err != nil {
+			return nil, err
+		}
+		down = append(down, GeneratedDownComment+q)
+	}
+	return down, nil
+}
+
+// generateDownQuery returns the query that reverts a single up query.
+func generateDownQuery(dialect Dialect, query string) (string, error) {
+	nq := normalizeQuery(query)
+	if m := createTableRegexp.FindStringSubmatch(nq); m != nil {
+		return "DROP TABLE " + m[1], nil
+	}
+	if m := createIndexRegexp.FindStringSubmatch(nq); m != nil {
+		if dialect == DialectMySQL {
+			return fmt.Sprintf("DROP INDEX %s ON %s", m[1], m[2]), nil
+		}
+		return "DROP INDEX " + m[1], nil
+	}
+	if m := createViewRegexp.FindStringSubmatch(nq); m != nil {
+		return fmt.Sprintf("DROP %sVIEW %s", strings.ToUpper(m[1]), m[2]), nil
+	}
+	if m := addColumnRegexp.FindStringSubmatch(nq); m != nil && !addNotColumnRegexp.MatchString(m[2]) &&
+		!strings.Contains(strings.ToUpper(nq), ", ADD ") {
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", m[1], m[2]), nil
+	}
+	return "", fmt.Errorf("can't generate a down query for %q", query)
+}
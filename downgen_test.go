@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateDown(t *testing.T) {
+	up := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE UNIQUE INDEX CONCURRENTLY users_name ON users (name)",
+		"ALTER TABLE users ADD COLUMN email TEXT",
+		"create materialized view user_names as select name from users",
+	}
+	down, err := GenerateDown(DialectPostgreSQL, up)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []string{
+		GeneratedDownComment + "DROP MATERIALIZED VIEW user_names",
+		GeneratedDownComment + "ALTER TABLE users DROP COLUMN email",
+		GeneratedDownComment + "DROP INDEX users_name",
+		GeneratedDownComment + "DROP TABLE users",
+	}
+	if !reflect.DeepEqual(down, expected) {
+		t.Errorf("expected %q, got %q", expected, down)
+	}
+
+	down, err = GenerateDown(DialectMySQL, []string{"CREATE INDEX users_name ON users (name)"})
+	if err != nil || down[0] != GeneratedDownComment+"DROP INDEX users_name ON users" {
+		t.Errorf("unexpected down queries %q (err %v)", down, err)
+	}
+}
+
+func TestGenerateDownUnsupported(t *testing.T) {
+	for _, q := range []string{
+		"ALTER TABLE users ADD CONSTRAINT users_email UNIQUE (email)",
+		"ALTER TABLE users ADD COLUMN a INT, ADD COLUMN b INT",
+		"CREATE INDEX ON users (name)",
+		"UPDATE users SET name = ''",
+	} {
+		if _, err := GenerateDown(DialectPostgreSQL, []string{q}); err == nil {
+			t.Errorf("expected an error for %q", q)
+		}
+	}
+}
@@ -5,6 +5,11 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sync"
 	"testing"
 )
 
@@ -12,9 +17,16 @@ func init() {
 	sql.Register("migrate_test", &MockDriver{})
 }
 
-type contextKey int
+type mockContextKey int
 
-const mockDataKey contextKey = 0
+const mockDataKey mockContextKey = 0
+
+// mockMu guards the logs in MockData, for tests that run queries concurrently.
+var mockMu sync.Mutex
+
+// mockPatterns are the compiled patterns of MockQueryResults, guarded by
+// mockMu.
+var mockPatterns = map[string]*regexp.Regexp{}
 
 type MockData struct {
 	ExecErr   error
@@ -22,6 +34,23 @@ type MockData struct {
 	QueryErr  error
 	QueryLogs []MockQueryLog
 	QueryRows MockRows
+
+	// QueryResults are the rows returned for queries matching their
+	// patterns. The first matching result is used, and queries that don't
+	// match any of them return QueryRows.
+	QueryResults []MockQueryResult
+
+	// RowsAffected is returned by the results of successive Exec calls. It
+	// returns 0 once all the values have been used.
+	RowsAffected []int64
+
+	// BeginErr, CommitErr, and RollbackErr are returned by the transaction
+	// calls, which are logged to TxLogs as "BEGIN", "COMMIT", and
+	// "ROLLBACK".
+	BeginErr    error
+	CommitErr   error
+	RollbackErr error
+	TxLogs      []string
 }
 
 func MockDataFromContext(ctx context.Context) *MockData {
@@ -44,6 +73,12 @@ func (md *MockData) Reset() {
 	md.QueryErr = nil
 	md.QueryLogs = nil
 	md.QueryRows = MockRows{}
+	md.QueryResults = nil
+	md.RowsAffected = nil
+	md.BeginErr = nil
+	md.CommitErr = nil
+	md.RollbackErr = nil
+	md.TxLogs = nil
 }
 
 func checkLogs(t *testing.T, key string, logs []MockQueryLog, expected []MockQueryLog) {
@@ -93,7 +128,16 @@ type MockQueryLog struct {
 type MockConn struct{}
 
 func (c *MockConn) Begin() (driver.Tx, error) {
-	return nil, errors.New("conn.Begin() not implemented")
+	return &MockTx{}, nil
+}
+
+func (c *MockConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	md := MockDataFromContext(ctx)
+	if md.BeginErr != nil {
+		return nil, md.BeginErr
+	}
+	md.logTx("BEGIN")
+	return &MockTx{md: md}, nil
 }
 
 func (c *MockConn) Close() error {
@@ -105,12 +149,14 @@ func (c *MockConn) ExecContext(ctx context.Context, query string, args []driver.
 	if md.ExecErr != nil {
 		return nil, md.ExecErr
 	}
+	mockMu.Lock()
 	md.ExecLogs = append(md.ExecLogs, MockQueryLog{Query: query, Args: args})
-	return &MockResult{}, nil
+	mockMu.Unlock()
+	return md.result(), nil
 }
 
 func (c *MockConn) Prepare(query string) (driver.Stmt, error) {
-	return nil, errors.New("conn.Prepare() not implemented")
+	return &MockStmt{query: query}, nil
 }
 
 func (c *MockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
@@ -118,26 +164,144 @@ func (c *MockConn) QueryContext(ctx context.Context, query string, args []driver
 	if md.QueryErr != nil {
 		return nil, md.QueryErr
 	}
+	mockMu.Lock()
 	md.QueryLogs = append(md.QueryLogs, MockQueryLog{Query: query, Args: args})
+	mockMu.Unlock()
+	for _, r := range md.QueryResults {
+		re, err := mockPattern(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		if re.MatchString(query) {
+			rows := r.Rows
+			return &rows, nil
+		}
+	}
 	return &md.QueryRows, nil
 }
 
-type MockResult struct{}
+// mockPattern returns the compiled pattern, compiling it the first time it's
+// used.
+func mockPattern(pattern string) (*regexp.Regexp, error) {
+	mockMu.Lock()
+	defer mockMu.Unlock()
+	if re, ok := mockPatterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling mock query pattern: %w", err)
+	}
+	mockPatterns[pattern] = re
+	return re, nil
+}
+
+// MockQueryResult is a result set returned by MockConn for queries that match
+// Pattern, a regular expression. Each query gets a copy of Rows, so the same
+// result can be read more than once. Queries fail if the pattern can't be
+// compiled. See migratetest.OpenMock for a mock database that can be used
+// outside this package.
+type MockQueryResult struct {
+	Pattern string
+	Rows    MockRows
+}
+
+// MockTx is returned by MockConn.BeginTx. It logs its Commit and Rollback
+// calls to the TxLogs of the MockData it was started with, if any.
+type MockTx struct {
+	md *MockData
+}
+
+func (tx *MockTx) Commit() error {
+	if tx.md == nil {
+		return nil
+	}
+	tx.md.logTx("COMMIT")
+	return tx.md.CommitErr
+}
+
+func (tx *MockTx) Rollback() error {
+	if tx.md == nil {
+		return nil
+	}
+	tx.md.logTx("ROLLBACK")
+	return tx.md.RollbackErr
+}
+
+func (md *MockData) logTx(s string) {
+	mockMu.Lock()
+	md.TxLogs = append(md.TxLogs, s)
+	mockMu.Unlock()
+}
+
+// MockStmt is returned by MockConn.Prepare. Executing it logs the query and
+// arguments to ExecLogs, the same way MockConn.ExecContext does.
+type MockStmt struct {
+	query string
+}
+
+func (s *MockStmt) Close() error {
+	return nil
+}
+
+func (s *MockStmt) NumInput() int {
+	return -1
+}
+
+func (s *MockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("stmt.Exec() not implemented")
+}
+
+func (s *MockStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	md := MockDataFromContext(ctx)
+	if md.ExecErr != nil {
+		return nil, md.ExecErr
+	}
+	mockMu.Lock()
+	md.ExecLogs = append(md.ExecLogs, MockQueryLog{Query: s.query, Args: args})
+	mockMu.Unlock()
+	return md.result(), nil
+}
+
+func (s *MockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("stmt.Query() not implemented")
+}
+
+// result returns the result for an Exec call, using the next value from
+// RowsAffected.
+func (md *MockData) result() *MockResult {
+	mockMu.Lock()
+	defer mockMu.Unlock()
+	var r MockResult
+	if len(md.RowsAffected) > 0 {
+		r.rowsAffected = md.RowsAffected[0]
+		md.RowsAffected = md.RowsAffected[1:]
+	}
+	return &r
+}
+
+type MockResult struct {
+	rowsAffected int64
+}
 
 func (r *MockResult) LastInsertId() (int64, error) {
 	return 0, nil
 }
 
 func (r *MockResult) RowsAffected() (int64, error) {
-	return 0, nil
+	return r.rowsAffected, nil
 }
 
-// MockRows mocks the Rows object returned by the DB for a Query call. Note
-// this implementation assumes that we're only ever going to be called to
-// lookup the current schema version. It returns schema version 0 by default,
-// but that can be changed by changing the Version field.
+// MockRows mocks the Rows object returned by the DB for a Query call. By
+// default, it assumes that we're only ever going to be called to lookup the
+// current schema version. It returns schema version 0 by default, but that
+// can be changed by changing the Version field. If Cols is set, it returns
+// Values instead, which can have any number of rows and columns.
 type MockRows struct {
 	Version int
+	Cols    []string
+	Values  [][]driver.Value
+	next    int
 }
 
 func (r *MockRows) Close() error {
@@ -145,10 +309,121 @@ func (r *MockRows) Close() error {
 }
 
 func (r *MockRows) Columns() []string {
+	if r.Cols != nil {
+		return r.Cols
+	}
 	return []string{"version"}
 }
 
 func (r *MockRows) Next(dest []driver.Value) error {
+	if r.Cols != nil {
+		if r.next >= len(r.Values) {
+			return io.EOF
+		}
+		copy(dest, r.Values[r.next])
+		r.next++
+		return nil
+	}
 	dest[0] = int64(r.Version)
 	return nil
 }
+
+func TestMockQueryResults(t *testing.T) {
+	md, ctx := WithMockData(context.Background())
+	md.QueryRows.Version = 3
+	md.QueryResults = []MockQueryResult{
+		{Pattern: `FROM users\b`, Rows: MockRows{
+			Cols:   []string{"id", "name"},
+			Values: [][]driver.Value{{int64(1), "alice"}, {int64(2), "bob"}},
+		}},
+	}
+
+	db, err := sql.Open("migrate_test", "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	// The result can be read more than once.
+	for i := 0; i < 2; i++ {
+		rows, err := db.QueryContext(ctx, "SELECT id, name FROM users")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		var names []string
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			names = append(names, name)
+		}
+		rows.Close()
+		if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+			t.Errorf("expected alice and bob, got %v", names)
+		}
+	}
+
+	var version int
+	if err := db.QueryRowContext(ctx, "SELECT version FROM schema_versions").Scan(&version); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	} else if version != 3 {
+		t.Errorf("expected version 3, got %d", version)
+	}
+}
+
+func TestMockQueryResultsInvalidPattern(t *testing.T) {
+	md, ctx := WithMockData(context.Background())
+	md.QueryResults = []MockQueryResult{{Pattern: "("}}
+	db, err := sql.Open("migrate_test", "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.QueryContext(ctx, "SELECT 1"); err == nil {
+		t.Error("expected an error for the invalid pattern")
+	}
+}
+
+func TestMockTx(t *testing.T) {
+	md, ctx := WithMockData(context.Background())
+	db, err := sql.Open("migrate_test", "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.CommitErr = errors.New("mock commit error")
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tx.Commit(); err != md.CommitErr {
+		t.Errorf("expected commit error, got %v", err)
+	}
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []string{"BEGIN", "COMMIT", "BEGIN", "COMMIT", "BEGIN", "ROLLBACK"}
+	if !reflect.DeepEqual(md.TxLogs, expected) {
+		t.Errorf("expected %v, got %v", expected, md.TxLogs)
+	}
+
+	md.BeginErr = errors.New("mock begin error")
+	if _, err := db.BeginTx(ctx, nil); err != md.BeginErr {
+		t.Errorf("expected begin error, got %v", err)
+	}
+}
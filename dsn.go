@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// DSNFunc returns the data source name to use when opening a new connection.
+type DSNFunc func(ctx context.Context) (string, error)
+
+// OpenDSNFunc returns a database that calls dsn to get a new data source name
+// each time it opens a connection. This is useful for credentials that expire,
+// like the IAM authentication tokens used by Amazon RDS and Aurora, which are
+// only valid for 15 minutes. Connections that are already open aren't
+// affected when a token expires, so only new connections need a fresh one.
+//
+// The DSN should also enable TLS, which IAM authentication requires. For
+// example, with github.com/go-sql-driver/mysql and the AWS SDK:
+//
+//	db := migrate.OpenDSNFunc(&mysql.MySQLDriver{}, func(ctx context.Context) (string, error) {
+//		token, err := auth.BuildAuthToken(ctx, endpoint, region, user, creds)
+//		if err != nil {
+//			return "", err
+//		}
+//		return fmt.Sprintf("%s:%s@tcp(%s)/%s?tls=rds&allowCleartextPasswords=true",
+//			user, token, endpoint, name), nil
+//	})
+func OpenDSNFunc(d driver.Driver, dsn DSNFunc) *sql.DB {
+	return sql.OpenDB(dsnConnector{driver: d, dsn: dsn})
+}
+
+// dsnConnector is a driver.Connector that gets a new DSN for each connection.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    DSNFunc
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	name, err := c.dsn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,42 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOpenDSNFunc(t *testing.T) {
+	calls := 0
+	db := OpenDSNFunc(&MockDriver{}, func(ctx context.Context) (string, error) {
+		calls++
+		return "", nil
+	})
+	defer db.Close()
+
+	ctx := context.Background()
+	conn1, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn1.Close()
+	conn2, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer conn2.Close()
+	if calls != 2 {
+		t.Errorf("expected a DSN for each connection, got %d calls", calls)
+	}
+}
+
+func TestOpenDSNFuncError(t *testing.T) {
+	db := OpenDSNFunc(&MockDriver{}, func(ctx context.Context) (string, error) {
+		return "", errors.New("mock error")
+	})
+	defer db.Close()
+
+	if err := db.PingContext(context.Background()); err == nil || err.Error() != "mock error" {
+		t.Errorf("expected mock error, got %v", err)
+	}
+}
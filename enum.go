@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Enum describes a column whose values are restricted to a list, for use
+// with AddEnumValue. How the values are restricted depends on the dialect:
+// DialectPostgreSQL uses an enum type, and DialectMySQL and DialectSQLite use
+// a CHECK constraint, or an ENUM column for DialectMySQL.
+type Enum struct {
+	// Type is the name of the PostgreSQL enum type.
+	Type string
+
+	// Table and Column are the column whose values are restricted, for
+	// DialectMySQL and DialectSQLite.
+	Table  string
+	Column string
+
+	// Constraint is the name of the CHECK constraint that restricts the
+	// values. If it's empty, the column is a MySQL ENUM column.
+	Constraint string
+
+	// Values are the current values, in order. The CHECK constraint or ENUM
+	// column is replaced with one that also allows the new value, so they
+	// must all be listed.
+	Values []string
+
+	// ColumnDefinition is the rest of the definition of a MySQL ENUM column,
+	// like "NOT NULL DEFAULT 'active'", since the column is redefined.
+	ColumnDefinition string
+
+	// Rebuild returns how to rebuild the table for DialectSQLite, which
+	// can't change a CHECK constraint without rebuilding it. It's passed the
+	// CHECK expression that allows the new value, like
+	// "status IN ('active', 'deleted')", for the table's Definition.
+	Rebuild func(check string) TableRebuild
+}
+
+// AddEnumValue returns a migration function that adds a value to an Enum,
+// handling the differences between the dialects:
+//
+// For DialectPostgreSQL, the value is added to the enum type with
+// ALTER TYPE ... ADD VALUE IF NOT EXISTS. Before PostgreSQL 12 this can't be
+// run inside a transaction, and the new value can't be used until the
+// statement commits, so the migration can't be run by Prepare and shouldn't
+// use the value itself.
+//
+// For DialectMySQL, the CHECK constraint is dropped and added again with the
+// value in the same statement, or the ENUM column is redefined with the value
+// added at the end, which MySQL can do without rebuilding the table.
+//
+// For DialectSQLite, the table is rebuilt with RebuildTable, using the
+// TableRebuild returned by the Enum's Rebuild function.
+func AddEnumValue(e Enum, value string) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		values := append(e.Values[:len(e.Values):len(e.Values)], value)
+		d := dialectFromContext(ctx)
+		var query string
+		switch d {
+		case DialectPostgreSQL:
+			query = fmt.Sprintf("ALTER TYPE %s ADD VALUE IF NOT EXISTS %s", e.Type, QuoteLiteral(d, value))
+		case DialectMySQL:
+			if e.Constraint == "" {
+				query = strings.TrimSpace(fmt.Sprintf("ALTER TABLE %s MODIFY %s ENUM(%s) %s",
+					e.Table, e.Column, quoteLiterals(d, values), e.ColumnDefinition))
+			} else {
+				query = fmt.Sprintf("ALTER TABLE %s DROP CHECK %s, ADD CONSTRAINT %s CHECK (%s)",
+					e.Table, e.Constraint, e.Constraint, enumCheck(d, e.Column, values))
+			}
+		case DialectSQLite:
+			if e.Rebuild == nil {
+				return fmt.Errorf("adding a value to %s.%s requires Rebuild, since SQLite can't change a CHECK constraint without rebuilding the table", e.Table, e.Column)
+			}
+			return RebuildTable(e.Rebuild(enumCheck(d, e.Column, values)))(ctx, db)
+		default:
+			return fmt.Errorf("adding enum values is not supported for dialect %q", d)
+		}
+		return ExecQueries([]string{query})(ctx, db)
+	}
+}
+
+// enumCheck returns the CHECK expression that restricts the column to the
+// values.
+func enumCheck(dialect Dialect, column string, values []string) string {
+	return fmt.Sprintf("%s IN (%s)", column, quoteLiterals(dialect, values))
+}
+
+// quoteLiterals returns the values as a comma separated list of literals.
+func quoteLiterals(dialect Dialect, values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = QuoteLiteral(dialect, v)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddEnumValue(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	ctx = WithoutQueryComments(ctx)
+	status := Enum{
+		Type:       "user_status",
+		Table:      "users",
+		Column:     "status",
+		Constraint: "users_status_check",
+		Values:     []string{"active", "suspended"},
+	}
+	queries := func(adapter Adapter, e Enum) []string {
+		md.Reset()
+		m := &Migrator{DB: db, Adapter: adapter, Migrations: []Migration{{Comment: "add status", Up: AddEnumValue(e, "user's")}}}
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		var queries []string
+		for _, l := range md.ExecLogs {
+			if len(l.Args) == 0 && !strings.Contains(l.Query, "schema_versions") {
+				queries = append(queries, l.Query)
+			}
+		}
+		return queries
+	}
+
+	expected := []string{`ALTER TYPE user_status ADD VALUE IF NOT EXISTS 'user''s'`}
+	if actual := queries(NewPostgreSQLAdapter(t.Logf), status); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected queries %q, got %q", expected, actual)
+	}
+	expected = []string{`ALTER TABLE users DROP CHECK users_status_check, ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'user''s'))`}
+	if actual := queries(NewMySQLAdapter(t.Logf), status); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected queries %q, got %q", expected, actual)
+	}
+	if len(status.Values) != 2 {
+		t.Errorf("expected the values not to be modified, got %q", status.Values)
+	}
+
+	enum := status
+	enum.Constraint = ""
+	enum.ColumnDefinition = "NOT NULL DEFAULT 'active'"
+	expected = []string{`ALTER TABLE users MODIFY status ENUM('active', 'suspended', 'user''s') NOT NULL DEFAULT 'active'`}
+	if actual := queries(NewMySQLAdapter(t.Logf), enum); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected queries %q, got %q", expected, actual)
+	}
+
+	md.Reset()
+	m := &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf), Migrations: []Migration{{Comment: "add status", Up: AddEnumValue(status, "deleted")}}}
+	expectedErr := "adding a value to users.status requires Rebuild"
+	if err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+
+	var check string
+	status.Rebuild = func(c string) TableRebuild {
+		check = c
+		return TableRebuild{Table: "users", Definition: "(id INTEGER PRIMARY KEY, status TEXT CHECK (" + c + "))", Columns: []string{"id", "status"}}
+	}
+	m.Migrations[0].Up = AddEnumValue(status, "deleted")
+	md.Reset()
+	md.QueryResults = []MockQueryResult{
+		{Pattern: "schema_versions", Rows: MockRows{}},
+		{Pattern: `COUNT\(\*\)`, Rows: MockRows{Cols: []string{"count"}, Values: [][]driver.Value{{int64(0)}}}},
+	}
+	md.QueryRows = MockRows{Cols: []string{"max"}, Values: [][]driver.Value{{nil}}}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if expected := "status IN ('active', 'suspended', 'deleted')"; check != expected {
+		t.Errorf("expected the table to be rebuilt with check %q, got %q", expected, check)
+	}
+}
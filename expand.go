@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// These helpers generate the migrations for common expand and contract
+// schema changes, which let a column change without downtime by splitting it
+// into steps that are compatible with both the old and the new code. They
+// return slices of migrations to append to the migration list, with phases
+// set so that Up applies the expand steps before new code is deployed and
+// UpPhase applies the contract steps afterward.
+
+// AddColumnNotNull returns migrations that add a NOT NULL column to a table
+// without blocking writes from code that doesn't know about it yet. The
+// column is added as nullable before the deploy, and after the deploy it's
+// backfilled and then made NOT NULL. The definition is the column type and
+// any default, like "TEXT" or "INT DEFAULT 0", and backfill is a query that
+// sets the column for existing rows. The new code must write the column.
+// Changing a column to NOT NULL is only supported for DialectPostgreSQL and
+// DialectMySQL.
+func AddColumnNotNull(table, column, definition, backfill string) []Migration {
+	return []Migration{
+		{
+			Comment:     fmt.Sprintf("Add %s.%s as nullable", table, column),
+			UpQueries:   []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)},
+			DownQueries: []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)},
+		},
+		{
+			Comment:       fmt.Sprintf("Backfill %s.%s and make it NOT NULL", table, column),
+			Up:            Sequence(ExecQueries([]string{backfill}), setNotNull(table, column, definition, true)),
+			Down:          setNotNull(table, column, definition, false),
+			AnalyzeTables: []string{table},
+			Phase:         PhasePostDeploy,
+		},
+	}
+}
+
+// AddColumnNotNullValidated is like AddColumnNotNull, but avoids the table
+// scan that PostgreSQL does to set NOT NULL while it holds a lock that blocks
+// reads and writes. Each step is a separate migration, so it commits on its
+// own and a failed run can be resumed from the step that failed.
+//
+// Before the deploy, the column is added as nullable. The definition should
+// include a default, like "TEXT DEFAULT 'unknown'", so rows inserted by the
+// old code get a value. After the deploy, the existing rows are backfilled by
+// running backfill with ExecBatches and pacer, so it should update a limited
+// number of the rows where the column is still NULL, like:
+//
+//	UPDATE users SET email = 'unknown'
+//	WHERE id IN (SELECT id FROM users WHERE email IS NULL LIMIT 1000)
+//
+// Then a CHECK (column IS NOT NULL) constraint is added as NOT VALID, which
+// only needs a brief lock. Finally the constraint is validated, which scans
+// the table without blocking writes, the column is set NOT NULL, which
+// PostgreSQL 12 and later do without another scan because of the validated
+// constraint, and the constraint is dropped. It's only supported for
+// DialectPostgreSQL.
+func AddColumnNotNullValidated(table, column, definition, backfill string, pacer Pacer) []Migration {
+	constraint := fmt.Sprintf("%s_%s_not_null", unqualifiedName(table), column)
+	return []Migration{
+		{
+			Comment:     fmt.Sprintf("Add %s.%s as nullable", table, column),
+			UpQueries:   []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)},
+			DownQueries: []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)},
+		},
+		{
+			Comment:       fmt.Sprintf("Backfill %s.%s", table, column),
+			Up:            ExecBatches(backfill, pacer),
+			DownQueries:   []string{},
+			AnalyzeTables: []string{table},
+			Phase:         PhasePostDeploy,
+		},
+		{
+			Comment:     fmt.Sprintf("Add NOT VALID NOT NULL constraint for %s.%s", table, column),
+			UpQueries:   []string{fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s IS NOT NULL) NOT VALID", table, constraint, column)},
+			DownQueries: []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, constraint)},
+			Phase:       PhasePostDeploy,
+		},
+		{
+			Comment: fmt.Sprintf("Validate NOT NULL constraint and make %s.%s NOT NULL", table, column),
+			UpQueries: []string{
+				fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", table, constraint),
+				fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", table, column),
+				fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, constraint),
+			},
+			DownQueries: []string{
+				fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s IS NOT NULL) NOT VALID", table, constraint, column),
+				fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL", table, column),
+			},
+			Phase: PhasePostDeploy,
+		},
+	}
+}
+
+// setNotNull returns a migration function that adds or removes the NOT NULL
+// constraint for a column.
+func setNotNull(table, column, definition string, notNull bool) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		var query string
+		switch d := dialectFromContext(ctx); d {
+		case DialectPostgreSQL:
+			action := "DROP"
+			if notNull {
+				action = "SET"
+			}
+			query = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s NOT NULL", table, column, action)
+		case DialectMySQL:
+			constraint := "NULL"
+			if notNull {
+				constraint = "NOT NULL"
+			}
+			query = fmt.Sprintf("ALTER TABLE %s MODIFY %s %s %s", table, column, definition, constraint)
+		default:
+			return fmt.Errorf("changing NOT NULL is not supported for dialect %q", d)
+		}
+		return ExecQueries([]string{query})(ctx, db)
+	}
+}
+
+// RenameColumn returns migrations that rename a column without breaking code
+// that uses the old name. Before the deploy, the new column is added and the
+// existing values are copied to it. The new code must write to both columns,
+// and read from the new one. After the deploy, the values are copied again,
+// to catch rows written by the old code during the deploy. Once no running
+// code uses the old column, it can be removed with DropColumn in a later
+// release.
+func RenameColumn(table, oldColumn, newColumn, definition string) []Migration {
+	copyQuery := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s IS NULL", table, newColumn, oldColumn, newColumn)
+	return []Migration{
+		{
+			Comment: fmt.Sprintf("Add %s.%s to replace %s", table, newColumn, oldColumn),
+			UpQueries: []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, newColumn, definition),
+				copyQuery,
+			},
+			DownQueries: []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, newColumn)},
+		},
+		{
+			Comment:     fmt.Sprintf("Copy %s.%s to %s", table, oldColumn, newColumn),
+			UpQueries:   []string{copyQuery},
+			DownQueries: []string{},
+			Phase:       PhasePostDeploy,
+		},
+	}
+}
+
+// DropColumn returns a migration that drops a column after new code is
+// deployed, so the old code can keep using it until the deploy finishes. It
+// should be added in a release after the one that stopped using the column,
+// so that there's a grace period for rolling back the code. Reverting the
+// migration adds the column back with the definition, but its data is lost.
+func DropColumn(table, column, definition string) []Migration {
+	return []Migration{
+		{
+			Comment:     fmt.Sprintf("Drop %s.%s", table, column),
+			UpQueries:   []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)},
+			DownQueries: []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)},
+			Phase:       PhasePostDeploy,
+		},
+	}
+}
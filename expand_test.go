@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddColumnNotNull(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	ctx = WithoutQueryComments(ctx)
+	migrations := AddColumnNotNull("users", "email", "TEXT", "UPDATE users SET email = ''")
+	if err := UpPhase(ctx, db, NewPostgreSQLAdapter(t.Logf), PhasePostDeploy, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		if len(l.Args) == 0 {
+			queries = append(queries, l.Query)
+		}
+	}
+	expected := []string{
+		"ALTER TABLE users ADD COLUMN email TEXT",
+		"UPDATE users SET email = ''",
+		"ALTER TABLE users ALTER COLUMN email SET NOT NULL",
+	}
+	if len(queries) < 3 || !reflect.DeepEqual(queries[len(queries)-3:], expected) {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+	if migrations[1].Phase != PhasePostDeploy {
+		t.Errorf("expected the NOT NULL step to be post-deploy")
+	}
+
+	expectedErr := `error upgrading database to version 2: changing NOT NULL is not supported for dialect "sqlite"`
+	if err := UpPhase(ctx, db, NewSQLiteAdapter(t.Logf), PhasePostDeploy, migrations); err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestAddColumnNotNullValidated(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	ctx = WithoutQueryComments(ctx)
+	backfill := "UPDATE users SET email = '' WHERE id IN (SELECT id FROM users WHERE email IS NULL LIMIT 2)"
+	migrations := AddColumnNotNullValidated("app.users", "email", "TEXT DEFAULT ''", backfill, Pacer{})
+	if err := UpPhase(ctx, db, NewPostgreSQLAdapter(t.Logf), PhasePostDeploy, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		if len(l.Args) == 0 && !strings.Contains(l.Query, "schema_versions") {
+			queries = append(queries, l.Query)
+		}
+	}
+	expected := []string{
+		"ALTER TABLE app.users ADD COLUMN email TEXT DEFAULT ''",
+		backfill,
+		"ALTER TABLE app.users ADD CONSTRAINT users_email_not_null CHECK (email IS NOT NULL) NOT VALID",
+		"ALTER TABLE app.users VALIDATE CONSTRAINT users_email_not_null",
+		"ALTER TABLE app.users ALTER COLUMN email SET NOT NULL",
+		"ALTER TABLE app.users DROP CONSTRAINT users_email_not_null",
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(queries, "\n"))
+	}
+	for i, m := range migrations[1:] {
+		if m.Phase != PhasePostDeploy {
+			t.Errorf("expected step %d to be post-deploy", i+2)
+		}
+	}
+}
+
+func TestRenameColumn(t *testing.T) {
+	migrations := RenameColumn("users", "name", "full_name", "TEXT")
+	if len(migrations) != 2 || migrations[0].Phase != "" || migrations[1].Phase != PhasePostDeploy {
+		t.Fatalf("unexpected migrations %#v", migrations)
+	}
+	expected := []string{
+		"ALTER TABLE users ADD COLUMN full_name TEXT",
+		"UPDATE users SET full_name = name WHERE full_name IS NULL",
+	}
+	if !reflect.DeepEqual(migrations[0].UpQueries, expected) {
+		t.Errorf("expected queries %q, got %q", expected, migrations[0].UpQueries)
+	}
+}
+
+func TestDropColumn(t *testing.T) {
+	migrations := DropColumn("users", "name", "TEXT")
+	if len(migrations) != 1 || migrations[0].Phase != PhasePostDeploy {
+		t.Fatalf("unexpected migrations %#v", migrations)
+	}
+	if q := migrations[0].DownQueries[0]; q != "ALTER TABLE users ADD COLUMN name TEXT" {
+		t.Errorf("unexpected down query %q", q)
+	}
+}
@@ -0,0 +1,334 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// FSLoader loads migrations from SQL files in a file system, such as one
+// embedded in the application binary with go:embed.
+//
+// Each migration is a pair of files named like "0001_create_users.up.sql"
+// and "0001_create_users.down.sql". The number at the start of the name is
+// the version, and the rest of the name is used for the comment, with
+// underscores replaced by spaces. The down file is optional. Each file can
+// contain several statements separated by semicolons. Semicolons in
+// PostgreSQL dollar quoted function bodies are ignored, and MySQL DELIMITER
+// commands can be used to define triggers and procedures.
+//
+// A block of comments at the top of the up file that's followed by a blank
+// line is used as the migration's Description:
+//
+//	-- Adds the users table for the accounts service.
+//	--
+//	-- Reverting drops the table along with any accounts in it.
+//
+//	CREATE TABLE users (id INT PRIMARY KEY);
+//
+// The comments are also left in the first statement. Comments that run
+// straight into a statement, and comments in down files, aren't used as a
+// description.
+//
+// Files with a .sql.tmpl extension (like "0002_partitions.up.sql.tmpl") are
+// run through text/template with Data before they are split into statements.
+// This can be used for things like schema names or partition counts that
+// vary between deployments.
+//
+// Files can keep per-dialect variants of a statement in blocks that are only
+// included when Dialect matches one of the dialects listed in the block's
+// opening line, and dropped otherwise:
+//
+//	-- +migrate dialect:postgres
+//	CREATE INDEX CONCURRENTLY users_name ON users (name);
+//	-- +migrate end
+//	-- +migrate dialect:mysql,sqlite
+//	CREATE INDEX users_name ON users (name);
+//	-- +migrate end
+//
+// Blocks can't be nested, and are selected after templates are rendered.
+type FSLoader struct {
+	// Dialect selects the dialect blocks that are included in the
+	// migrations. It's required if any of the files contain dialect blocks.
+	// It also decides whether backslashes escape quotes in strings when
+	// splitting files into statements, which they only do for MySQL and
+	// ClickHouse.
+	Dialect Dialect
+
+	// Data is passed to templates when rendering .sql.tmpl files.
+	Data map[string]interface{}
+
+	// Funcs are added to the function map of templates when rendering
+	// .sql.tmpl files.
+	Funcs template.FuncMap
+
+	// Allocator is the numbering scheme of the files, like
+	// TimestampAllocator. If it's set, the numbers at the start of the
+	// names are IDs that must follow the scheme, and each migration's
+	// version is its position when the files are sorted by ID. If it's
+	// nil, the numbers are the versions, and must count up from 1.
+	Allocator VersionAllocator
+}
+
+var (
+	migrationFileRegexp = regexp.MustCompile(`^(\d+)_([^.]*)\.(up|down)\.sql(\.tmpl)?$`)
+	directiveRegexp     = regexp.MustCompile(`^--\s*\+migrate\s+(.*?)\s*$`)
+)
+
+// LoadFS loads migrations from the SQL files in a directory of a file system
+// using the default FSLoader. See FSLoader for details.
+func LoadFS(fsys fs.FS, dir string) ([]Migration, error) {
+	return FSLoader{}.Load(fsys, dir)
+}
+
+// Load loads migrations from the SQL files in a directory of a file system.
+// Files without a .sql or .sql.tmpl extension are ignored. The returned
+// migrations are ordered by version, and an error is returned if there are
+// any missing or duplicate versions.
+func (l FSLoader) Load(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := readMigrationFiles(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := l.versions(files)
+	if err != nil {
+		return nil, err
+	}
+	set := Set{Name: dir}
+	indexes := map[int]int{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		key := fmt.Sprintf("%d.%s", f.id, f.direction)
+		if seen[key] {
+			return nil, fmt.Errorf("migration version %d has more than one %s file", f.id, f.direction)
+		}
+		seen[key] = true
+		queries, description, err := l.loadFile(fsys, path.Join(dir, f.name), f.template)
+		if err != nil {
+			return nil, err
+		}
+		version := versions[f.id]
+		i, ok := indexes[version]
+		if !ok {
+			i = len(set.Migrations)
+			indexes[version] = i
+			set.Add(Migration{Version: version, Comment: f.comment})
+		}
+		if f.direction == "up" {
+			set.Migrations[i].UpQueries = queries
+			set.Migrations[i].Description = description
+		} else {
+			set.Migrations[i].DownQueries = queries
+		}
+	}
+	for _, id := range migrationIDs(files) {
+		if !seen[fmt.Sprintf("%d.up", id)] {
+			return nil, fmt.Errorf("migration version %d is missing an up file", id)
+		}
+	}
+	return set.Sorted()
+}
+
+// IDs returns the IDs at the start of the names of the migration files in a
+// directory of a file system, in ascending order. Without an Allocator, the
+// IDs are the versions of the migrations. With one, the IDs are checked with
+// the Allocator's Validate method.
+func (l FSLoader) IDs(fsys fs.FS, dir string) ([]int64, error) {
+	files, err := readMigrationFiles(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.versions(files); err != nil {
+		return nil, err
+	}
+	return migrationIDs(files), nil
+}
+
+// versions returns the version of the migration with each ID. Without an
+// Allocator, the IDs are the versions. With one, the IDs are validated, and
+// the version of each migration is its position.
+func (l FSLoader) versions(files []migrationFile) (map[int64]int, error) {
+	ids := migrationIDs(files)
+	versions := make(map[int64]int, len(ids))
+	if l.Allocator == nil {
+		for _, id := range ids {
+			if int64(int(id)) != id {
+				return nil, fmt.Errorf("migration version %d is too large", id)
+			}
+			versions[id] = int(id)
+		}
+		return versions, nil
+	}
+	if err := l.Allocator.Validate(ids); err != nil {
+		return nil, fmt.Errorf("invalid migration numbering: %w", err)
+	}
+	for i, id := range ids {
+		versions[id] = i + 1
+	}
+	return versions, nil
+}
+
+// migrationFile is a SQL file containing one direction of a migration.
+type migrationFile struct {
+	name      string
+	id        int64
+	comment   string
+	direction string
+	template  bool
+}
+
+// readMigrationFiles returns the migration files in a directory of a file
+// system.
+func readMigrationFiles(fsys fs.FS, dir string) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations directory: %w", err)
+	}
+	var files []migrationFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql.tmpl")) {
+			continue
+		}
+		match := migrationFileRegexp.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s must be named like 0001_comment.up.sql", name)
+		}
+		id, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("migration file %s has an invalid version", name)
+		}
+		files = append(files, migrationFile{
+			name:      name,
+			id:        id,
+			comment:   strings.Replace(match[2], "_", " ", -1),
+			direction: match[3],
+			template:  match[4] != "",
+		})
+	}
+	return files, nil
+}
+
+// migrationIDs returns the unique IDs of the files, in ascending order.
+func migrationIDs(files []migrationFile) []int64 {
+	seen := map[int64]bool{}
+	var ids []int64
+	for _, f := range files {
+		if !seen[f.id] {
+			seen[f.id] = true
+			ids = append(ids, f.id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// loadFile reads a SQL file, renders it as a template if needed, and splits
+// it into statements. It also returns the description from the comment at
+// the top of the file.
+func (l FSLoader) loadFile(fsys fs.FS, name string, isTemplate bool) ([]string, string, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading migration file %s: %w", name, err)
+	}
+	if isTemplate {
+		t, err := template.New(path.Base(name)).Funcs(l.Funcs).Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			return nil, "", fmt.Errorf("error parsing migration template %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, l.Data); err != nil {
+			return nil, "", fmt.Errorf("error rendering migration template %s: %w", name, err)
+		}
+		b = buf.Bytes()
+	}
+	src, err := selectDialect(string(b), l.Dialect)
+	if err != nil {
+		return nil, "", fmt.Errorf("error in migration file %s: %w", name, err)
+	}
+	description := fileDescription(src)
+	queries := splitStatements(src, l.Dialect)
+	if queries == nil {
+		// An empty file is a valid no-op migration, which is different from a
+		// missing one.
+		queries = []string{}
+	}
+	return queries, description, nil
+}
+
+// fileDescription returns the text of the block of comments at the top of a
+// SQL file, if it's followed by a blank line or the end of the file. The
+// comment markers are removed, and directives are ignored.
+func fileDescription(src string) string {
+	var lines []string
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+		if !strings.HasPrefix(line, "--") {
+			return ""
+		}
+		if directiveRegexp.MatchString(line) {
+			return ""
+		}
+		line = strings.TrimPrefix(line, "--")
+		lines = append(lines, strings.TrimPrefix(line, " "))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// selectDialect removes the dialect blocks that don't match the dialect from
+// the source of a SQL file, along with the lines that open and close blocks.
+func selectDialect(src string, dialect Dialect) (string, error) {
+	if !strings.Contains(src, "+migrate") {
+		return src, nil
+	}
+	lines := strings.Split(src, "\n")
+	open, include := 0, true
+	for i, line := range lines {
+		match := directiveRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			if !include {
+				lines[i] = ""
+			}
+			continue
+		}
+		lines[i] = ""
+		switch {
+		case strings.HasPrefix(match[1], "dialect:"):
+			if open > 0 {
+				return "", fmt.Errorf("line %d: dialect blocks can't be nested", i+1)
+			}
+			if dialect == DialectUnknown {
+				return "", fmt.Errorf("line %d: dialect blocks require the loader's Dialect to be set", i+1)
+			}
+			open, include = i+1, false
+			for _, d := range strings.Split(strings.TrimPrefix(match[1], "dialect:"), ",") {
+				if Dialect(strings.TrimSpace(d)) == dialect {
+					include = true
+				}
+			}
+		case match[1] == "end":
+			if open == 0 {
+				return "", fmt.Errorf("line %d: end without a dialect block", i+1)
+			}
+			open, include = 0, true
+		default:
+			return "", fmt.Errorf("line %d: unknown directive %q", i+1, match[1])
+		}
+	}
+	if open > 0 {
+		return "", fmt.Errorf("line %d: dialect block is never closed", open)
+	}
+	return strings.Join(lines, "\n"), nil
+}
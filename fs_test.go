@@ -0,0 +1,202 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+)
+
+func TestFSLoaderLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_partitions.up.sql.tmpl": {Data: []byte(`
+			{{range $i := seq .partitions}}CREATE TABLE {{$.schema}}.events_{{$i}} ();
+			{{end}}`)},
+		"migrations/0001_create_events.up.sql": {Data: []byte(`
+			CREATE TABLE events (id INT);
+			CREATE INDEX events_id ON events (id);`)},
+		"migrations/0001_create_events.down.sql": {Data: []byte(`DROP TABLE events;`)},
+		"migrations/README.md":                   {Data: []byte(`ignored`)},
+	}
+	l := FSLoader{
+		Data: map[string]interface{}{"schema": "app", "partitions": 2},
+		Funcs: template.FuncMap{"seq": func(n int) []int {
+			s := make([]int, n)
+			for i := range s {
+				s[i] = i
+			}
+			return s
+		}},
+	}
+	migrations, err := l.Load(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []Migration{
+		{
+			Version:     1,
+			Comment:     "create events",
+			UpQueries:   []string{"CREATE TABLE events (id INT)", "CREATE INDEX events_id ON events (id)"},
+			DownQueries: []string{"DROP TABLE events"},
+		},
+		{
+			Version:   2,
+			Comment:   "add partitions",
+			UpQueries: []string{"CREATE TABLE app.events_0 ()", "CREATE TABLE app.events_1 ()"},
+		},
+	}
+	if !reflect.DeepEqual(migrations, expected) {
+		t.Errorf("expected %#v, got %#v", expected, migrations)
+	}
+}
+
+func TestFSLoaderDialect(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0001_create_users.up.sql": {Data: []byte(`CREATE TABLE users (id INT, name TEXT);
+-- +migrate dialect:postgres
+CREATE INDEX CONCURRENTLY users_name ON users (name);
+-- +migrate end
+--  +migrate dialect:mysql, sqlite
+CREATE INDEX users_name ON users (name);
+-- +migrate end
+`)},
+	}
+	for dialect, expected := range map[Dialect]string{
+		DialectPostgreSQL: "CREATE INDEX CONCURRENTLY users_name ON users (name)",
+		DialectSQLite:     "CREATE INDEX users_name ON users (name)",
+	} {
+		migrations, err := FSLoader{Dialect: dialect}.Load(fsys, "m")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		queries := []string{"CREATE TABLE users (id INT, name TEXT)", expected}
+		if !reflect.DeepEqual(migrations[0].UpQueries, queries) {
+			t.Errorf("expected %s queries %q, got %q", dialect, queries, migrations[0].UpQueries)
+		}
+	}
+
+	for src, expectedErr := range map[string]string{
+		"-- +migrate dialect:mysql\n-- +migrate dialect:postgres": "line 2: dialect blocks can't be nested",
+		"-- +migrate end":               "line 1: end without a dialect block",
+		"\n-- +migrate dialect:mysql\n": "line 2: dialect block is never closed",
+		"-- +migrate up":                `line 1: unknown directive "up"`,
+	} {
+		if _, err := selectDialect(src, DialectMySQL); err == nil || err.Error() != expectedErr {
+			t.Errorf("expected error %q, got %v", expectedErr, err)
+		}
+	}
+}
+
+func TestFSLoaderDescription(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0001_create_users.up.sql": {Data: []byte(`-- Adds the users table.
+--
+-- Reverting drops every user.
+
+-- the table
+CREATE TABLE users (id INT);
+`)},
+		"m/0001_create_users.down.sql": {Data: []byte("-- Not a description.\n\nDROP TABLE users;")},
+		"m/0002_add_index.up.sql":      {Data: []byte("-- the index\nCREATE INDEX users_id ON users (id);")},
+	}
+	migrations, err := LoadFS(fsys, "m")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []Migration{
+		{
+			Version:     1,
+			Comment:     "create users",
+			Description: "Adds the users table.\n\nReverting drops every user.",
+			UpQueries:   []string{"-- Adds the users table.\n--\n-- Reverting drops every user.\n\n-- the table\nCREATE TABLE users (id INT)"},
+			DownQueries: []string{"-- Not a description.\n\nDROP TABLE users"},
+		},
+		{
+			Version:   2,
+			Comment:   "add index",
+			UpQueries: []string{"-- the index\nCREATE INDEX users_id ON users (id)"},
+		},
+	}
+	if !reflect.DeepEqual(migrations, expected) {
+		t.Errorf("expected %#v, got %#v", expected, migrations)
+	}
+}
+
+func TestFSLoaderAllocator(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/20200105000000_add_index.up.sql":    {Data: []byte("CREATE INDEX users_id ON users (id);")},
+		"m/20200102000000_create_users.up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+	}
+	l := FSLoader{Allocator: TimestampAllocator{}}
+	migrations, err := l.Load(fsys, "m")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []Migration{
+		{Version: 1, Comment: "create users", UpQueries: []string{"CREATE TABLE users (id INT)"}},
+		{Version: 2, Comment: "add index", UpQueries: []string{"CREATE INDEX users_id ON users (id)"}},
+	}
+	if !reflect.DeepEqual(migrations, expected) {
+		t.Errorf("expected %#v, got %#v", expected, migrations)
+	}
+	ids, err := l.IDs(fsys, "m")
+	if err != nil || !reflect.DeepEqual(ids, []int64{20200102000000, 20200105000000}) {
+		t.Errorf("unexpected ids %v, %v", ids, err)
+	}
+
+	fsys["m/3_add_name.up.sql"] = &fstest.MapFile{}
+	if _, err := l.Load(fsys, "m"); err == nil || err.Error() != "invalid migration numbering: migration 3 is not a timestamp like 20060102150405" {
+		t.Errorf("expected a numbering error, got %v", err)
+	}
+}
+
+func TestFSLoaderLoadErrors(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Files       fstest.MapFS
+		ExpectedErr string
+	}{
+		{
+			Name:        "Bad name",
+			Files:       fstest.MapFS{"m/create.up.sql": {}},
+			ExpectedErr: "migration file create.up.sql must be named like 0001_comment.up.sql",
+		},
+		{
+			Name:        "Missing up",
+			Files:       fstest.MapFS{"m/1_a.down.sql": {}},
+			ExpectedErr: "migration version 1 is missing an up file",
+		},
+		{
+			Name:        "Duplicate",
+			Files:       fstest.MapFS{"m/1_a.up.sql": {}, "m/01_b.up.sql": {}},
+			ExpectedErr: "migration version 1 has more than one up file",
+		},
+		{
+			Name:        "Gap",
+			Files:       fstest.MapFS{"m/1_a.up.sql": {}, "m/3_b.up.sql": {}},
+			ExpectedErr: "set m is missing migration version 2",
+		},
+		{
+			Name:        "Dialect block without dialect",
+			Files:       fstest.MapFS{"m/1_a.up.sql": {Data: []byte("-- +migrate dialect:postgres\n-- +migrate end")}},
+			ExpectedErr: "error in migration file m/1_a.up.sql: line 1: dialect blocks require the loader's Dialect to be set",
+		},
+		{
+			Name:        "Missing template key",
+			Files:       fstest.MapFS{"m/1_a.up.sql.tmpl": {Data: []byte("{{.schema}}")}},
+			ExpectedErr: "error rendering migration template m/1_a.up.sql.tmpl",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := LoadFS(tt.Files, "m")
+			if err == nil || !strings.HasPrefix(err.Error(), tt.ExpectedErr) {
+				t.Errorf("expected error %q, got %v", tt.ExpectedErr, err)
+			}
+		})
+	}
+}
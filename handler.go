@@ -0,0 +1,136 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler is an http.Handler that lets internal tools inspect and apply
+// the migrations for a running service. It's created with Handler, and
+// serves these endpoints, relative to where it's mounted:
+//
+//	GET  /status             the current and latest versions
+//	GET  /plan?target=N      the Plan for migrating to version N
+//	POST /apply?target=N     applies migrations, and returns a RunResult
+//
+// Without a target, the plan and apply endpoints stop before the first
+// pending migration in PhasePostDeploy, like Migrator.Up. The status and plan
+// endpoints use the Migrator's ReadDB if it's set. Applying migrations is disabled
+// unless Authorize is set. Mount the handler with http.StripPrefix:
+//
+//	mux.Handle("/admin/migrations/", http.StripPrefix("/admin/migrations", migrate.Handler(m)))
+type AdminHandler struct {
+	// Migrator is used to inspect and apply migrations. If it doesn't have a
+	// LockName, and its dialect supports advisory locks, applying migrations
+	// uses the lock "migrate", so that only one replica applies them.
+	Migrator *Migrator
+
+	// Authorize is called before applying migrations, and should return true
+	// if the request is allowed to apply them. If it's nil, all requests to
+	// apply migrations are rejected.
+	Authorize func(r *http.Request) bool
+}
+
+// Handler returns an AdminHandler for the migrator. Set Authorize on the
+// returned handler to enable applying migrations.
+func Handler(m *Migrator) *AdminHandler {
+	return &AdminHandler{Migrator: m}
+}
+
+// Status is returned by Migrator.Status and the status endpoint of
+// AdminHandler.
+type Status struct {
+	// CurrentVersion is the current version of the database.
+	CurrentVersion int `json:"current_version"`
+
+	// LatestVersion is the version of the latest migration.
+	LatestVersion int `json:"latest_version"`
+
+	// Pending is the number of migrations that haven't been applied.
+	Pending int `json:"pending"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// A target of 0 means no target was given, as it does for RunConfig.
+	var target int
+	if s := r.URL.Query().Get("target"); s != "" {
+		var err error
+		if target, err = strconv.Atoi(s); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid target version")
+			return
+		}
+	}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/status":
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.serveStatus(r.Context(), w)
+	case "/plan":
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.servePlan(r.Context(), w, target)
+	case "/apply":
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if h.Authorize == nil || !h.Authorize(r) {
+			writeJSONError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		h.serveApply(r.Context(), w, target)
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *AdminHandler) serveStatus(ctx context.Context, w http.ResponseWriter) {
+	status, err := h.Migrator.Status(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *AdminHandler) servePlan(ctx context.Context, w http.ResponseWriter, target int) {
+	var plan *Plan
+	var err error
+	if target == 0 {
+		plan, err = h.Migrator.planPhase(ctx, len(h.Migrator.Migrations), PhasePreDeploy)
+	} else {
+		plan, err = h.Migrator.PlanUpToVersion(ctx, target)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+func (h *AdminHandler) serveApply(ctx context.Context, w http.ResponseWriter, target int) {
+	result := runResult(ctx, RunConfig{Migrator: h.Migrator, TargetVersion: target})
+	code := http.StatusOK
+	if result.Status == "failed" {
+		code = http.StatusInternalServerError
+	}
+	writeJSON(w, code, result)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
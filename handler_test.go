@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 1
+	h := Handler(&Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+		},
+	})
+	tests := []struct {
+		Name         string
+		Method       string
+		Path         string
+		Authorize    bool
+		ExpectedCode int
+		ExpectedBody string
+	}{
+		{"Status", "GET", "/status", false, 200, `{"current_version":1,"latest_version":2,"pending":1}`},
+		{"Plan", "GET", "/plan", false, 200, `{"current_version":1,"target_version":2,"steps":[{"version":2,"upgrade":true,"comment":"example comment 2"}]}`},
+		{"PlanTarget", "GET", "/plan?target=1", false, 200, `{"current_version":1,"target_version":1,"steps":null}`},
+		{"PlanInvalidTarget", "GET", "/plan?target=x", false, 400, `{"error":"invalid target version"}`},
+		{"ApplyForbidden", "POST", "/apply", false, 403, `{"error":"forbidden"}`},
+		{"ApplyMethod", "GET", "/apply", true, 405, `{"error":"method not allowed"}`},
+		{"Apply", "POST", "/apply", true, 200, `{"status":"applied","from_version":1,"to_version":2,"exit_code":0}`},
+		{"NotFound", "GET", "/other", false, 404, `{"error":"not found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			h.Authorize = nil
+			if tt.Authorize {
+				h.Authorize = func(r *http.Request) bool { return true }
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.Method, tt.Path, nil).WithContext(ctx))
+			if w.Code != tt.ExpectedCode {
+				t.Errorf("expected status %d, got %d", tt.ExpectedCode, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.ExpectedBody {
+				t.Errorf("expected body %s, got %s", tt.ExpectedBody, body)
+			}
+		})
+	}
+}
+
+func TestHandlerPostDeploy(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 1
+	h := Handler(&Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+			{Comment: "example comment 3", UpQueries: []string{"example query 3"}, Phase: PhasePostDeploy},
+		},
+	})
+	h.Authorize = func(r *http.Request) bool { return true }
+	tests := []struct {
+		Name         string
+		Method       string
+		Path         string
+		ExpectedCode int
+		ExpectedBody string
+	}{
+		{"Plan", "GET", "/plan", 200, `{"current_version":1,"target_version":2,"steps":[{"version":2,"upgrade":true,"comment":"example comment 2"}]}`},
+		{"PlanTarget", "GET", "/plan?target=3", 200, `{"current_version":1,"target_version":3,"steps":[{"version":2,"upgrade":true,"comment":"example comment 2"},{"version":3,"upgrade":true,"comment":"example comment 3"}]}`},
+		{"Apply", "POST", "/apply", 200, `{"status":"applied","from_version":1,"to_version":2,"pending":[{"version":3,"comment":"example comment 3"}],"exit_code":0}`},
+		{"ApplyTarget", "POST", "/apply?target=3", 200, `{"status":"applied","from_version":1,"to_version":3,"exit_code":0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.Method, tt.Path, nil).WithContext(ctx))
+			if w.Code != tt.ExpectedCode {
+				t.Errorf("expected status %d, got %d", tt.ExpectedCode, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.ExpectedBody {
+				t.Errorf("expected body %s, got %s", tt.ExpectedBody, body)
+			}
+		})
+	}
+}
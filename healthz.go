@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CheckVersion returns an error if the database hasn't been migrated to the
+// version that Up would migrate it to. Pending migrations in PhasePostDeploy
+// are only applied once the new code is running, so the database is expected
+// to stop before the first of them. A database with a newer version is
+// considered up to date, so that instances running an older build keep
+// working during a rolling deploy. Unlike the other Migrator methods, it
+// doesn't create the version table if it's missing.
+func (m *Migrator) CheckVersion(ctx context.Context) error {
+	current, err := m.Adapter.QuerySchemaVersion(ctx, m.DB)
+	if err != nil {
+		return fmt.Errorf("error querying current schema version: %w", err)
+	}
+	expected := len(m.Migrations)
+	for i := current; i < expected; i++ {
+		if m.Migrations[i].Phase.rank() > PhasePreDeploy.rank() {
+			expected = i
+			break
+		}
+	}
+	if current < expected {
+		return fmt.Errorf("database is at version %d, expected version %d", current, expected)
+	}
+	return nil
+}
+
+// Healthz returns an http.Handler that reports whether the database has been
+// migrated to the latest version, for use as a readiness probe. It responds
+// with 200 OK if it has, or 503 Service Unavailable if it hasn't or the
+// version couldn't be checked. See CheckVersion for details.
+func Healthz(m *Migrator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := m.CheckVersion(r.Context()); err != nil {
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
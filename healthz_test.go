@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	h := Healthz(&Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+		},
+	})
+	tests := []struct {
+		Name         string
+		Version      int
+		QueryErr     error
+		ExpectedCode int
+		ExpectedBody string
+	}{
+		{"Current", 2, nil, 200, `{"status":"ok"}`},
+		{"Newer", 3, nil, 200, `{"status":"ok"}`},
+		{"Older", 1, nil, 503, `{"error":"database is at version 1, expected version 2"}`},
+		{"Error", 2, errors.New("mock error"), 503, `{"error":"error querying current schema version: mock error"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			md.Reset()
+			md.QueryRows.Version = tt.Version
+			md.QueryErr = tt.QueryErr
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil).WithContext(ctx))
+			if w.Code != tt.ExpectedCode {
+				t.Errorf("expected status %d, got %d", tt.ExpectedCode, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.ExpectedBody {
+				t.Errorf("expected body %s, got %s", tt.ExpectedBody, body)
+			}
+			if len(md.ExecLogs) != 0 {
+				t.Errorf("expected no queries to be executed, got %#v", md.ExecLogs)
+			}
+		})
+	}
+}
+
+func TestHealthzPendingPostDeploy(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	h := Healthz(&Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}, Phase: PhasePostDeploy},
+			{Comment: "example comment 3", UpQueries: []string{"example query 3"}},
+		},
+	})
+	tests := []struct {
+		Name         string
+		Version      int
+		ExpectedCode int
+		ExpectedBody string
+	}{
+		{"PostDeployPending", 1, 200, `{"status":"ok"}`},
+		{"PostDeployApplied", 2, 503, `{"error":"database is at version 2, expected version 3"}`},
+		{"PreDeployPending", 0, 503, `{"error":"database is at version 0, expected version 1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			md.Reset()
+			md.QueryRows.Version = tt.Version
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil).WithContext(ctx))
+			if w.Code != tt.ExpectedCode {
+				t.Errorf("expected status %d, got %d", tt.ExpectedCode, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.ExpectedBody {
+				t.Errorf("expected body %s, got %s", tt.ExpectedBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// existenceErrorRegexp matches the errors returned by PostgreSQL, MySQL and
+// SQLite when a query creates an object that already exists, or drops or
+// changes one that doesn't exist, like:
+//
+//	relation "users" already exists
+//	Error 1060: Duplicate column name 'name'
+//	Error 1091: Can't DROP 'users_name'; check that column/key exists
+//	no such index: users_name
+var existenceErrorRegexp = regexp.MustCompile(`(?i)already exists|does not exist|doesn't exist|` +
+	`duplicate (column|key) name|check that (column/key|it) exists|unknown table|no such (table|index|column|view|trigger)`)
+
+// IsExistenceError returns true if err means that a query tried to create an
+// object that already exists, or to drop or change one that doesn't exist.
+// It recognizes the messages of PostgreSQL, MySQL and SQLite. It doesn't
+// match errors about duplicate rows, like unique constraint violations.
+func IsExistenceError(err error) bool {
+	return err != nil && existenceErrorRegexp.MatchString(err.Error())
+}
+
+// ExecQueriesIdempotent is like ExecQueries, but errors for which tolerate
+// returns true are logged and ignored, and the following queries are still
+// run. If tolerate is nil, IsExistenceError is used. This makes it easier to
+// retry a migration that was partially applied on a database without
+// transactional DDL, like MySQL, where some of its tables or columns were
+// created before it failed. Queries that can use IF EXISTS or IF NOT EXISTS
+// should still prefer them, since tolerated errors can hide real problems,
+// like a table that exists with a different structure.
+func ExecQueriesIdempotent(queries []string, tolerate func(err error) bool) MigrationFunc {
+	if tolerate == nil {
+		tolerate = IsExistenceError
+	}
+	return func(ctx context.Context, db *sql.DB) error {
+		for i, q := range queries {
+			q = rewriteQuery(ctx, q)
+			logQuery(ctx, q, nil)
+			_, err := db.ExecContext(ctx, q)
+			if err != nil && tolerate(err) {
+				LoggerFromContext(ctx)("Ignoring error with query %d: %s", i, err)
+			} else if err != nil {
+				return fmt.Errorf("error with query %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+}
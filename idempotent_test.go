@@ -0,0 +1,54 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsExistenceError(t *testing.T) {
+	tests := []struct {
+		Err      error
+		Expected bool
+	}{
+		{errors.New(`pq: relation "users" already exists`), true},
+		{errors.New(`pq: column "name" of relation "users" does not exist`), true},
+		{errors.New("Error 1060: Duplicate column name 'name'"), true},
+		{errors.New("Error 1061: Duplicate key name 'users_name'"), true},
+		{errors.New("Error 1091: Can't DROP 'users_name'; check that column/key exists"), true},
+		{errors.New("Error 1051: Unknown table 'app.users'"), true},
+		{errors.New("no such index: users_name"), true},
+		{errors.New("Error 1062: Duplicate entry '1' for key 'PRIMARY'"), false},
+		{errors.New(`pq: duplicate key value violates unique constraint "users_pkey"`), false},
+		{errors.New("syntax error"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if actual := IsExistenceError(tt.Err); actual != tt.Expected {
+			t.Errorf("expected %v for %v, got %v", tt.Expected, tt.Err, actual)
+		}
+	}
+}
+
+func TestExecQueriesIdempotent(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	queries := []string{"CREATE TABLE users (id INT)", "CREATE INDEX users_id ON users (id)"}
+	md.ExecErr = errors.New(`pq: relation "users" already exists`)
+	if err := ExecQueriesIdempotent(queries, nil)(ctx, db); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	var tolerated []error
+	tolerate := func(err error) bool {
+		tolerated = append(tolerated, err)
+		return false
+	}
+	err := ExecQueriesIdempotent(queries, tolerate)(ctx, db)
+	if err == nil || err.Error() != `error with query 0: pq: relation "users" already exists` {
+		t.Errorf("expected the first query to fail, got %v", err)
+	}
+	if len(tolerated) != 1 {
+		t.Errorf("expected tolerate to be called once, got %d", len(tolerated))
+	}
+}
@@ -0,0 +1,241 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Index declares an index that a table should have, for use with
+// DeclareIndexes and SyncIndexes.
+type Index struct {
+	// Name is the name of the index. Indexes are matched by name, so an
+	// index whose definition changes should also be renamed, so that the old
+	// one is dropped and the new one is created.
+	Name string
+
+	// Table is the table the index is on.
+	Table string
+
+	// Columns are the columns or expressions that are indexed, like
+	// "email" or "lower(email)".
+	Columns []string
+
+	// Unique makes the index a unique index.
+	Unique bool
+
+	// Where makes the index a partial index, on the rows matching the
+	// condition. It's not supported for DialectMySQL.
+	Where string
+}
+
+// IndexDrift describes how the indexes of a database differ from the ones
+// declared for it, as returned by DiffIndexes and SyncIndexes.
+type IndexDrift struct {
+	// Missing are the declared indexes that don't exist.
+	Missing []Index
+
+	// Invalid are declared indexes that exist but can't be used, like ones
+	// left by a CREATE INDEX CONCURRENTLY that failed. They're also in
+	// Missing, since they're dropped and created again.
+	Invalid []Index
+
+	// Extra are indexes on the declared tables that weren't declared. Only
+	// their Name and Table are set.
+	Extra []Index
+}
+
+// Empty returns true if the indexes match the declared ones.
+func (d *IndexDrift) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Invalid) == 0 && len(d.Extra) == 0
+}
+
+// indexQueries return the name of each index on a table that isn't used by a
+// primary key or other constraint, and whether it's valid.
+var indexQueries = map[Dialect]string{
+	DialectPostgreSQL: `
+		SELECT i.relname, x.indisvalid::int FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		WHERE x.indrelid = $1::regclass AND NOT x.indisprimary
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = x.indexrelid)
+	`,
+	DialectMySQL: `
+		SELECT DISTINCT index_name, 1 FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY'
+	`,
+	DialectSQLite: `SELECT name, 1 FROM pragma_index_list(?) WHERE origin = 'c'`,
+}
+
+// DeclareIndexes returns a migration function that creates and drops indexes
+// so that the tables they're on have exactly the declared indexes, like
+// SyncIndexes. Tables that don't have any declared indexes aren't changed.
+//
+// This lets the indexes of hot tables be kept in one place, instead of spread
+// across many migrations. Add a migration that uses it each time the
+// declaration changes; since it only changes indexes that differ, it also
+// corrects any drift from indexes that were added or dropped by hand.
+//
+// For DialectPostgreSQL, the indexes are created and dropped concurrently, so
+// the migration can't be run by Prepare. For DialectMySQL, they're changed
+// with ALGORITHM=INPLACE and LOCK=NONE.
+func DeclareIndexes(indexes ...Index) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		_, err := SyncIndexes(ctx, db, dialectFromContext(ctx), indexes)
+		return err
+	}
+}
+
+// DiffIndexes returns how the indexes on the tables of the declared indexes
+// differ from them.
+func DiffIndexes(ctx context.Context, db *sql.DB, dialect Dialect, indexes []Index) (*IndexDrift, error) {
+	query, ok := indexQueries[dialect]
+	if !ok {
+		return nil, fmt.Errorf("declaring indexes is not supported for dialect %q", dialect)
+	}
+	declared := map[string]bool{}
+	var tables []string
+	byTable := map[string][]Index{}
+	for _, index := range indexes {
+		if err := index.validate(dialect); err != nil {
+			return nil, err
+		}
+		if declared[index.Name] {
+			return nil, fmt.Errorf("index %s is declared more than once", index.Name)
+		}
+		declared[index.Name] = true
+		if _, ok := byTable[index.Table]; !ok {
+			tables = append(tables, index.Table)
+		}
+		byTable[index.Table] = append(byTable[index.Table], index)
+	}
+
+	drift := &IndexDrift{}
+	for _, table := range tables {
+		valid, err := queryIndexes(ctx, db, query, table)
+		if err != nil {
+			return nil, fmt.Errorf("error querying indexes for %s: %w", table, err)
+		}
+		for _, index := range byTable[table] {
+			v, ok := valid[index.Name]
+			if !ok || !v {
+				drift.Missing = append(drift.Missing, index)
+			}
+			if ok && !v {
+				drift.Invalid = append(drift.Invalid, index)
+			}
+			delete(valid, index.Name)
+		}
+		var extra []string
+		for name := range valid {
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			drift.Extra = append(drift.Extra, Index{Name: name, Table: table})
+		}
+	}
+	return drift, nil
+}
+
+// SyncIndexes creates and drops indexes so that the tables of the declared
+// indexes have exactly those indexes, and returns how they differed. Invalid
+// indexes are dropped first, then missing indexes are created, and then
+// extra indexes are dropped, so that a replacement for an index exists before
+// the old one is removed. Indexes used by primary keys or other constraints
+// are left alone.
+func SyncIndexes(ctx context.Context, db *sql.DB, dialect Dialect, indexes []Index) (*IndexDrift, error) {
+	drift, err := DiffIndexes(ctx, db, dialect, indexes)
+	if err != nil {
+		return nil, err
+	}
+	var queries []string
+	for _, index := range drift.Invalid {
+		queries = append(queries, index.dropQuery(dialect))
+	}
+	for _, index := range drift.Missing {
+		queries = append(queries, index.createQuery(dialect))
+	}
+	for _, index := range drift.Extra {
+		queries = append(queries, index.dropQuery(dialect))
+	}
+	if len(queries) > 0 {
+		LoggerFromContext(ctx)("Synchronizing indexes: %d missing, %d invalid, %d extra",
+			len(drift.Missing), len(drift.Invalid), len(drift.Extra))
+	}
+	return drift, ExecQueries(queries)(ctx, db)
+}
+
+// queryIndexes returns whether each index on the table is valid.
+func queryIndexes(ctx context.Context, db *sql.DB, query, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	valid := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var v int
+		if err := rows.Scan(&name, &v); err != nil {
+			return nil, err
+		}
+		valid[name] = v != 0
+	}
+	return valid, rows.Err()
+}
+
+// validate returns an error if the index can't be created for the dialect.
+func (i Index) validate(dialect Dialect) error {
+	switch {
+	case i.Name == "" || i.Table == "":
+		return fmt.Errorf("index %q must have a name and a table", i.Name)
+	case len(i.Columns) == 0:
+		return fmt.Errorf("index %s must have columns", i.Name)
+	case i.Where != "" && dialect == DialectMySQL:
+		return fmt.Errorf("index %s: partial indexes are not supported for dialect %q", i.Name, dialect)
+	}
+	return nil
+}
+
+// createQuery returns the query that creates the index.
+func (i Index) createQuery(dialect Dialect) string {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if i.Unique {
+		b.WriteString("UNIQUE ")
+	}
+	b.WriteString("INDEX ")
+	switch dialect {
+	case DialectPostgreSQL:
+		b.WriteString("CONCURRENTLY IF NOT EXISTS ")
+	case DialectSQLite:
+		b.WriteString("IF NOT EXISTS ")
+	}
+	fmt.Fprintf(&b, "%s ON %s (%s)", i.Name, i.Table, strings.Join(i.Columns, ", "))
+	if i.Where != "" {
+		fmt.Fprintf(&b, " WHERE %s", i.Where)
+	}
+	if dialect == DialectMySQL {
+		b.WriteString(" ALGORITHM=INPLACE LOCK=NONE")
+	}
+	return b.String()
+}
+
+// dropQuery returns the query that drops the index.
+func (i Index) dropQuery(dialect Dialect) string {
+	switch dialect {
+	case DialectPostgreSQL:
+		// Indexes are in the same schema as their table.
+		name := i.Name
+		if n := strings.LastIndex(i.Table, "."); n >= 0 {
+			name = i.Table[:n+1] + name
+		}
+		return fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", name)
+	case DialectMySQL:
+		return fmt.Sprintf("DROP INDEX %s ON %s ALGORITHM=INPLACE LOCK=NONE", i.Name, i.Table)
+	default:
+		return fmt.Sprintf("DROP INDEX IF EXISTS %s", i.Name)
+	}
+}
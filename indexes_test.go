@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncIndexes(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "FROM pg_index",
+		Rows: MockRows{
+			Cols: []string{"relname", "indisvalid"},
+			Values: [][]driver.Value{
+				{"users_name", int64(1)},
+				{"users_email", int64(0)},
+				{"users_old", int64(1)},
+			},
+		},
+	}}
+	indexes := []Index{
+		{Name: "users_name", Table: "app.users", Columns: []string{"name"}},
+		{Name: "users_email", Table: "app.users", Columns: []string{"lower(email)"}, Unique: true},
+		{Name: "users_active", Table: "app.users", Columns: []string{"created_at"}, Where: "deleted_at IS NULL"},
+	}
+	drift, err := SyncIndexes(ctx, db, DialectPostgreSQL, indexes)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := &IndexDrift{
+		Missing: indexes[1:],
+		Invalid: indexes[1:2],
+		Extra:   []Index{{Name: "users_old", Table: "app.users"}},
+	}
+	if !reflect.DeepEqual(drift, expected) {
+		t.Errorf("expected drift %+v, got %+v", expected, drift)
+	}
+	if args := md.QueryLogs[0].Args; len(args) != 1 || args[0].Value != "app.users" {
+		t.Errorf("expected indexes to be queried for app.users, got %#v", args)
+	}
+	checkLogs(t, "ExecLogs", md.ExecLogs, []MockQueryLog{
+		{Query: "DROP INDEX CONCURRENTLY IF EXISTS app.users_email"},
+		{Query: "CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_email ON app.users (lower(email))"},
+		{Query: "CREATE INDEX CONCURRENTLY IF NOT EXISTS users_active ON app.users (created_at) WHERE deleted_at IS NULL"},
+		{Query: "DROP INDEX CONCURRENTLY IF EXISTS app.users_old"},
+	})
+
+	md.Reset()
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "FROM information_schema.statistics",
+		Rows: MockRows{
+			Cols:   []string{"index_name", "1"},
+			Values: [][]driver.Value{{"users_name", int64(1)}},
+		},
+	}}
+	drift, err = SyncIndexes(ctx, db, DialectMySQL, indexes[:1])
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !drift.Empty() || len(md.ExecLogs) != 0 {
+		t.Errorf("expected no drift or queries, got %+v and %#v", drift, md.ExecLogs)
+	}
+
+	_, err = SyncIndexes(ctx, db, DialectMySQL, indexes)
+	expectedErr := `index users_active: partial indexes are not supported for dialect "mysql"`
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	_, err = SyncIndexes(ctx, db, DialectMySQL, []Index{indexes[0], indexes[0]})
+	expectedErr = "index users_name is declared more than once"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestDeclareIndexes(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "FROM pragma_index_list",
+		Rows:    MockRows{Cols: []string{"name", "1"}},
+	}}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{
+			Comment: "declare indexes",
+			Up:      DeclareIndexes(Index{Name: "users_name", Table: "users", Columns: []string{"name"}}),
+		}},
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var found bool
+	for _, l := range md.ExecLogs {
+		if strings.HasSuffix(l.Query, "CREATE INDEX IF NOT EXISTS users_name ON users (name)") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the index to be created, got %#v", md.ExecLogs)
+	}
+}
@@ -0,0 +1,251 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LintFinding describes a problem found in a migration by Lint.
+type LintFinding struct {
+	// Version is the version of the migration.
+	Version int `json:"version"`
+
+	// Rule is the name of the rule that produced the finding.
+	Rule string `json:"rule"`
+
+	// Query is the SQL query that triggered the finding, if the finding is
+	// about a specific query.
+	Query string `json:"query,omitempty"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// String returns a one line description of the finding.
+func (f LintFinding) String() string {
+	return fmt.Sprintf("version %d: %s: %s", f.Version, f.Rule, f.Message)
+}
+
+// LintRule is a policy checked by Lint, such as a naming convention or a
+// list of forbidden column types. Organizations can implement their own
+// rules and pass them to Lint, or set them on RunConfig, so they're checked
+// in CI along with the built-in rules.
+type LintRule interface {
+	// Name returns the name of the rule, such as "missing-down". It's used as
+	// the Rule of the findings.
+	Name() string
+
+	// Check returns findings for the problems in a migration. The Version
+	// and Rule of the findings are filled in by Lint. The dialect is the
+	// dialect passed to Lint, and may be DialectUnknown.
+	Check(dialect Dialect, m Migration) []LintFinding
+}
+
+// NewLintRule returns a LintRule with the name that calls check.
+func NewLintRule(name string, check func(dialect Dialect, m Migration) []LintFinding) LintRule {
+	return lintRule{name: name, check: check}
+}
+
+// lintRule implements LintRule with a function.
+type lintRule struct {
+	name  string
+	check func(dialect Dialect, m Migration) []LintFinding
+}
+
+func (r lintRule) Name() string {
+	return r.name
+}
+
+func (r lintRule) Check(dialect Dialect, m Migration) []LintFinding {
+	return r.check(dialect, m)
+}
+
+var (
+	lintCreateTable = regexp.MustCompile(`(?i)^CREATE (?:TEMP |TEMPORARY )?TABLE (?:IF NOT EXISTS )?([^\s(]+)`)
+	lintCreateIndex = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (CONCURRENTLY )?(?:\S+ )?(?:IF NOT EXISTS \S+ )?ON (?:ONLY )?([^\s(]+)`)
+	lintTypeChange  = regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*(?:ALTER (?:COLUMN )?\S+ (?:SET DATA )?TYPE |MODIFY |CHANGE )`)
+	lintTemporary   = regexp.MustCompile(`(?i)^CREATE TEMP(?:ORARY)? `)
+	lintCreateAs    = regexp.MustCompile(`(?i)^CREATE [^(]* (?:AS|LIKE) `)
+	lintPrimaryKey  = regexp.MustCompile(`(?i)PRIMARY KEY`)
+	lintAlterTable  = regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName)
+	lintReferences  = regexp.MustCompile(`(?i)\bREFERENCES ([^\s(),]+)`)
+	lintDropFK      = regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*DROP (?:CONSTRAINT|FOREIGN KEY) `)
+	lintDropTable   = regexp.MustCompile(`(?i)^DROP TABLE (?:IF EXISTS )?(.+?)( CASCADE)?$`)
+)
+
+// lintRules are the built-in rules used by Lint.
+var lintRules = []LintRule{
+	lintRule{
+		name: "missing-down",
+		check: func(dialect Dialect, m Migration) []LintFinding {
+			if m.Down != nil || m.DownQueries != nil {
+				return nil
+			}
+			return []LintFinding{{Message: "migration has no Down function or queries, so it can't be reverted"}}
+		},
+	},
+	lintRule{
+		name: "index-not-concurrent",
+		check: func(dialect Dialect, m Migration) []LintFinding {
+			if dialect != DialectPostgreSQL {
+				return nil
+			}
+			// Indexes on tables created by the same migration can't block
+			// anything, since the tables are empty.
+			created := map[string]bool{}
+			var findings []LintFinding
+			for _, q := range m.UpQueries {
+				nq := normalizeQuery(q)
+				if match := lintCreateTable.FindStringSubmatch(nq); match != nil {
+					created[match[1]] = true
+				} else if match := lintCreateIndex.FindStringSubmatch(nq); match != nil && match[1] == "" && !created[match[2]] {
+					findings = append(findings, LintFinding{
+						Query:   q,
+						Message: fmt.Sprintf("creating an index on %s without CONCURRENTLY blocks writes until it finishes", match[2]),
+					})
+				}
+			}
+			return findings
+		},
+	},
+	lintRule{
+		name: "column-type-change",
+		check: func(dialect Dialect, m Migration) []LintFinding {
+			var findings []LintFinding
+			for _, q := range m.UpQueries {
+				if match := lintTypeChange.FindStringSubmatch(normalizeQuery(q)); match != nil {
+					findings = append(findings, LintFinding{
+						Query:   q,
+						Message: fmt.Sprintf("changing a column type on %s may rewrite the table, and implicit conversions can change or reject existing values", match[1]),
+					})
+				}
+			}
+			return findings
+		},
+	},
+	lintRule{
+		name: "missing-primary-key",
+		check: func(dialect Dialect, m Migration) []LintFinding {
+			var findings []LintFinding
+			for _, q := range m.UpQueries {
+				nq := normalizeQuery(q)
+				match := lintCreateTable.FindStringSubmatch(nq)
+				if match == nil || lintTemporary.MatchString(nq) || lintCreateAs.MatchString(nq) || lintPrimaryKey.MatchString(nq) {
+					continue
+				}
+				findings = append(findings, LintFinding{
+					Query:   q,
+					Message: fmt.Sprintf("table %s has no primary key", match[1]),
+				})
+			}
+			return findings
+		},
+	},
+	lintRule{
+		name: "down-fk-order",
+		check: func(dialect Dialect, m Migration) []LintFinding {
+			// The foreign keys are found from the UpQueries, so that tables
+			// created by the migration can be checked before they exist.
+			refs := map[string]map[string]bool{}
+			for _, q := range m.UpQueries {
+				nq := normalizeQuery(q)
+				match := lintCreateTable.FindStringSubmatch(nq)
+				if match == nil {
+					match = lintAlterTable.FindStringSubmatch(nq)
+				}
+				if match == nil {
+					continue
+				}
+				for _, ref := range lintReferences.FindAllStringSubmatch(nq, -1) {
+					if ref[1] == match[1] {
+						continue
+					}
+					if refs[match[1]] == nil {
+						refs[match[1]] = map[string]bool{}
+					}
+					refs[match[1]][ref[1]] = true
+				}
+			}
+			var findings []LintFinding
+			for _, q := range m.DownQueries {
+				nq := normalizeQuery(strings.TrimSuffix(strings.TrimSpace(q), ";"))
+				if match := lintDropFK.FindStringSubmatch(nq); match != nil {
+					delete(refs, match[1])
+					continue
+				}
+				match := lintDropTable.FindStringSubmatch(nq)
+				if match == nil {
+					continue
+				}
+				dropped := map[string]bool{}
+				for _, table := range strings.Split(match[1], ",") {
+					dropped[strings.TrimSpace(table)] = true
+				}
+				var children []string
+				for child, parents := range refs {
+					if dropped[child] {
+						continue
+					}
+					for parent := range parents {
+						if dropped[parent] && match[2] == "" {
+							children = append(children, fmt.Sprintf("%s (references %s)", child, parent))
+						}
+					}
+				}
+				for table := range dropped {
+					delete(refs, table)
+				}
+				if len(children) > 0 {
+					sort.Strings(children)
+					findings = append(findings, LintFinding{
+						Query:   q,
+						Message: fmt.Sprintf("table is dropped before the tables with foreign keys that reference it: %s", strings.Join(children, ", ")),
+					})
+				}
+			}
+			return findings
+		},
+	},
+}
+
+// Lint checks migrations for common mistakes, and returns a finding for each
+// one, in order of version. Like AnalyzeLocks, the rules are heuristics based
+// on the shape of the SQL in UpQueries and DownQueries, so migrations with an Up function are
+// only checked for a missing Down. These rules are used:
+//
+//	missing-down          the migration has no Down function or queries
+//	index-not-concurrent  a PostgreSQL index is created on an existing table
+//	                      without CONCURRENTLY
+//	column-type-change    a column's type is changed in place
+//	missing-primary-key   a table is created without a primary key
+//	down-fk-order         a table is dropped by DownQueries before a table
+//	                      with a foreign key to it, which the UpQueries
+//	                      created
+//
+// Any additional rules are checked after the built-in rules for each
+// migration. The findings are intended to be reported by CI, such as with the
+// -lint flag registered by RunConfig.
+func Lint(dialect Dialect, migrations []Migration, rules ...LintRule) []LintFinding {
+	rules = append(lintRules[:len(lintRules):len(lintRules)], rules...)
+	var findings []LintFinding
+	for i, m := range migrations {
+		for _, r := range rules {
+			for _, f := range r.Check(dialect, m) {
+				f.Version, f.Rule = i+1, r.Name()
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings
+}
+
+// lintError is returned by runResult when the migrations have findings.
+func lintError(findings []LintFinding) error {
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = f.String()
+	}
+	return fmt.Errorf("migrations have %d lint findings: %s", len(findings), strings.Join(lines, "; "))
+}
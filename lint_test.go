@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	migrations := []Migration{
+		{
+			UpQueries: []string{
+				"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+				"CREATE INDEX users_name ON users (name)",
+				"CREATE TABLE events (name TEXT)",
+				"CREATE TEMPORARY TABLE scratch (name TEXT)",
+			},
+			DownQueries: []string{"DROP TABLE events", "DROP TABLE users"},
+		},
+		{
+			UpQueries: []string{
+				"CREATE INDEX events_name ON events (name)",
+				"CREATE INDEX CONCURRENTLY users_id ON users (id)",
+				"ALTER TABLE users ALTER COLUMN name TYPE VARCHAR(100)",
+			},
+		},
+		{Up: func(ctx context.Context, db *sql.DB) error { return nil }},
+	}
+	expected := []LintFinding{
+		{Version: 1, Rule: "missing-primary-key", Query: "CREATE TABLE events (name TEXT)", Message: "table events has no primary key"},
+		{Version: 2, Rule: "missing-down", Message: "migration has no Down function or queries, so it can't be reverted"},
+		{
+			Version: 2, Rule: "index-not-concurrent", Query: "CREATE INDEX events_name ON events (name)",
+			Message: "creating an index on events without CONCURRENTLY blocks writes until it finishes",
+		},
+		{
+			Version: 2, Rule: "column-type-change", Query: "ALTER TABLE users ALTER COLUMN name TYPE VARCHAR(100)",
+			Message: "changing a column type on users may rewrite the table, and implicit conversions can change or reject existing values",
+		},
+		{Version: 3, Rule: "missing-down", Message: "migration has no Down function or queries, so it can't be reverted"},
+	}
+	if findings := Lint(DialectPostgreSQL, migrations); !reflect.DeepEqual(findings, expected) {
+		t.Errorf("expected findings:\n%v\ngot:\n%v", expected, findings)
+	}
+	if findings := Lint(DialectMySQL, migrations[1:2]); len(findings) != 2 {
+		t.Errorf("expected concurrent index findings to be PostgreSQL only, got %v", findings)
+	}
+}
+
+func TestLintDownFKOrder(t *testing.T) {
+	migrations := []Migration{
+		{
+			UpQueries: []string{
+				"CREATE TABLE users (id INT PRIMARY KEY, manager_id INT REFERENCES users (id))",
+				"CREATE TABLE teams (id INT PRIMARY KEY)",
+				"CREATE TABLE memberships (id INT PRIMARY KEY, user_id INT REFERENCES users, team_id INT REFERENCES teams (id))",
+				"CREATE TABLE invites (id INT PRIMARY KEY)",
+				"ALTER TABLE invites ADD FOREIGN KEY (team_id) REFERENCES teams (id)",
+			},
+			DownQueries: []string{
+				"DROP TABLE users;",
+				"DROP TABLE teams, memberships",
+				"DROP TABLE invites",
+			},
+		},
+		{
+			UpQueries: []string{
+				"CREATE TABLE orgs (id INT PRIMARY KEY)",
+				"CREATE TABLE projects (id INT PRIMARY KEY, org_id INT REFERENCES orgs)",
+				"CREATE TABLE repos (id INT PRIMARY KEY, org_id INT REFERENCES orgs)",
+			},
+			DownQueries: []string{
+				"ALTER TABLE repos DROP CONSTRAINT repos_org_id_fkey",
+				"DROP TABLE orgs",
+				"DROP TABLE projects",
+				"DROP TABLE repos",
+			},
+		},
+	}
+	expected := []LintFinding{
+		{
+			Version: 1, Rule: "down-fk-order", Query: "DROP TABLE users;",
+			Message: "table is dropped before the tables with foreign keys that reference it: memberships (references users)",
+		},
+		{
+			Version: 1, Rule: "down-fk-order", Query: "DROP TABLE teams, memberships",
+			Message: "table is dropped before the tables with foreign keys that reference it: invites (references teams)",
+		},
+		{
+			Version: 2, Rule: "down-fk-order", Query: "DROP TABLE orgs",
+			Message: "table is dropped before the tables with foreign keys that reference it: projects (references orgs)",
+		},
+	}
+	if findings := Lint(DialectPostgreSQL, migrations); !reflect.DeepEqual(findings, expected) {
+		t.Errorf("expected findings:\n%v\ngot:\n%v", expected, findings)
+	}
+
+	migrations[1].DownQueries = []string{"DROP TABLE IF EXISTS orgs CASCADE"}
+	if findings := Lint(DialectPostgreSQL, migrations[1:]); findings != nil {
+		t.Errorf("expected CASCADE not to be reported, got %v", findings)
+	}
+}
+
+func TestRunLint(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+	}
+	var out bytes.Buffer
+	if code := run(ctx, RunConfig{Migrator: m, Lint: true, Output: &out}); code != ExitLintFailed {
+		t.Errorf("expected exit code %d, got %d", ExitLintFailed, code)
+	}
+	expected := `{"status":"failed","from_version":0,"to_version":0,` +
+		`"error":"migrations have 1 lint findings: version 1: missing-down: migration has no Down function or queries, so it can't be reverted",` +
+		`"findings":[{"version":1,"rule":"missing-down","message":"migration has no Down function or queries, so it can't be reverted"}],"exit_code":6}` + "\n"
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+	if len(md.ExecLogs) != 0 || len(md.QueryLogs) != 0 {
+		t.Error("expected no queries to be run")
+	}
+
+	m.Migrations[0].DownQueries = []string{"example down query"}
+	if code := run(ctx, RunConfig{Migrator: m, Lint: true, Output: &out}); code != ExitOK {
+		t.Errorf("expected exit code %d, got %d", ExitOK, code)
+	}
+}
+
+func TestLintCustomRule(t *testing.T) {
+	rule := NewLintRule("require-comment", func(dialect Dialect, m Migration) []LintFinding {
+		if m.Comment != "" {
+			return nil
+		}
+		return []LintFinding{{Message: "migration has no comment"}}
+	})
+	migrations := []Migration{
+		{Comment: "example comment", UpQueries: []string{"example query"}, DownQueries: []string{"example query"}},
+		{UpQueries: []string{"example query"}, DownQueries: []string{"example query"}},
+	}
+	expected := []LintFinding{{Version: 2, Rule: "require-comment", Message: "migration has no comment"}}
+	if findings := Lint(DialectPostgreSQL, migrations, rule); !reflect.DeepEqual(findings, expected) {
+		t.Errorf("expected findings %v, got %v", expected, findings)
+	}
+	if findings := Lint(DialectPostgreSQL, migrations); findings != nil {
+		t.Errorf("expected no findings without the rule, got %v", findings)
+	}
+	if len(lintRules) != 5 {
+		t.Errorf("expected the built-in rules not to be modified, got %d rules", len(lintRules))
+	}
+
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+	m := &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf), Migrations: migrations}
+	result := runResult(ctx, RunConfig{Migrator: m, Lint: true, LintRules: []LintRule{rule}})
+	if result.ExitCode != ExitLintFailed || !reflect.DeepEqual(result.Findings, expected) {
+		t.Errorf("expected the run to fail with findings %v, got %#v", expected, result)
+	}
+}
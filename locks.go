@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LockWarning describes a query that is likely to hold a lock that blocks
+// reads or writes on a table while it runs. These are usually fine on small
+// tables, but can cause an outage on large, busy ones.
+type LockWarning struct {
+	// Query is the SQL query that triggered the warning.
+	Query string `json:"query"`
+
+	// Table is the name of the affected table, if it could be determined.
+	Table string `json:"table,omitempty"`
+
+	// Lock describes the lock the query is expected to take, such as
+	// "ACCESS EXCLUSIVE" for PostgreSQL or "COPY" for a MySQL ALTER that
+	// copies the table.
+	Lock string `json:"lock"`
+
+	// Reason explains why the query is risky.
+	Reason string `json:"reason"`
+}
+
+// String returns a one line description of the warning.
+func (w LockWarning) String() string {
+	if w.Table == "" {
+		return fmt.Sprintf("%s lock: %s", w.Lock, w.Reason)
+	}
+	return fmt.Sprintf("%s lock on %s: %s", w.Lock, w.Table, w.Reason)
+}
+
+// lockRule matches a query against a pattern and produces a warning for it.
+// If safe is set and also matches the query, the query is safe, and none of
+// the later rules are checked for it.
+type lockRule struct {
+	pattern *regexp.Regexp
+	safe    *regexp.Regexp
+	lock    string
+	reason  string
+}
+
+const tableName = `(?:IF (?:NOT )?EXISTS )?(?:ONLY )?([^\s(]+)`
+
+var postgresLockRules = []lockRule{
+	{
+		pattern: regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*ALTER (?:COLUMN )?\S+ (?:SET DATA )?TYPE `),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "changing a column type may rewrite the table, blocking reads and writes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*SET NOT NULL`),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "SET NOT NULL scans the whole table, blocking reads and writes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*ADD (?:CONSTRAINT \S+ )?(?:FOREIGN KEY|CHECK|UNIQUE|PRIMARY KEY)`),
+		safe:    regexp.MustCompile(`(?i)NOT VALID`),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "adding a constraint without NOT VALID scans the whole table, blocking reads and writes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` `),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "ALTER TABLE waits for and then blocks all queries on the table",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (?:\S+ )?(?:IF NOT EXISTS \S+ )?ON (?:ONLY )?([^\s(]+)`),
+		safe:    regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX CONCURRENTLY `),
+		lock:    "SHARE",
+		reason:  "creating an index without CONCURRENTLY blocks writes until it finishes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^REINDEX (?:TABLE|INDEX) ([^\s(]+)`),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "REINDEX without CONCURRENTLY blocks writes until it finishes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^(?:DROP TABLE|TRUNCATE(?: TABLE)?) ` + tableName),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "this waits for and then blocks all queries on the table",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^(?:VACUUM FULL|CLUSTER)(?: ([^\s(]+))?`),
+		lock:    "ACCESS EXCLUSIVE",
+		reason:  "this rewrites the table, blocking reads and writes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^LOCK (?:TABLE )?` + tableName),
+		lock:    "EXPLICIT",
+		reason:  "the table is explicitly locked",
+	},
+}
+
+var mysqlLockRules = []lockRule{
+	{
+		pattern: regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*ALGORITHM\s*=\s*COPY`),
+		lock:    "COPY",
+		reason:  "ALGORITHM=COPY copies the table, blocking writes until it finishes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName + ` .*(?:MODIFY |CHANGE |CONVERT TO CHARACTER SET|ENGINE\s*=|(?:ADD|DROP) PRIMARY KEY)`),
+		safe:    regexp.MustCompile(`(?i)ALGORITHM\s*=\s*(?:INPLACE|INSTANT)`),
+		lock:    "COPY",
+		reason:  "this ALTER usually copies the table, blocking writes until it finishes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^(?:ALTER TABLE ` + tableName + ` .*ADD |CREATE )(?:FULLTEXT|SPATIAL) (?:INDEX|KEY)`),
+		lock:    "SHARED",
+		reason:  "adding a FULLTEXT or SPATIAL index blocks writes until it finishes",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^OPTIMIZE (?:NO_WRITE_TO_BINLOG |LOCAL )?TABLE ([^\s,]+)`),
+		lock:    "COPY",
+		reason:  "OPTIMIZE TABLE rebuilds the table",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)^LOCK TABLES? ([^\s,]+)`),
+		lock:    "EXPLICIT",
+		reason:  "the table is explicitly locked",
+	},
+}
+
+// AnalyzeLocks examines SQL queries and returns warnings for any that are
+// likely to hold locks that block access to a table for the dialect. This is
+// a heuristic based on the shape of the SQL, so it can't know how large a
+// table is or how long a lock will actually be held, but it's useful for
+// flagging changes that deserve a closer look in review.
+//
+// Only DialectPostgreSQL and DialectMySQL are analyzed. SQLite locks the
+// whole database for any write, so there is nothing useful to report.
+func AnalyzeLocks(dialect Dialect, queries []string) []LockWarning {
+	var rules []lockRule
+	switch dialect {
+	case DialectPostgreSQL:
+		rules = postgresLockRules
+	case DialectMySQL:
+		rules = mysqlLockRules
+	default:
+		return nil
+	}
+	var warnings []LockWarning
+	for _, q := range queries {
+		nq := normalizeQuery(q)
+		for _, r := range rules {
+			m := r.pattern.FindStringSubmatch(nq)
+			if m == nil {
+				continue
+			}
+			if r.safe != nil && r.safe.MatchString(nq) {
+				break
+			}
+			w := LockWarning{Query: q, Lock: r.lock, Reason: r.reason}
+			if len(m) > 1 {
+				w.Table = m[1]
+			}
+			warnings = append(warnings, w)
+			break
+		}
+	}
+	return warnings
+}
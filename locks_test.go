@@ -0,0 +1,52 @@
+package migrate
+
+import "testing"
+
+func TestAnalyzeLocks(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Dialect Dialect
+		Query   string
+		Table   string
+		Lock    string
+	}{
+		{"PostgreSQL type change", DialectPostgreSQL, "ALTER TABLE users ALTER COLUMN name TYPE TEXT", "users", "ACCESS EXCLUSIVE"},
+		{"PostgreSQL add column", DialectPostgreSQL, "alter table users add column age int", "users", "ACCESS EXCLUSIVE"},
+		{"PostgreSQL index", DialectPostgreSQL, "CREATE INDEX users_name ON users (name)", "users", "SHARE"},
+		{"PostgreSQL concurrent index", DialectPostgreSQL, "CREATE INDEX CONCURRENTLY users_name ON users (name)", "", ""},
+		{"PostgreSQL constraint", DialectPostgreSQL, "ALTER TABLE orders ADD CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES users (id)", "orders", "ACCESS EXCLUSIVE"},
+		{"PostgreSQL constraint not valid", DialectPostgreSQL, "ALTER TABLE orders ADD CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID", "", ""},
+		{"PostgreSQL drop table", DialectPostgreSQL, "DROP TABLE IF EXISTS users", "users", "ACCESS EXCLUSIVE"},
+		{"PostgreSQL create table", DialectPostgreSQL, "CREATE TABLE users (id INT)", "", ""},
+		{"PostgreSQL commented", DialectPostgreSQL, "-- widen the column\nALTER TABLE\n\tusers /* yes */ ALTER name TYPE TEXT;", "users", "ACCESS EXCLUSIVE"},
+		{"MySQL modify", DialectMySQL, "ALTER TABLE `users` MODIFY name TEXT", "`users`", "COPY"},
+		{"MySQL inplace", DialectMySQL, "ALTER TABLE users MODIFY name TEXT, ALGORITHM=INPLACE, LOCK=NONE", "", ""},
+		{"MySQL add column", DialectMySQL, "ALTER TABLE users ADD COLUMN age INT", "", ""},
+		{"MySQL optimize", DialectMySQL, "OPTIMIZE TABLE users", "users", "COPY"},
+		{"SQLite", DialectSQLite, "ALTER TABLE users ADD COLUMN age INT", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			warnings := AnalyzeLocks(tt.Dialect, []string{tt.Query})
+			if tt.Lock == "" {
+				if len(warnings) != 0 {
+					t.Errorf("expected no warnings, got %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 {
+				t.Fatalf("expected 1 warning, got %v", warnings)
+			}
+			w := warnings[0]
+			if w.Query != tt.Query {
+				t.Errorf("expected Query to be %q, got %q", tt.Query, w.Query)
+			}
+			if w.Table != tt.Table {
+				t.Errorf("expected Table to be %q, got %q", tt.Table, w.Table)
+			}
+			if w.Lock != tt.Lock {
+				t.Errorf("expected Lock to be %q, got %q", tt.Lock, w.Lock)
+			}
+		})
+	}
+}
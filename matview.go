@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// MaterializedView declares a PostgreSQL materialized view to be refreshed
+// by RefreshMaterializedViews.
+type MaterializedView struct {
+	// Name is the name of the view.
+	Name string
+
+	// DependsOn are the names of the other materialized views that this one
+	// selects from, which are refreshed before it. Names that aren't
+	// declared, like regular tables, are ignored.
+	DependsOn []string
+
+	// Concurrent refreshes the view without blocking queries that read it.
+	// The view must have a unique index, and must have been populated
+	// before.
+	Concurrent bool
+}
+
+// RefreshMaterializedViews returns a migration function that refreshes
+// materialized views in dependency order, so each view is refreshed after
+// the views it selects from. Views that don't depend on each other are
+// refreshed in the order they're declared.
+//
+// It's meant to be used as the Up of a migration in PhasePostDeploy, after
+// the migrations that change the tables the views select from. Since
+// concurrent refreshes can't be run inside a transaction, migrations that
+// use it with Concurrent views can't be run by Prepare. It's only supported
+// for DialectPostgreSQL.
+func RefreshMaterializedViews(views ...MaterializedView) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		if d := dialectFromContext(ctx); d != DialectPostgreSQL {
+			return fmt.Errorf("materialized views are not supported for dialect %q", d)
+		}
+		ordered, err := sortMaterializedViews(views)
+		if err != nil {
+			return err
+		}
+		queries := make([]string, len(ordered))
+		for i, v := range ordered {
+			if v.Concurrent {
+				queries[i] = fmt.Sprintf("REFRESH MATERIALIZED VIEW CONCURRENTLY %s", v.Name)
+			} else {
+				queries[i] = fmt.Sprintf("REFRESH MATERIALIZED VIEW %s", v.Name)
+			}
+		}
+		return ExecQueries(queries)(ctx, db)
+	}
+}
+
+// sortMaterializedViews returns the views ordered so that each one comes
+// after the views it depends on, keeping the declared order otherwise. It
+// returns an error if the dependencies have a cycle.
+func sortMaterializedViews(views []MaterializedView) ([]MaterializedView, error) {
+	declared := map[string]bool{}
+	for _, v := range views {
+		if declared[v.Name] {
+			return nil, fmt.Errorf("materialized view %s is declared more than once", v.Name)
+		}
+		declared[v.Name] = true
+	}
+	done := map[string]bool{}
+	var ordered []MaterializedView
+	for len(ordered) < len(views) {
+		progressed := false
+		for _, v := range views {
+			if done[v.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range v.DependsOn {
+				if declared[dep] && !done[dep] && dep != v.Name {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, v)
+				done[v.Name] = true
+				progressed = true
+			}
+		}
+		if !progressed {
+			var cycle []string
+			for _, v := range views {
+				if !done[v.Name] {
+					cycle = append(cycle, v.Name)
+				}
+			}
+			return nil, fmt.Errorf("materialized views have a dependency cycle: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
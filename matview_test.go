@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRefreshMaterializedViews(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{
+			Comment: "refresh views",
+			Up: RefreshMaterializedViews(
+				MaterializedView{Name: "monthly_revenue", DependsOn: []string{"daily_revenue"}, Concurrent: true},
+				MaterializedView{Name: "daily_revenue", DependsOn: []string{"orders"}},
+				MaterializedView{Name: "top_customers", DependsOn: []string{"orders"}, Concurrent: true},
+			),
+		}},
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var actual []string
+	for _, l := range md.ExecLogs {
+		if i := strings.Index(l.Query, "REFRESH "); i >= 0 {
+			actual = append(actual, l.Query[i:])
+		}
+	}
+	expected := []string{
+		"REFRESH MATERIALIZED VIEW daily_revenue",
+		"REFRESH MATERIALIZED VIEW CONCURRENTLY top_customers",
+		"REFRESH MATERIALIZED VIEW CONCURRENTLY monthly_revenue",
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected refreshes %q, got %q", expected, actual)
+	}
+
+	m.Adapter = NewMySQLAdapter(t.Logf)
+	md.Reset()
+	expectedErr := `materialized views are not supported for dialect "mysql"`
+	if err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestSortMaterializedViewsCycle(t *testing.T) {
+	_, err := sortMaterializedViews([]MaterializedView{
+		{Name: "a", DependsOn: []string{"c"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c", DependsOn: []string{"b"}},
+		{Name: "d", DependsOn: []string{"d"}},
+	})
+	expected := "materialized views have a dependency cycle: a, b, c"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
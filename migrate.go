@@ -17,26 +17,175 @@ type MigrationFunc func(ctx context.Context, db *sql.DB) error
 // to migrate from the previous version to this version, and the Down function
 // can be run to go back the other way. The Comment is inserted into the
 // schema_versions table after migrating to this version.
+//
+// Simple SQL migrations can use UpQueries and DownQueries instead of Up and
+// Down. This has the same effect as using ExecQueries, but it also allows
+// helpers like AnalyzeLocks to inspect the SQL for the migration.
 type Migration struct {
+	// Version is the version number of the migration. It can be left as zero
+	// for migrations passed to Up, where the position in the slice determines
+	// the version, but it's required for migrations added to a Set.
+	Version int
+
 	// Comment should be a string describing the migration.
 	Comment string
 
+	// Description is an optional longer explanation of the migration, such
+	// as why it's needed and what's safe to do if it has to be reverted.
+	// It's included in plans and changelogs, but not in the version table.
+	// FSLoader reads it from the comment at the top of the up file.
+	Description string
+
 	// Up should be a function to apply the migration.
 	Up MigrationFunc
 
 	// Down should be a function to revert the migration.
 	Down MigrationFunc
+
+	// UpQueries are SQL queries to apply the migration. They're only used if
+	// Up is nil.
+	UpQueries []string
+
+	// DownQueries are SQL queries to revert the migration. They're only used
+	// if Down is nil.
+	DownQueries []string
+
+	// Cleanup is an optional function that's called if Up fails, to undo any
+	// work it did before failing, so the migration can be safely retried.
+	// This is useful for databases like MySQL, where DDL isn't transactional
+	// and a failed migration can leave some of its changes behind. It should
+	// be written defensively, since it doesn't know how far Up got, such as
+	// by using IF EXISTS. Errors returned by Cleanup are logged, and the
+	// error from Up is returned. It's not called by Prepare, since the
+	// transaction is rolled back instead.
+	Cleanup MigrationFunc
+
+	// Independent marks the migration as not depending on the migrations
+	// next to it, such as one that creates an unrelated table. If the
+	// Migrator's Parallelism is set, runs of adjacent independent migrations
+	// are applied concurrently, which can speed up creating a new database
+	// with a long history. Independent migrations must be safe to run on
+	// separate connections at the same time.
+	Independent bool
+
+	// Priority orders the migrations in a run of adjacent independent
+	// migrations that are applied concurrently. Migrations with a higher
+	// priority are started first, so cheap schema changes can be started
+	// before expensive index builds when Parallelism limits how many run at
+	// once. Migrations with the same priority are started in version order.
+	// It doesn't change the order the versions are recorded in, so the
+	// history is the same whatever the priorities are.
+	Priority int
+
+	// Team is the component or team that owns the migration. It's recorded
+	// in the version table if the adapter's TeamColumn is set, so platform
+	// teams can attribute schema changes with SummarizeTeams.
+	Team string
+
+	// Checkpoints are the steps used to apply the migration, if Up and
+	// UpQueries are nil. This is intended for long running migrations like
+	// backfills. Each step is committed in its own transaction, and if the
+	// adapter implements CheckpointRecorder, its progress is recorded in the
+	// same transaction. If the migration fails, or the process is restarted
+	// while it's running, the steps that were committed are skipped the next
+	// time it's applied. Each step should leave the database in a state that
+	// the following steps and the Down function can handle. Migrations with
+	// Checkpoints can't be run by Prepare.
+	Checkpoints []CheckpointFunc
+
+	// AnalyzeTables are the tables the migration changes enough that their
+	// statistics should be refreshed afterward, such as tables that were
+	// backfilled or had indexes added. They're only analyzed if the
+	// Migrator's Analyze option is set.
+	AnalyzeTables []string
+
+	// Phase is the stage of a deploy that the migration should be applied
+	// in. It defaults to PhasePreDeploy. Up only applies pre-deploy
+	// migrations, so PhasePostDeploy migrations must be applied with
+	// UpPhase, or with an explicit target version.
+	Phase Phase
+
+	// Signature is an Ed25519 signature of the migration's version and
+	// Checksum, as generated by SignMigrations. It's required for every
+	// migration if the Migrator's VerifyKey is set.
+	Signature []byte
+}
+
+// up returns the function used to apply the migration.
+func (m Migration) up() MigrationFunc {
+	if m.Up != nil {
+		return m.Up
+	}
+	if m.UpQueries == nil {
+		return missingFunc("Up")
+	}
+	return ExecQueries(m.UpQueries)
+}
+
+// down returns the function used to revert the migration.
+func (m Migration) down() MigrationFunc {
+	if m.Down != nil {
+		return m.Down
+	}
+	if m.DownQueries == nil {
+		return missingFunc("Down")
+	}
+	return ExecQueries(m.DownQueries)
+}
+
+// missingFunc returns a migration function that always fails, for migrations
+// that don't specify a function or queries.
+func missingFunc(name string) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		return fmt.Errorf("migration has no %s function or queries", name)
+	}
 }
 
 // ExecQueries generates a migration function from a list of SQL queries.
 // Running the returned function will execute each of the SQL queries as its
-// migration step.
+// migration step. Queries are passed through any rewriters registered on the
+// context with WithRewriter before they are executed.
+//
+// When the function is run by UpToVersion or DownToVersion, each query is
+// prefixed with a comment identifying the migration version and comment.
+// This can be disabled with WithoutQueryComments.
 func ExecQueries(queries []string) MigrationFunc {
 	return func(ctx context.Context, db *sql.DB) error {
 		for i, q := range queries {
+			q = rewriteQuery(ctx, q)
+			logQuery(ctx, q, nil)
 			_, err := db.ExecContext(ctx, q)
 			if err != nil {
-				return fmt.Errorf("error with query %d: %s", i, err)
+				return fmt.Errorf("error with query %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Query is a SQL query with arguments, for use with ExecQueriesWithArgs.
+type Query struct {
+	// SQL is the query to execute.
+	SQL string
+
+	// Args are the values to bind to the placeholders in SQL.
+	Args []interface{}
+}
+
+// ExecQueriesWithArgs is like ExecQueries, but each query is executed with
+// arguments bound to its placeholders. This lets migrations use values like
+// environment-specific IDs without interpolating them into the SQL. The
+// placeholders must use the syntax of the database driver, like ? for MySQL
+// or $1 for PostgreSQL, unless RewritePlaceholders is registered to translate
+// them.
+func ExecQueriesWithArgs(queries []Query) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		for i, q := range queries {
+			s := rewriteQuery(ctx, q.SQL)
+			logQuery(ctx, s, q.Args)
+			_, err := db.ExecContext(ctx, s, q.Args...)
+			if err != nil {
+				return fmt.Errorf("error with query %d: %w", i, err)
 			}
 		}
 		return nil
@@ -44,38 +193,38 @@ func ExecQueries(queries []string) MigrationFunc {
 }
 
 // Up upgrades the given database to the latest migration in the list
-// of passed migrations.
+// of passed migrations. It stops before any migrations in PhasePostDeploy.
 func Up(ctx context.Context, db *sql.DB, adapter Adapter, migrations []Migration) error {
-	return UpToVersion(ctx, db, adapter, len(migrations), migrations)
+	m := &Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	return m.Up(ctx)
 }
 
-// UpToVersion migrates the database to the specified version.
-func UpToVersion(ctx context.Context, db *sql.DB, adapter Adapter, targetVersion int, migrations []Migration) error {
+// queryCurrentVersion prepares the schema versions and returns the current
+// version of the database.
+func queryCurrentVersion(ctx context.Context, db *sql.DB, adapter Adapter) (int, error) {
+	recordReplay(ctx, ReplayEvent{Kind: ReplayPrepare})
 	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
-		return fmt.Errorf("error preparing schema versions: %s", err)
+		return 0, fmt.Errorf("error preparing schema versions: %w", err)
 	}
+	return querySchemaVersion(ctx, db, adapter)
+}
+
+// querySchemaVersion returns the current version of the database, without
+// preparing the schema versions.
+func querySchemaVersion(ctx context.Context, db *sql.DB, adapter Adapter) (int, error) {
 	currentVersion, err := adapter.QuerySchemaVersion(ctx, db)
 	if err != nil {
-		return fmt.Errorf("error querying current schema version: %s", err)
+		return 0, fmt.Errorf("error querying current schema version: %w", err)
 	}
 	adapter.Log("Current database version is %d", currentVersion)
-	for i, m := range migrations {
-		version := i + 1
-		if version <= currentVersion {
-			continue
-		}
-		if version > targetVersion {
-			break
-		}
-		adapter.Log("Upgrading database to version %d", version)
-		if err := m.Up(ctx, db); err != nil {
-			return fmt.Errorf("error upgrading database to version %d: %s", version, err)
-		}
-		if err := adapter.InsertSchemaVersion(ctx, db, version, true, m.Comment); err != nil {
-			return fmt.Errorf("error inserting schema version for version %d: %s", version, err)
-		}
-	}
-	return nil
+	recordReplay(ctx, ReplayEvent{Kind: ReplayQueryVersion, Version: currentVersion})
+	return currentVersion, nil
+}
+
+// UpToVersion migrates the database to the specified version.
+func UpToVersion(ctx context.Context, db *sql.DB, adapter Adapter, targetVersion int, migrations []Migration) error {
+	m := &Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	return m.UpToVersion(ctx, targetVersion)
 }
 
 // DownToVersion migrates the database down to the specified version. This is
@@ -83,30 +232,6 @@ func UpToVersion(ctx context.Context, db *sql.DB, adapter Adapter, targetVersion
 // separate function makes it slightly more difficult to unintentionally
 // downgrade (e.g. by passing an incorrect target version).
 func DownToVersion(ctx context.Context, db *sql.DB, adapter Adapter, targetVersion int, migrations []Migration) error {
-	if err := adapter.PrepareSchemaVersions(ctx, db); err != nil {
-		return fmt.Errorf("error preparing schema versions: %s", err)
-	}
-	currentVersion, err := adapter.QuerySchemaVersion(ctx, db)
-	if err != nil {
-		return fmt.Errorf("error querying current schema version: %s", err)
-	}
-	adapter.Log("Current database version is %d", currentVersion)
-	for i := len(migrations) - 1; i >= 0; i-- {
-		m := migrations[i]
-		version := i + 1
-		if version > currentVersion {
-			continue
-		}
-		if version <= targetVersion {
-			break
-		}
-		adapter.Log("Downgrading database to version %d", version)
-		if err := m.Down(ctx, db); err != nil {
-			return fmt.Errorf("error upgrading database to version %d: %s", version, err)
-		}
-		if err := adapter.InsertSchemaVersion(ctx, db, version, false, m.Comment); err != nil {
-			return fmt.Errorf("error inserting schema_versions row for version %d: %s", version, err)
-		}
-	}
-	return nil
+	m := &Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	return m.DownToVersion(ctx, targetVersion)
 }
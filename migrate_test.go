@@ -60,6 +60,32 @@ func TestExecQueriesError(t *testing.T) {
 	md.Check(t, MockData{})
 }
 
+func TestExecQueriesWithArgs(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	queries := []Query{
+		{SQL: "example query 1 $1 $2", Args: []interface{}{"a", 2}},
+		{SQL: "example query 2"},
+	}
+	err := ExecQueriesWithArgs(queries)(ctx, db)
+	if err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs: []MockQueryLog{
+			{
+				Query: queries[0].SQL,
+				Args: []driver.NamedValue{
+					{Ordinal: 1, Value: "a"},
+					{Ordinal: 2, Value: int64(2)},
+				},
+			},
+			{Query: queries[1].SQL},
+		},
+	})
+}
+
 // This is kind of a long test, but mostly because of the expected value
 // comparisons. It applies the migrations once, where the second migration
 // fails, then runs them again. This is used to validate error handling and
@@ -242,3 +268,69 @@ func TestDown(t *testing.T) {
 		t.Errorf("expected down to be %v, got %v", expectedDown, down)
 	}
 }
+
+func TestUpQueries(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	migrations := []Migration{
+		{
+			Comment:     "example comment",
+			UpQueries:   []string{"example up query"},
+			DownQueries: []string{"example down query"},
+		},
+	}
+	adapter := NewSQLiteAdapter(t.Logf)
+	if err := Up(ctx, db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || md.ExecLogs[1].Query != "/* migrate: v1 example comment */ example up query" {
+		t.Errorf("expected up query to be executed, got %#v", md.ExecLogs)
+	}
+
+	md.Reset()
+	md.QueryRows.Version = 1
+	if err := DownToVersion(ctx, db, adapter, 0, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || md.ExecLogs[1].Query != "/* migrate: v1 example comment */ example down query" {
+		t.Errorf("expected down query to be executed, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMissingDown(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 1
+	migrations := []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}}
+	err := DownToVersion(ctx, db, NewSQLiteAdapter(t.Logf), 0, migrations)
+	expectedErr := errors.New("error downgrading database to version 1: migration has no Down function or queries")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	migrations := []Migration{{
+		Comment: "example comment",
+		Up: func(ctx context.Context, db *sql.DB) error {
+			if _, err := db.ExecContext(ctx, "example query"); err != nil {
+				return err
+			}
+			return errors.New("mock error")
+		},
+		Cleanup: ExecQueries([]string{"example cleanup query"}),
+	}}
+	err := Up(WithoutQueryComments(ctx), db, NewSQLiteAdapter(t.Logf), migrations)
+	expectedErr := errors.New("error upgrading database to version 1: mock error")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	if len(md.ExecLogs) != 3 || md.ExecLogs[2].Query != "example cleanup query" {
+		t.Errorf("expected cleanup query to be executed, got %#v", md.ExecLogs)
+	}
+}
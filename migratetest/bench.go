@@ -0,0 +1,96 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noonat/migrate"
+)
+
+// StepTiming is how long a migration took to apply.
+type StepTiming struct {
+	// Version is the version of the migration.
+	Version int
+
+	// Comment is the comment for the migration.
+	Comment string
+
+	// Duration is how long it took to apply the migration and record its
+	// version.
+	Duration time.Duration
+}
+
+// TimeMigrations applies the pending migrations to the database one at a
+// time, and returns how long each one took. It's useful for failing a CI
+// job when a migration is too slow against a seeded copy of the data.
+func TimeMigrations(ctx context.Context, db *sql.DB, adapter migrate.Adapter, migrations []migrate.Migration) ([]StepTiming, error) {
+	m := &migrate.Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	var timings []StepTiming
+	for i, mi := range migrations {
+		start := time.Now()
+		if err := m.UpToVersion(ctx, i+1); err != nil {
+			return timings, err
+		}
+		timings = append(timings, StepTiming{Version: i + 1, Comment: mi.Comment, Duration: time.Since(start)})
+	}
+	return timings, nil
+}
+
+// BenchmarkMigrations runs a sub-benchmark for each migration, which times
+// applying it to the database, so slow migrations can be found before they
+// run against production. The database should be at version zero, and
+// seeded with enough data for the timings to be meaningful.
+//
+// Each iteration applies the migration, and then reverts it with its Down
+// function or queries without timing it, so the migration can be repeated.
+// Migrations without a Down are applied once, and their duration is logged
+// instead. After each sub-benchmark, the migration is applied so that the
+// next one can run.
+func BenchmarkMigrations(b *testing.B, db *sql.DB, adapter migrate.Adapter, migrations []migrate.Migration) {
+	ctx := context.Background()
+	m := &migrate.Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	for i, mi := range migrations {
+		version := i + 1
+		if mi.Down == nil && mi.DownQueries == nil {
+			start := time.Now()
+			if err := m.UpToVersion(ctx, version); err != nil {
+				b.Fatal(err)
+			}
+			b.Logf("version %d has no Down, so it was applied once in %s", version, time.Since(start))
+			continue
+		}
+		b.Run(benchmarkName(version, mi.Comment), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if err := m.UpToVersion(ctx, version); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if err := m.DownToVersion(ctx, version-1); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+		if err := m.UpToVersion(ctx, version); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkName returns the name of the sub-benchmark for a migration.
+func benchmarkName(version int, comment string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '/' {
+			return '_'
+		}
+		return r
+	}, comment)
+	if name == "" {
+		return fmt.Sprintf("v%d", version)
+	}
+	return fmt.Sprintf("v%d_%s", version, name)
+}
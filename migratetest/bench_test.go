@@ -0,0 +1,49 @@
+package migratetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/noonat/migrate"
+)
+
+func TestTimeMigrations(t *testing.T) {
+	db, err := OpenFaultDB("migratetest_stub", "", &Faults{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	migrations := []migrate.Migration{
+		{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+		{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+	}
+	timings, err := TimeMigrations(context.Background(), db, migrate.NewSQLiteAdapter(t.Logf), migrations)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(timings) != 2 || timings[1].Version != 2 || timings[1].Comment != "example comment 2" {
+		t.Errorf("unexpected timings %#v", timings)
+	}
+}
+
+func TestBenchmarkName(t *testing.T) {
+	if name := benchmarkName(3, "add users/apps index"); name != "v3_add_users_apps_index" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if name := benchmarkName(3, ""); name != "v3" {
+		t.Errorf("unexpected name %q", name)
+	}
+}
+
+func BenchmarkMigrationsStub(b *testing.B) {
+	db, err := OpenFaultDB("migratetest_stub", "", &Faults{})
+	if err != nil {
+		b.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	BenchmarkMigrations(b, db, migrate.NewSQLiteAdapter(b.Logf), []migrate.Migration{
+		{Comment: "example comment", UpQueries: []string{"example query 1"}, DownQueries: []string{"example query 2"}},
+	})
+}
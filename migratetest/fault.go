@@ -0,0 +1,279 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrInjected is returned for faults injected by a database opened with
+// OpenFaultDB, unless Faults.Err is set.
+var ErrInjected = errors.New("migratetest: injected fault")
+
+// Faults configures the failures injected into a database opened with
+// OpenFaultDB, so tests can check how an application behaves when migrations
+// fail partway through. The fields can be changed between runs, and are
+// safe to use concurrently with the database.
+type Faults struct {
+	// FailExec fails the Nth statement executed on the database, counting
+	// from 1, or none if it's zero. Statements are counted across every
+	// connection, and queries that return rows aren't counted.
+	FailExec int
+
+	// FailInsertInto fails every INSERT into the named table. Set it to the
+	// table name of a TableAdapter to fail when the version row for a
+	// migration is inserted, after the migration itself has run.
+	FailInsertInto string
+
+	// FailCommit fails every commit, including transactions committed with
+	// a COMMIT statement, like the one used by Migrator.Prepare.
+	FailCommit bool
+
+	// Err is the error returned for the injected faults. It defaults to
+	// ErrInjected.
+	Err error
+
+	mu    sync.Mutex
+	execs int
+}
+
+// Execs returns the number of statements that have been executed, including
+// the ones that failed.
+func (f *Faults) Execs() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.execs
+}
+
+// Reset resets the count of executed statements.
+func (f *Faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execs = 0
+}
+
+func (f *Faults) err() error {
+	if f.Err != nil {
+		return f.Err
+	}
+	return ErrInjected
+}
+
+// exec counts a statement and returns an error if it should fail.
+func (f *Faults) exec(query string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execs++
+	switch {
+	case f.FailExec > 0 && f.execs == f.FailExec:
+		return f.err()
+	case f.FailInsertInto != "" && insertRegexp(f.FailInsertInto).MatchString(query):
+		return f.err()
+	case f.FailCommit && strings.EqualFold(strings.TrimRight(strings.TrimSpace(query), ";"), "COMMIT"):
+		return f.err()
+	}
+	return nil
+}
+
+// commit returns an error if commits should fail.
+func (f *Faults) commit() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.FailCommit {
+		return f.err()
+	}
+	return nil
+}
+
+func insertRegexp(table string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\bINSERT\s+INTO\s+` + regexp.QuoteMeta(table) + `[\s(]`)
+}
+
+// OpenFaultDB opens a database like sql.Open, which injects the faults into
+// the statements and transactions run on it.
+func OpenFaultDB(driverName, dataSourceName string, faults *Faults) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+	var c driver.Connector = dsnConnector{driver: d, dsn: dataSourceName}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if c, err = dc.OpenConnector(dataSourceName); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(faultConnector{Connector: c, faults: faults}), nil
+}
+
+// dsnConnector opens connections for drivers that don't implement
+// driver.DriverContext.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// faultConnector wraps the connections it opens with faultConn.
+type faultConnector struct {
+	driver.Connector
+	faults *Faults
+}
+
+func (c faultConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return faultConn{Conn: conn, faults: c.faults}, nil
+}
+
+// faultConn injects faults into a connection. It forwards the optional
+// driver interfaces to the wrapped connection, or returns driver.ErrSkip so
+// database/sql falls back to the default behavior.
+type faultConn struct {
+	driver.Conn
+	faults *Faults
+}
+
+func (c faultConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return faultTx{Tx: tx, faults: c.faults}, nil
+}
+
+func (c faultConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return faultStmt{Stmt: stmt, query: query, faults: c.faults}, nil
+}
+
+func (c faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		// The statement is counted by faultStmt when it's prepared instead.
+		return nil, driver.ErrSkip
+	}
+	if err := c.faults.exec(query); err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c faultConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c faultConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c faultConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// faultTx fails commits if FailCommit is set. The transaction is rolled back
+// when a commit fails, so the database isn't left with an open transaction.
+type faultTx struct {
+	driver.Tx
+	faults *Faults
+}
+
+func (t faultTx) Commit() error {
+	if err := t.faults.commit(); err != nil {
+		t.Tx.Rollback()
+		return err
+	}
+	return t.Tx.Commit()
+}
+
+// faultStmt counts the executions of a prepared statement.
+type faultStmt struct {
+	driver.Stmt
+	query  string
+	faults *Faults
+}
+
+func (s faultStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.faults.exec(s.query); err != nil {
+		return nil, err
+	}
+	return s.Stmt.Exec(args)
+}
+
+func (s faultStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.faults.exec(s.query); err != nil {
+		return nil, err
+	}
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return s.Stmt.Exec(values)
+}
+
+func (s faultStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return s.Stmt.Query(values)
+}
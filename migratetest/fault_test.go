@@ -0,0 +1,99 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/noonat/migrate"
+)
+
+func init() {
+	sql.Register("migratetest_stub", stubDriver{})
+}
+
+// stubDriver is a driver whose statements succeed without doing anything,
+// and whose queries return no rows.
+type stubDriver struct{}
+
+func (stubDriver) Open(name string) (driver.Conn, error) {
+	return stubConn{}, nil
+}
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) { return stubStmt{}, nil }
+func (stubConn) Close() error                              { return nil }
+func (stubConn) Begin() (driver.Tx, error)                 { return stubTx{}, nil }
+
+type stubStmt struct{}
+
+func (stubStmt) Close() error                                    { return nil }
+func (stubStmt) NumInput() int                                   { return -1 }
+func (stubStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (stubStmt) Query(args []driver.Value) (driver.Rows, error)  { return stubRows{}, nil }
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubRows struct{}
+
+func (stubRows) Columns() []string              { return []string{"version"} }
+func (stubRows) Close() error                   { return nil }
+func (stubRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	faults := &Faults{}
+	db, err := OpenFaultDB("migratetest_stub", "", faults)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	adapter := migrate.NewSQLiteAdapter(t.Logf)
+	migrations := []migrate.Migration{
+		{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+		{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+	}
+
+	// The version table is created by the first statement, and then each
+	// migration runs its query and inserts its version.
+	faults.FailExec = 4
+	err = migrate.Up(ctx, db, adapter, migrations)
+	var me *migrate.MigrationError
+	if !errors.Is(err, ErrInjected) || !errors.As(err, &me) || me.Version != 2 {
+		t.Errorf("expected version 2 to fail with ErrInjected, got %v", err)
+	}
+	if n := faults.Execs(); n != 4 {
+		t.Errorf("expected 4 statements, got %d", n)
+	}
+
+	faults.FailExec = 0
+	faults.FailInsertInto = "schema_versions"
+	faults.Err = errors.New("mock error")
+	if err := migrate.Up(ctx, db, adapter, migrations); err == nil || err.Error() != "error inserting schema version for version 1: mock error" {
+		t.Errorf("expected the version insert to fail, got %v", err)
+	}
+
+	faults.FailInsertInto = ""
+	faults.FailCommit = true
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := tx.Exec("example query"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tx.Commit(); err != faults.Err {
+		t.Errorf("expected the commit to fail, got %v", err)
+	}
+	if _, err := db.Exec("COMMIT"); err != faults.Err {
+		t.Errorf("expected a COMMIT statement to fail, got %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// MockData configures the results of the statements run on a database opened
+// with OpenMock, and records them. It lets tests check the SQL that custom
+// adapters and migrations run, including ones that read data, without a real
+// database.
+type MockData struct {
+	// ExecErr is returned by statements, and QueryErr by queries, if they're
+	// set.
+	ExecErr  error
+	QueryErr error
+
+	// ExecLogs and QueryLogs are the statements and queries that were run,
+	// in order.
+	ExecLogs  []MockQueryLog
+	QueryLogs []MockQueryLog
+
+	// QueryResults are the rows returned for queries matching their
+	// patterns. The first matching result is used, and each query gets a
+	// copy of its Rows, so the same result can be read more than once.
+	QueryResults []MockQueryResult
+
+	// QueryRows are returned by queries that don't match any of the
+	// QueryResults. If its Cols are set, the rows are shared by those
+	// queries, so successive queries read successive rows.
+	QueryRows MockRows
+
+	// RowsAffected is returned by the results of successive statements. It
+	// returns 0 once all the values have been used.
+	RowsAffected []int64
+
+	// BeginErr, CommitErr, and RollbackErr are returned by the transaction
+	// calls, which are recorded in TxLogs as "BEGIN", "COMMIT", and
+	// "ROLLBACK".
+	BeginErr    error
+	CommitErr   error
+	RollbackErr error
+	TxLogs      []string
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// MockQueryLog is a statement or query run on a mock database.
+type MockQueryLog struct {
+	Query string
+	Args  []driver.NamedValue
+}
+
+// MockQueryResult is the result returned for queries that match Pattern, a
+// regular expression. Queries fail if the pattern can't be compiled.
+type MockQueryResult struct {
+	Pattern string
+	Rows    MockRows
+}
+
+// MockRows are the rows returned by a query on a mock database. If Cols is
+// set, they're the Values, which can have any number of rows and columns.
+// Otherwise they're a single row with a version column, set to Version, for
+// the queries adapters use to look up the current schema version.
+type MockRows struct {
+	Version int
+	Cols    []string
+	Values  [][]driver.Value
+	next    int
+}
+
+// OpenMock opens a mock database, and returns it along with the MockData that
+// configures it. Statements run on the database succeed without doing
+// anything, and queries return rows from the MockData.
+func OpenMock() (*sql.DB, *MockData) {
+	md := &MockData{}
+	return sql.OpenDB(mockConnector{md: md}), md
+}
+
+// Reset clears the logs and results.
+func (md *MockData) Reset() {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	md.ExecErr, md.QueryErr = nil, nil
+	md.ExecLogs, md.QueryLogs = nil, nil
+	md.QueryResults = nil
+	md.QueryRows = MockRows{}
+	md.RowsAffected = nil
+	md.BeginErr, md.CommitErr, md.RollbackErr = nil, nil, nil
+	md.TxLogs = nil
+}
+
+// exec records a statement, and returns its result.
+func (md *MockData) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if md.ExecErr != nil {
+		return nil, md.ExecErr
+	}
+	md.ExecLogs = append(md.ExecLogs, MockQueryLog{Query: query, Args: args})
+	var n int64
+	if len(md.RowsAffected) > 0 {
+		n, md.RowsAffected = md.RowsAffected[0], md.RowsAffected[1:]
+	}
+	return driver.RowsAffected(n), nil
+}
+
+// query records a query, and returns the rows for it.
+func (md *MockData) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if md.QueryErr != nil {
+		return nil, md.QueryErr
+	}
+	md.QueryLogs = append(md.QueryLogs, MockQueryLog{Query: query, Args: args})
+	for _, r := range md.QueryResults {
+		re, err := md.pattern(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		if re.MatchString(query) {
+			rows := r.Rows
+			return &mockRows{rows: &rows}, nil
+		}
+	}
+	if md.QueryRows.Cols == nil {
+		return &mockRows{rows: &MockRows{Version: md.QueryRows.Version}}, nil
+	}
+	return &mockRows{rows: &md.QueryRows, mu: &md.mu}, nil
+}
+
+// pattern returns the compiled pattern, compiling it the first time it's
+// used. The lock must be held.
+func (md *MockData) pattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := md.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling mock query pattern: %w", err)
+	}
+	if md.patterns == nil {
+		md.patterns = make(map[string]*regexp.Regexp)
+	}
+	md.patterns[pattern] = re
+	return re, nil
+}
+
+// tx records a transaction call, and returns err. A BEGIN that fails isn't
+// recorded, since there's no transaction to commit or roll back.
+func (md *MockData) tx(s string, err *error) error {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if *err == nil || s != "BEGIN" {
+		md.TxLogs = append(md.TxLogs, s)
+	}
+	return *err
+}
+
+type mockConnector struct {
+	md *MockData
+}
+
+func (c mockConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &mockConn{md: c.md}, nil
+}
+
+func (c mockConnector) Driver() driver.Driver {
+	return mockDriver{}
+}
+
+// mockDriver is the driver.Driver for mockConnector. Mock databases can't be
+// opened by name, so it's only used by database/sql to identify the driver.
+type mockDriver struct{}
+
+func (mockDriver) Open(name string) (driver.Conn, error) {
+	return nil, fmt.Errorf("mock databases must be opened with OpenMock")
+}
+
+type mockConn struct {
+	md *MockData
+}
+
+func (c *mockConn) Prepare(query string) (driver.Stmt, error) {
+	return &mockStmt{md: c.md, query: query}, nil
+}
+
+func (c *mockConn) Close() error {
+	return nil
+}
+
+func (c *mockConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *mockConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.md.tx("BEGIN", &c.md.BeginErr); err != nil {
+		return nil, err
+	}
+	return &mockTx{md: c.md}, nil
+}
+
+func (c *mockConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.md.exec(query, args)
+}
+
+func (c *mockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.md.query(query, args)
+}
+
+type mockTx struct {
+	md *MockData
+}
+
+func (tx *mockTx) Commit() error {
+	return tx.md.tx("COMMIT", &tx.md.CommitErr)
+}
+
+func (tx *mockTx) Rollback() error {
+	return tx.md.tx("ROLLBACK", &tx.md.RollbackErr)
+}
+
+// mockStmt is a prepared statement on a mock database. Executing it records
+// it the same way as executing the query directly.
+type mockStmt struct {
+	md    *MockData
+	query string
+}
+
+func (s *mockStmt) Close() error {
+	return nil
+}
+
+func (s *mockStmt) NumInput() int {
+	return -1
+}
+
+func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.md.exec(s.query, namedValues(args))
+}
+
+func (s *mockStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.md.exec(s.query, args)
+}
+
+func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.md.query(s.query, namedValues(args))
+}
+
+func (s *mockStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.md.query(s.query, args)
+}
+
+// namedValues returns the values as ordinal arguments.
+func namedValues(values []driver.Value) []driver.NamedValue {
+	args := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		args[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return args
+}
+
+// mockRows reads MockRows. If mu is set, the rows are shared with other
+// queries, and it's held while reading them.
+type mockRows struct {
+	rows *MockRows
+	mu   *sync.Mutex
+}
+
+func (r *mockRows) Columns() []string {
+	if r.rows.Cols != nil {
+		return r.rows.Cols
+	}
+	return []string{"version"}
+}
+
+func (r *mockRows) Close() error {
+	return nil
+}
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	if r.mu != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+	rows := r.rows
+	if rows.Cols == nil {
+		if rows.next > 0 {
+			return io.EOF
+		}
+		rows.next++
+		dest[0] = int64(rows.Version)
+		return nil
+	}
+	if rows.next >= len(rows.Values) {
+		return io.EOF
+	}
+	copy(dest, rows.Values[rows.next])
+	rows.next++
+	return nil
+}
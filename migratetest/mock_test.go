@@ -0,0 +1,107 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/noonat/migrate"
+)
+
+func TestOpenMock(t *testing.T) {
+	ctx := context.Background()
+	db, md := OpenMock()
+	defer db.Close()
+
+	md.QueryRows.Version = 3
+	md.QueryResults = []MockQueryResult{
+		{Pattern: `FROM users\b`, Rows: MockRows{
+			Cols:   []string{"id", "name"},
+			Values: [][]driver.Value{{int64(1), "alice"}, {int64(2), "bob"}},
+		}},
+	}
+	// The result can be read more than once.
+	for i := 0; i < 2; i++ {
+		rows, err := db.QueryContext(ctx, "SELECT id, name FROM users")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		var names []string
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			names = append(names, name)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(names, []string{"alice", "bob"}) {
+			t.Errorf("expected alice and bob, got %v", names)
+		}
+	}
+
+	adapter := migrate.NewPostgreSQLAdapter(t.Logf)
+	if version, err := adapter.QuerySchemaVersion(ctx, db); err != nil || version != 3 {
+		t.Errorf("expected version 3, got %d, %v", version, err)
+	}
+
+	md.Reset()
+	// The version table is created first, and then the batch deletes two
+	// rows, and then none.
+	md.RowsAffected = []int64{0, 2}
+	migrations := []migrate.Migration{{Comment: "example comment", Up: migrate.ExecBatches("DELETE FROM users LIMIT 10", migrate.Pacer{})}}
+	if err := migrate.Up(migrate.WithoutQueryComments(ctx), db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var deletes int
+	for _, l := range md.ExecLogs {
+		if l.Query == "DELETE FROM users LIMIT 10" {
+			deletes++
+		}
+	}
+	if deletes != 2 {
+		t.Errorf("expected the batch to run until no rows were affected, got %#v", md.ExecLogs)
+	}
+}
+
+func TestOpenMockInvalidPattern(t *testing.T) {
+	db, md := OpenMock()
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{{Pattern: "("}}
+	if _, err := db.QueryContext(context.Background(), "SELECT 1"); err == nil {
+		t.Error("expected an error for the invalid pattern")
+	}
+}
+
+func TestOpenMockTx(t *testing.T) {
+	ctx := context.Background()
+	db, md := OpenMock()
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.RollbackErr = errors.New("mock rollback error")
+	if tx, err = db.BeginTx(ctx, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tx.Rollback(); err != md.RollbackErr {
+		t.Errorf("expected rollback error, got %v", err)
+	}
+	md.BeginErr = errors.New("mock begin error")
+	if _, err := db.BeginTx(ctx, nil); err != md.BeginErr {
+		t.Errorf("expected begin error, got %v", err)
+	}
+	expected := []string{"BEGIN", "COMMIT", "BEGIN", "ROLLBACK"}
+	if !reflect.DeepEqual(md.TxLogs, expected) {
+		t.Errorf("expected %v, got %v", expected, md.TxLogs)
+	}
+}
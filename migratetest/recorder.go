@@ -0,0 +1,123 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/noonat/migrate"
+)
+
+// AdapterCall is a call made to a RecordingAdapter. Args are the arguments
+// to the method, not including the context and database.
+type AdapterCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// String returns the call formatted like a function call.
+func (c AdapterCall) String() string {
+	s := c.Method + "("
+	for i, arg := range c.Args {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%#v", arg)
+	}
+	return s + ")"
+}
+
+// RecordingAdapter wraps an Adapter, and records each call made to it, so
+// tests can check how the Migrator, or code that orchestrates migrations,
+// uses the adapter. It's complementary to a fake database driver, which
+// records the SQL the adapter runs. Calls are passed on to Adapter, and its
+// results are returned.
+//
+// Calls to Log are recorded with the formatted message as their argument.
+// InsertSchemaVersionDirection is passed on to Adapter if it implements
+// migrate.DirectionInserter, and is otherwise recorded and passed on as
+// InsertSchemaVersion. The other optional interfaces aren't implemented.
+type RecordingAdapter struct {
+	Adapter migrate.Adapter
+
+	mu    sync.Mutex
+	calls []AdapterCall
+}
+
+// RecordAdapter returns a RecordingAdapter that wraps adapter.
+func RecordAdapter(adapter migrate.Adapter) *RecordingAdapter {
+	return &RecordingAdapter{Adapter: adapter}
+}
+
+// Calls returns the calls that have been made to the adapter.
+func (a *RecordingAdapter) Calls() []AdapterCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AdapterCall(nil), a.calls...)
+}
+
+// Methods returns the names of the methods that have been called, which is
+// often enough to check the order of the calls.
+func (a *RecordingAdapter) Methods() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	methods := make([]string, len(a.calls))
+	for i, c := range a.calls {
+		methods[i] = c.Method
+	}
+	return methods
+}
+
+// Reset forgets the calls that have been recorded.
+func (a *RecordingAdapter) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = nil
+}
+
+// Unwrap returns the wrapped adapter, so helpers that depend on the dialect
+// of a migrate.TableAdapter still work.
+func (a *RecordingAdapter) Unwrap() migrate.Adapter {
+	return a.Adapter
+}
+
+func (a *RecordingAdapter) record(method string, args ...interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, AdapterCall{Method: method, Args: args})
+}
+
+// Log implements migrate.Adapter.
+func (a *RecordingAdapter) Log(format string, v ...interface{}) {
+	a.record("Log", fmt.Sprintf(format, v...))
+	a.Adapter.Log(format, v...)
+}
+
+// PrepareSchemaVersions implements migrate.Adapter.
+func (a *RecordingAdapter) PrepareSchemaVersions(ctx context.Context, db *sql.DB) error {
+	a.record("PrepareSchemaVersions")
+	return a.Adapter.PrepareSchemaVersions(ctx, db)
+}
+
+// QuerySchemaVersion implements migrate.Adapter.
+func (a *RecordingAdapter) QuerySchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	a.record("QuerySchemaVersion")
+	return a.Adapter.QuerySchemaVersion(ctx, db)
+}
+
+// InsertSchemaVersion implements migrate.Adapter.
+func (a *RecordingAdapter) InsertSchemaVersion(ctx context.Context, db *sql.DB, version int, upgrade bool, comment string) error {
+	a.record("InsertSchemaVersion", version, upgrade, comment)
+	return a.Adapter.InsertSchemaVersion(ctx, db, version, upgrade, comment)
+}
+
+// InsertSchemaVersionDirection implements migrate.DirectionInserter.
+func (a *RecordingAdapter) InsertSchemaVersionDirection(ctx context.Context, db *sql.DB, version int, direction migrate.Direction, comment string) error {
+	di, ok := a.Adapter.(migrate.DirectionInserter)
+	if !ok {
+		return a.InsertSchemaVersion(ctx, db, version, direction != migrate.DirectionReverted, comment)
+	}
+	a.record("InsertSchemaVersionDirection", version, direction, comment)
+	return di.InsertSchemaVersionDirection(ctx, db, version, direction, comment)
+}
@@ -0,0 +1,52 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/noonat/migrate"
+)
+
+func TestRecordingAdapter(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("migratetest_stub", "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	adapter := RecordAdapter(migrate.NewSQLiteAdapter(func(string, ...interface{}) {}))
+	migrations := []migrate.Migration{
+		{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+		{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+	}
+	if err := migrate.Up(ctx, db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var calls []AdapterCall
+	for _, c := range adapter.Calls() {
+		if c.Method != "Log" {
+			calls = append(calls, c)
+		}
+	}
+	expected := []AdapterCall{
+		{Method: "PrepareSchemaVersions"},
+		{Method: "QuerySchemaVersion"},
+		{Method: "InsertSchemaVersionDirection", Args: []interface{}{1, migrate.DirectionApplied, "example comment 1"}},
+		{Method: "InsertSchemaVersionDirection", Args: []interface{}{2, migrate.DirectionApplied, "example comment 2"}},
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+	if s := calls[2].String(); s != `InsertSchemaVersionDirection(1, "applied", "example comment 1")` {
+		t.Errorf("unexpected string %q", s)
+	}
+
+	adapter.Reset()
+	if methods := adapter.Methods(); len(methods) != 0 {
+		t.Errorf("expected no calls after Reset, got %v", methods)
+	}
+}
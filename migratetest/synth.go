@@ -0,0 +1,140 @@
+package migratetest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/noonat/migrate"
+)
+
+// synthBatchParams is the maximum number of parameters Synthesize binds per
+// INSERT, which is the lowest limit of the supported databases.
+const synthBatchParams = 999
+
+// Generator returns the value for a column in the nth row, counting from
+// zero. It should use r for randomness, so the generated data is the same for
+// the same seed.
+type Generator func(r *rand.Rand, n int) interface{}
+
+// Column is a column filled by Synthesize.
+type Column struct {
+	// Name is the name of the column.
+	Name string
+
+	// Generate returns the value for each row.
+	Generate Generator
+}
+
+// Synthesize inserts rows of generated data into a table, so that migrations
+// like ALTERs and backfills can be rehearsed against realistic volumes of
+// data in CI, such as with BenchmarkMigrations. Rows are inserted in
+// multi-row batches, using the placeholders of the dialect. The generators
+// are given a random source created from seed, so the data is the same each
+// time.
+func Synthesize(ctx context.Context, db *sql.DB, dialect migrate.Dialect, table string, rows int, seed int64, columns ...Column) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("no columns to synthesize for %s", table)
+	}
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(names, ", "))
+	row := "(" + strings.Repeat("?, ", len(columns)-1) + "?)"
+	batchRows := synthBatchParams / len(columns)
+	r := rand.New(rand.NewSource(seed))
+	args := make([]interface{}, 0, batchRows*len(columns))
+	for start := 0; start < rows; start += batchRows {
+		end := start + batchRows
+		if end > rows {
+			end = rows
+		}
+		var b bytes.Buffer
+		b.WriteString(prefix)
+		args = args[:0]
+		for n := start; n < end; n++ {
+			if n > start {
+				b.WriteString(", ")
+			}
+			b.WriteString(row)
+			for _, c := range columns {
+				args = append(args, c.Generate(r, n))
+			}
+		}
+		if _, err := db.ExecContext(ctx, migrate.TranslatePlaceholders(dialect, b.String()), args...); err != nil {
+			return fmt.Errorf("error inserting rows %d to %d into %s: %w", start, end-1, table, err)
+		}
+	}
+	return nil
+}
+
+// Sequence returns a Generator for sequential integers, starting at start,
+// for columns like IDs.
+func Sequence(start int64) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		return start + int64(n)
+	}
+}
+
+// IntRange returns a Generator for random integers from min up to, but not
+// including, max.
+func IntRange(min, max int64) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		return min + r.Int63n(max-min)
+	}
+}
+
+// Format returns a Generator for strings made with fmt.Sprintf, with the row
+// number as the argument, like Format("user%d@example.com").
+func Format(format string) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		return fmt.Sprintf(format, n)
+	}
+}
+
+const synthLetters = "abcdefghijklmnopqrstuvwxyz"
+
+// Text returns a Generator for random lower case strings with lengths from
+// min to max, inclusive.
+func Text(min, max int) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		b := make([]byte, min+r.Intn(max-min+1))
+		for i := range b {
+			b[i] = synthLetters[r.Intn(len(synthLetters))]
+		}
+		return string(b)
+	}
+}
+
+// OneOf returns a Generator that picks one of the values at random, for
+// columns like statuses or enums.
+func OneOf(values ...interface{}) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		return values[r.Intn(len(values))]
+	}
+}
+
+// TimeRange returns a Generator for random times from start up to, but not
+// including, end, truncated to the second.
+func TimeRange(start, end time.Time) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		return start.Add(time.Duration(r.Int63n(int64(end.Sub(start))))).Truncate(time.Second)
+	}
+}
+
+// Nullable returns a Generator that returns nil with the probability p, from
+// 0 to 1, and the value from g otherwise. It's useful for testing backfills
+// and NOT NULL constraints.
+func Nullable(p float64, g Generator) Generator {
+	return func(r *rand.Rand, n int) interface{} {
+		if r.Float64() < p {
+			return nil
+		}
+		return g(r, n)
+	}
+}
@@ -0,0 +1,99 @@
+package migratetest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/noonat/migrate"
+)
+
+func TestSynthesize(t *testing.T) {
+	ctx := context.Background()
+	faults := &Faults{}
+	db, err := OpenFaultDB("migratetest_stub", "", faults)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []Column{
+		{Name: "id", Generate: Sequence(1)},
+		{Name: "email", Generate: Format("user%d@example.com")},
+		{Name: "created_at", Generate: TimeRange(start, start.AddDate(1, 0, 0))},
+	}
+
+	// Each batch has 333 rows of 3 columns, to stay under 999 parameters.
+	if err := Synthesize(ctx, db, migrate.DialectPostgreSQL, "users", 700, 1, columns...); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if n := faults.Execs(); n != 3 {
+		t.Errorf("expected 3 statements, got %d", n)
+	}
+
+	faults.Reset()
+	faults.FailInsertInto = "users"
+	if err := Synthesize(ctx, db, migrate.DialectPostgreSQL, "users", 10, 1, columns...); !errors.Is(err, ErrInjected) {
+		t.Errorf("expected ErrInjected, got %v", err)
+	}
+
+	if err := Synthesize(ctx, db, migrate.DialectPostgreSQL, "users", 10, 1); err == nil {
+		t.Error("expected an error with no columns")
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	generate := func(g Generator) []interface{} {
+		r := rand.New(rand.NewSource(1))
+		var values []interface{}
+		for n := 0; n < 20; n++ {
+			values = append(values, g(r, n))
+		}
+		return values
+	}
+
+	if v := generate(Sequence(10)); v[0] != int64(10) || v[19] != int64(29) {
+		t.Errorf("unexpected sequence %v", v)
+	}
+	if v := generate(Format("user%d")); v[3] != "user3" {
+		t.Errorf("unexpected format %v", v)
+	}
+	for _, v := range generate(IntRange(5, 8)) {
+		if n := v.(int64); n < 5 || n >= 8 {
+			t.Errorf("expected value in [5, 8), got %d", n)
+		}
+	}
+	for _, v := range generate(Text(2, 4)) {
+		if s := v.(string); len(s) < 2 || len(s) > 4 {
+			t.Errorf("expected 2 to 4 letters, got %q", s)
+		}
+	}
+	for _, v := range generate(OneOf("a", "b")) {
+		if v != "a" && v != "b" {
+			t.Errorf("unexpected choice %v", v)
+		}
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, v := range generate(TimeRange(start, start.Add(time.Hour))) {
+		if tm := v.(time.Time); tm.Before(start) || !tm.Before(start.Add(time.Hour)) {
+			t.Errorf("unexpected time %v", tm)
+		}
+	}
+	var nulls int
+	for _, v := range generate(Nullable(0.5, Sequence(1))) {
+		if v == nil {
+			nulls++
+		}
+	}
+	if nulls == 0 || nulls == 20 {
+		t.Errorf("expected some nulls, got %d", nulls)
+	}
+
+	if a, b := generate(Text(1, 10)), generate(Text(1, 10)); !reflect.DeepEqual(a, b) {
+		t.Errorf("expected the same values for the same seed, got %v and %v", a, b)
+	}
+}
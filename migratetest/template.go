@@ -0,0 +1,117 @@
+// Package migratetest provides helpers for using migrations in tests.
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/noonat/migrate"
+)
+
+// Template maintains a PostgreSQL template database with the migrations
+// applied, and creates new databases for tests by cloning it with CREATE
+// DATABASE ... TEMPLATE. Cloning a database is much faster than applying a
+// long history of migrations to each test database.
+type Template struct {
+	// DB is a connection to a database on the same server, such as the
+	// postgres database, which is used to create and drop databases. The
+	// role must have the CREATEDB privilege.
+	DB *sql.DB
+
+	// Open opens a connection to the database with the given name.
+	Open func(name string) (*sql.DB, error)
+
+	// Name is the name of the template database.
+	Name string
+
+	// Adapter is used to track the schema version of the template database.
+	Adapter migrate.Adapter
+
+	// Migrations are applied to the template database.
+	Migrations []migrate.Migration
+
+	mu       sync.Mutex
+	prepared bool
+	clones   int64
+}
+
+// Prepare creates the template database if it doesn't exist, and applies any
+// pending migrations to it, including any in PhasePostDeploy, so databases
+// cloned from it have the complete schema. It's called by Create, so it doesn't need to be
+// called directly, but it can be used to prepare the template once before
+// running tests in parallel. Template databases shared between test processes
+// should be prepared by one process before the others start, since the
+// migrations can't be applied concurrently.
+func (t *Template) Prepare(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prepared {
+		return nil
+	}
+	var exists bool
+	err := t.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", t.Name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking for template database %s: %w", t.Name, err)
+	}
+	if !exists {
+		if _, err := t.DB.ExecContext(ctx, "CREATE DATABASE "+quoteIdent(t.Name)); err != nil {
+			return fmt.Errorf("error creating template database %s: %w", t.Name, err)
+		}
+	}
+	db, err := t.Open(t.Name)
+	if err != nil {
+		return fmt.Errorf("error opening template database %s: %w", t.Name, err)
+	}
+	// The template can't be cloned while there are connections to it, so
+	// this connection has to be closed before returning.
+	err = migrate.UpToVersion(ctx, db, t.Adapter, len(t.Migrations), t.Migrations)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error migrating template database %s: %w", t.Name, err)
+	}
+	t.prepared = true
+	return nil
+}
+
+// Create prepares the template database, and then creates a new database
+// named name as a copy of it, and opens it.
+func (t *Template) Create(ctx context.Context, name string) (*sql.DB, error) {
+	if err := t.Prepare(ctx); err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", quoteIdent(name), quoteIdent(t.Name))
+	if _, err := t.DB.ExecContext(ctx, q); err != nil {
+		return nil, fmt.Errorf("error creating database %s: %w", name, err)
+	}
+	db, err := t.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %w", name, err)
+	}
+	return db, nil
+}
+
+// Drop drops a database created with Create. Connections to the database
+// must be closed first.
+func (t *Template) Drop(ctx context.Context, name string) error {
+	if _, err := t.DB.ExecContext(ctx, "DROP DATABASE IF EXISTS "+quoteIdent(name)); err != nil {
+		return fmt.Errorf("error dropping database %s: %w", name, err)
+	}
+	return nil
+}
+
+// cloneName returns a unique name for a database cloned from the template.
+func (t *Template) cloneName() string {
+	n := atomic.AddInt64(&t.clones, 1)
+	return fmt.Sprintf("%s_%d_%d", t.Name, os.Getpid(), n)
+}
+
+// quoteIdent quotes a PostgreSQL identifier.
+func quoteIdent(name string) string {
+	return migrate.QuoteIdent(migrate.DialectPostgreSQL, name)
+}
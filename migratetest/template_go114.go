@@ -0,0 +1,32 @@
+//go:build go1.14
+// +build go1.14
+
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// Clone creates a new database from the template for a test, with a unique
+// name. The database is closed and dropped when the test finishes. The test
+// fails immediately if the database can't be created.
+func (t *Template) Clone(tb testing.TB) *sql.DB {
+	tb.Helper()
+	ctx := context.Background()
+	name := t.cloneName()
+	db, err := t.Create(ctx, name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			tb.Errorf("error closing database %s: %s", name, err)
+		}
+		if err := t.Drop(ctx, name); err != nil {
+			tb.Error(err)
+		}
+	})
+	return db
+}
@@ -0,0 +1,147 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/noonat/migrate"
+)
+
+func TestCloneName(t *testing.T) {
+	tmpl := &Template{Name: "app_template"}
+	a, b := tmpl.cloneName(), tmpl.cloneName()
+	if a == b {
+		t.Errorf("expected unique names, got %q twice", a)
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	if q := quoteIdent(`app"test`); q != `"app""test"` {
+		t.Errorf("expected quoted identifier, got %s", q)
+	}
+}
+
+// mockTemplate returns a Template whose server and template databases are
+// mocks, and the MockData for each of them. Databases created from the
+// template are opened as new mocks. The caller should close the Template's
+// DB.
+func mockTemplate(t *testing.T, exists bool, migrations []migrate.Migration) (*Template, *MockData, *MockData) {
+	server, serverData := OpenMock()
+	serverData.QueryResults = []MockQueryResult{{Pattern: "pg_database", Rows: MockRows{
+		Cols:   []string{"exists"},
+		Values: [][]driver.Value{{exists}},
+	}}}
+	db, templateData := OpenMock()
+	tmpl := &Template{
+		DB: server,
+		Open: func(name string) (*sql.DB, error) {
+			if name != "app_template" {
+				clone, _ := OpenMock()
+				return clone, nil
+			}
+			return db, nil
+		},
+		Name:       "app_template",
+		Adapter:    migrate.NewPostgreSQLAdapter(t.Logf),
+		Migrations: migrations,
+	}
+	return tmpl, serverData, templateData
+}
+
+func TestTemplatePreparePostDeploy(t *testing.T) {
+	tmpl, _, templateData := mockTemplate(t, true, []migrate.Migration{
+		{Comment: "add column", UpQueries: []string{"add query"}},
+		{Comment: "drop column", UpQueries: []string{"drop query"}, Phase: migrate.PhasePostDeploy},
+	})
+	defer tmpl.DB.Close()
+	if err := tmpl.Prepare(migrate.WithoutQueryComments(context.Background())); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range templateData.ExecLogs {
+		if strings.HasSuffix(l.Query, "query") {
+			queries = append(queries, l.Query)
+		}
+	}
+	if !reflect.DeepEqual(queries, []string{"add query", "drop query"}) {
+		t.Errorf("expected both migrations to be applied, got %q", queries)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	ctx := migrate.WithoutQueryComments(context.Background())
+	tmpl, serverData, templateData := mockTemplate(t, false, []migrate.Migration{
+		{Comment: "create users", UpQueries: []string{"CREATE TABLE users (id INT)"}},
+	})
+	defer tmpl.DB.Close()
+	var opened []string
+	open := tmpl.Open
+	tmpl.Open = func(name string) (*sql.DB, error) {
+		opened = append(opened, name)
+		return open(name)
+	}
+
+	db, err := tmpl.Create(ctx, "app_test_1")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	db.Close()
+	if expected := []string{"app_template", "app_test_1"}; !reflect.DeepEqual(opened, expected) {
+		t.Errorf("expected databases %q to be opened, got %q", expected, opened)
+	}
+	if err := tmpl.Drop(ctx, "app_test_1"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range serverData.ExecLogs {
+		queries = append(queries, l.Query)
+	}
+	expected := []string{
+		`CREATE DATABASE "app_template"`,
+		`CREATE DATABASE "app_test_1" TEMPLATE "app_template"`,
+		`DROP DATABASE IF EXISTS "app_test_1"`,
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+	if len(serverData.QueryLogs) != 1 || serverData.QueryLogs[0].Args[0].Value != "app_template" {
+		t.Errorf("expected the template database to be looked up, got %#v", serverData.QueryLogs)
+	}
+	var migrated bool
+	for _, l := range templateData.ExecLogs {
+		if l.Query == "CREATE TABLE users (id INT)" {
+			migrated = true
+		}
+	}
+	if !migrated {
+		t.Errorf("expected the template database to be migrated, got %#v", templateData.ExecLogs)
+	}
+
+	// The template is only prepared once.
+	serverData.Reset()
+	if _, err := tmpl.Create(ctx, "app_test_2"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(serverData.QueryLogs) != 0 || len(serverData.ExecLogs) != 1 {
+		t.Errorf("expected only the clone to be created, got %#v", serverData.ExecLogs)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	ctx := context.Background()
+	tmpl, serverData, _ := mockTemplate(t, true, nil)
+	defer tmpl.DB.Close()
+
+	serverData.ExecErr = errors.New("mock error")
+	if _, err := tmpl.Create(ctx, "app_test_1"); err == nil || err.Error() != "error creating database app_test_1: mock error" {
+		t.Errorf("expected create error, got %v", err)
+	}
+	if err := tmpl.Drop(ctx, "app_test_1"); err == nil || err.Error() != "error dropping database app_test_1: mock error" {
+		t.Errorf("expected drop error, got %v", err)
+	}
+}
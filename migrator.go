@@ -0,0 +1,950 @@
+package migrate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Migrator runs migrations against a database, with options to control how
+// they are run. The Up, UpToVersion and DownToVersion functions are shortcuts
+// for running a Migrator with the default options.
+type Migrator struct {
+	// DB is the database to migrate. It can be opened with an instrumented
+	// driver, such as one wrapped by otelsql or ocsql, to trace the queries
+	// made by migrations. Every query goes through the driver's connections,
+	// including those on the pinned connections used for session options
+	// like LockName, and in transactions started by Prepare and Checkpoints.
+	DB *sql.DB
+
+	// ReadDB is used instead of DB by operations that only read the version
+	// table, like Status, PlanUpToVersion and dry runs, so that they can use
+	// credentials with read-only access. The schema versions aren't
+	// prepared when it's used, so the version table must already exist. If
+	// it's nil, DB is used for everything.
+	ReadDB *sql.DB
+
+	// Adapter is used to track the schema version of the database.
+	Adapter Adapter
+
+	// Migrations is the list of migrations. The version of each migration is
+	// its position in the list, starting at 1.
+	Migrations []Migration
+
+	// Role is a database role to switch to while running migrations, so they
+	// can run as a role that owns the schema while the application uses a
+	// more restricted one. The previous role is restored afterward. When this
+	// is set, the migrations are run on a single connection from DB, and if
+	// the role can't be restored, the connection is closed rather than being
+	// returned to the pool. This requires Go 1.17, and is only supported for
+	// DialectPostgreSQL and DialectMySQL.
+	Role string
+
+	// NotifyChannel is a PostgreSQL channel to NOTIFY after migrations have
+	// changed the version of the database. The payload is the new version.
+	// Other services can LISTEN on the channel to react to schema changes.
+	// This is only supported for DialectPostgreSQL.
+	NotifyChannel string
+
+	// Parallelism is the maximum number of migrations to apply concurrently.
+	// If it's more than 1, runs of adjacent pending migrations that are
+	// marked as Independent are applied concurrently, and their versions are
+	// recorded once they've all finished. If one of them fails, the versions
+	// before it are recorded, but any later ones in the run that succeeded
+	// are not, and they'll be applied again on the next run. Migrations are
+	// always applied one at a time by Prepare and DownToVersion, and when
+	// the run is pinned to a single connection because SingleConnection,
+	// Role or LockName is set.
+	Parallelism int
+
+	// SingleConnection runs the migrations on a single connection from DB,
+	// rather than letting each query use whichever pooled connection is
+	// free. This is needed for databases where each connection sees
+	// different data, like SQLite in-memory databases. It requires Go 1.17.
+	// Parallelism has no effect when this is set.
+	SingleConnection bool
+
+	// LockName is the name of an advisory lock to hold while running
+	// migrations, so that if several processes try to migrate the database
+	// at the same time, they take turns instead of applying the same
+	// migrations concurrently. When this is set, the migrations are run on a
+	// single connection from DB, and the lock is released when they finish.
+	// If the lock can't be acquired, a *LockError is returned. This requires
+	// Go 1.17, and is only supported for DialectPostgreSQL and DialectMySQL.
+	LockName string
+
+	// LockTimeout controls how long to wait for LockName when another
+	// process holds it. If it's zero, the Migrator waits until the lock is
+	// released or the context is done. If it's positive, the lock is polled
+	// every LockPollInterval, and the *LockError wraps ErrLockTimeout if it
+	// isn't acquired in time. If it's negative, the Migrator fails fast, and
+	// the *LockError wraps ErrLockHeld.
+	LockTimeout time.Duration
+
+	// LockPollInterval is how often to try to acquire the lock while
+	// waiting for it. It defaults to one second.
+	LockPollInterval time.Duration
+
+	// LockStaleAfter steals the lock from a holder whose connection has been
+	// idle for at least this long, by terminating that connection. This is
+	// for recovering from processes that hang while holding the lock. It
+	// must be longer than any migration might pause between queries, and it
+	// requires privileges to terminate other connections. If it's set, the
+	// lock is polled even when LockTimeout is zero.
+	LockStaleAfter time.Duration
+
+	// RejectNewerDatabase returns a *VersionSkewError if the database's
+	// current version is higher than the number of migrations, instead of
+	// leaving it alone. That usually means an older build of the application
+	// is being deployed against a schema migrated by a newer one, which is
+	// worth failing loudly on. It should be left unset if older builds are
+	// expected to keep running during a deploy, such as with rolling
+	// upgrades.
+	RejectNewerDatabase bool
+
+	// Strict makes Up, UpToVersion, UpPhase, UpFromSnapshot and Prepare fail
+	// if the database has applied versions that don't match the migrations: a
+	// version higher than the number of migrations returns a
+	// *VersionSkewError, like RejectNewerDatabase, and if the adapter is a
+	// TableAdapter, an applied version that has no migration or was recorded
+	// with a different comment returns an *UnknownVersionError. This stops a
+	// build whose migrations are out of sync with the database, such as an
+	// old binary or a branch with renumbered migrations, from reporting
+	// success without applying anything.
+	Strict bool
+
+	// Analyze refreshes the query planner statistics for the AnalyzeTables
+	// of each migration that was applied, once all the migrations have
+	// finished. This avoids slow queries while waiting for the database to
+	// notice that the tables have changed. It uses ANALYZE for PostgreSQL
+	// and SQLite, and ANALYZE TABLE for MySQL. Errors analyzing tables are
+	// logged rather than returned, since the migrations have already been
+	// applied.
+	Analyze bool
+
+	// CachePrepare skips preparing the schema versions once they've been
+	// prepared successfully by this Migrator, so that the version table
+	// isn't checked with DDL like CREATE TABLE IF NOT EXISTS each time the
+	// Migrator is run in the same process. It shouldn't be used if the
+	// version table might be dropped while the process is running.
+	CachePrepare bool
+
+	// RequirePrimary checks that the database is writable before running
+	// migrations, and returns an error wrapping ErrReadOnlyDatabase if it's
+	// a read-only replica, rather than failing partway through with a
+	// confusing write error. This is only supported for DialectPostgreSQL,
+	// where it checks pg_is_in_recovery(), and DialectMySQL, where it
+	// checks the read_only variable.
+	RequirePrimary bool
+
+	// ReconnectAttempts is the number of times to reconnect and resume after
+	// losing the connection to the database, such as during a planned
+	// failover. The current version is queried again after reconnecting, so
+	// the migrations continue from the last one that was recorded. By
+	// default, only driver.ErrBadConn and errors dialing the database are
+	// treated as a lost connection, since they mean the query wasn't sent.
+	// Up and DownToVersion reconnect, but Prepare doesn't, since its
+	// transaction is lost along with the connection.
+	ReconnectAttempts int
+
+	// ReconnectDelay is the time to wait before reconnecting. It defaults to
+	// one second.
+	ReconnectDelay time.Duration
+
+	// IsConnectionError can be set to change which errors are treated as a
+	// lost connection by ReconnectAttempts. It must only return true for
+	// errors where the failed query definitely wasn't applied, or the
+	// migration it belonged to must be safe to run again.
+	IsConnectionError func(err error) bool
+
+	// LockRetryMaxWait retries a run of Up or DownToVersion that fails
+	// because a lock couldn't be acquired in time, such as when LockName
+	// times out, or a migration's DDL exceeds PostgreSQL's lock_timeout or
+	// MySQL's lock_wait_timeout. This lets rolling deploys, where many
+	// replicas start at the same time, converge without an operator. The
+	// delay between runs starts at LockRetryDelay and doubles each time,
+	// with jitter so the replicas don't retry together, and the run fails
+	// once the total delay would exceed LockRetryMaxWait. It's zero by
+	// default, which disables retries. A migration whose DDL timed out is
+	// run again from the start, so it must be safe to run again.
+	LockRetryMaxWait time.Duration
+
+	// LockRetryDelay is the delay before the first retry for
+	// LockRetryMaxWait. It defaults to one second.
+	LockRetryDelay time.Duration
+
+	// IsLockTimeout can be set to change which errors are retried by
+	// LockRetryMaxWait. By default, a *LockError wrapping ErrLockHeld or
+	// ErrLockTimeout is retried, along with errors whose text matches the
+	// lock timeout errors of PostgreSQL and MySQL.
+	IsLockTimeout func(err error) bool
+
+	// VerifyKey is an Ed25519 public key used to verify the Signature of
+	// every migration before running any of them, with VerifyMigrations.
+	// This is for environments that require proof of where schema changes
+	// came from. Migrations with Up or Down functions can't be verified, so
+	// they're rejected when this is set.
+	VerifyKey ed25519.PublicKey
+
+	// Approve is called with the Plan for the migrations that are about to
+	// be run, and they're only run if it returns nil. It can block, such as
+	// while waiting for someone to approve the change in an external system,
+	// so it's useful for protected environments. It's called after LockName
+	// is acquired, so the plan can't change while waiting, and it's called
+	// again with the remaining steps if the Migrator reconnects. It isn't
+	// called if there are no migrations to run.
+	Approve func(ctx context.Context, plan *Plan) error
+
+	// SummaryOutput is where a Summary of each run of Up, UpToVersion,
+	// UpPhase, UpFromSnapshot and DownToVersion is written, as a single line
+	// of JSON, such as os.Stdout. It's written whether the run succeeds or
+	// fails, and regardless of how the Adapter logs, so CI logs always
+	// contain a result that can be parsed.
+	SummaryOutput io.Writer
+
+	// PoolerSafe avoids features that depend on session state, for
+	// databases that are connected through a transaction pooling proxy like
+	// PgBouncer or ProxySQL, which can send each transaction to a different
+	// server connection. Options that need session state, like LockName and
+	// Role, are rejected unless DirectDB is set.
+	PoolerSafe bool
+
+	// DirectDB is a connection to the database that bypasses any
+	// connection pooling proxy, such as one to the database's own port
+	// rather than PgBouncer's. If it's set, runs use it instead of DB, so
+	// options that need session state keep working. Operations that only
+	// read the version, like Status, still use DB or ReadDB.
+	DirectDB *sql.DB
+
+	// DetectPooler checks whether the database used for each run appears
+	// to be connected through a transaction pooling proxy, and logs a
+	// warning if it is and PoolerSafe isn't set.
+	DetectPooler bool
+
+	// VerifyInserts queries each version again after it's inserted, and
+	// fails the run if the row can't be read back. This catches writes that
+	// didn't take effect where they're expected to be read, such as with
+	// Galera or group replication, or a proxy that sends reads to a lagging
+	// replica. The adapter must implement VersionVerifier.
+	VerifyInserts bool
+
+	// VerifyInsertTimeout is how long VerifyInserts keeps querying a version
+	// that isn't visible yet before failing the run. If it's zero, the
+	// version is only queried once.
+	VerifyInsertTimeout time.Duration
+
+	// Metadata describes the run, with values like a deploy ID, git SHA or
+	// environment. It's stored with every version inserted by the run if
+	// the adapter's MetadataColumn is set, so the history of the database
+	// can be matched up with releases.
+	Metadata map[string]string
+
+	// Preflight checks that the database is configured as expected at the
+	// start of each run, before any migrations are applied, and fails the
+	// run with a *PreflightError listing every problem if it isn't.
+	Preflight *Preflight
+
+	// prepared is set to 1 once the schema versions have been prepared, if
+	// CachePrepare is set. It's accessed atomically.
+	prepared uint32
+
+	// active tracks the runs in progress, so they can be stopped by Cancel.
+	// It's created by runs, and shared with copies of the Migrator.
+	active *activeRuns
+}
+
+// Up upgrades the database to the latest migration, stopping before any
+// migrations in PhasePostDeploy.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpPhase(ctx, PhasePreDeploy)
+}
+
+// UpToVersion migrates the database to the specified version. Migrations in
+// every phase up to the version are applied.
+func (m *Migrator) UpToVersion(ctx context.Context, targetVersion int) error {
+	_, _, err := m.migrateUp(ctx, targetVersion, PhasePostDeploy, nil)
+	return err
+}
+
+// migrateUp migrates the database to the specified version, stopping before
+// any migrations in phases after phase, and returns the version of the
+// database before and after migrating. If snapshot isn't nil, it's loaded
+// first if the database is empty.
+func (m *Migrator) migrateUp(ctx context.Context, targetVersion int, phase Phase, snapshot *Snapshot) (from, to int, err error) {
+	defer m.writeSummary("up", time.Now(), &from, &to, &err)
+	ctx, done := m.startRun(ctx)
+	defer done()
+	ctx = withMetadata(ctx, m.Metadata)
+	if err := m.checkOptions(); err != nil {
+		return 0, 0, err
+	}
+	if err := checkTarget(m.Migrations, targetVersion); err != nil {
+		return 0, 0, err
+	}
+	// If the migrator retries, from is the version before the first
+	// attempt that was able to query it.
+	from, to = -1, 0
+	err = m.retry(ctx, func() error {
+		return m.session(ctx, false, func(db *sql.DB) error {
+			current, newVersion, err := m.upToVersion(ctx, db, targetVersion, phase, false, snapshot)
+			if current >= 0 {
+				if from < 0 {
+					from = current
+				}
+				to = newVersion
+			}
+			if err != nil {
+				m.recordFailure(ctx, db, err)
+				return err
+			}
+			m.analyze(ctx, db, from, to)
+			return m.notify(ctx, db, from, to)
+		})
+	})
+	if from < 0 {
+		from = 0
+	}
+	return from, to, err
+}
+
+// DownToVersion migrates the database down to the specified version. See the
+// DownToVersion function for more information.
+func (m *Migrator) DownToVersion(ctx context.Context, targetVersion int) (err error) {
+	from, to := -1, 0
+	defer m.writeSummary("down", time.Now(), &from, &to, &err)
+	ctx, done := m.startRun(ctx)
+	defer done()
+	ctx = withMetadata(ctx, m.Metadata)
+	if err := m.checkOptions(); err != nil {
+		return err
+	}
+	if err := checkTarget(m.Migrations, targetVersion); err != nil {
+		return err
+	}
+	return m.retry(ctx, func() error {
+		return m.session(ctx, false, func(db *sql.DB) error {
+			current, newVersion, err := m.downToVersion(ctx, db, targetVersion)
+			if current >= 0 {
+				if from < 0 {
+					from = current
+				}
+				to = newVersion
+			}
+			if err != nil {
+				m.recordFailure(ctx, db, err)
+				return err
+			}
+			return m.notify(ctx, db, from, to)
+		})
+	})
+}
+
+// upToVersion runs the up migrations in phases up to and including phase,
+// and returns the version of the database before and after running them, or
+// -1 for both if the current version couldn't be queried. If inTx is true,
+// the migrations are being run inside a transaction, so they're run one at a
+// time and Cleanup isn't called when they fail. If snapshot isn't nil and the
+// database is empty, the snapshot is loaded after the plan is approved, and
+// only the migrations after it are run.
+func (m *Migrator) upToVersion(ctx context.Context, db *sql.DB, targetVersion int, phase Phase, inTx bool, snapshot *Snapshot) (int, int, error) {
+	currentVersion, err := m.currentVersion(ctx, db)
+	if err != nil {
+		return -1, -1, err
+	}
+	if err := m.checkSkew(currentVersion); err != nil {
+		return currentVersion, currentVersion, err
+	}
+	if err := m.checkStrict(ctx, db, currentVersion); err != nil {
+		return currentVersion, currentVersion, err
+	}
+	targetVersion = m.phaseTarget(currentVersion, targetVersion, phase)
+	stop := targetVersion
+	if currentVersion > stop {
+		stop = currentVersion
+	}
+	if last := len(m.Migrations); stop < last {
+		m.Adapter.Log("Stopping at version %d, leaving versions %d to %d pending", stop, stop+1, last)
+	}
+	if inTx {
+		if err := m.checkTransactional(currentVersion, targetVersion); err != nil {
+			return currentVersion, currentVersion, err
+		}
+	}
+	startVersion := currentVersion
+	if snapshot != nil && currentVersion == 0 && snapshot.Version > 0 {
+		startVersion = snapshot.Version
+	}
+	plan := planUp(dialectOf(m.Adapter), startVersion, targetVersion, m.Migrations)
+	plan.CurrentVersion = currentVersion
+	if err := m.approve(ctx, plan); err != nil {
+		return currentVersion, currentVersion, err
+	}
+	if startVersion != currentVersion {
+		if err := m.loadSnapshot(ctx, db, *snapshot); err != nil {
+			return currentVersion, currentVersion, err
+		}
+	}
+	newVersion, err := m.upFromVersion(ctx, db, startVersion, targetVersion, inTx)
+	return currentVersion, newVersion, err
+}
+
+// currentVersion returns the current version of the database. It prepares
+// the schema versions first, unless CachePrepare is set and they've already
+// been prepared.
+func (m *Migrator) currentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	if m.CachePrepare && atomic.LoadUint32(&m.prepared) == 1 {
+		return querySchemaVersion(ctx, db, m.Adapter)
+	}
+	currentVersion, err := queryCurrentVersion(ctx, db, m.Adapter)
+	if err == nil && m.CachePrepare {
+		atomic.StoreUint32(&m.prepared, 1)
+	}
+	return currentVersion, err
+}
+
+// readVersion returns the current version of the database for operations
+// that don't change it, using ReadDB if it's set.
+func (m *Migrator) readVersion(ctx context.Context) (int, error) {
+	if m.ReadDB == nil {
+		return m.currentVersion(ctx, m.DB)
+	}
+	return querySchemaVersion(ctx, m.ReadDB, m.Adapter)
+}
+
+// Status returns the current and latest versions of the database. It uses
+// ReadDB if it's set.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	current, err := m.readVersion(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{CurrentVersion: current, LatestVersion: len(m.Migrations)}
+	if current < status.LatestVersion {
+		status.Pending = status.LatestVersion - current
+	}
+	return status, nil
+}
+
+// PlanUpToVersion returns a plan describing the migrations UpToVersion would
+// apply. It uses ReadDB if it's set.
+func (m *Migrator) PlanUpToVersion(ctx context.Context, targetVersion int) (*Plan, error) {
+	if err := checkTarget(m.Migrations, targetVersion); err != nil {
+		return nil, err
+	}
+	current, err := m.readVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return planUp(dialectOf(m.Adapter), current, targetVersion, m.Migrations), nil
+}
+
+// planPhase returns a plan like PlanUpToVersion, but without the steps that
+// phaseTarget would stop before, and with its target version set to match.
+func (m *Migrator) planPhase(ctx context.Context, targetVersion int, phase Phase) (*Plan, error) {
+	plan, err := m.PlanUpToVersion(ctx, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	plan.TargetVersion = m.phaseTarget(plan.CurrentVersion, targetVersion, phase)
+	for len(plan.Steps) > 0 && plan.Steps[len(plan.Steps)-1].Version > plan.TargetVersion {
+		plan.Steps = plan.Steps[:len(plan.Steps)-1]
+	}
+	return plan, nil
+}
+
+// upFromVersion runs the up migrations after currentVersion, and returns the
+// new version of the database.
+func (m *Migrator) upFromVersion(ctx context.Context, db *sql.DB, currentVersion, targetVersion int, inTx bool) (int, error) {
+	newVersion := currentVersion
+	for i := 0; i < len(m.Migrations); i++ {
+		version := i + 1
+		if version <= currentVersion {
+			continue
+		}
+		if version > targetVersion {
+			break
+		}
+		n := 1
+		if !inTx {
+			n = m.independentGroup(i, targetVersion)
+		}
+		start := time.Now()
+		applied, err := m.applyUp(ctx, db, i, n, inTx)
+		if r := rehearsalFromContext(ctx); r != nil {
+			// Rehearsals run in a transaction, so migrations are always
+			// applied one at a time.
+			r.Steps = append(r.Steps, RehearsalStep{Version: version, Comment: m.Migrations[i].Comment, Duration: time.Since(start), Err: err})
+		}
+		for j := i; j < i+applied; j++ {
+			mi := m.Migrations[j]
+			if err := m.insertVersion(ctx, db, mi, j+1, DirectionApplied); err != nil {
+				return newVersion, fmt.Errorf("error inserting schema version for version %d: %w", j+1, err)
+			}
+			newVersion = j + 1
+		}
+		if err != nil {
+			return newVersion, err
+		}
+		i += n - 1
+	}
+	return newVersion, nil
+}
+
+// independentGroup returns the number of migrations starting at index i that
+// can be applied concurrently. This is 1 unless Parallelism is set, the run
+// isn't pinned to a single connection, and the migration at i is the start of
+// a run of independent migrations.
+func (m *Migrator) independentGroup(i, targetVersion int) int {
+	if m.Parallelism < 2 || m.pinned() {
+		return 1
+	}
+	n := 0
+	for i+n < len(m.Migrations) && i+n < targetVersion && m.Migrations[i+n].Independent {
+		n++
+	}
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// applyUp applies the n migrations starting at index i. If n is more than 1,
+// they're applied concurrently, using up to Parallelism goroutines, and
+// started in order of their Priority. It returns the number of migrations at
+// the start of the group that were applied successfully, and the error for
+// the first one that failed.
+func (m *Migrator) applyUp(ctx context.Context, db *sql.DB, i, n int, inTx bool) (int, error) {
+	errs := make([]error, n)
+	if n == 1 {
+		errs[0] = m.up(ctx, db, i, inTx)
+	} else {
+		m.Adapter.Log("Upgrading database to versions %d through %d concurrently", i+1, i+n)
+		order := make([]int, n)
+		for j := range order {
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return m.Migrations[i+order[a]].Priority > m.Migrations[i+order[b]].Priority
+		})
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, m.Parallelism)
+		for _, j := range order {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(j int) {
+				defer wg.Done()
+				errs[j] = m.up(ctx, db, i+j, inTx)
+				<-sem
+			}(j)
+		}
+		wg.Wait()
+	}
+	for j, err := range errs {
+		if err != nil {
+			return j, err
+		}
+	}
+	return n, nil
+}
+
+// up applies the migration at index i.
+func (m *Migrator) up(ctx context.Context, db *sql.DB, i int, inTx bool) error {
+	adapter := m.Adapter
+	mi := m.Migrations[i]
+	version := i + 1
+	adapter.Log("Upgrading database to version %d", version)
+	mctx := withMigration(ctx, adapter, version, true, mi.Comment)
+	up := mi.up()
+	if mi.Up == nil && mi.UpQueries == nil && mi.Checkpoints != nil {
+		if inTx {
+			err := errors.New("migrations with checkpoints can't be run in a transaction")
+			return &MigrationError{Version: version, Upgrade: true, Comment: mi.Comment, Err: err}
+		}
+		up = runCheckpoints(adapter, version, mi.Checkpoints)
+	}
+	if err := up(mctx, db); err != nil {
+		if !inTx && mi.Cleanup != nil {
+			adapter.Log("Cleaning up failed migration to version %d", version)
+			if cleanupErr := mi.Cleanup(withoutCancel(mctx), db); cleanupErr != nil {
+				adapter.Log("Error cleaning up failed migration to version %d: %s", version, cleanupErr)
+			}
+		}
+		return &MigrationError{Version: version, Upgrade: true, Comment: mi.Comment, Err: err}
+	}
+	return nil
+}
+
+// downToVersion runs the down migrations, and returns the version of the
+// database before and after running them, or -1 for both if the current
+// version couldn't be queried.
+func (m *Migrator) downToVersion(ctx context.Context, db *sql.DB, targetVersion int) (int, int, error) {
+	adapter := m.Adapter
+	currentVersion, err := m.currentVersion(ctx, db)
+	if err != nil {
+		return -1, -1, err
+	}
+	if err := m.checkSkew(currentVersion); err != nil {
+		return currentVersion, currentVersion, err
+	}
+	if err := m.approve(ctx, planDown(dialectOf(adapter), currentVersion, targetVersion, m.Migrations)); err != nil {
+		return currentVersion, currentVersion, err
+	}
+	newVersion := currentVersion
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		mi := m.Migrations[i]
+		version := i + 1
+		if version > currentVersion {
+			continue
+		}
+		if version <= targetVersion {
+			break
+		}
+		adapter.Log("Downgrading database to version %d", version)
+		if err := mi.down()(withMigration(ctx, adapter, version, false, mi.Comment), db); err != nil {
+			return currentVersion, newVersion, &MigrationError{Version: version, Upgrade: false, Comment: mi.Comment, Err: err}
+		}
+		if err := m.insertVersion(ctx, db, mi, version, DirectionReverted); err != nil {
+			return currentVersion, newVersion, fmt.Errorf("error inserting schema_versions row for version %d: %w", version, err)
+		}
+		if recorder, ok := adapter.(CheckpointRecorder); ok && mi.Checkpoints != nil {
+			if err := recorder.ClearCheckpoints(ctx, db, version); err != nil {
+				return currentVersion, newVersion, fmt.Errorf("error clearing checkpoint for version %d: %w", version, err)
+			}
+		}
+		newVersion = version - 1
+	}
+	return currentVersion, newVersion, nil
+}
+
+// MigrationError is returned when a migration's Up or Down function fails.
+type MigrationError struct {
+	// Version is the version of the migration that failed.
+	Version int
+
+	// Upgrade is true if the migration failed while being applied, or false
+	// if it failed while being reverted.
+	Upgrade bool
+
+	// Comment is the comment for the migration.
+	Comment string
+
+	// Err is the error returned by the migration.
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	if e.Upgrade {
+		return fmt.Sprintf("error upgrading database to version %d: %s", e.Version, e.Err)
+	}
+	return fmt.Sprintf("error downgrading database to version %d: %s", e.Version, e.Err)
+}
+
+// Unwrap returns the error returned by the migration.
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// FailureRecorder is an optional interface for adapters that can record
+// failed migrations in the database, so operators can see failed attempts
+// alongside the migration history. If the adapter implements it, the
+// Migrator calls RecordFailure whenever a migration returns an error.
+type FailureRecorder interface {
+	RecordFailure(ctx context.Context, db *sql.DB, failure *MigrationError) error
+}
+
+// recordFailure records err with the adapter, if it's a *MigrationError and
+// the adapter supports it. Errors recording the failure are logged rather
+// than returned, so they don't hide the original error.
+func (m *Migrator) recordFailure(ctx context.Context, db *sql.DB, err error) {
+	var failure *MigrationError
+	if !errors.As(err, &failure) || rehearsalFromContext(ctx) != nil {
+		return
+	}
+	recordReplay(ctx, ReplayEvent{Kind: ReplayFailure, Version: failure.Version, Error: failure.Err.Error()})
+	recorder, ok := m.Adapter.(FailureRecorder)
+	if !ok {
+		return
+	}
+	if err := recorder.RecordFailure(withoutCancel(ctx), db, failure); err != nil {
+		m.Adapter.Log("Error recording failure for version %d: %s", failure.Version, err)
+	}
+}
+
+// VersionSkewError is returned when RejectNewerDatabase is set and the
+// database's version is higher than the number of migrations.
+type VersionSkewError struct {
+	// DatabaseVersion is the current version of the database.
+	DatabaseVersion int
+
+	// LatestVersion is the version of the last migration.
+	LatestVersion int
+}
+
+func (e *VersionSkewError) Error() string {
+	return fmt.Sprintf("database version %d is newer than the latest migration version %d", e.DatabaseVersion, e.LatestVersion)
+}
+
+// checkSkew returns a *VersionSkewError if RejectNewerDatabase is set and the
+// current version is higher than the number of migrations.
+func (m *Migrator) checkSkew(currentVersion int) error {
+	if m.RejectNewerDatabase && currentVersion > len(m.Migrations) {
+		return &VersionSkewError{DatabaseVersion: currentVersion, LatestVersion: len(m.Migrations)}
+	}
+	return nil
+}
+
+// approve calls Approve with the plan, if it's set and the plan has steps.
+func (m *Migrator) approve(ctx context.Context, plan *Plan) error {
+	if m.Approve == nil || len(plan.Steps) == 0 {
+		return nil
+	}
+	if err := m.Approve(ctx, plan); err != nil {
+		return fmt.Errorf("migrations were not approved: %w", err)
+	}
+	return nil
+}
+
+// checkOptions returns an error if the options set on the migrator aren't
+// supported by the adapter's dialect.
+func (m *Migrator) checkOptions() error {
+	if err := m.checkPhases(); err != nil {
+		return err
+	}
+	if m.VerifyKey != nil {
+		if err := VerifyMigrations(m.VerifyKey, m.Migrations); err != nil {
+			return err
+		}
+	}
+	if err := m.checkPooler(); err != nil {
+		return err
+	}
+	if m.VerifyInserts && versionVerifier(m.Adapter) == nil {
+		return errors.New("adapter must implement VersionVerifier to verify inserts")
+	}
+	if d := dialectOf(m.Adapter); m.NotifyChannel != "" && d != DialectPostgreSQL {
+		return fmt.Errorf("notifications are not supported for dialect %q", d)
+	}
+	if d := dialectOf(m.Adapter); m.RequirePrimary && d != DialectPostgreSQL && d != DialectMySQL {
+		return fmt.Errorf("checking for a primary is not supported for dialect %q", d)
+	}
+	if d := dialectOf(m.Adapter); m.Analyze && d != DialectPostgreSQL && d != DialectMySQL && d != DialectSQLite {
+		return fmt.Errorf("analyzing tables is not supported for dialect %q", d)
+	}
+	return nil
+}
+
+// notify sends a notification on NotifyChannel if the version changed.
+func (m *Migrator) notify(ctx context.Context, db *sql.DB, from, to int) error {
+	if m.NotifyChannel == "" || from == to {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, "SELECT pg_notify($1, $2)", m.NotifyChannel, strconv.Itoa(to)); err != nil {
+		return fmt.Errorf("error notifying channel %s: %w", m.NotifyChannel, err)
+	}
+	return nil
+}
+
+// analyze refreshes the statistics for the tables changed by the migrations
+// after from, up to and including to, if Analyze is set.
+func (m *Migrator) analyze(ctx context.Context, db *sql.DB, from, to int) {
+	if !m.Analyze {
+		return
+	}
+	prefix := "ANALYZE "
+	if dialectOf(m.Adapter) == DialectMySQL {
+		prefix = "ANALYZE TABLE "
+	}
+	seen := map[string]bool{}
+	for i := from; i < to && i < len(m.Migrations); i++ {
+		for _, table := range m.Migrations[i].AnalyzeTables {
+			if seen[table] {
+				continue
+			}
+			seen[table] = true
+			m.Adapter.Log("Analyzing table %s", table)
+			if _, err := db.ExecContext(ctx, prefix+table); err != nil {
+				m.Adapter.Log("Error analyzing table %s: %s", table, err)
+			}
+		}
+	}
+}
+
+// ConfirmFunc is called by Prepare after the migrations have been applied,
+// but before they are committed. The db passed to it is pinned to the
+// connection running the transaction, so queries made with it can see the
+// changes made by the migrations.
+type ConfirmFunc func(ctx context.Context, db *sql.DB) error
+
+// Prepare migrates the database to the specified version in a transaction,
+// and then calls confirm before committing the transaction. If the migrations
+// or confirm return an error, the transaction is rolled back and the database
+// is left at its original version. This can be used to run smoke checks
+// against the new schema before deciding whether to keep it.
+//
+// This is only supported for DialectPostgreSQL and DialectSQLite, since they
+// support DDL inside transactions. Migrations run by Prepare must not start
+// their own transactions, since that would commit the outer transaction
+// early. Helpers like CopyFS and LoadCSV, which usually do, run their
+// statements in the outer transaction instead. While the transaction is open,
+// the migrations may hold locks that block other connections, so confirm
+// should use the db passed to it rather than the application's connection
+// pool, and should finish quickly.
+//
+// Before anything is applied, the UpQueries of the pending migrations are
+// checked for statements that can't be run inside a transaction, such as
+// CREATE INDEX CONCURRENTLY or VACUUM, and an error is returned if any are
+// found. Those migrations must be applied with Up or UpToVersion instead.
+func (m *Migrator) Prepare(ctx context.Context, targetVersion int, confirm ConfirmFunc) error {
+	if d := dialectOf(m.Adapter); d != DialectPostgreSQL && d != DialectSQLite {
+		return fmt.Errorf("transactional migrations are not supported for dialect %q", d)
+	}
+	if err := m.checkOptions(); err != nil {
+		return err
+	}
+	if err := checkTarget(m.Migrations, targetVersion); err != nil {
+		return err
+	}
+	ctx, done := m.startRun(ctx)
+	defer done()
+	ctx = withMetadata(ctx, m.Metadata)
+	return m.session(ctx, true, func(db *sql.DB) error {
+		if _, err := db.ExecContext(ctx, "BEGIN"); err != nil {
+			return fmt.Errorf("error beginning transaction: %w", err)
+		}
+		from, to, err := m.upToVersion(withTransaction(ctx), db, targetVersion, PhasePostDeploy, true, nil)
+		if err == nil {
+			if err = confirm(ctx, db); err != nil {
+				err = fmt.Errorf("error confirming migrations: %w", err)
+			}
+		}
+		if err != nil {
+			m.Adapter.Log("Rolling back migrations")
+			if _, rollbackErr := db.ExecContext(withoutCancel(ctx), "ROLLBACK"); rollbackErr != nil {
+				return &sessionError{fmt.Errorf("%w (rollback also failed: %s)", err, rollbackErr)}
+			}
+			// The failure is recorded after rolling back, so that it isn't
+			// rolled back along with everything else.
+			m.recordFailure(ctx, db, err)
+			return err
+		}
+		if _, err := db.ExecContext(ctx, "COMMIT"); err != nil {
+			return fmt.Errorf("error committing migrations: %w", err)
+		}
+		m.analyze(ctx, db, from, to)
+		return m.notify(ctx, db, from, to)
+	})
+}
+
+// sessionError is returned by the functions passed to session when the state
+// of the connection is unknown, so it should be closed rather than being
+// returned to the pool.
+type sessionError struct {
+	err error
+}
+
+func (e *sessionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *sessionError) Unwrap() error {
+	return e.err
+}
+
+// session calls f with the database that migrations should be run against.
+// This is usually just DB, but if pin is true or any session options are set,
+// f is called with a database pinned to a single connection with those
+// options applied.
+func (m *Migrator) session(ctx context.Context, pin bool, f func(db *sql.DB) error) error {
+	if m.RequirePrimary {
+		f = m.checkPrimary(ctx, f)
+	}
+	if m.Preflight != nil {
+		f = m.preflight(ctx, f)
+	}
+	m.warnPooler(ctx)
+	if !pin && !m.pinned() {
+		return f(m.runDB())
+	}
+	var role *roleSwitch
+	var lock *advisoryLock
+	if m.Role != "" {
+		var err error
+		if role, err = newRoleSwitch(dialectOf(m.Adapter), m.Role); err != nil {
+			return err
+		}
+	}
+	if m.LockName != "" {
+		var err error
+		if lock, err = newAdvisoryLock(dialectOf(m.Adapter), m.LockName); err != nil {
+			return err
+		}
+	}
+	return pinDB(ctx, m.runDB(), func(db *sql.DB) (bool, error) {
+		if lock != nil {
+			if err := m.acquireLock(ctx, db, lock); err != nil {
+				return false, err
+			}
+		}
+		m.trackConnection(ctx, db)
+		discard, err := m.sessionRole(ctx, db, role, f)
+		// Like the role, the lock must be released even if the context has
+		// been cancelled. Closing the connection also releases it.
+		if lock != nil && !discard {
+			if _, unlockErr := db.ExecContext(withoutCancel(ctx), lock.unlock, lock.arg); unlockErr != nil {
+				m.Adapter.Log("Error releasing lock, closing connection: %s", unlockErr)
+				return true, err
+			}
+		}
+		return discard, err
+	})
+}
+
+// pinned returns true if the session options require runs to be pinned to a
+// single connection.
+func (m *Migrator) pinned() bool {
+	return m.SingleConnection || m.Role != "" || m.LockName != ""
+}
+
+// sessionRole calls f after switching to the role, if it isn't nil, and then
+// switches back. It returns true if the connection should be discarded.
+func (m *Migrator) sessionRole(ctx context.Context, db *sql.DB, role *roleSwitch, f func(db *sql.DB) error) (bool, error) {
+	var reset string
+	if role != nil {
+		reset = role.reset
+		if role.current != "" {
+			var current sql.NullString
+			if err := db.QueryRowContext(ctx, role.current).Scan(&current); err != nil {
+				return false, fmt.Errorf("error querying current role: %w", err)
+			}
+			if current.String == "" {
+				current.String = "NONE"
+			}
+			reset += current.String
+		}
+		if _, err := db.ExecContext(ctx, role.set); err != nil {
+			return false, fmt.Errorf("error setting role %s: %w", m.Role, err)
+		}
+	}
+	err := f(db)
+	if se, ok := err.(*sessionError); ok {
+		m.Adapter.Log("Closing connection after error: %s", se)
+		return true, se.err
+	}
+	// The role must be reset even if the context has been cancelled, or
+	// the connection would go back to the pool with the wrong role.
+	if reset != "" {
+		if _, resetErr := db.ExecContext(withoutCancel(ctx), reset); resetErr != nil {
+			m.Adapter.Log("Error resetting role, closing connection: %s", resetErr)
+			return true, err
+		}
+	}
+	return false, err
+}
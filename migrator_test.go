@@ -0,0 +1,728 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMigratorRole(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		Role:       `schema"owner`,
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 5 {
+		t.Fatalf("expected 5 queries, got %#v", md.ExecLogs)
+	}
+	if q := md.ExecLogs[0].Query; q != `SET ROLE "schema""owner"` {
+		t.Errorf("expected first query to set the role, got %q", q)
+	}
+	if q := md.ExecLogs[2].Query; q != "example query" {
+		t.Errorf("expected migration to run with the role, got %q", q)
+	}
+	if q := md.ExecLogs[4].Query; q != "RESET ROLE" {
+		t.Errorf("expected last query to reset the role, got %q", q)
+	}
+}
+
+func TestMigratorRoleUnsupported(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf), Role: "owner"}
+	err := m.Up(ctx)
+	expectedErr := errors.New(`switching roles is not supported for dialect "sqlite"`)
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	md.Check(t, MockData{})
+}
+
+func TestMigratorPrepare(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+	}
+	confirmed := false
+	err := m.Prepare(WithoutQueryComments(ctx), 1, func(ctx context.Context, db *sql.DB) error {
+		confirmed = true
+		if n := len(md.ExecLogs); n != 4 {
+			t.Errorf("expected 4 queries before confirming, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !confirmed {
+		t.Error("expected confirm to be called")
+	}
+	if len(md.ExecLogs) != 5 || md.ExecLogs[0].Query != "BEGIN" || md.ExecLogs[4].Query != "COMMIT" {
+		t.Errorf("expected migrations to be wrapped in a transaction, got %#v", md.ExecLogs)
+	}
+
+	md.Reset()
+	err = m.Prepare(ctx, 1, func(ctx context.Context, db *sql.DB) error {
+		return errors.New("smoke test failed")
+	})
+	expectedErr := errors.New("error confirming migrations: smoke test failed")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	if n := len(md.ExecLogs); n != 5 || md.ExecLogs[n-1].Query != "ROLLBACK" {
+		t.Errorf("expected migrations to be rolled back, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMigratorPrepareUnsupported(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{DB: db, Adapter: NewMySQLAdapter(t.Logf)}
+	err := m.Prepare(ctx, 1, nil)
+	expectedErr := errors.New(`transactional migrations are not supported for dialect "mysql"`)
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestMigratorNotifyChannel(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}, DownQueries: []string{}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}, DownQueries: []string{}},
+		},
+		NotifyChannel: "migrate_events",
+	}
+	md.QueryRows.Version = 1
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	last := md.ExecLogs[len(md.ExecLogs)-1]
+	if last.Query != "SELECT pg_notify($1, $2)" || len(last.Args) != 2 || last.Args[0].Value != "migrate_events" || last.Args[1].Value != "2" {
+		t.Errorf("expected notification for version 2, got %#v", last)
+	}
+
+	// Nothing is sent if the version didn't change.
+	md.Reset()
+	md.QueryRows.Version = 2
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 {
+		t.Errorf("expected no notification, got %#v", md.ExecLogs)
+	}
+
+	md.Reset()
+	md.QueryRows.Version = 2
+	if err := m.DownToVersion(ctx, 0); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	last = md.ExecLogs[len(md.ExecLogs)-1]
+	if last.Query != "SELECT pg_notify($1, $2)" || len(last.Args) != 2 || last.Args[1].Value != "0" {
+		t.Errorf("expected notification for version 0, got %#v", last)
+	}
+
+	m.Adapter = NewMySQLAdapter(t.Logf)
+	err := m.Up(ctx)
+	expectedErr := errors.New(`notifications are not supported for dialect "mysql"`)
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestMigratorRecordFailure(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.FailuresTableName = "schema_version_failures"
+	m := &Migrator{
+		DB:      db,
+		Adapter: adapter,
+		Migrations: []Migration{{
+			Comment: "example comment",
+			Up: func(ctx context.Context, db *sql.DB) error {
+				return errors.New("mock error")
+			},
+		}},
+	}
+	err := m.Up(ctx)
+	var me *MigrationError
+	if !errors.As(err, &me) || me.Version != 1 || !me.Upgrade {
+		t.Fatalf("expected *MigrationError for version 1, got %#v", err)
+	}
+	if len(md.ExecLogs) != 3 {
+		t.Fatalf("expected 3 queries, got %#v", md.ExecLogs)
+	}
+	last := md.ExecLogs[2]
+	if normalizeQuery(last.Query) != "INSERT INTO schema_version_failures (version, upgrade, comment, error) VALUES ($1, $2, $3, $4)" {
+		t.Errorf("expected failure to be inserted, got %q", last.Query)
+	}
+	if len(last.Args) != 4 || last.Args[0].Value != int64(1) || last.Args[1].Value != true ||
+		last.Args[2].Value != "example comment" || last.Args[3].Value != "mock error" {
+		t.Errorf("unexpected args %#v", last.Args)
+	}
+
+	// Failures aren't recorded unless the table name is set.
+	md.Reset()
+	adapter.FailuresTableName = ""
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(md.ExecLogs) != 1 {
+		t.Errorf("expected no failure to be recorded, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMigratorParallelism(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	independent := func(ctx context.Context, db *sql.DB) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "1", Up: independent, Independent: true},
+			{Comment: "2", Up: independent, Independent: true},
+			{Comment: "3", Up: independent, Independent: true},
+			{Comment: "4", UpQueries: []string{"example query"}},
+		},
+		Parallelism: 2,
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("expected 2 migrations to run concurrently, got %d", maxRunning)
+	}
+	var versions []interface{}
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "INSERT INTO schema_versions") {
+			versions = append(versions, l.Args[0].Value)
+		}
+	}
+	if fmt.Sprint(versions) != "[1 2 3 4]" {
+		t.Errorf("expected versions to be recorded in order, got %v", versions)
+	}
+}
+
+func TestMigratorParallelismSingleConnection(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	independent := func(ctx context.Context, db *sql.DB) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "1", Up: independent, Independent: true},
+			{Comment: "2", Up: independent, Independent: true},
+			{Comment: "3", Up: independent, Independent: true},
+		},
+		Parallelism:      2,
+		SingleConnection: true,
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if maxRunning != 1 {
+		t.Errorf("expected migrations to run one at a time on the pinned connection, got %d", maxRunning)
+	}
+}
+
+func TestMigratorPriority(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var mu sync.Mutex
+	var started []int
+	independent := func(version int) MigrationFunc {
+		return func(ctx context.Context, db *sql.DB) error {
+			mu.Lock()
+			started = append(started, version)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}
+	}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "1", Up: independent(1), Independent: true},
+			{Comment: "2", Up: independent(2), Independent: true},
+			{Comment: "3", Up: independent(3), Independent: true, Priority: 1},
+		},
+		Parallelism: 2,
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Versions 3 and 1 are started first, and version 2 waits for one of
+	// them to finish.
+	if len(started) != 3 || started[2] != 2 {
+		t.Errorf("expected version 2 to be started last, got %v", started)
+	}
+	var versions []interface{}
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "INSERT INTO schema_versions") {
+			versions = append(versions, l.Args[0].Value)
+		}
+	}
+	if fmt.Sprint(versions) != "[1 2 3]" {
+		t.Errorf("expected versions to be recorded in order, got %v", versions)
+	}
+}
+
+func TestMigratorParallelismError(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "1", UpQueries: []string{}, Independent: true},
+			{Comment: "2", Up: func(ctx context.Context, db *sql.DB) error {
+				return errors.New("mock error")
+			}, Independent: true},
+			{Comment: "3", UpQueries: []string{}, Independent: true},
+		},
+		Parallelism: 3,
+	}
+	err := m.Up(ctx)
+	expectedErr := errors.New("error upgrading database to version 2: mock error")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	if len(md.ExecLogs) != 2 || md.ExecLogs[1].Args[0].Value != int64(1) {
+		t.Errorf("expected only version 1 to be recorded, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMigratorSingleConnection(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:               db,
+		Adapter:          NewSQLiteAdapter(t.Logf),
+		Migrations:       []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		SingleConnection: true,
+	}
+	var pinned *sql.DB
+	m.Migrations[0].Up = func(ctx context.Context, db *sql.DB) error {
+		pinned = db
+		return nil
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if pinned == nil || pinned == db {
+		t.Error("expected migration to run on a pinned database")
+	}
+	if len(md.ExecLogs) != 2 {
+		t.Errorf("expected 2 queries, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMigratorLockName(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		LockName:   "migrate",
+		Role:       "owner",
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 7 {
+		t.Fatalf("expected 7 queries, got %#v", md.ExecLogs)
+	}
+	first, last := md.ExecLogs[0], md.ExecLogs[6]
+	if first.Query != "SELECT pg_advisory_lock($1)" || last.Query != "SELECT pg_advisory_unlock($1)" {
+		t.Errorf("expected lock to be held around the migrations, got %q and %q", first.Query, last.Query)
+	}
+	if first.Args[0].Value != last.Args[0].Value {
+		t.Errorf("expected the same lock to be released, got %v and %v", first.Args[0].Value, last.Args[0].Value)
+	}
+	if q := md.ExecLogs[1].Query; q != `SET ROLE "owner"` {
+		t.Errorf("expected role to be set after locking, got %q", q)
+	}
+}
+
+func TestMigratorLockError(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.ExecErr = errors.New("mock error")
+	m := &Migrator{DB: db, Adapter: NewMySQLAdapter(t.Logf), LockName: "migrate"}
+	err := m.Up(ctx)
+	var le *LockError
+	if !errors.As(err, &le) || le.Name != "migrate" {
+		t.Errorf("expected *LockError, got %v", err)
+	}
+}
+
+func TestMigratorRejectNewerDatabase(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 3
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	m.RejectNewerDatabase = true
+	for _, f := range []func() error{
+		func() error { return m.Up(ctx) },
+		func() error { return m.DownToVersion(ctx, 0) },
+	} {
+		err := f()
+		var se *VersionSkewError
+		if !errors.As(err, &se) || se.DatabaseVersion != 3 || se.LatestVersion != 1 {
+			t.Errorf("expected a *VersionSkewError, got %v", err)
+		}
+	}
+	if len(md.ExecLogs) != 3 {
+		t.Errorf("expected no migrations to be run, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMigratorLockTimeout(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	tests := []struct {
+		Name     string
+		Timeout  time.Duration
+		Version  int
+		Expected error
+	}{
+		{"Acquired", time.Second, 1, nil},
+		{"FailFast", -1, 0, ErrLockHeld},
+		{"Timeout", 20 * time.Millisecond, 0, ErrLockTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			md.Reset()
+			md.QueryRows.Version = tt.Version
+			m := &Migrator{
+				DB:               db,
+				Adapter:          NewMySQLAdapter(t.Logf),
+				LockName:         "migrate",
+				LockTimeout:      tt.Timeout,
+				LockPollInterval: 5 * time.Millisecond,
+			}
+			err := m.Up(ctx)
+			var le *LockError
+			if tt.Expected == nil {
+				if err != nil {
+					t.Errorf("unexpected err: %v", err)
+				}
+			} else if !errors.Is(err, tt.Expected) || !errors.As(err, &le) {
+				t.Errorf("expected *LockError wrapping %v, got %v", tt.Expected, err)
+			}
+			if q := md.QueryLogs[0].Query; q != "SELECT GET_LOCK(?, 0)" {
+				t.Errorf("expected the lock to be polled, got %q", q)
+			}
+			if tt.Name == "Timeout" && len(md.QueryLogs) < 2 {
+				t.Errorf("expected the lock to be tried more than once, got %#v", md.QueryLogs)
+			}
+		})
+	}
+}
+
+func TestMigratorLockStaleAfter(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows = MockRows{Cols: []string{"result"}, Values: [][]driver.Value{{int64(0)}, {int64(42)}, {int64(1)}}}
+	m := &Migrator{
+		DB:               db,
+		Adapter:          NewPostgreSQLAdapter(t.Logf),
+		LockName:         "migrate",
+		LockTimeout:      -1,
+		LockPollInterval: time.Millisecond,
+		LockStaleAfter:   time.Minute,
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if args := md.QueryLogs[1].Args; len(args) != 2 || args[1].Value != int64(60) {
+		t.Errorf("expected the stale threshold in seconds, got %#v", args)
+	}
+	if q := md.ExecLogs[0].Query; q != "SELECT pg_terminate_backend(42)" {
+		t.Errorf("expected the holder to be terminated, got %q", q)
+	}
+	if q := md.QueryLogs[2].Query; q != "SELECT pg_try_advisory_lock($1)::int" {
+		t.Errorf("expected the lock to be tried again, got %q", q)
+	}
+}
+
+func TestMigratorAnalyze(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 1
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewMySQLAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}, AnalyzeTables: []string{"skipped"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}, AnalyzeTables: []string{"users"}},
+			{Comment: "example comment 3", UpQueries: []string{"example query 3"}, AnalyzeTables: []string{"users", "posts"}},
+		},
+		Analyze: true,
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var analyzed []string
+	for _, l := range md.ExecLogs {
+		if strings.HasPrefix(l.Query, "ANALYZE") {
+			analyzed = append(analyzed, l.Query)
+		}
+	}
+	if fmt.Sprint(analyzed) != "[ANALYZE TABLE users ANALYZE TABLE posts]" {
+		t.Errorf("unexpected analyze queries %q", analyzed)
+	}
+	if q := md.ExecLogs[len(md.ExecLogs)-1].Query; q != "ANALYZE TABLE posts" {
+		t.Errorf("expected tables to be analyzed after the migrations, got %q", q)
+	}
+
+	m.Adapter = NewClickHouseAdapter(t.Logf)
+	expected := `analyzing tables is not supported for dialect "clickhouse"`
+	if err := m.Up(ctx); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestMigratorCachePrepare(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf), CachePrepare: true}
+	for i := 0; i < 2; i++ {
+		if err := m.Up(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if len(md.ExecLogs) != 1 || !strings.Contains(md.ExecLogs[0].Query, "CREATE TABLE IF NOT EXISTS") {
+		t.Errorf("expected the version table to be prepared once, got %#v", md.ExecLogs)
+	}
+	if len(md.QueryLogs) != 2 {
+		t.Errorf("expected the version to be queried each time, got %#v", md.QueryLogs)
+	}
+
+	md.Reset()
+	md.ExecErr = errors.New("mock error")
+	m = &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf), CachePrepare: true}
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	md.ExecErr = nil
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 {
+		t.Errorf("expected a failed prepare not to be cached, got %#v", md.ExecLogs)
+	}
+}
+
+func TestMigratorApprove(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var plans []*Plan
+	approveErr := errors.New("change request rejected")
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}, DownQueries: []string{"example query 2"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 3"}},
+		},
+		Approve: func(ctx context.Context, plan *Plan) error {
+			plans = append(plans, plan)
+			return approveErr
+		},
+	}
+	err := m.Up(ctx)
+	expectedErr := "migrations were not approved: change request rejected"
+	if err == nil || err.Error() != expectedErr || !errors.Is(err, approveErr) {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "example query") {
+			t.Errorf("expected no migrations to be run, got %q", l.Query)
+		}
+	}
+	if len(plans) != 1 || plans[0].CurrentVersion != 0 || len(plans[0].Steps) != 2 || !plans[0].Steps[1].Upgrade {
+		t.Errorf("expected a plan for both migrations, got %#v", plans)
+	}
+
+	md.QueryRows.Version = 1
+	if err := m.DownToVersion(ctx, 0); err == nil {
+		t.Error("expected the downgrade not to be approved")
+	}
+	if len(plans) != 2 || len(plans[1].Steps) != 1 || plans[1].Steps[0].Upgrade {
+		t.Errorf("expected a plan for the downgrade, got %#v", plans[1])
+	}
+
+	md.QueryRows.Version = 2
+	if err := m.Up(ctx); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if len(plans) != 2 {
+		t.Error("expected Approve not to be called when there's nothing to run")
+	}
+}
+
+func TestMigratorReadDB(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+	closed, _, _ := setupMockDB(t)
+	closed.Close()
+
+	md.QueryRows.Version = 1
+	m := &Migrator{
+		DB:      closed,
+		ReadDB:  db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+		},
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if status != (Status{CurrentVersion: 1, LatestVersion: 2, Pending: 1}) {
+		t.Errorf("unexpected status %#v", status)
+	}
+	plan, err := m.PlanUpToVersion(ctx, 2)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].Version != 2 {
+		t.Errorf("unexpected plan %#v", plan)
+	}
+	if result := runResult(ctx, RunConfig{Migrator: m, DryRun: true}); result.Status != "pending" {
+		t.Errorf("expected the dry run to use ReadDB, got %#v", result)
+	}
+	if len(md.ExecLogs) != 0 {
+		t.Errorf("expected the schema versions not to be prepared, got %#v", md.ExecLogs)
+	}
+	if err := m.Up(ctx); err == nil {
+		t.Error("expected Up to use DB")
+	}
+}
+
+func TestMigratorRoleMySQL(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{{Pattern: `CURRENT_ROLE\(\)`, Rows: MockRows{
+		Cols:   []string{"CURRENT_ROLE()"},
+		Values: [][]driver.Value{{"`app`@`%`,`reader`@`%`"}},
+	}}}
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewMySQLAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		Role:       "owner",
+	}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queried bool
+	for _, l := range md.QueryLogs {
+		queried = queried || l.Query == "SELECT CURRENT_ROLE()"
+	}
+	if !queried {
+		t.Errorf("expected the current roles to be queried, got %#v", md.QueryLogs)
+	}
+	first, last := md.ExecLogs[0].Query, md.ExecLogs[len(md.ExecLogs)-1].Query
+	if first != "SET ROLE `owner`" {
+		t.Errorf("expected first query to set the role, got %q", first)
+	}
+	if last != "SET ROLE `app`@`%`,`reader`@`%`" {
+		t.Errorf("expected last query to restore the previous roles, got %q", last)
+	}
+
+	md.Reset()
+	md.QueryResults = []MockQueryResult{{Pattern: `CURRENT_ROLE\(\)`, Rows: MockRows{
+		Cols:   []string{"CURRENT_ROLE()"},
+		Values: [][]driver.Value{{"NONE"}},
+	}}}
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if last := md.ExecLogs[len(md.ExecLogs)-1].Query; last != "SET ROLE NONE" {
+		t.Errorf("expected last query to restore no roles, got %q", last)
+	}
+}
@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Sleep pauses for d, or until ctx is done, in which case it returns the
+// context's error. If the context's deadline is before the pause would end,
+// it returns context.DeadlineExceeded immediately, rather than sleeping until
+// the deadline only to fail anyway.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Pacer throttles batched data migrations, so that large backfills don't
+// compete with the application for the database. The zero value doesn't
+// throttle at all.
+type Pacer struct {
+	// Delay is the minimum time to pause after each batch.
+	Delay time.Duration
+
+	// RowsPerSecond limits the average number of rows processed per second,
+	// measured from the first batch. If it's zero, the rate isn't limited.
+	RowsPerSecond float64
+
+	start time.Time
+	rows  float64
+}
+
+// Wait should be called after each batch, with the number of rows the batch
+// processed. It pauses for Delay, or longer if needed to keep the average
+// rate under RowsPerSecond. It returns an error if the context is done
+// before the pause ends.
+func (p *Pacer) Wait(ctx context.Context, rows int64) error {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	p.rows += float64(rows)
+	d := p.Delay
+	if p.RowsPerSecond > 0 {
+		target := time.Duration(p.rows / p.RowsPerSecond * float64(time.Second))
+		if wait := target - time.Since(p.start); wait > d {
+			d = wait
+		}
+	}
+	return Sleep(ctx, d)
+}
+
+// ExecBatches returns a migration function that executes a query repeatedly
+// until it affects no rows, pausing between batches as configured by pacer.
+// This is intended for backfills that change a limited number of rows at a
+// time, so that no single query holds locks for long, like:
+//
+//	UPDATE users SET name_lower = lower(name)
+//	WHERE id IN (SELECT id FROM users WHERE name_lower IS NULL LIMIT 1000)
+//
+// The query must stop matching rows once they've been changed, or the
+// function will never return.
+func ExecBatches(query string, pacer Pacer) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		p := pacer
+		q := rewriteQuery(ctx, query)
+		for batch := 0; ; batch++ {
+			logQuery(ctx, q, nil)
+			result, err := db.ExecContext(ctx, q)
+			if err != nil {
+				return fmt.Errorf("error with batch %d: %w", batch, err)
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error with batch %d: %w", batch, err)
+			}
+			if n == 0 {
+				return nil
+			}
+			if err := p.Wait(ctx, n); err != nil {
+				return err
+			}
+		}
+	}
+}
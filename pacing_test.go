@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if err := Sleep(ctx, time.Millisecond); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	start := time.Now()
+	if err := Sleep(ctx, 2*time.Hour); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected Sleep to return without waiting for the deadline")
+	}
+	cancel()
+	if err := Sleep(ctx, time.Millisecond); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPacer(t *testing.T) {
+	p := Pacer{RowsPerSecond: 1000}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := p.Wait(context.Background(), 10); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("expected 30 rows at 1000 rows/sec to take at least 30ms, took %s", d)
+	}
+}
+
+func TestExecBatches(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.RowsAffected = []int64{1000, 1000, 10}
+	pacer := Pacer{Delay: time.Millisecond}
+	if err := ExecBatches("example backfill", pacer)(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 4 {
+		t.Errorf("expected 4 batches, got %#v", md.ExecLogs)
+	}
+
+	md.Reset()
+	md.RowsAffected = []int64{1000}
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := ExecBatches("example backfill", Pacer{})(ctx, db); err == nil {
+		t.Error("expected an error after the context was cancelled")
+	}
+}
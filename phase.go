@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Phase is the stage of a deploy that a migration should be applied in. This
+// supports expand and contract schema changes, where a pre-deploy migration
+// adds a column before new code that uses it is deployed, and a post-deploy
+// migration removes an old column once no running code uses it.
+type Phase string
+
+// These are the phases, in the order they're applied.
+const (
+	// PhasePreDeploy migrations are applied before new code is deployed.
+	// It's the default for migrations that don't specify a phase.
+	PhasePreDeploy Phase = "pre-deploy"
+
+	// PhasePostDeploy migrations are applied after new code is deployed.
+	PhasePostDeploy Phase = "post-deploy"
+)
+
+// rank returns the position of the phase in the order phases are applied,
+// or -1 if the phase isn't known.
+func (p Phase) rank() int {
+	switch p {
+	case "", PhasePreDeploy:
+		return 0
+	case PhasePostDeploy:
+		return 1
+	}
+	return -1
+}
+
+// UpPhase applies pending migrations in phases up to and including phase. The
+// versions of the migrations are still applied in order, so it stops before
+// the first pending migration from a later phase, even if there are
+// migrations for earlier phases after it.
+func (m *Migrator) UpPhase(ctx context.Context, phase Phase) error {
+	if phase.rank() < 0 {
+		return fmt.Errorf("unknown phase %q", phase)
+	}
+	_, _, err := m.migrateUp(ctx, len(m.Migrations), phase, nil)
+	return err
+}
+
+// UpPhase applies pending migrations in phases up to and including phase. See
+// Migrator.UpPhase for more information.
+func UpPhase(ctx context.Context, db *sql.DB, adapter Adapter, phase Phase, migrations []Migration) error {
+	m := &Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	return m.UpPhase(ctx, phase)
+}
+
+// phaseTarget returns the version to migrate up to, given the target version,
+// so that no migrations in phases after phase are applied.
+func (m *Migrator) phaseTarget(currentVersion, targetVersion int, phase Phase) int {
+	for i := currentVersion; i < targetVersion && i < len(m.Migrations); i++ {
+		if mi := m.Migrations[i]; mi.Phase.rank() > phase.rank() {
+			m.Adapter.Log("Stopping before version %d, which is in the %s phase", i+1, mi.Phase)
+			return i
+		}
+	}
+	return targetVersion
+}
+
+// checkPhases returns an error if any of the migrations have an unknown
+// phase.
+func (m *Migrator) checkPhases() error {
+	for i, mi := range m.Migrations {
+		if mi.Phase.rank() < 0 {
+			return fmt.Errorf("unknown phase %q for version %d", mi.Phase, i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"testing"
+)
+
+func TestUpPhase(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	ctx = WithoutQueryComments(ctx)
+	adapter := NewSQLiteAdapter(t.Logf)
+	migrations := []Migration{
+		{Comment: "add column", UpQueries: []string{"add column"}},
+		{Comment: "drop column", UpQueries: []string{"drop column"}, Phase: PhasePostDeploy},
+		{Comment: "add table", UpQueries: []string{"add table"}, Phase: PhasePreDeploy},
+	}
+	queries := func() []string {
+		var queries []string
+		for _, l := range md.ExecLogs {
+			switch l.Query {
+			case "add column", "drop column", "add table":
+				queries = append(queries, l.Query)
+			}
+		}
+		return queries
+	}
+
+	if err := Up(ctx, db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := queries(); len(q) != 1 || q[0] != "add column" {
+		t.Errorf("expected Up to stop before the post-deploy migration, got %v", q)
+	}
+
+	md.Reset()
+	if err := UpPhase(ctx, db, adapter, PhasePostDeploy, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := queries(); len(q) != 3 {
+		t.Errorf("expected every migration to be applied, got %v", q)
+	}
+
+	expected := `unknown phase "during-deploy"`
+	if err := UpPhase(ctx, db, adapter, "during-deploy", migrations); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	migrations[2].Phase = "during-deploy"
+	expected = `unknown phase "during-deploy" for version 3`
+	if err := Up(ctx, db, adapter, migrations); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
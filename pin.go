@@ -0,0 +1,108 @@
+//go:build go1.17
+// +build go1.17
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// pinDB calls f with a *sql.DB that sends every query to the same underlying
+// connection from db. This is needed for things that depend on session state,
+// like the current role, which would otherwise only apply to whichever pooled
+// connection happened to run the query that set them. If f returns true, the
+// connection is closed instead of being returned to the pool, which should be
+// done if the session state couldn't be restored.
+func pinDB(ctx context.Context, db *sql.DB, f func(db *sql.DB) (bool, error)) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var ferr error
+	err = conn.Raw(func(dc interface{}) error {
+		pinned := sql.OpenDB(pinnedConnector{conn: pinnedConn{dc.(driver.Conn)}, driver: db.Driver()})
+		pinned.SetMaxOpenConns(1)
+		var discard bool
+		discard, ferr = f(pinned)
+		pinned.Close()
+		if discard {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// pinnedConnector always returns the same connection.
+type pinnedConnector struct {
+	conn   pinnedConn
+	driver driver.Driver
+}
+
+func (c pinnedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c pinnedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// pinnedConn wraps a connection owned by another *sql.DB. Closing it does
+// nothing, since the connection is still owned by the other pool. It forwards
+// the optional driver interfaces to the wrapped connection, or returns
+// driver.ErrSkip so database/sql falls back to the default behavior.
+type pinnedConn struct {
+	driver.Conn
+}
+
+func (c pinnedConn) Close() error {
+	return nil
+}
+
+func (c pinnedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c pinnedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c pinnedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c pinnedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c pinnedConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c pinnedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !go1.17
+// +build !go1.17
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// pinDB requires sql.Conn.Raw, which was added in Go 1.17.
+func pinDB(ctx context.Context, db *sql.DB, f func(db *sql.DB) (bool, error)) error {
+	return errors.New("running migrations on a single connection requires Go 1.17")
+}
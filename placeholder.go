@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var dollarQuoteTag = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z_0-9]*)?\$`)
+
+// TranslatePlaceholders rewrites the ? placeholders in a query to the syntax
+// of the dialect, so that one set of queries can be run against several
+// databases. For DialectPostgreSQL, each ? is replaced with $1, $2 and so on,
+// and ?? is replaced with a literal ?, for operators like jsonb's ? operator.
+// Placeholders inside quotes, comments and dollar quoted strings are left
+// alone. Queries for other dialects are returned unchanged, since they
+// already use ?.
+func TranslatePlaceholders(dialect Dialect, query string) string {
+	if dialect != DialectPostgreSQL || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		j := i
+		switch {
+		case c == '\'' || c == '"':
+			for j++; j < len(query) && query[j] != c; j++ {
+			}
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for j < len(query) && query[j] != '\n' {
+				j++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			if end := strings.Index(query[i+2:], "*/"); end < 0 {
+				j = len(query)
+			} else {
+				j = i + end + 3
+			}
+		case c == '$':
+			if tag := dollarQuoteTag.FindString(query[i:]); tag != "" {
+				if end := strings.Index(query[i+len(tag):], tag); end < 0 {
+					j = len(query)
+				} else {
+					j = i + len(tag) + end + len(tag) - 1
+				}
+			}
+		case c == '?' && i+1 < len(query) && query[i+1] == '?':
+			b.WriteByte('?')
+			i++
+			continue
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		if j >= len(query) {
+			j = len(query) - 1
+		}
+		b.WriteString(query[i : j+1])
+		i = j
+	}
+	return b.String()
+}
+
+// RewritePlaceholders is a RewriteFunc that translates ? placeholders with
+// TranslatePlaceholders, for the dialect of the adapter running the
+// migration. Register it with WithRewriter so that migrations written with ?
+// placeholders can be run with any adapter:
+//
+//	ctx = migrate.WithRewriter(ctx, migrate.RewritePlaceholders)
+func RewritePlaceholders(ctx context.Context, query string) string {
+	return TranslatePlaceholders(dialectFromContext(ctx), query)
+}
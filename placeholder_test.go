@@ -0,0 +1,41 @@
+package migrate
+
+import "testing"
+
+func TestTranslatePlaceholders(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Dialect  Dialect
+		Query    string
+		Expected string
+	}{
+		{"MySQL", DialectMySQL, "INSERT INTO a (b, c) VALUES (?, ?)", "INSERT INTO a (b, c) VALUES (?, ?)"},
+		{"PostgreSQL", DialectPostgreSQL, "INSERT INTO a (b, c) VALUES (?, ?)", "INSERT INTO a (b, c) VALUES ($1, $2)"},
+		{"Escaped", DialectPostgreSQL, "SELECT * FROM a WHERE b ?? 'c' AND d = ?", "SELECT * FROM a WHERE b ? 'c' AND d = $1"},
+		{"Quoted", DialectPostgreSQL, `SELECT '?', "?", ? FROM a`, `SELECT '?', "?", $1 FROM a`},
+		{"Comments", DialectPostgreSQL, "SELECT ? -- ?\n/* ? */ FROM a WHERE b = ?", "SELECT $1 -- ?\n/* ? */ FROM a WHERE b = $2"},
+		{"Dollar quoted", DialectPostgreSQL, "SELECT $f$ ? $f$, $$?$$, ?", "SELECT $f$ ? $f$, $$?$$, $1"},
+		{"Unterminated", DialectPostgreSQL, "SELECT ?, 'a?", "SELECT $1, 'a?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if q := TranslatePlaceholders(tt.Dialect, tt.Query); q != tt.Expected {
+				t.Errorf("expected %q, got %q", tt.Expected, q)
+			}
+		})
+	}
+}
+
+func TestRewritePlaceholders(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	ctx = WithoutQueryComments(WithRewriter(ctx, RewritePlaceholders))
+	migrations := []Migration{{Up: ExecQueriesWithArgs([]Query{{SQL: "INSERT INTO a VALUES (?, ?)", Args: []interface{}{1, 2}}})}}
+	if err := Up(ctx, db, NewPostgreSQLAdapter(t.Logf), migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := md.ExecLogs[1].Query; q != "INSERT INTO a VALUES ($1, $2)" {
+		t.Errorf("expected placeholders to be translated, got %q", q)
+	}
+}
@@ -0,0 +1,140 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Plan describes the migrations that would be run to move the database from
+// its current version to a target version, without running them.
+type Plan struct {
+	// CurrentVersion is the version of the database when the plan was made.
+	CurrentVersion int `json:"current_version"`
+
+	// TargetVersion is the version the plan migrates to.
+	TargetVersion int `json:"target_version"`
+
+	// Steps are the migrations that would be run, in order.
+	Steps []PlanStep `json:"steps"`
+}
+
+// PlanStep describes a single migration within a Plan.
+type PlanStep struct {
+	// Version is the version of the migration.
+	Version int `json:"version"`
+
+	// Upgrade is true if the migration would be applied, or false if it would
+	// be reverted.
+	Upgrade bool `json:"upgrade"`
+
+	// Comment is the comment for the migration.
+	Comment string `json:"comment"`
+
+	// Description is the description of the migration, if it has one.
+	Description string `json:"description,omitempty"`
+
+	// Warnings are any locking risks found by AnalyzeLocks in the SQL for
+	// the step. This is only populated for migrations that specify their SQL
+	// with UpQueries or DownQueries.
+	Warnings []LockWarning `json:"warnings,omitempty"`
+}
+
+// String returns a human readable description of the plan, suitable for
+// printing during review or before applying migrations.
+func (p *Plan) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Current database version is %d\n", p.CurrentVersion)
+	if len(p.Steps) == 0 {
+		fmt.Fprintf(&b, "Database is already at version %d\n", p.TargetVersion)
+		return b.String()
+	}
+	for _, s := range p.Steps {
+		action := "Upgrade"
+		if !s.Upgrade {
+			action = "Downgrade"
+		}
+		fmt.Fprintf(&b, "%s database to version %d: %s\n", action, s.Version, s.Comment)
+		if s.Description != "" {
+			for _, line := range strings.Split(s.Description, "\n") {
+				fmt.Fprintf(&b, "  %s\n", line)
+			}
+		}
+		for _, w := range s.Warnings {
+			fmt.Fprintf(&b, "  WARNING: %s\n", w)
+		}
+	}
+	return b.String()
+}
+
+// PlanUpToVersion returns a plan describing what UpToVersion would do with
+// the same arguments. The adapter's dialect is used to check the SQL for each
+// step for locking risks. Like UpToVersion, it returns a *TargetVersionError
+// if the target version is out of range.
+func PlanUpToVersion(ctx context.Context, db *sql.DB, adapter Adapter, targetVersion int, migrations []Migration) (*Plan, error) {
+	if err := checkTarget(migrations, targetVersion); err != nil {
+		return nil, err
+	}
+	currentVersion, err := queryCurrentVersion(ctx, db, adapter)
+	if err != nil {
+		return nil, err
+	}
+	return planUp(dialectOf(adapter), currentVersion, targetVersion, migrations), nil
+}
+
+// planUp returns the plan for migrating up from currentVersion.
+func planUp(dialect Dialect, currentVersion, targetVersion int, migrations []Migration) *Plan {
+	p := &Plan{CurrentVersion: currentVersion, TargetVersion: targetVersion}
+	for i, m := range migrations {
+		version := i + 1
+		if version <= currentVersion {
+			continue
+		}
+		if version > targetVersion {
+			break
+		}
+		step := PlanStep{Version: version, Upgrade: true, Comment: m.Comment, Description: m.Description}
+		if m.Up == nil {
+			step.Warnings = AnalyzeLocks(dialect, m.UpQueries)
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	return p
+}
+
+// PlanDownToVersion returns a plan describing what DownToVersion would do
+// with the same arguments. Like DownToVersion, it returns a
+// *TargetVersionError if the target version is out of range.
+func PlanDownToVersion(ctx context.Context, db *sql.DB, adapter Adapter, targetVersion int, migrations []Migration) (*Plan, error) {
+	if err := checkTarget(migrations, targetVersion); err != nil {
+		return nil, err
+	}
+	currentVersion, err := queryCurrentVersion(ctx, db, adapter)
+	if err != nil {
+		return nil, err
+	}
+	return planDown(dialectOf(adapter), currentVersion, targetVersion, migrations), nil
+}
+
+// planDown returns the plan for migrating down from currentVersion.
+func planDown(dialect Dialect, currentVersion, targetVersion int, migrations []Migration) *Plan {
+	p := &Plan{CurrentVersion: currentVersion, TargetVersion: targetVersion}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		version := i + 1
+		if version > currentVersion {
+			continue
+		}
+		if version <= targetVersion {
+			break
+		}
+		step := PlanStep{Version: version, Upgrade: false, Comment: m.Comment, Description: m.Description}
+		if m.Down == nil {
+			step.Warnings = AnalyzeLocks(dialect, m.DownQueries)
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	return p
+}
@@ -0,0 +1,111 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestPlanUpToVersion(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	migrations := []Migration{
+		{Comment: "create users", UpQueries: []string{"CREATE TABLE users (id INT)"}},
+		{
+			Comment:     "add name",
+			Description: "Names are required.\nReverting loses them.",
+			UpQueries:   []string{"ALTER TABLE users ADD COLUMN name TEXT NOT NULL"},
+		},
+		{Comment: "index name", UpQueries: []string{"CREATE INDEX users_name ON users (name)"}},
+		{
+			Comment: "custom",
+			Up: func(ctx context.Context, db *sql.DB) error {
+				t.Error("plan should not run migrations")
+				return nil
+			},
+			UpQueries: []string{"DROP TABLE users"},
+		},
+	}
+	md.QueryRows.Version = 1
+	p, err := PlanUpToVersion(ctx, db, adapter, 4, migrations)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if p.CurrentVersion != 1 || p.TargetVersion != 4 {
+		t.Errorf("expected versions 1 -> 4, got %d -> %d", p.CurrentVersion, p.TargetVersion)
+	}
+	if len(p.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(p.Steps))
+	}
+	for i, s := range p.Steps {
+		if s.Version != i+2 || !s.Upgrade || s.Comment != migrations[i+1].Comment {
+			t.Errorf("unexpected step %d: %+v", i, s)
+		}
+	}
+	if len(p.Steps[2].Warnings) != 0 {
+		t.Errorf("expected no warnings for custom Up, got %v", p.Steps[2].Warnings)
+	}
+	expected := `Current database version is 1
+Upgrade database to version 2: add name
+  Names are required.
+  Reverting loses them.
+  WARNING: ACCESS EXCLUSIVE lock on users: ALTER TABLE waits for and then blocks all queries on the table
+Upgrade database to version 3: index name
+  WARNING: SHARE lock on users: creating an index without CONCURRENTLY blocks writes until it finishes
+Upgrade database to version 4: custom
+`
+	if p.String() != expected {
+		t.Errorf("expected plan to be %q, got %q", expected, p.String())
+	}
+	if len(md.ExecLogs) != 1 {
+		t.Errorf("expected only the CREATE TABLE to be executed, got %#v", md.ExecLogs)
+	}
+}
+
+func TestPlanDownToVersion(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewMySQLAdapter(t.Logf)
+	migrations := []Migration{
+		{Comment: "create users", DownQueries: []string{"DROP TABLE users"}},
+		{Comment: "widen name", DownQueries: []string{"ALTER TABLE users MODIFY name VARCHAR(50)"}},
+		{Comment: "not applied"},
+	}
+	md.QueryRows.Version = 2
+	p, err := PlanDownToVersion(ctx, db, adapter, 0, migrations)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(p.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(p.Steps))
+	}
+	if p.Steps[0].Version != 2 || p.Steps[0].Upgrade || len(p.Steps[0].Warnings) != 1 {
+		t.Errorf("unexpected first step: %+v", p.Steps[0])
+	}
+	if p.Steps[1].Version != 1 || p.Steps[1].Upgrade || len(p.Steps[1].Warnings) != 0 {
+		t.Errorf("unexpected second step: %+v", p.Steps[1])
+	}
+}
+
+func TestPlanTargetOutOfRange(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewSQLiteAdapter(t.Logf)
+	migrations := []Migration{{Comment: "create users"}, {Comment: "add name"}}
+	md.QueryRows.Version = 1
+	var te *TargetVersionError
+	if _, err := PlanUpToVersion(ctx, db, adapter, 3, migrations); !errors.As(err, &te) || te.Version != 3 || te.Latest != 2 {
+		t.Errorf("expected a *TargetVersionError for version 3, got %v", err)
+	}
+	if _, err := PlanDownToVersion(ctx, db, adapter, -1, migrations); !errors.As(err, &te) || te.Version != -1 {
+		t.Errorf("expected a *TargetVersionError for version -1, got %v", err)
+	}
+	if len(md.QueryLogs) != 0 || len(md.ExecLogs) != 0 {
+		t.Errorf("expected no queries, got %#v and %#v", md.QueryLogs, md.ExecLogs)
+	}
+}
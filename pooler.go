@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// poolerProbes is the number of times the connection id is queried by
+// detectPooler.
+const poolerProbes = 3
+
+// runDB returns the database that runs use, which is DirectDB if it's set.
+func (m *Migrator) runDB() *sql.DB {
+	if m.DirectDB != nil {
+		return m.DirectDB
+	}
+	return m.DB
+}
+
+// checkPooler returns an error if PoolerSafe is set along with options that
+// depend on session state.
+func (m *Migrator) checkPooler() error {
+	if !m.PoolerSafe || m.DirectDB != nil {
+		return nil
+	}
+	switch {
+	case m.LockName != "":
+		return errors.New("the LockName option depends on session state, so it can't be used with PoolerSafe unless DirectDB is set")
+	case m.Role != "":
+		return errors.New("the Role option depends on session state, so it can't be used with PoolerSafe unless DirectDB is set")
+	}
+	return nil
+}
+
+// warnPooler logs a warning if DetectPooler is set and the database that
+// runs use appears to be connected through a transaction pooling proxy.
+func (m *Migrator) warnPooler(ctx context.Context) {
+	if !m.DetectPooler || m.PoolerSafe {
+		return
+	}
+	name, err := detectPooler(ctx, m.runDB(), dialectOf(m.Adapter))
+	if err != nil {
+		m.Adapter.Log("Error detecting connection pooler: %s", err)
+	} else if name != "" {
+		m.Adapter.Log("WARNING: database appears to be connected through %s, which doesn't keep session state "+
+			"like advisory locks and roles between transactions; set PoolerSafe, or DirectDB to bypass it", name)
+	}
+}
+
+// detectPooler returns a description of the transaction pooling proxy the
+// database is connected through, or an empty string if it doesn't appear to
+// be connected through one. ProxySQL is recognized by the version comment it
+// returns. Other proxies, like PgBouncer in transaction mode, are found by
+// querying the id of the server connection several times on the same client
+// connection, since the proxy can send each query to a different one. Proxies
+// that happen to reuse the same server connection aren't detected.
+func detectPooler(ctx context.Context, db *sql.DB, dialect Dialect) (string, error) {
+	idQuery, ok := connectionIDQueries[dialect]
+	if !ok {
+		return "", nil
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if dialect == DialectMySQL {
+		var comment string
+		if err := conn.QueryRowContext(ctx, "SELECT @@version_comment LIMIT 1").Scan(&comment); err != nil {
+			return "", fmt.Errorf("error querying version comment: %w", err)
+		}
+		if strings.Contains(strings.ToLower(comment), "proxysql") {
+			return "ProxySQL", nil
+		}
+	}
+	var first int64
+	for i := 0; i < poolerProbes; i++ {
+		var id int64
+		if err := conn.QueryRowContext(ctx, idQuery).Scan(&id); err != nil {
+			return "", fmt.Errorf("error querying connection id: %w", err)
+		}
+		if i == 0 {
+			first = id
+		} else if id != first {
+			return "a transaction pooling proxy", nil
+		}
+	}
+	return "", nil
+}
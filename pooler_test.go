@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestMigratorPoolerSafe(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		PoolerSafe: true,
+		LockName:   "migrations",
+	}
+	expected := "the LockName option depends on session state, so it can't be used with PoolerSafe unless DirectDB is set"
+	if err := m.Up(ctx); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if len(md.ExecLogs) != 0 {
+		t.Errorf("expected nothing to be run, got %#v", md.ExecLogs)
+	}
+
+	// Runs should only use DirectDB, so DB is left nil to make sure.
+	m.DB, m.DirectDB, m.LockName = nil, db, ""
+	if err := m.Up(WithoutQueryComments(ctx)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || md.ExecLogs[1].Query != "example query" {
+		t.Errorf("expected the migration to be run on DirectDB, got %#v", md.ExecLogs)
+	}
+}
+
+func TestDetectPooler(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 42
+	if name, err := detectPooler(ctx, db, DialectPostgreSQL); err != nil || name != "" {
+		t.Errorf("expected no pooler, got %q, %v", name, err)
+	}
+	if n := len(md.QueryLogs); n != poolerProbes || md.QueryLogs[0].Query != "SELECT pg_backend_pid()" {
+		t.Errorf("expected the backend pid to be queried %d times, got %#v", poolerProbes, md.QueryLogs)
+	}
+
+	md.Reset()
+	md.QueryRows = MockRows{Cols: []string{"pid"}, Values: [][]driver.Value{{int64(1)}, {int64(2)}}}
+	if name, err := detectPooler(ctx, db, DialectPostgreSQL); err != nil || name != "a transaction pooling proxy" {
+		t.Errorf("expected a pooler, got %q, %v", name, err)
+	}
+
+	md.Reset()
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "version_comment",
+		Rows:    MockRows{Cols: []string{"@@version_comment"}, Values: [][]driver.Value{{"(ProxySQL)"}}},
+	}}
+	if name, err := detectPooler(ctx, db, DialectMySQL); err != nil || name != "ProxySQL" {
+		t.Errorf("expected ProxySQL, got %q, %v", name, err)
+	}
+
+	if name, err := detectPooler(ctx, db, DialectSQLite); err != nil || name != "" {
+		t.Errorf("expected no pooler for SQLite, got %q, %v", name, err)
+	}
+}
@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Preflight describes how the database must be configured before migrations
+// are run against it, so that misconfigured environments fail before any DDL
+// is executed. Every requirement is checked, and the problems are reported
+// together in a PreflightError. It's checked by the Migrator's Preflight
+// option at the start of each run, or it can be checked directly with Run.
+type Preflight struct {
+	// MinServerVersion is the lowest version of the database server that's
+	// allowed, like "13" for PostgreSQL or "8.0.28" for MySQL. The versions
+	// are compared by their dot separated numbers.
+	MinServerVersion string
+
+	// TimeZone is the time zone the session must use, like "UTC". It's
+	// compared case-insensitively. It isn't supported for SQLite.
+	TimeZone string
+
+	// SQLModes are MySQL sql_mode flags that must be enabled for the
+	// session, like STRICT_TRANS_TABLES or ANSI_QUOTES.
+	SQLModes []string
+
+	// Privileges are the privileges the user must have, such as the ones
+	// reported by AuditPrivileges. Privileges with an Object are checked on
+	// that table, and the others are checked on the current schema. They're
+	// only supported for PostgreSQL.
+	Privileges []Privilege
+
+	// Checks are queries for any other requirements. Like for RunChecks,
+	// each check fails if its query returns any rows.
+	Checks []Check
+}
+
+// PreflightError is returned when the database doesn't meet the requirements
+// of a Preflight.
+type PreflightError struct {
+	// Problems describe each requirement that wasn't met.
+	Problems []string
+}
+
+func (e *PreflightError) Error() string {
+	return "pre-flight checks failed: " + strings.Join(e.Problems, "; ")
+}
+
+// serverVersionQueries return the version of the database server.
+var serverVersionQueries = map[Dialect]string{
+	DialectPostgreSQL: "SHOW server_version",
+	DialectMySQL:      "SELECT VERSION()",
+	DialectSQLite:     "SELECT sqlite_version()",
+	DialectClickHouse: "SELECT version()",
+}
+
+// timeZoneQueries return the time zone of the session.
+var timeZoneQueries = map[Dialect]string{
+	DialectPostgreSQL: "SHOW TimeZone",
+	DialectMySQL:      "SELECT IF(@@session.time_zone = 'SYSTEM', @@system_time_zone, @@session.time_zone)",
+	DialectClickHouse: "SELECT timezone()",
+}
+
+// Run checks the requirements against the database, and returns a
+// *PreflightError listing every requirement that wasn't met, or nil if they
+// all were.
+func (p Preflight) Run(ctx context.Context, db *sql.DB, dialect Dialect) error {
+	var problems []string
+	fail := func(format string, v ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, v...))
+	}
+	queryString := func(name, query string) (string, bool) {
+		var s string
+		if err := db.QueryRowContext(ctx, query).Scan(&s); err != nil {
+			fail("error querying %s: %s", name, err)
+			return "", false
+		}
+		return s, true
+	}
+
+	if p.MinServerVersion != "" {
+		if query, ok := serverVersionQueries[dialect]; !ok {
+			fail("checking the server version is not supported for dialect %q", dialect)
+		} else if version, ok := queryString("server version", query); ok {
+			if compareVersions(version, p.MinServerVersion) < 0 {
+				fail("server version %s is older than %s", version, p.MinServerVersion)
+			}
+		}
+	}
+	if p.TimeZone != "" {
+		if query, ok := timeZoneQueries[dialect]; !ok {
+			fail("checking the time zone is not supported for dialect %q", dialect)
+		} else if tz, ok := queryString("time zone", query); ok && !strings.EqualFold(tz, p.TimeZone) {
+			fail("time zone is %s, not %s", tz, p.TimeZone)
+		}
+	}
+	if len(p.SQLModes) > 0 {
+		if dialect != DialectMySQL {
+			fail("checking sql_mode is not supported for dialect %q", dialect)
+		} else if mode, ok := queryString("sql_mode", "SELECT @@SESSION.sql_mode"); ok {
+			enabled := map[string]bool{}
+			for _, m := range strings.Split(mode, ",") {
+				enabled[strings.ToUpper(strings.TrimSpace(m))] = true
+			}
+			for _, m := range p.SQLModes {
+				if !enabled[strings.ToUpper(m)] {
+					fail("sql_mode %s is not enabled", m)
+				}
+			}
+		}
+	}
+	if len(p.Privileges) > 0 {
+		if dialect != DialectPostgreSQL {
+			fail("checking privileges is not supported for dialect %q", dialect)
+		} else {
+			for _, priv := range p.Privileges {
+				if err := checkPrivilege(ctx, db, priv); err != nil {
+					fail("%s", err)
+				}
+			}
+		}
+	}
+	if len(p.Checks) > 0 {
+		report := RunChecks(ctx, db, p.Checks)
+		for _, r := range report.Results {
+			if r.Error != "" {
+				fail("check %s failed: %s", r.Name, r.Error)
+			} else if !r.Passed() {
+				fail("check %s returned %d rows", r.Name, r.Violations)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &PreflightError{Problems: problems}
+	}
+	return nil
+}
+
+// preflight wraps a session function so that it runs the Preflight checks
+// first.
+func (m *Migrator) preflight(ctx context.Context, f func(db *sql.DB) error) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		if err := m.Preflight.Run(ctx, db, dialectOf(m.Adapter)); err != nil {
+			return err
+		}
+		return f(db)
+	}
+}
+
+// checkPrivilege returns an error if the PostgreSQL user doesn't have the
+// privilege.
+func checkPrivilege(ctx context.Context, db *sql.DB, p Privilege) error {
+	name := p.Name
+	var row *sql.Row
+	switch {
+	case p.Object != "":
+		switch name {
+		case "ALTER", "DROP", "INDEX":
+			// PostgreSQL doesn't have these privileges, since they require
+			// owning the table.
+			row = db.QueryRowContext(ctx, "SELECT pg_has_role((SELECT relowner FROM pg_class WHERE oid = $1::regclass), 'USAGE')::int", p.Object)
+		default:
+			row = db.QueryRowContext(ctx, "SELECT has_table_privilege($1, $2)::int", p.Object, name)
+		}
+	case name == "CREATE" || name == "USAGE":
+		row = db.QueryRowContext(ctx, "SELECT has_schema_privilege(current_schema(), $1)::int", name)
+	default:
+		return nil
+	}
+	var has int
+	if err := row.Scan(&has); err != nil {
+		return fmt.Errorf("error checking privilege %s: %w", p, err)
+	}
+	if has == 0 {
+		return fmt.Errorf("missing privilege %s", p)
+	}
+	return nil
+}
+
+var versionNumberRegexp = regexp.MustCompile(`^\d+(?:\.\d+)*`)
+
+// compareVersions compares the dot separated numbers at the start of two
+// version strings, and returns -1, 0 or 1 if a is older than, the same as or
+// newer than b. Missing numbers are treated as zero.
+func compareVersions(a, b string) int {
+	as := strings.Split(versionNumberRegexp.FindString(strings.TrimSpace(a)), ".")
+	bs := strings.Split(versionNumberRegexp.FindString(strings.TrimSpace(b)), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPreflightRun(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: `VERSION\(\)`, Rows: MockRows{Cols: []string{"version"}, Values: [][]driver.Value{{"8.0.28-log"}}}},
+		{Pattern: `time_zone`, Rows: MockRows{Cols: []string{"time_zone"}, Values: [][]driver.Value{{"SYSTEM"}}}},
+		{Pattern: `sql_mode`, Rows: MockRows{Cols: []string{"sql_mode"}, Values: [][]driver.Value{{"STRICT_TRANS_TABLES,NO_ZERO_DATE"}}}},
+		{Pattern: `FROM orders`, Rows: MockRows{Cols: []string{"id"}, Values: [][]driver.Value{{int64(1)}, {int64(2)}}}},
+		{Pattern: `FROM users`, Rows: MockRows{Cols: []string{"id"}}},
+	}
+	p := Preflight{
+		MinServerVersion: "8.0.30",
+		TimeZone:         "UTC",
+		SQLModes:         []string{"strict_trans_tables", "ANSI_QUOTES"},
+		Privileges:       []Privilege{{Name: "CREATE"}},
+		Checks: []Check{
+			{Name: "negative totals", Query: "SELECT id FROM orders WHERE total < 0"},
+			{Name: "missing emails", Query: "SELECT id FROM users WHERE email IS NULL"},
+		},
+	}
+	err := p.Run(ctx, db, DialectMySQL)
+	var perr *PreflightError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *PreflightError, got %v", err)
+	}
+	expected := []string{
+		"server version 8.0.28-log is older than 8.0.30",
+		"time zone is SYSTEM, not UTC",
+		"sql_mode ANSI_QUOTES is not enabled",
+		`checking privileges is not supported for dialect "mysql"`,
+		"check negative totals returned 2 rows",
+	}
+	if !reflect.DeepEqual(perr.Problems, expected) {
+		t.Errorf("expected problems %#v, got %#v", expected, perr.Problems)
+	}
+
+	p = Preflight{MinServerVersion: "8", TimeZone: "system", SQLModes: []string{"NO_ZERO_DATE"}}
+	if err := p.Run(ctx, db, DialectMySQL); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestMigratorPreflight(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: `server_version`, Rows: MockRows{Cols: []string{"server_version"}, Values: [][]driver.Value{{"12.9 (Debian 12.9-1)"}}}},
+		{Pattern: `has_schema_privilege`, Rows: MockRows{Cols: []string{"has"}, Values: [][]driver.Value{{int64(0)}}}},
+	}
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		Preflight:  &Preflight{MinServerVersion: "13", Privileges: []Privilege{{Name: "CREATE"}}},
+	}
+	err := m.Up(ctx)
+	expected := "pre-flight checks failed: server version 12.9 (Debian 12.9-1) is older than 13; missing privilege CREATE"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if len(md.ExecLogs) != 0 {
+		t.Errorf("expected no queries to be executed, got %#v", md.ExecLogs)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"13.0", "13", 0},
+		{"13.4", "13", 1},
+		{"13.4", "13.10", -1},
+		{"8.0.28-log", "8.0.9", 1},
+		{"3.31.1", "3.35", -1},
+		{"22.8.5.29", "22.8", 1},
+	} {
+		if actual := compareVersions(c.a, c.b); actual != c.expected {
+			t.Errorf("expected compareVersions(%q, %q) to be %d, got %d", c.a, c.b, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package migrate
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Privilege is a database privilege required to run migrations, such as
+// CREATE, or INSERT on a specific table.
+type Privilege struct {
+	// Name is the name of the privilege, like ALTER or INSERT.
+	Name string
+
+	// Object is the table or other object the privilege is needed on. It's
+	// empty for privileges that apply to the database or schema as a whole.
+	Object string
+}
+
+func (p Privilege) String() string {
+	if p.Object == "" {
+		return p.Name
+	}
+	return p.Name + " ON " + p.Object
+}
+
+// PrivilegeReport is returned by AuditPrivileges.
+type PrivilegeReport struct {
+	// Privileges are the privileges required, sorted by object and name.
+	Privileges []Privilege
+
+	// Unknown lists the versions of migrations that couldn't be analyzed,
+	// because they use Up or Down functions or Checkpoints instead of
+	// queries. They may require additional privileges.
+	Unknown []int
+
+	// Unrecognized lists queries that couldn't be classified. They may
+	// require additional privileges.
+	Unrecognized []string
+}
+
+type privilegeRule struct {
+	pattern *regexp.Regexp
+	name    string
+}
+
+// privilegeRules are checked in order, and the first match is used. The
+// first capture group, if present, is the object the privilege applies to.
+var privilegeRules = []privilegeRule{
+	{regexp.MustCompile(`(?i)^CREATE (?:GLOBAL |LOCAL )?(?:TEMP |TEMPORARY |UNLOGGED )?TABLE ` + tableName), "CREATE"},
+	{regexp.MustCompile(`(?i)^CREATE (?:UNIQUE |FULLTEXT |SPATIAL )?INDEX (?:CONCURRENTLY )?(?:IF NOT EXISTS )?(?:\S+ )?ON (?:ONLY )?([^\s(]+)`), "INDEX"},
+	{regexp.MustCompile(`(?i)^CREATE (?:OR REPLACE )?(?:MATERIALIZED )?VIEW ` + tableName), "CREATE VIEW"},
+	{regexp.MustCompile(`(?i)^CREATE (?:OR REPLACE )?(?:FUNCTION|PROCEDURE) ([^\s(]+)`), "CREATE ROUTINE"},
+	{regexp.MustCompile(`(?i)^CREATE (?:OR REPLACE )?TRIGGER .* ON ([^\s(]+)`), "TRIGGER"},
+	{regexp.MustCompile(`(?i)^CREATE (?:SCHEMA|DATABASE|EXTENSION|TYPE|SEQUENCE)\b`), "CREATE"},
+	{regexp.MustCompile(`(?i)^ALTER TABLE ` + tableName), "ALTER"},
+	{regexp.MustCompile(`(?i)^DROP (?:TABLE|VIEW|MATERIALIZED VIEW) ` + tableName), "DROP"},
+	{regexp.MustCompile(`(?i)^DROP INDEX (?:CONCURRENTLY )?(?:IF EXISTS )?\S+ ON ([^\s;]+)`), "INDEX"},
+	{regexp.MustCompile(`(?i)^DROP (?:INDEX|FUNCTION|PROCEDURE|TRIGGER|TYPE|SEQUENCE|SCHEMA)\b`), "DROP"},
+	{regexp.MustCompile(`(?i)^TRUNCATE (?:TABLE )?(?:ONLY )?([^\s,;]+)`), "TRUNCATE"},
+	{regexp.MustCompile(`(?i)^INSERT (?:IGNORE )?INTO ([^\s(]+)`), "INSERT"},
+	{regexp.MustCompile(`(?i)^UPDATE (?:ONLY )?([^\s]+)`), "UPDATE"},
+	{regexp.MustCompile(`(?i)^DELETE FROM (?:ONLY )?([^\s]+)`), "DELETE"},
+	{regexp.MustCompile(`(?i)^(?:GRANT|REVOKE)\b`), "GRANT OPTION"},
+	{regexp.MustCompile(`(?i)^(?:SELECT|WITH)\b`), "SELECT"},
+	{regexp.MustCompile(`(?i)^(?:SET|ANALYZE|VACUUM|OPTIMIZE|COMMENT ON)\b`), ""},
+}
+
+var selectFromRegexp = regexp.MustCompile(`(?i)\b(?:FROM|JOIN) ([a-zA-Z_"` + "`" + `][^\s,;()]*)`)
+
+// AuditPrivileges statically analyzes migrations and reports the database
+// privileges needed to apply and revert them, including those needed for the
+// adapter's version table. This can help grant a migration role only the
+// privileges it actually uses. For a *TableAdapter, this also includes the
+// privileges needed for its failures and checkpoints tables, and for
+// maintaining the version table with PruneHistory and BackfillChecksums.
+//
+// The analysis is based on the shape of each SQL query, so it can only see
+// migrations that use UpQueries and DownQueries, and it's intended as a
+// starting point for review rather than an exact answer.
+func AuditPrivileges(adapter Adapter, migrations []Migration) PrivilegeReport {
+	var r PrivilegeReport
+	seen := map[Privilege]bool{}
+	add := func(name, object string) {
+		p := Privilege{Name: name, Object: object}
+		if name != "" && !seen[p] {
+			seen[p] = true
+			r.Privileges = append(r.Privileges, p)
+		}
+	}
+	if t, ok := adapter.(*TableAdapter); ok {
+		if !t.SkipPrepare {
+			add("CREATE", t.table())
+			if t.IDColumn {
+				add("ALTER", t.table())
+			}
+		}
+		add("SELECT", t.table())
+		add("INSERT", t.table())
+		// PruneHistory deletes old rows, and BackfillChecksums adds the
+		// checksum column and updates the rows that don't have one.
+		add("DELETE", t.table())
+		if t.ChecksumColumn {
+			add("ALTER", t.table())
+			add("UPDATE", t.table())
+		}
+		if t.FailuresTableName != "" {
+			add("CREATE", t.FailuresTableName)
+			add("INSERT", t.FailuresTableName)
+		}
+		if t.CheckpointsTableName != "" {
+			for _, name := range []string{"CREATE", "SELECT", "INSERT", "DELETE"} {
+				add(name, t.CheckpointsTableName)
+			}
+		}
+	}
+	for i, m := range migrations {
+		version := i + 1
+		if m.Up != nil || m.Down != nil || len(m.Checkpoints) > 0 {
+			r.Unknown = append(r.Unknown, version)
+		}
+		var queries []string
+		if m.Up == nil {
+			queries = append(queries, m.UpQueries...)
+		}
+		if m.Down == nil {
+			queries = append(queries, m.DownQueries...)
+		}
+		for _, q := range queries {
+			nq := normalizeQuery(q)
+			rule, object, ok := matchPrivilegeRule(nq)
+			if !ok {
+				r.Unrecognized = append(r.Unrecognized, q)
+				continue
+			}
+			add(rule.name, object)
+			// Queries like INSERT ... SELECT and UPDATE ... FROM also need
+			// to read from other tables.
+			if !strings.HasPrefix(rule.name, "GRANT") {
+				for _, match := range selectFromRegexp.FindAllStringSubmatch(nq, -1) {
+					add("SELECT", match[1])
+				}
+			}
+		}
+	}
+	sort.Slice(r.Privileges, func(i, j int) bool {
+		a, b := r.Privileges[i], r.Privileges[j]
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		return a.Name < b.Name
+	})
+	return r
+}
+
+// matchPrivilegeRule returns the first rule matching a normalized query, and
+// the object the privilege applies to.
+func matchPrivilegeRule(query string) (privilegeRule, string, bool) {
+	for _, rule := range privilegeRules {
+		match := rule.pattern.FindStringSubmatch(query)
+		if match == nil {
+			continue
+		}
+		object := ""
+		if len(match) > 1 {
+			object = match[1]
+		}
+		return rule, object, true
+	}
+	return privilegeRule{}, "", false
+}
@@ -0,0 +1,104 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestAuditPrivileges(t *testing.T) {
+	adapter := NewPostgreSQLAdapter(nil)
+	migrations := []Migration{
+		{
+			UpQueries: []string{
+				"CREATE TABLE users (id INT, name TEXT)",
+				"CREATE INDEX users_name ON users (name)",
+			},
+			DownQueries: []string{"DROP TABLE users"},
+		},
+		{
+			UpQueries: []string{
+				"ALTER TABLE users ADD COLUMN team_id INT",
+				"UPDATE users SET team_id = t.id FROM teams t WHERE t.owner_id = users.id",
+				"REVOKE ALL ON users FROM public",
+				"FROB users",
+			},
+		},
+		{
+			Up: func(ctx context.Context, db *sql.DB) error { return nil },
+			DownQueries: []string{
+				"DELETE FROM users WHERE id IN (SELECT user_id FROM banned)",
+			},
+		},
+	}
+	r := AuditPrivileges(adapter, migrations)
+	expected := []Privilege{
+		{Name: "GRANT OPTION", Object: ""},
+		{Name: "SELECT", Object: "banned"},
+		{Name: "CREATE", Object: "schema_versions"},
+		{Name: "DELETE", Object: "schema_versions"},
+		{Name: "INSERT", Object: "schema_versions"},
+		{Name: "SELECT", Object: "schema_versions"},
+		{Name: "SELECT", Object: "teams"},
+		{Name: "ALTER", Object: "users"},
+		{Name: "CREATE", Object: "users"},
+		{Name: "DELETE", Object: "users"},
+		{Name: "DROP", Object: "users"},
+		{Name: "INDEX", Object: "users"},
+		{Name: "SELECT", Object: "users"},
+		{Name: "UPDATE", Object: "users"},
+	}
+	if !reflect.DeepEqual(r.Privileges, expected) {
+		t.Errorf("expected privileges %v, got %v", expected, r.Privileges)
+	}
+	if !reflect.DeepEqual(r.Unknown, []int{3}) {
+		t.Errorf("expected unknown versions [3], got %v", r.Unknown)
+	}
+	if !reflect.DeepEqual(r.Unrecognized, []string{"FROB users"}) {
+		t.Errorf("expected unrecognized [FROB users], got %v", r.Unrecognized)
+	}
+
+	adapter.SkipPrepare = true
+	r = AuditPrivileges(adapter, nil)
+	expected = []Privilege{
+		{Name: "DELETE", Object: "schema_versions"},
+		{Name: "INSERT", Object: "schema_versions"},
+		{Name: "SELECT", Object: "schema_versions"},
+	}
+	if !reflect.DeepEqual(r.Privileges, expected) {
+		t.Errorf("expected privileges %v, got %v", expected, r.Privileges)
+	}
+}
+
+func TestAuditPrivilegesAdapterTables(t *testing.T) {
+	adapter := NewPostgreSQLAdapter(nil)
+	adapter.IDColumn = true
+	adapter.ChecksumColumn = true
+	adapter.FailuresTableName = "schema_failures"
+	adapter.CheckpointsTableName = "schema_checkpoints"
+	migrations := []Migration{
+		{Checkpoints: []CheckpointFunc{func(ctx context.Context, tx *sql.Tx) error { return nil }}},
+	}
+	r := AuditPrivileges(adapter, migrations)
+	expected := []Privilege{
+		{Name: "CREATE", Object: "schema_checkpoints"},
+		{Name: "DELETE", Object: "schema_checkpoints"},
+		{Name: "INSERT", Object: "schema_checkpoints"},
+		{Name: "SELECT", Object: "schema_checkpoints"},
+		{Name: "CREATE", Object: "schema_failures"},
+		{Name: "INSERT", Object: "schema_failures"},
+		{Name: "ALTER", Object: "schema_versions"},
+		{Name: "CREATE", Object: "schema_versions"},
+		{Name: "DELETE", Object: "schema_versions"},
+		{Name: "INSERT", Object: "schema_versions"},
+		{Name: "SELECT", Object: "schema_versions"},
+		{Name: "UPDATE", Object: "schema_versions"},
+	}
+	if !reflect.DeepEqual(r.Privileges, expected) {
+		t.Errorf("expected privileges %v, got %v", expected, r.Privileges)
+	}
+	if !reflect.DeepEqual(r.Unknown, []int{1}) {
+		t.Errorf("expected unknown versions [1], got %v", r.Unknown)
+	}
+}
@@ -0,0 +1,153 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Progress describes how far a long running DDL statement has got, as
+// reported by the database. It's reported by ExecQueriesWithProgress.
+type Progress struct {
+	// Query is the index of the query being run.
+	Query int
+
+	// Phase is the database's name for what the statement is doing, like
+	// "building index: scanning table" for PostgreSQL, or
+	// "stage/innodb/alter table (read PK and internal sort)" for MySQL.
+	Phase string
+
+	// Done is the amount of work that has been completed, in units that
+	// depend on the database and the phase.
+	Done int64
+
+	// Total is the estimated amount of work for the phase, or zero if it
+	// isn't known.
+	Total int64
+}
+
+// Percent returns the percentage of the phase that has been completed, or -1
+// if the total isn't known.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Done) / float64(p.Total) * 100
+}
+
+// String returns a one line description of the progress.
+func (p Progress) String() string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("query %d: %s", p.Query, p.Phase)
+	}
+	return fmt.Sprintf("query %d: %s: %.1f%% (%d of %d)", p.Query, p.Phase, p.Percent(), p.Done, p.Total)
+}
+
+// progressQueries are the queries used to read the progress of the
+// connection running a statement. They take the id returned by the
+// connectionIDQueries as their only argument, and return the phase, the work
+// done and the total work.
+var progressQueries = map[Dialect]string{
+	DialectPostgreSQL: "SELECT phase, blocks_done, blocks_total FROM pg_stat_progress_create_index WHERE pid = $1",
+	DialectMySQL: "SELECT s.EVENT_NAME, s.WORK_COMPLETED, s.WORK_ESTIMATED FROM performance_schema.events_stages_current s " +
+		"JOIN performance_schema.threads t ON t.THREAD_ID = s.THREAD_ID WHERE t.PROCESSLIST_ID = ?",
+}
+
+// ExecQueriesWithProgress is like ExecQueries, but while each query runs, the
+// database's progress views are polled from another connection every
+// interval, and the progress is logged with the migration's logger and
+// passed to report, if it's not nil. This is intended for long running DDL
+// like index builds, so operators can see how far it has got. PostgreSQL
+// reports the progress of CREATE INDEX and REINDEX from
+// pg_stat_progress_create_index. MySQL reports the progress of InnoDB ALTER
+// TABLE from performance_schema, which requires the stage instruments and
+// events_stages_current consumer to be enabled. For other dialects, the
+// queries are run without reporting progress.
+//
+// The queries are run on a single connection, so that its progress can be
+// found. Progress can't be polled if the pool doesn't allow another
+// connection, such as with SingleConnection. If polling fails, the error is
+// logged and polling stops, but the queries keep running. The interval
+// defaults to 10 seconds.
+func ExecQueriesWithProgress(queries []string, interval time.Duration, report func(Progress)) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		dialect := dialectFromContext(ctx)
+		progress, ok := progressQueries[dialect]
+		if !ok {
+			return ExecQueries(queries)(ctx, db)
+		}
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		var id int64
+		if err := conn.QueryRowContext(ctx, connectionIDQueries[dialect]).Scan(&id); err != nil {
+			return fmt.Errorf("error querying connection id: %w", err)
+		}
+		log := LoggerFromContext(ctx)
+		for i, q := range queries {
+			q = rewriteQuery(ctx, q)
+			logQuery(ctx, q, nil)
+			stop := watchProgress(ctx, db, progress, id, interval, log, func(p Progress) {
+				p.Query = i
+				log("Progress of %s", p)
+				if report != nil {
+					report(p)
+				}
+			})
+			_, err := conn.ExecContext(ctx, q)
+			stop()
+			if err != nil {
+				return fmt.Errorf("error with query %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// watchProgress polls the progress of the connection with the id every
+// interval, and calls f with it, until the returned function is called.
+func watchProgress(ctx context.Context, db *sql.DB, query string, id int64, interval time.Duration, log LogFunc, f func(Progress)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for Sleep(ctx, interval) == nil {
+			p, ok, err := queryProgress(ctx, db, query, id)
+			if err != nil {
+				if ctx.Err() == nil {
+					log("Error querying progress: %s", err)
+				}
+				return
+			}
+			if ok {
+				f(p)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// queryProgress returns the progress of the connection with the id. It
+// returns false if the connection isn't reporting any progress.
+func queryProgress(ctx context.Context, db *sql.DB, query string, id int64) (Progress, bool, error) {
+	var p Progress
+	var phase sql.NullString
+	var done, total sql.NullInt64
+	err := db.QueryRowContext(ctx, query, id).Scan(&phase, &done, &total)
+	if err == sql.ErrNoRows {
+		return p, false, nil
+	} else if err != nil {
+		return p, false, err
+	}
+	p.Phase, p.Done, p.Total = phase.String, done.Int64, total.Int64
+	return p, true, nil
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := Progress{Query: 1, Phase: "building index: scanning table", Done: 25, Total: 200}
+	if s := p.String(); s != "query 1: building index: scanning table: 12.5% (25 of 200)" {
+		t.Errorf("unexpected string %q", s)
+	}
+	p = Progress{Phase: "waiting for old snapshots"}
+	if s := p.String(); s != "query 0: waiting for old snapshots" || p.Percent() != -1 {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestExecQueriesWithProgress(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: "pg_backend_pid", Rows: MockRows{Version: 42}},
+		{Pattern: "pg_stat_progress_create_index", Rows: MockRows{
+			Cols:   []string{"phase", "blocks_done", "blocks_total"},
+			Values: [][]driver.Value{{"building index: scanning table", int64(50), int64(100)}},
+		}},
+	}
+	ctx = withMigration(WithoutQueryComments(ctx), NewPostgreSQLAdapter(t.Logf), 1, true, "")
+	var mu sync.Mutex
+	var reports []Progress
+	err := ExecQueriesWithProgress([]string{"CREATE INDEX users_name ON users (name)"}, time.Hour, func(p Progress) {
+		mu.Lock()
+		reports = append(reports, p)
+		mu.Unlock()
+	})(ctx, db)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs:  []MockQueryLog{{Query: "CREATE INDEX users_name ON users (name)"}},
+		QueryLogs: []MockQueryLog{{Query: "SELECT pg_backend_pid()"}},
+	})
+
+	// Progress is polled until the watch is stopped.
+	done := make(chan struct{})
+	stop := watchProgress(ctx, db, progressQueries[DialectPostgreSQL], 42, time.Millisecond, t.Logf, func(p Progress) {
+		mu.Lock()
+		reports = append(reports, p)
+		if len(reports) == 1 {
+			close(done)
+		}
+		mu.Unlock()
+	})
+	<-done
+	stop()
+	expected := Progress{Phase: "building index: scanning table", Done: 50, Total: 100}
+	if reports[0] != expected {
+		t.Errorf("expected progress %#v, got %#v", expected, reports[0])
+	}
+	if l := md.QueryLogs[1]; l.Args[0].Value != int64(42) {
+		t.Errorf("expected progress for connection 42, got %#v", l.Args)
+	}
+}
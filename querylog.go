@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// RedactFunc is called with the arguments of a query before they're logged,
+// and returns the values to log in their place. It's used to mask sensitive
+// values, like personal data copied by a data migration.
+type RedactFunc func(query string, args []interface{}) []interface{}
+
+// RedactAll is a RedactFunc that replaces every argument with "[REDACTED]".
+func RedactAll(query string, args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i := range redacted {
+		redacted[i] = "[REDACTED]"
+	}
+	return redacted
+}
+
+// WithQueryLogging returns a copy of the context that logs each query run by
+// the package's helpers, like ExecQueries and LoadCSV, using the logger from
+// LoggerFromContext. If the query has arguments, they're passed through
+// redact before they're logged. If redact is nil, they're logged as they are.
+func WithQueryLogging(ctx context.Context, redact RedactFunc) context.Context {
+	if redact == nil {
+		redact = func(query string, args []interface{}) []interface{} { return args }
+	}
+	return context.WithValue(ctx, queryLogKey, redact)
+}
+
+// logQuery logs a query, if query logging is enabled on the context. It
+// also records the query for replay.
+func logQuery(ctx context.Context, query string, args []interface{}) {
+	info, _ := MigrationFromContext(ctx)
+	recordReplay(ctx, ReplayEvent{Kind: ReplaySQL, Version: info.Version, Query: query, Args: args})
+	redact, ok := ctx.Value(queryLogKey).(RedactFunc)
+	if !ok {
+		return
+	}
+	log := LoggerFromContext(ctx)
+	if len(args) == 0 {
+		log("Executing query: %s", query)
+		return
+	}
+	log("Executing query: %s with arguments %s", query, fmt.Sprint(redact(query, args)))
+}
@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWithQueryLogging(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var logs []string
+	adapter := NewSQLiteAdapter(func(format string, v ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, v...))
+	})
+	ctx = withMigration(WithoutQueryComments(ctx), adapter, 1, true, "")
+
+	// Nothing is logged unless query logging is enabled.
+	if err := ExecQueries([]string{"example query"})(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	logQuery(ctx, "INSERT INTO users (email) VALUES (?)", []interface{}{"a@example.com"})
+	if len(logs) != 0 {
+		t.Errorf("expected no logs, got %q", logs)
+	}
+
+	ctx = WithQueryLogging(ctx, RedactAll)
+	if err := ExecQueries([]string{"example query"})(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	logQuery(ctx, "INSERT INTO users (email) VALUES (?)", []interface{}{"a@example.com"})
+	expected := []string{
+		"Executing query: example query",
+		"Executing query: INSERT INTO users (email) VALUES (?) with arguments [[REDACTED]]",
+	}
+	if fmt.Sprint(logs) != fmt.Sprint(expected) {
+		t.Errorf("expected logs %q, got %q", expected, logs)
+	}
+
+	logs = nil
+	logQuery(WithQueryLogging(ctx, nil), "INSERT INTO users (email) VALUES (?)", []interface{}{"a@example.com"})
+	if len(logs) != 1 || logs[0] != "Executing query: INSERT INTO users (email) VALUES (?) with arguments [a@example.com]" {
+		t.Errorf("expected arguments to be logged, got %q", logs)
+	}
+}
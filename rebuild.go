@@ -0,0 +1,220 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// TableRebuild describes how to rebuild a table with RebuildTable.
+type TableRebuild struct {
+	// Table is the table to rebuild.
+	Table string
+
+	// Definition is the part of the CREATE TABLE statement for the new
+	// table that follows its name, like
+	// "(id BIGINT PRIMARY KEY, name TEXT NOT NULL)". It should include any
+	// constraints and indexes the table needs.
+	Definition string
+
+	// Columns are the columns of the new table that are copied into.
+	Columns []string
+
+	// Select are the expressions for each of the Columns, selected from the
+	// old table, like "lower(name)". If it's nil, the Columns are copied from
+	// the old table as is.
+	Select []string
+
+	// KeyColumn is an integer column of the old table with unique values,
+	// which is used to copy the rows in batches. It defaults to "id".
+	KeyColumn string
+
+	// BatchSize is the number of rows copied by each batch. It defaults to
+	// 1000.
+	BatchSize int
+
+	// Pacer throttles the batches.
+	Pacer Pacer
+
+	// Progress, if set, is called after each batch. Its Done is the number
+	// of rows copied so far, and its Total is the number of rows in the old
+	// table when the copy started.
+	Progress func(Progress)
+}
+
+// RebuildTable returns a migration function that rebuilds a table by
+// creating a new table with the definition, copying the rows into it in
+// batches, checking that both tables have the same number of rows, and then
+// swapping their names and dropping the old table. This is useful for changes
+// that ALTER TABLE would make by rewriting the table while holding a lock
+// that blocks writes for too long, or that the database can't make in place,
+// like many changes for DialectSQLite.
+//
+// If anything fails before the names are swapped, the new table is dropped
+// and the old one is left as it was. The names are swapped atomically, in a
+// transaction for DialectPostgreSQL and DialectSQLite, and with a single
+// RENAME TABLE for DialectMySQL.
+//
+// Rows that are changed or deleted in the old table while it's being copied
+// aren't copied again, so the table must not be updated or deleted from
+// during the rebuild. Rows inserted with higher keys are copied by later
+// batches, as long as they're inserted before the last one. Views, triggers
+// and foreign keys that refer to the old table aren't moved to the new one.
+func RebuildTable(r TableRebuild) MigrationFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		dialect := dialectFromContext(ctx)
+		if dialect != DialectPostgreSQL && dialect != DialectMySQL && dialect != DialectSQLite {
+			return fmt.Errorf("rebuilding tables is not supported for dialect %q", dialect)
+		}
+		if len(r.Columns) == 0 || (r.Select != nil && len(r.Select) != len(r.Columns)) {
+			return fmt.Errorf("rebuilding %s requires columns, and an expression for each one", r.Table)
+		}
+		newTable := r.Table + "_rebuild"
+		create := fmt.Sprintf("CREATE TABLE %s %s", newTable, r.Definition)
+		if err := ExecQueries([]string{create})(ctx, db); err != nil {
+			return fmt.Errorf("error creating %s: %w", newTable, err)
+		}
+		if err := r.copyRows(ctx, db, dialect, newTable); err != nil {
+			if dropErr := ExecQueries([]string{"DROP TABLE " + newTable})(ctx, db); dropErr != nil {
+				return fmt.Errorf("%w (and error dropping %s: %s)", err, newTable, dropErr)
+			}
+			return err
+		}
+		return r.swap(ctx, db, dialect, newTable)
+	}
+}
+
+// copyRows copies the rows of the table into newTable in batches, and then
+// checks that they have the same number of rows.
+func (r TableRebuild) copyRows(ctx context.Context, db *sql.DB, dialect Dialect, newTable string) error {
+	key := r.KeyColumn
+	if key == "" {
+		key = "id"
+	}
+	size := r.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	selects := r.Select
+	if selects == nil {
+		selects = r.Columns
+	}
+	nextQuery := fmt.Sprintf("SELECT MAX(%s) FROM (SELECT %s FROM %s WHERE %s > %s ORDER BY %s LIMIT %d) batch",
+		key, key, r.Table, key, dialect.placeholder(1), key, size)
+	insertQuery := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s > %s AND %s <= %s",
+		newTable, strings.Join(r.Columns, ", "), strings.Join(selects, ", "),
+		r.Table, key, dialect.placeholder(1), key, dialect.placeholder(2))
+	minQuery := fmt.Sprintf("SELECT MIN(%s) FROM %s", key, r.Table)
+	minQuery, nextQuery, insertQuery = rewriteQuery(ctx, minQuery), rewriteQuery(ctx, nextQuery), rewriteQuery(ctx, insertQuery)
+
+	total, err := countRows(ctx, db, r.Table)
+	if err != nil {
+		return err
+	}
+	log := LoggerFromContext(ctx)
+	log("Copying %d rows from %s to %s", total, r.Table, newTable)
+	p := r.Pacer
+	// Batches start after the last key copied, so the first one starts just
+	// before the smallest key, which may be zero or negative.
+	var first sql.NullInt64
+	logQuery(ctx, minQuery, nil)
+	if err := db.QueryRowContext(ctx, minQuery).Scan(&first); err != nil {
+		return fmt.Errorf("error finding the first key of %s: %w", r.Table, err)
+	}
+	last, copied := first.Int64-1, int64(0)
+	for batch := 0; first.Valid; batch++ {
+		var next sql.NullInt64
+		logQuery(ctx, nextQuery, []interface{}{last})
+		if err := db.QueryRowContext(ctx, nextQuery, last).Scan(&next); err != nil {
+			return fmt.Errorf("error finding batch %d of %s: %w", batch, r.Table, err)
+		}
+		if !next.Valid {
+			break
+		}
+		args := []interface{}{last, next.Int64}
+		logQuery(ctx, insertQuery, args)
+		result, err := db.ExecContext(ctx, insertQuery, args...)
+		if err != nil {
+			return fmt.Errorf("error copying batch %d of %s: %w", batch, r.Table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error copying batch %d of %s: %w", batch, r.Table, err)
+		}
+		copied += n
+		last = next.Int64
+		if r.Progress != nil {
+			r.Progress(Progress{Phase: "copying rows", Done: copied, Total: total})
+		}
+		if err := p.Wait(ctx, n); err != nil {
+			return err
+		}
+	}
+
+	oldCount, err := countRows(ctx, db, r.Table)
+	if err != nil {
+		return err
+	}
+	newCount, err := countRows(ctx, db, newTable)
+	if err != nil {
+		return err
+	}
+	if oldCount != newCount {
+		return fmt.Errorf("error verifying %s: it has %d rows, but %s has %d", newTable, newCount, r.Table, oldCount)
+	}
+	return nil
+}
+
+// swap renames the table to the old table, and newTable to the table, and
+// then drops the old table.
+func (r TableRebuild) swap(ctx context.Context, db *sql.DB, dialect Dialect, newTable string) error {
+	oldTable := r.Table + "_old"
+	if dialect == DialectMySQL {
+		query := fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", r.Table, oldTable, newTable, r.Table)
+		if err := ExecQueries([]string{query})(ctx, db); err != nil {
+			return fmt.Errorf("error swapping %s and %s: %w", r.Table, newTable, err)
+		}
+	} else {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// The new name given to RENAME TO can't include the schema.
+		queries := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", r.Table, unqualifiedName(oldTable)),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", newTable, unqualifiedName(r.Table)),
+		}
+		for _, q := range queries {
+			q = rewriteQuery(ctx, q)
+			logQuery(ctx, q, nil)
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error swapping %s and %s: %w", r.Table, newTable, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error swapping %s and %s: %w", r.Table, newTable, err)
+		}
+	}
+	if err := ExecQueries([]string{"DROP TABLE " + oldTable})(ctx, db); err != nil {
+		return fmt.Errorf("error dropping %s: %w", oldTable, err)
+	}
+	return nil
+}
+
+// countRows returns the number of rows in the table.
+func countRows(ctx context.Context, db *sql.DB, table string) (int64, error) {
+	query := "SELECT COUNT(*) FROM " + table
+	logQuery(ctx, query, nil)
+	var n int64
+	if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting rows in %s: %w", table, err)
+	}
+	return n, nil
+}
+
+// unqualifiedName returns the name without its schema.
+func unqualifiedName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,137 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRebuildTable(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: "schema_versions", Rows: MockRows{}},
+		{Pattern: `COUNT\(\*\)`, Rows: MockRows{Cols: []string{"count"}, Values: [][]driver.Value{{int64(5)}}}},
+		{Pattern: `MIN\(id\)`, Rows: MockRows{Cols: []string{"min"}, Values: [][]driver.Value{{int64(1)}}}},
+	}
+	md.QueryRows = MockRows{Cols: []string{"max"}, Values: [][]driver.Value{{int64(3)}, {int64(7)}, {nil}}}
+	var progress []Progress
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{
+			Comment: "rebuild users",
+			Up: RebuildTable(TableRebuild{
+				Table:      "users",
+				Definition: "(id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+				Columns:    []string{"id", "name"},
+				Select:     []string{"id", "COALESCE(name, '')"},
+				BatchSize:  3,
+				Progress:   func(p Progress) { progress = append(progress, p) },
+			}),
+		}},
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		if i := strings.Index(l.Query, "*/ "); i >= 0 {
+			queries = append(queries, l.Query[i+3:])
+		}
+	}
+	expected := []string{
+		"CREATE TABLE users_rebuild (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+		"INSERT INTO users_rebuild (id, name) SELECT id, COALESCE(name, '') FROM users WHERE id > ? AND id <= ?",
+		"INSERT INTO users_rebuild (id, name) SELECT id, COALESCE(name, '') FROM users WHERE id > ? AND id <= ?",
+		"ALTER TABLE users RENAME TO users_old",
+		"ALTER TABLE users_rebuild RENAME TO users",
+		"DROP TABLE users_old",
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+	if !reflect.DeepEqual(md.TxLogs, []string{"BEGIN", "COMMIT"}) {
+		t.Errorf("expected the names to be swapped in a transaction, got %v", md.TxLogs)
+	}
+	if len(progress) != 2 || progress[1].Total != 5 {
+		t.Errorf("expected progress after each batch, got %+v", progress)
+	}
+}
+
+func TestRebuildTableVerifyFailed(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: "schema_versions", Rows: MockRows{}},
+		{Pattern: `COUNT\(\*\) FROM users_rebuild`, Rows: MockRows{Cols: []string{"count"}, Values: [][]driver.Value{{int64(4)}}}},
+		{Pattern: `COUNT\(\*\)`, Rows: MockRows{Cols: []string{"count"}, Values: [][]driver.Value{{int64(5)}}}},
+	}
+	md.QueryRows = MockRows{Cols: []string{"max"}, Values: [][]driver.Value{{nil}}}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewMySQLAdapter(t.Logf),
+		Migrations: []Migration{{
+			Comment: "rebuild users",
+			Up:      RebuildTable(TableRebuild{Table: "users", Definition: "(id INT PRIMARY KEY)", Columns: []string{"id"}}),
+		}},
+	}
+	err := m.Up(ctx)
+	expected := "error verifying users_rebuild: it has 4 rows, but users has 5"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if last := md.ExecLogs[len(md.ExecLogs)-1].Query; !strings.HasSuffix(last, "DROP TABLE users_rebuild") {
+		t.Errorf("expected the new table to be dropped, got %q", last)
+	}
+}
+
+func TestRebuildTableNonPositiveKeys(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryResults = []MockQueryResult{
+		{Pattern: "schema_versions", Rows: MockRows{}},
+		{Pattern: `COUNT\(\*\)`, Rows: MockRows{Cols: []string{"count"}, Values: [][]driver.Value{{int64(3)}}}},
+		{Pattern: `MIN\(id\)`, Rows: MockRows{Cols: []string{"min"}, Values: [][]driver.Value{{int64(-5)}}}},
+	}
+	md.QueryRows = MockRows{Cols: []string{"max"}, Values: [][]driver.Value{{int64(0)}, {int64(4)}, {nil}}}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{
+			Comment: "rebuild users",
+			Up: RebuildTable(TableRebuild{
+				Table:      "users",
+				Definition: "(id INTEGER PRIMARY KEY)",
+				Columns:    []string{"id"},
+				BatchSize:  2,
+			}),
+		}},
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var batches [][]driver.NamedValue
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "INSERT INTO users_rebuild") {
+			batches = append(batches, l.Args)
+		}
+	}
+	expected := [][]driver.NamedValue{
+		{{Ordinal: 1, Value: int64(-6)}, {Ordinal: 2, Value: int64(0)}},
+		{{Ordinal: 1, Value: int64(0)}, {Ordinal: 2, Value: int64(4)}},
+	}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, batches)
+	}
+	for _, l := range md.QueryLogs {
+		if strings.Contains(l.Query, "LIMIT 2") && reflect.DeepEqual(l.Args, []driver.NamedValue{{Ordinal: 1, Value: int64(-6)}}) {
+			return
+		}
+	}
+	t.Errorf("expected the first batch to start before the smallest key, got %#v", md.QueryLogs)
+}
@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"net"
+	"regexp"
+	"time"
+)
+
+// retry calls f, and calls it again after losing the connection or timing
+// out waiting for a lock, as configured by the Migrator's options.
+func (m *Migrator) retry(ctx context.Context, f func() error) error {
+	return m.retryLocks(ctx, func() error {
+		return m.reconnect(ctx, f)
+	})
+}
+
+// retryLocks calls f, and calls it again after a jittered backoff if it fails
+// because of a lock timeout, until the total delay would exceed
+// LockRetryMaxWait.
+func (m *Migrator) retryLocks(ctx context.Context, f func() error) error {
+	delay := m.LockRetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || m.LockRetryMaxWait <= 0 || !m.isLockTimeout(err) {
+			return err
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if waited+wait > m.LockRetryMaxWait {
+			return err
+		}
+		m.Adapter.Log("Timed out waiting for lock (%s), retrying in %s (attempt %d)", err, wait, attempt)
+		if sleepErr := Sleep(ctx, wait); sleepErr != nil {
+			return err
+		}
+		waited += wait
+		delay *= 2
+	}
+}
+
+// lockTimeoutRegexp matches the errors returned by PostgreSQL when a query
+// exceeds lock_timeout, and by MySQL when it exceeds lock_wait_timeout or
+// innodb_lock_wait_timeout.
+var lockTimeoutRegexp = regexp.MustCompile(`(?i)due to lock timeout|lock wait timeout exceeded`)
+
+// isLockTimeout returns true if err means a lock couldn't be acquired in time.
+func (m *Migrator) isLockTimeout(err error) bool {
+	if m.IsLockTimeout != nil {
+		return m.IsLockTimeout(err)
+	}
+	if errors.Is(err, ErrLockHeld) || errors.Is(err, ErrLockTimeout) {
+		return true
+	}
+	return lockTimeoutRegexp.MatchString(err.Error())
+}
+
+// reconnect calls f, and calls it again after a delay if it fails because the
+// connection was lost, up to ReconnectAttempts times.
+func (m *Migrator) reconnect(ctx context.Context, f func() error) error {
+	delay := m.ReconnectDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt > m.ReconnectAttempts || !m.isConnectionError(err) {
+			return err
+		}
+		m.Adapter.Log("Lost connection to database (%s), reconnecting in %s (attempt %d of %d)",
+			err, delay, attempt, m.ReconnectAttempts)
+		if sleepErr := Sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// isConnectionError returns true if err means the connection to the database
+// was lost before a query was sent.
+func (m *Migrator) isConnectionError(err error) bool {
+	if m.IsConnectionError != nil {
+		return m.IsConnectionError(err)
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
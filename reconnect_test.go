@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigratorReconnect(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	attempts := 0
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", Up: func(ctx context.Context, db *sql.DB) error {
+				attempts++
+				if attempts == 1 {
+					// The first migration has been recorded, so the next
+					// attempt resumes from version 1.
+					md.QueryRows.Version = 1
+					return fmt.Errorf("mock error: %w", driver.ErrBadConn)
+				}
+				return nil
+			}},
+		},
+		ReconnectAttempts: 1,
+		ReconnectDelay:    time.Millisecond,
+	}
+	from, to, err := m.migrateUp(WithoutQueryComments(ctx), 2, PhasePreDeploy, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if from != 0 || to != 2 || attempts != 2 {
+		t.Errorf("expected to migrate from 0 to 2 in 2 attempts, got %d to %d in %d", from, to, attempts)
+	}
+	applied := 0
+	for _, l := range md.ExecLogs {
+		if l.Query == "example query 1" {
+			applied++
+		}
+	}
+	if applied != 1 {
+		t.Errorf("expected the first migration to be applied once, got %d", applied)
+	}
+}
+
+func TestMigratorReconnectOtherError(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	attempts := 0
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Up: func(ctx context.Context, db *sql.DB) error {
+			attempts++
+			return errors.New("mock error")
+		}}},
+		ReconnectAttempts: 3,
+		ReconnectDelay:    time.Millisecond,
+	}
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("expected other errors not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestMigratorLockRetry(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	attempts := 0
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Up: func(ctx context.Context, db *sql.DB) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("pq: canceling statement due to lock timeout")
+			}
+			return nil
+		}}},
+		LockRetryMaxWait: time.Second,
+		LockRetryDelay:   time.Millisecond,
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	// Other errors aren't retried.
+	attempts = 0
+	m.Migrations[0].Up = func(ctx context.Context, db *sql.DB) error {
+		attempts++
+		return errors.New("mock error")
+	}
+	if err := m.Up(ctx); err == nil || attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d with %v", attempts, err)
+	}
+}
+
+func TestMigratorLockRetryMaxWait(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	// The lock is always held by another connection.
+	md.QueryResults = []MockQueryResult{{Pattern: "pg_try_advisory_lock", Rows: MockRows{Version: 0}}}
+	m := &Migrator{
+		DB:               db,
+		Adapter:          NewPostgreSQLAdapter(t.Logf),
+		Migrations:       []Migration{{UpQueries: []string{"example query"}}},
+		LockName:         "migrate",
+		LockTimeout:      -1,
+		LockRetryMaxWait: 20 * time.Millisecond,
+		LockRetryDelay:   2 * time.Millisecond,
+	}
+	err := m.Up(ctx)
+	if !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+	tries := 0
+	for _, l := range md.QueryLogs {
+		if strings.Contains(l.Query, "pg_try_advisory_lock") {
+			tries++
+		}
+	}
+	// The delays are at least 1, 2, 4 and 8ms, so there are at most 4
+	// retries before the total reaches 20ms.
+	if tries < 2 || tries > 5 {
+		t.Errorf("expected 2 to 5 tries, got %d", tries)
+	}
+}
@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Rehearsal describes a run of Migrator.Rehearse.
+type Rehearsal struct {
+	// FromVersion is the version of the database before the rehearsal.
+	FromVersion int
+
+	// ToVersion is the version the migrations reached before they were
+	// rolled back.
+	ToVersion int
+
+	// Steps are the migrations that were run, in order. If a migration
+	// failed, it's the last step.
+	Steps []RehearsalStep
+
+	// Duration is how long the rehearsal took, not including rolling back.
+	Duration time.Duration
+}
+
+// RehearsalStep describes a migration that was run by Migrator.Rehearse.
+type RehearsalStep struct {
+	// Version is the version of the migration.
+	Version int
+
+	// Comment is the comment for the migration.
+	Comment string
+
+	// Duration is how long the migration took.
+	Duration time.Duration
+
+	// Err is the error the migration failed with, if any.
+	Err error
+}
+
+// errRehearsed is returned by the confirm function used by Rehearse, so that
+// Prepare rolls back the migrations.
+var errRehearsed = errors.New("rehearsal finished")
+
+// Rehearse runs the migrations up to the target version in a transaction,
+// like Prepare, and then always rolls them back, so the migrations are
+// really executed against the database without changing it. This is a
+// stronger check than a plan, since errors from the database, like
+// constraint violations in backfills, are found. It returns the version the
+// migrations reached and how long each one took, along with the error for
+// the migration that failed, if any. Failures aren't recorded in the
+// adapter's failures table.
+//
+// It has the same requirements as Prepare: the dialect must support
+// transactional DDL, and the migrations can't use statements that can't be
+// run in a transaction, or Checkpoints. Locks taken by the migrations are
+// held until the rollback, and side effects outside the transaction, like
+// sequence values, aren't undone.
+func (m *Migrator) Rehearse(ctx context.Context, targetVersion int) (*Rehearsal, error) {
+	r := &Rehearsal{}
+	ctx = context.WithValue(ctx, rehearsalKey, r)
+	start := time.Now()
+	err := m.Prepare(ctx, targetVersion, func(ctx context.Context, db *sql.DB) error {
+		r.Duration = time.Since(start)
+		if len(r.Steps) > 0 {
+			r.FromVersion = r.Steps[0].Version - 1
+			r.ToVersion = r.Steps[len(r.Steps)-1].Version
+		} else {
+			current, err := querySchemaVersion(ctx, db, m.Adapter)
+			if err != nil {
+				return err
+			}
+			r.FromVersion, r.ToVersion = current, current
+		}
+		return errRehearsed
+	})
+	if errors.Is(err, errRehearsed) {
+		return r, nil
+	}
+	if len(r.Steps) > 0 {
+		r.Duration = time.Since(start)
+		r.FromVersion = r.Steps[0].Version - 1
+		r.ToVersion = r.Steps[len(r.Steps)-1].Version - 1
+	}
+	return r, err
+}
+
+// rehearsalFromContext returns the Rehearsal of the run, or nil if the run
+// isn't a rehearsal.
+func rehearsalFromContext(ctx context.Context) *Rehearsal {
+	r, _ := ctx.Value(rehearsalKey).(*Rehearsal)
+	return r
+}
@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestMigratorRehearse(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.FailuresTableName = "schema_failures"
+	adapter.PlaceholderError = "$4"
+	m := &Migrator{
+		DB:      db,
+		Adapter: adapter,
+		Migrations: []Migration{
+			{Comment: "create users", UpQueries: []string{"CREATE TABLE users (id INT)"}},
+			{Comment: "backfill users", Up: func(ctx context.Context, db *sql.DB) error {
+				return errors.New("duplicate key")
+			}},
+		},
+	}
+	r, err := m.Rehearse(WithoutQueryComments(ctx), 1)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if r.FromVersion != 0 || r.ToVersion != 1 || len(r.Steps) != 1 || r.Steps[0].Version != 1 || r.Steps[0].Err != nil {
+		t.Errorf("unexpected rehearsal %+v", r)
+	}
+	if n := len(md.ExecLogs); n != 5 || md.ExecLogs[0].Query != "BEGIN" || md.ExecLogs[n-1].Query != "ROLLBACK" {
+		t.Errorf("expected migrations to be rolled back, got %#v", md.ExecLogs)
+	}
+
+	md.Reset()
+	r, err = m.Rehearse(WithoutQueryComments(ctx), 2)
+	var failure *MigrationError
+	if !errors.As(err, &failure) || failure.Version != 2 {
+		t.Fatalf("expected version 2 to fail, got %v", err)
+	}
+	if r.FromVersion != 0 || r.ToVersion != 1 || len(r.Steps) != 2 || r.Steps[1].Err == nil {
+		t.Errorf("unexpected rehearsal %+v", r)
+	}
+	if n := len(md.ExecLogs); md.ExecLogs[n-1].Query != "ROLLBACK" {
+		t.Errorf("expected the failure not to be recorded after rolling back, got %#v", md.ExecLogs)
+	}
+}
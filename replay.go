@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// These are the kinds of ReplayEvent.
+const (
+	// ReplayPrepare is recorded when the adapter prepares the schema
+	// versions.
+	ReplayPrepare = "prepare"
+
+	// ReplayQueryVersion is recorded when the current version is queried.
+	// Version is the version that was returned.
+	ReplayQueryVersion = "query_version"
+
+	// ReplaySQL is recorded for each query run by the package's helpers,
+	// like ExecQueries, after it has been rewritten.
+	ReplaySQL = "sql"
+
+	// ReplayInsertVersion is recorded when a version is inserted.
+	ReplayInsertVersion = "insert_version"
+
+	// ReplayFailure is recorded when a migration fails.
+	ReplayFailure = "failure"
+)
+
+// ReplayEvent is a single line of a file written by a ReplayRecorder.
+type ReplayEvent struct {
+	// Kind is one of the Replay constants.
+	Kind string `json:"kind"`
+
+	// Version is the version of the migration that was running, or the
+	// version that was queried or inserted.
+	Version int `json:"version,omitempty"`
+
+	// Query is the SQL for ReplaySQL events.
+	Query string `json:"query,omitempty"`
+
+	// Args are the arguments for ReplaySQL events.
+	Args []interface{} `json:"args,omitempty"`
+
+	// Direction is the direction for ReplayInsertVersion events.
+	Direction Direction `json:"direction,omitempty"`
+
+	// Comment is the comment for ReplayInsertVersion events.
+	Comment string `json:"comment,omitempty"`
+
+	// Error is the error for ReplayFailure events.
+	Error string `json:"error,omitempty"`
+}
+
+// ReplayRecorder records the adapter calls and SQL of a run as lines of JSON,
+// so the run can be reproduced with Replay, such as to debug a migration that
+// failed in production against a copy of the database in staging. Register
+// it on the context of the run with WithReplayRecorder.
+//
+// Only the SQL run by the package's helpers, like ExecQueries and UpQueries,
+// is recorded. Queries that Up functions run on the database directly can't
+// be seen. Arguments are stored as JSON, so values like []byte and time.Time
+// are replayed as strings.
+type ReplayRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewReplayRecorder creates a ReplayRecorder that writes to w.
+func NewReplayRecorder(w io.Writer) *ReplayRecorder {
+	return &ReplayRecorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing an event, if any.
+func (r *ReplayRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *ReplayRecorder) record(e ReplayEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(e)
+	}
+}
+
+// WithReplayRecorder returns a copy of the context that records the run to
+// the recorder.
+func WithReplayRecorder(ctx context.Context, r *ReplayRecorder) context.Context {
+	return context.WithValue(ctx, replayRecorderKey, r)
+}
+
+// recordReplay records an event, if there's a recorder on the context.
+func recordReplay(ctx context.Context, e ReplayEvent) {
+	if r, ok := ctx.Value(replayRecorderKey).(*ReplayRecorder); ok {
+		r.record(e)
+	}
+}
+
+// Replay runs the events recorded by a ReplayRecorder against a database,
+// using the adapter for the adapter calls. The recorded SQL is executed as it
+// was recorded, and versions are inserted as they were, so the database
+// should start at the same version as the recorded one. Queried versions
+// and failures are logged rather than run. Replay stops at the first error,
+// such as the one that caused the recorded run to fail.
+func Replay(ctx context.Context, db *sql.DB, adapter Adapter, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e ReplayEvent
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		if err := dec.Decode(&e); err != nil {
+			return fmt.Errorf("error decoding replay line %d: %w", line, err)
+		}
+		if err := replayEvent(ctx, db, adapter, e); err != nil {
+			return fmt.Errorf("error replaying line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// replayEvent runs a single event for Replay.
+func replayEvent(ctx context.Context, db *sql.DB, adapter Adapter, e ReplayEvent) error {
+	switch e.Kind {
+	case ReplayPrepare:
+		return adapter.PrepareSchemaVersions(ctx, db)
+	case ReplayQueryVersion:
+		adapter.Log("Recorded database version was %d", e.Version)
+	case ReplaySQL:
+		for i, arg := range e.Args {
+			if n, ok := arg.(json.Number); ok {
+				if v, err := n.Int64(); err == nil {
+					e.Args[i] = v
+				} else if v, err := n.Float64(); err == nil {
+					e.Args[i] = v
+				}
+			}
+		}
+		_, err := db.ExecContext(ctx, e.Query, e.Args...)
+		return err
+	case ReplayInsertVersion:
+		return insertVersion(ctx, db, adapter, e.Version, e.Direction, e.Comment)
+	case ReplayFailure:
+		adapter.Log("Recorded failure for version %d: %s", e.Version, e.Error)
+	default:
+		return fmt.Errorf("unknown event kind %q", e.Kind)
+	}
+	return nil
+}
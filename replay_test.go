@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReplayRecorder(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	rec := NewReplayRecorder(&buf)
+	migrations := []Migration{
+		{Comment: "example comment 1", Up: ExecQueriesWithArgs([]Query{{SQL: "example query 1", Args: []interface{}{int64(1), "a"}}})},
+		{Comment: "example comment 2", Up: func(ctx context.Context, db *sql.DB) error {
+			return errors.New("mock error")
+		}},
+	}
+	ctx = WithoutQueryComments(WithReplayRecorder(ctx, rec))
+	if err := Up(ctx, db, NewSQLiteAdapter(t.Logf), migrations); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := `{"kind":"prepare"}
+{"kind":"query_version"}
+{"kind":"sql","version":1,"query":"example query 1","args":[1,"a"]}
+{"kind":"insert_version","version":1,"direction":"applied","comment":"example comment 1"}
+{"kind":"failure","version":2,"error":"mock error"}
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	md.Reset()
+	if err := Replay(ctx, db, NewSQLiteAdapter(t.Logf), strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || md.ExecLogs[1].Query != "example query 1" {
+		t.Fatalf("expected the recorded queries to be replayed, got %#v", md.ExecLogs)
+	}
+	if args := md.ExecLogs[1].Args; len(args) != 2 || args[0].Value != int64(1) || args[1].Value != "a" {
+		t.Errorf("expected the recorded arguments to be replayed, got %#v", args)
+	}
+
+	err := Replay(ctx, db, NewSQLiteAdapter(t.Logf), strings.NewReader("\n{\"kind\":\"unknown\"}\n"))
+	if err == nil || err.Error() != `error replaying line 2: unknown event kind "unknown"` {
+		t.Errorf("expected an unknown kind error, got %v", err)
+	}
+}
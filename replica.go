@@ -0,0 +1,34 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnlyDatabase is wrapped by the error returned when RequirePrimary is
+// set and the database is a read-only replica.
+var ErrReadOnlyDatabase = errors.New("database is read-only")
+
+// checkPrimary wraps a session function so that it checks whether the
+// database is writable first.
+func (m *Migrator) checkPrimary(ctx context.Context, f func(db *sql.DB) error) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		var query string
+		switch dialectOf(m.Adapter) {
+		case DialectPostgreSQL:
+			query = "SELECT pg_is_in_recovery()::int"
+		case DialectMySQL:
+			query = "SELECT @@global.read_only"
+		}
+		var readOnly int
+		if err := db.QueryRowContext(ctx, query).Scan(&readOnly); err != nil {
+			return fmt.Errorf("error checking whether database is read-only: %w", err)
+		}
+		if readOnly != 0 {
+			return fmt.Errorf("%w (it may be a replica), migrations must be run against the primary", ErrReadOnlyDatabase)
+		}
+		return f(db)
+	}
+}
@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMigratorRequirePrimary(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:             db,
+		Adapter:        NewPostgreSQLAdapter(t.Logf),
+		Migrations:     []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		RequirePrimary: true,
+	}
+	if err := m.DownToVersion(ctx, 0); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if q := md.QueryLogs[0].Query; q != "SELECT pg_is_in_recovery()::int" {
+		t.Errorf("expected the database to be checked first, got %q", q)
+	}
+
+	md.Reset()
+	md.QueryRows.Version = 1
+	err := m.Up(ctx)
+	expected := "database is read-only (it may be a replica), migrations must be run against the primary"
+	if !errors.Is(err, ErrReadOnlyDatabase) || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if len(md.ExecLogs) != 0 {
+		t.Errorf("expected no queries to be executed, got %#v", md.ExecLogs)
+	}
+
+	m.Adapter = NewSQLiteAdapter(t.Logf)
+	expected = `checking for a primary is not supported for dialect "sqlite"`
+	if err := m.Up(ctx); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
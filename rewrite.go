@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RewriteFunc is the type of function used to rewrite SQL queries before they
+// are executed by ExecQueries. It can be used to append options to DDL (such
+// as "ALGORITHM=INPLACE, LOCK=NONE" for MySQL), add schema prefixes, or tag
+// queries with comments.
+type RewriteFunc func(ctx context.Context, query string) string
+
+// WithRewriter returns a copy of the context with the rewrite function
+// registered. Any queries run by ExecQueries with the returned context (or a
+// context derived from it) are passed through the function before they are
+// executed. Rewriters can be registered multiple times, and are called in the
+// order they were registered.
+func WithRewriter(ctx context.Context, f RewriteFunc) context.Context {
+	existing := rewritersFromContext(ctx)
+	rewriters := make([]RewriteFunc, len(existing), len(existing)+1)
+	copy(rewriters, existing)
+	return context.WithValue(ctx, rewritersKey, append(rewriters, f))
+}
+
+func rewritersFromContext(ctx context.Context) []RewriteFunc {
+	rewriters, _ := ctx.Value(rewritersKey).([]RewriteFunc)
+	return rewriters
+}
+
+// WithoutQueryComments returns a copy of the context that disables the
+// comments ExecQueries normally prepends to queries.
+func WithoutQueryComments(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryCommentsKey, true)
+}
+
+// rewriteQuery passes the query through each of the rewriters registered on
+// the context. If the query is being run as part of a migration, a comment is
+// then prepended to the query that identifies the migration, like:
+//
+//	/* migrate: v3 Add user app join table */ CREATE TABLE user_apps ...
+//
+// This makes it easy to attribute load to a migration in slow query logs or
+// pg_stat_statements.
+func rewriteQuery(ctx context.Context, query string) string {
+	for _, f := range rewritersFromContext(ctx) {
+		query = f(ctx, query)
+	}
+	if disabled, _ := ctx.Value(noQueryCommentsKey).(bool); disabled {
+		return query
+	}
+	if info, ok := MigrationFromContext(ctx); ok {
+		query = fmt.Sprintf("/* migrate: v%d %s */ %s", info.Version, sanitizeComment(info.Comment), query)
+	}
+	return query
+}
+
+var commentReplacer = strings.NewReplacer("*/", "* /", "/*", "/ *", "\r", " ", "\n", " ")
+
+// sanitizeComment makes a migration comment safe to include in a SQL comment.
+// The replacer is applied until no comment markers are left, since a single
+// pass can leave one behind in text like "/*/".
+func sanitizeComment(comment string) string {
+	comment = commentReplacer.Replace(comment)
+	for strings.Contains(comment, "*/") || strings.Contains(comment, "/*") {
+		comment = commentReplacer.Replace(comment)
+	}
+	return strings.TrimSpace(comment)
+}
@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithRewriter(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	ctx = WithRewriter(ctx, func(ctx context.Context, query string) string {
+		return query + ", ALGORITHM=INPLACE"
+	})
+	ctx2 := WithRewriter(ctx, func(ctx context.Context, query string) string {
+		return query + ", LOCK=NONE"
+	})
+	queries := []string{"ALTER TABLE a ADD COLUMN b INT", "ALTER TABLE a ADD COLUMN c INT"}
+	if err := ExecQueries(queries)(ctx2, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := ExecQueries(queries[:1])(ctx, db); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs: []MockQueryLog{
+			{Query: "ALTER TABLE a ADD COLUMN b INT, ALGORITHM=INPLACE, LOCK=NONE"},
+			{Query: "ALTER TABLE a ADD COLUMN c INT, ALGORITHM=INPLACE, LOCK=NONE"},
+			{Query: "ALTER TABLE a ADD COLUMN b INT, ALGORITHM=INPLACE"},
+		},
+	})
+}
+
+func TestQueryComments(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	migrations := []Migration{
+		{Comment: "first */ DROP TABLE x; /*\nmigration", UpQueries: []string{"example query 1"}},
+		{Comment: "second migration", UpQueries: []string{"example query 2"}, DownQueries: []string{"example query 3"}},
+		{Comment: "third /*/ DROP TABLE x", UpQueries: []string{"example query 4"}},
+		{Comment: "fourth *//* DROP TABLE x", UpQueries: []string{"example query 5"}},
+	}
+	adapter := NewSQLiteAdapter(t.Logf)
+	if err := Up(ctx, db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 9 {
+		t.Fatalf("expected 9 queries, got %#v", md.ExecLogs)
+	}
+	expected := "/* migrate: v1 first * / DROP TABLE x; / * migration */ example query 1"
+	if md.ExecLogs[1].Query != expected {
+		t.Errorf("expected %q, got %q", expected, md.ExecLogs[1].Query)
+	}
+	expected = "/* migrate: v2 second migration */ example query 2"
+	if md.ExecLogs[3].Query != expected {
+		t.Errorf("expected %q, got %q", expected, md.ExecLogs[3].Query)
+	}
+	expected = "/* migrate: v3 third / * / DROP TABLE x */ example query 4"
+	if md.ExecLogs[5].Query != expected {
+		t.Errorf("expected %q, got %q", expected, md.ExecLogs[5].Query)
+	}
+	expected = "/* migrate: v4 fourth * // * DROP TABLE x */ example query 5"
+	if md.ExecLogs[7].Query != expected {
+		t.Errorf("expected %q, got %q", expected, md.ExecLogs[7].Query)
+	}
+
+	md.Reset()
+	md.QueryRows.Version = 2
+	if err := DownToVersion(WithoutQueryComments(ctx), db, adapter, 1, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 3 || md.ExecLogs[1].Query != "example query 3" {
+		t.Errorf("expected query without comment, got %#v", md.ExecLogs)
+	}
+}
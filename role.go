@@ -0,0 +1,34 @@
+package migrate
+
+import "fmt"
+
+// roleSwitch holds the queries used to switch to a role and back.
+type roleSwitch struct {
+	// set switches to the role, and reset switches back to the session's
+	// original role.
+	set, reset string
+
+	// current returns the roles that are active before switching, for
+	// dialects that can't reset to them directly. If it's set, reset is a
+	// prefix that the roles are appended to.
+	current string
+}
+
+// newRoleSwitch returns the role queries for the dialect. MySQL's SET ROLE
+// DEFAULT activates the user's default roles, which may not be the ones that
+// were active, so the active roles are read with CURRENT_ROLE() and restored
+// instead.
+func newRoleSwitch(dialect Dialect, role string) (*roleSwitch, error) {
+	switch dialect {
+	case DialectPostgreSQL:
+		return &roleSwitch{set: "SET ROLE " + dialect.quoteIdent(role), reset: "RESET ROLE"}, nil
+	case DialectMySQL:
+		return &roleSwitch{
+			set:     "SET ROLE " + dialect.quoteIdent(role),
+			current: "SELECT CURRENT_ROLE()",
+			reset:   "SET ROLE ",
+		}, nil
+	default:
+		return nil, fmt.Errorf("switching roles is not supported for dialect %q", dialect)
+	}
+}
@@ -0,0 +1,313 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// These are the exit codes used by RunAndExit, so that deployment pipelines
+// and infrastructure tools can branch on the outcome of a run. They're part
+// of the package's compatibility promise, and won't change.
+const (
+	// ExitOK means the run succeeded. Unless DetailedExitCodes is set, it's
+	// used whether or not any migrations were applied. With it set, it means
+	// the database was already up to date.
+	ExitOK = 0
+
+	// ExitApplied means one or more migrations were applied. It's only used
+	// when DetailedExitCodes is set.
+	ExitApplied = 1
+
+	// ExitPending means a dry run found migrations that need to be applied.
+	// It's only used when DetailedExitCodes is set.
+	ExitPending = 2
+
+	// ExitError means the run failed for some other reason, such as not
+	// being able to connect to the database or read the current version.
+	ExitError = 3
+
+	// ExitMigrationFailed means one of the migrations returned an error.
+	ExitMigrationFailed = 4
+
+	// ExitLockFailed means the advisory lock couldn't be acquired, such as
+	// when the context timed out waiting for another process.
+	ExitLockFailed = 5
+
+	// ExitLintFailed means Lint was set and found problems in the
+	// migrations, so nothing was run.
+	ExitLintFailed = 6
+)
+
+// RunConfig configures RunAndExit.
+type RunConfig struct {
+	// Migrator runs the migrations. If its LockName is empty, and its
+	// dialect supports advisory locks, the lock "migrate" is used.
+	Migrator *Migrator
+
+	// TargetVersion is the version to migrate to. If it's zero, the database
+	// is migrated to the latest version in Phase.
+	TargetVersion int
+
+	// TargetComment selects the target version by the words in its
+	// comment, using ResolveTarget, instead of by TargetVersion.
+	TargetComment string
+
+	// ConfirmTarget is called with the version and comment that
+	// TargetComment resolved to, and the run fails unless it returns true.
+	// PromptConfirm can be used to ask on the terminal. If it's nil, the
+	// resolved version is used without confirmation.
+	ConfirmTarget func(version int, comment string) bool
+
+	// Phase is the last phase to apply migrations from when TargetVersion is
+	// zero. It defaults to PhasePreDeploy.
+	Phase Phase
+
+	// Lint checks the migrations with Lint before running them, and fails
+	// the run with ExitLintFailed if there are any findings.
+	Lint bool
+
+	// LintRules are additional rules checked when Lint is set, such as an
+	// organization's naming conventions.
+	LintRules []LintRule
+
+	// DryRun reports the migrations that would be applied, without applying
+	// them. It uses the Migrator's ReadDB if it's set, so it can be run with
+	// read-only credentials, such as by developers or in CI, while applying
+	// migrations uses the credentials of DB.
+	DryRun bool
+
+	// DetailedExitCodes distinguishes between runs that applied migrations
+	// and runs that didn't, using ExitApplied and ExitPending, like the
+	// -detailed-exitcode flag of terraform plan.
+	DetailedExitCodes bool
+
+	// OutputFormat is the format to write the result in, either "json" for a
+	// line of JSON containing a RunResult, or "text". It defaults to "json".
+	OutputFormat string
+
+	// Output is where the result is written. It defaults to os.Stdout.
+	Output io.Writer
+
+	// AllowNewerDatabase lets the run succeed when the database's version is
+	// higher than the number of migrations. Otherwise RejectNewerDatabase is
+	// set on the Migrator, since an older build migrating a newer schema is
+	// usually a deployment mistake.
+	AllowNewerDatabase bool
+}
+
+// RegisterFlags registers command line flags for the options in the config,
+// for programs that use RunAndExit as their main function:
+//
+//	cfg := migrate.RunConfig{Migrator: m}
+//	cfg.RegisterFlags(flag.CommandLine)
+//	flag.Parse()
+//	migrate.RunAndExit(ctx, cfg)
+func (c *RunConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.TargetVersion, "target", c.TargetVersion, "version to migrate to (default latest)")
+	fs.StringVar(&c.TargetComment, "to", c.TargetComment, "words from the comment of the migration to migrate to, instead of -target")
+	phase := c.Phase
+	if phase == "" {
+		phase = PhasePreDeploy
+	}
+	fs.StringVar((*string)(&c.Phase), "phase", string(phase), `last phase to migrate, "pre-deploy" or "post-deploy"`)
+	fs.BoolVar(&c.Lint, "lint", c.Lint, "check the migrations for common mistakes before running them")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "report pending migrations without applying them")
+	fs.BoolVar(&c.DetailedExitCodes, "detailed-exitcode", c.DetailedExitCodes,
+		"exit with 0 if up to date, 1 if migrations were applied, 2 if migrations are pending, or more for errors")
+	format := c.OutputFormat
+	if format == "" {
+		format = "json"
+	}
+	fs.StringVar(&c.OutputFormat, "output", format, `output format, "json" or "text"`)
+	fs.BoolVar(&c.AllowNewerDatabase, "allow-newer-database", c.AllowNewerDatabase,
+		"don't fail if the database version is higher than the latest migration")
+}
+
+// RunResult is the result written by RunAndExit.
+type RunResult struct {
+	// Status is "up_to_date" if there were no migrations to apply, "applied"
+	// if migrations were applied, "pending" if a dry run found migrations to
+	// apply, or "failed" if the run failed.
+	Status string `json:"status"`
+
+	// FromVersion is the version of the database before the run.
+	FromVersion int `json:"from_version"`
+
+	// ToVersion is the version of the database after the run. For a dry run,
+	// it's the version the database would be migrated to.
+	ToVersion int `json:"to_version"`
+
+	// FailedVersion is the version of the migration that failed, if any.
+	FailedVersion int `json:"failed_version,omitempty"`
+
+	// Error is the error that caused the run to fail, if any.
+	Error string `json:"error,omitempty"`
+
+	// Pending are the migrations after ToVersion that weren't applied,
+	// because they're after the target version or in a later phase.
+	Pending []PendingMigration `json:"pending,omitempty"`
+
+	// Findings are the problems found by Lint, if it was set.
+	Findings []LintFinding `json:"findings,omitempty"`
+
+	// ExitCode is the exit code for the run.
+	ExitCode int `json:"exit_code"`
+}
+
+// String returns a human readable description of the result.
+func (r RunResult) String() string {
+	var s string
+	switch r.Status {
+	case "up_to_date":
+		s = fmt.Sprintf("Database is up to date at version %d", r.ToVersion)
+	case "applied":
+		s = fmt.Sprintf("Migrated database from version %d to %d", r.FromVersion, r.ToVersion)
+	case "pending":
+		s = fmt.Sprintf("Database needs to be migrated from version %d to %d", r.FromVersion, r.ToVersion)
+	default:
+		return fmt.Sprintf("Error migrating database from version %d: %s", r.FromVersion, r.Error)
+	}
+	if len(r.Pending) > 0 {
+		s += fmt.Sprintf(", leaving versions %d to %d pending", r.Pending[0].Version, r.Pending[len(r.Pending)-1].Version)
+	}
+	return s
+}
+
+// RunAndExit applies migrations, writes a RunResult to the output, and then
+// exits the process with one of the Exit codes. It's intended for processes
+// that only exist to migrate the database, such as a Kubernetes init
+// container or Job, or a step in an infrastructure pipeline, so that the
+// outcome is easy to check. Log messages should be written to os.Stderr, so
+// they don't mix with the result.
+func RunAndExit(ctx context.Context, cfg RunConfig) {
+	os.Exit(run(ctx, cfg))
+}
+
+// run implements RunAndExit, and returns the exit code.
+func run(ctx context.Context, cfg RunConfig) int {
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	result := runResult(ctx, cfg)
+	var err error
+	switch cfg.OutputFormat {
+	case "", "json":
+		err = json.NewEncoder(out).Encode(result)
+	case "text":
+		_, err = fmt.Fprintln(out, result)
+	default:
+		err = fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if result.ExitCode < ExitError {
+			return ExitError
+		}
+	}
+	return result.ExitCode
+}
+
+// resolveConfirmedTarget resolves a target from a comment, and asks for
+// confirmation if confirm is set.
+func resolveConfirmedTarget(migrations []Migration, comment string, confirm func(int, string) bool) (int, error) {
+	target, err := ResolveTarget(migrations, comment)
+	if err != nil {
+		return 0, err
+	}
+	if confirm != nil && target > 0 && !confirm(target, migrations[target-1].Comment) {
+		return 0, fmt.Errorf("migration to version %d was not confirmed", target)
+	}
+	return target, nil
+}
+
+// runResult runs the migrations for run, and returns the result.
+func runResult(ctx context.Context, cfg RunConfig) RunResult {
+	// The runs are created before copying the migrator, so Cancel works on
+	// the original.
+	cfg.Migrator.runs()
+	m := *cfg.Migrator
+	if m.LockName == "" {
+		if _, err := newAdvisoryLock(dialectOf(m.Adapter), "migrate"); err == nil {
+			m.LockName = "migrate"
+		}
+	}
+	if !cfg.AllowNewerDatabase {
+		m.RejectNewerDatabase = true
+	}
+	target, phase := cfg.TargetVersion, PhasePostDeploy
+	var result RunResult
+	var err error
+	if cfg.TargetComment != "" {
+		target, err = resolveConfirmedTarget(m.Migrations, cfg.TargetComment, cfg.ConfirmTarget)
+	} else if target == 0 {
+		target, phase = len(m.Migrations), cfg.Phase
+	}
+
+	if err == nil && phase.rank() < 0 {
+		err = fmt.Errorf("unknown phase %q", phase)
+	}
+	if err == nil && cfg.Lint {
+		if result.Findings = Lint(dialectOf(m.Adapter), m.Migrations, cfg.LintRules...); result.Findings != nil {
+			err = lintError(result.Findings)
+		}
+	}
+	switch {
+	case err != nil:
+		// The options were invalid, so nothing is run.
+	case cfg.DryRun:
+		var plan *Plan
+		if plan, err = m.planPhase(ctx, target, phase); err == nil {
+			result.FromVersion, result.ToVersion = plan.CurrentVersion, plan.CurrentVersion
+			if len(plan.Steps) > 0 {
+				result.ToVersion = plan.Steps[len(plan.Steps)-1].Version
+			}
+			err = m.checkSkew(plan.CurrentVersion)
+		}
+	default:
+		result.FromVersion, result.ToVersion, err = m.migrateUp(ctx, target, phase, nil)
+		// The migrator is a copy, so the prepared cache is copied back.
+		if atomic.LoadUint32(&m.prepared) == 1 {
+			atomic.StoreUint32(&cfg.Migrator.prepared, 1)
+		}
+	}
+
+	if err == nil {
+		result.Pending = pendingMigrations(m.Migrations, result.ToVersion)
+	}
+	switch {
+	case err != nil:
+		result.Status = "failed"
+		result.Error = err.Error()
+		result.ExitCode = ExitError
+		var me *MigrationError
+		var le *LockError
+		if errors.As(err, &me) {
+			result.FailedVersion = me.Version
+			result.ExitCode = ExitMigrationFailed
+		} else if errors.As(err, &le) {
+			result.ExitCode = ExitLockFailed
+		} else if result.Findings != nil {
+			result.ExitCode = ExitLintFailed
+		}
+	case result.FromVersion == result.ToVersion:
+		result.Status = "up_to_date"
+	case cfg.DryRun:
+		result.Status = "pending"
+		if cfg.DetailedExitCodes {
+			result.ExitCode = ExitPending
+		}
+	default:
+		result.Status = "applied"
+		if cfg.DetailedExitCodes {
+			result.ExitCode = ExitApplied
+		}
+	}
+	return result
+}
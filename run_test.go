@@ -0,0 +1,216 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+		},
+	}
+	var out bytes.Buffer
+	if code := run(ctx, RunConfig{Migrator: m, Output: &out}); code != ExitOK {
+		t.Errorf("expected exit code %d, got %d", ExitOK, code)
+	}
+	expected := `{"status":"applied","from_version":0,"to_version":2,"exit_code":0}` + "\n"
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+	if q := md.ExecLogs[0].Query; q != "SELECT pg_advisory_lock($1)" {
+		t.Errorf("expected the default lock to be used, got %q", q)
+	}
+	if m.LockName != "" {
+		t.Error("expected the migrator not to be modified")
+	}
+}
+
+func TestRunDetailedExitCodes(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+	}
+	tests := []struct {
+		Name     string
+		Version  int
+		DryRun   bool
+		Expected int
+		Output   string
+	}{
+		{"UpToDate", 1, false, ExitOK, "Database is up to date at version 1\n"},
+		{"Applied", 0, false, ExitApplied, "Migrated database from version 0 to 1\n"},
+		{"Pending", 0, true, ExitPending, "Database needs to be migrated from version 0 to 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			md.Reset()
+			md.QueryRows.Version = tt.Version
+			var out bytes.Buffer
+			cfg := RunConfig{Migrator: m, DryRun: tt.DryRun, DetailedExitCodes: true, OutputFormat: "text", Output: &out}
+			if code := run(ctx, cfg); code != tt.Expected {
+				t.Errorf("expected exit code %d, got %d", tt.Expected, code)
+			}
+			if out.String() != tt.Output {
+				t.Errorf("expected output %q, got %q", tt.Output, out.String())
+			}
+			if tt.DryRun && len(md.ExecLogs) != 1 {
+				t.Errorf("expected no migrations to be applied, got %#v", md.ExecLogs)
+			}
+		})
+	}
+}
+
+func TestRunPending(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+			{Comment: "example comment 3", UpQueries: []string{"example query 3"}},
+		},
+	}
+	var out bytes.Buffer
+	if code := run(ctx, RunConfig{Migrator: m, TargetVersion: 1, Output: &out}); code != ExitOK {
+		t.Errorf("expected exit code %d, got %d", ExitOK, code)
+	}
+	expected := `{"status":"applied","from_version":0,"to_version":1,` +
+		`"pending":[{"version":2,"comment":"example comment 2"},{"version":3,"comment":"example comment 3"}],"exit_code":0}` + "\n"
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+	result := runResult(ctx, RunConfig{Migrator: m, TargetVersion: 1})
+	if s := result.String(); s != "Migrated database from version 0 to 1, leaving versions 2 to 3 pending" {
+		t.Errorf("unexpected result string %q", s)
+	}
+
+	result = runResult(ctx, RunConfig{Migrator: m, TargetVersion: 4})
+	if result.Error != "version 4 is out of range, the latest version is 3" || result.Pending != nil {
+		t.Errorf("expected an out of range error, got %#v", result)
+	}
+	var te *TargetVersionError
+	if err := m.UpToVersion(ctx, 4); !errors.As(err, &te) || te.Version != 4 || te.Latest != 3 {
+		t.Errorf("expected a *TargetVersionError, got %v", err)
+	}
+	if err := m.DownToVersion(ctx, -1); !errors.As(err, &te) || te.Version != -1 {
+		t.Errorf("expected a *TargetVersionError, got %v", err)
+	}
+}
+
+func TestRunMigrationFailed(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Up: func(ctx context.Context, db *sql.DB) error {
+			return errors.New("mock error")
+		}}},
+	}
+	var out bytes.Buffer
+	if code := run(ctx, RunConfig{Migrator: m, Output: &out}); code != ExitMigrationFailed {
+		t.Errorf("expected exit code %d, got %d", ExitMigrationFailed, code)
+	}
+	expected := `{"status":"failed","from_version":0,"to_version":0,"failed_version":1,` +
+		`"error":"error upgrading database to version 1: mock error","exit_code":4}` + "\n"
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestRunLockFailed(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.ExecErr = errors.New("mock error")
+	m := &Migrator{DB: db, Adapter: NewMySQLAdapter(t.Logf)}
+	var out bytes.Buffer
+	if code := run(ctx, RunConfig{Migrator: m, Output: &out}); code != ExitLockFailed {
+		t.Errorf("expected exit code %d, got %d", ExitLockFailed, code)
+	}
+}
+
+func TestRunNewerDatabase(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	md.QueryRows.Version = 2
+	m := &Migrator{
+		DB:         db,
+		Adapter:    NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+	}
+	for _, dryRun := range []bool{false, true} {
+		var out bytes.Buffer
+		if code := run(ctx, RunConfig{Migrator: m, DryRun: dryRun, Output: &out}); code != ExitError {
+			t.Errorf("expected exit code %d, got %d", ExitError, code)
+		}
+		expected := `{"status":"failed","from_version":2,"to_version":2,` +
+			`"error":"database version 2 is newer than the latest migration version 1","exit_code":3}` + "\n"
+		if out.String() != expected {
+			t.Errorf("expected output %q, got %q", expected, out.String())
+		}
+	}
+	if code := run(ctx, RunConfig{Migrator: m, AllowNewerDatabase: true, Output: ioutil.Discard}); code != ExitOK {
+		t.Errorf("expected exit code %d, got %d", ExitOK, code)
+	}
+}
+
+func TestRunPhase(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}, Phase: PhasePostDeploy},
+		},
+	}
+	for _, dryRun := range []bool{false, true} {
+		for phase, expected := range map[Phase]int{PhasePreDeploy: 1, PhasePostDeploy: 2} {
+			result := runResult(ctx, RunConfig{Migrator: m, DryRun: dryRun, Phase: phase})
+			if result.ToVersion != expected {
+				t.Errorf("expected %s to migrate to version %d, got %#v", phase, expected, result)
+			}
+		}
+	}
+}
+
+func TestRunConfigRegisterFlags(t *testing.T) {
+	var cfg RunConfig
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if cfg.Phase != PhasePreDeploy {
+		t.Errorf("expected the phase to default to %q, got %q", PhasePreDeploy, cfg.Phase)
+	}
+	args := []string{"--output", "text", "--dry-run", "--target", "3", "--detailed-exitcode", "--phase", "post-deploy", "--lint"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if cfg.OutputFormat != "text" || !cfg.DryRun || cfg.TargetVersion != 3 || !cfg.DetailedExitCodes || cfg.Phase != PhasePostDeploy || !cfg.Lint {
+		t.Errorf("unexpected config %#v", cfg)
+	}
+}
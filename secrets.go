@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SecretFunc returns the value of a secret, like a database password.
+type SecretFunc func(ctx context.Context) (string, error)
+
+var secretRefRegexp = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// ExpandDSN returns a DSNFunc that replaces references like ${password} in
+// template with the values of the named secrets. The secrets are resolved
+// each time a connection is opened, so rotated credentials are picked up
+// without restarting. Values are inserted as they are, so secrets that can
+// contain characters with special meaning in the DSN should be escaped by
+// the SecretFunc. This can be used with OpenDSNFunc to avoid putting
+// plaintext credentials in flags or config files:
+//
+//	dsn := migrate.ExpandDSN("postgres://app:${password}@db/app?sslmode=verify-full", map[string]migrate.SecretFunc{
+//		"password": migrate.FileSecret("/var/run/secrets/db/password"),
+//	})
+//	db := migrate.OpenDSNFunc(&pq.Driver{}, dsn)
+//
+// Other secret stores, like AWS Secrets Manager, can be used by writing a
+// SecretFunc that calls their client library.
+func ExpandDSN(template string, secrets map[string]SecretFunc) DSNFunc {
+	return func(ctx context.Context) (string, error) {
+		var err error
+		dsn := secretRefRegexp.ReplaceAllStringFunc(template, func(ref string) string {
+			name := ref[2 : len(ref)-1]
+			secret, ok := secrets[name]
+			if !ok {
+				if err == nil {
+					err = fmt.Errorf("unknown secret %s in DSN", name)
+				}
+				return ref
+			}
+			value, serr := secret(ctx)
+			if serr != nil && err == nil {
+				err = fmt.Errorf("error resolving secret %s: %w", name, serr)
+			}
+			return value
+		})
+		if err != nil {
+			return "", err
+		}
+		return dsn, nil
+	}
+}
+
+// EnvSecret returns a SecretFunc that reads an environment variable. It
+// returns an error if the variable isn't set.
+func EnvSecret(name string) SecretFunc {
+	return func(ctx context.Context) (string, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+}
+
+// FileSecret returns a SecretFunc that reads a file, such as a Kubernetes
+// secret mounted as a volume. Trailing newlines are removed.
+func FileSecret(path string) SecretFunc {
+	return func(ctx context.Context) (string, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+}
+
+// VaultSecret returns a SecretFunc that reads a field from a secret in
+// HashiCorp Vault, using its HTTP API. Both version 1 and version 2 of the
+// key/value secrets engine are supported. For version 2, the path must
+// include "data", like "secret/data/db". If token is empty, the VAULT_TOKEN
+// environment variable is used.
+func VaultSecret(addr, token, path, field string) SecretFunc {
+	return func(ctx context.Context) (string, error) {
+		token := token
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		url := strings.TrimRight(addr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-Vault-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("error reading %s from vault: %s", path, resp.Status)
+		}
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return "", fmt.Errorf("error decoding %s from vault: %w", path, err)
+		}
+		data := body.Data
+		if nested, ok := data["data"].(map[string]interface{}); ok {
+			data = nested
+		}
+		value, ok := data[field].(string)
+		if !ok {
+			return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+		}
+		return value, nil
+	}
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandDSN(t *testing.T) {
+	dsn := ExpandDSN("postgres://${user}:${password}@db/app", map[string]SecretFunc{
+		"user":     func(ctx context.Context) (string, error) { return "app", nil },
+		"password": func(ctx context.Context) (string, error) { return "hunter2", nil },
+	})
+	s, err := dsn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if s != "postgres://app:hunter2@db/app" {
+		t.Errorf("unexpected dsn %q", s)
+	}
+
+	_, err = ExpandDSN("${missing}", nil)(context.Background())
+	if err == nil || err.Error() != "unknown secret missing in DSN" {
+		t.Errorf("expected unknown secret error, got %v", err)
+	}
+}
+
+func TestEnvSecret(t *testing.T) {
+	os.Setenv("MIGRATE_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("MIGRATE_TEST_SECRET")
+	if s, err := EnvSecret("MIGRATE_TEST_SECRET")(context.Background()); err != nil || s != "hunter2" {
+		t.Errorf("expected hunter2, got %q, %v", s, err)
+	}
+	if _, err := EnvSecret("MIGRATE_TEST_MISSING")(context.Background()); err == nil {
+		t.Error("expected error for missing variable")
+	}
+}
+
+func TestFileSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(path, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := FileSecret(path)(context.Background()); err != nil || s != "hunter2" {
+		t.Errorf("expected hunter2, got %q, %v", s, err)
+	}
+}
+
+func TestVaultSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			w.Write([]byte(`{"data": {"data": {"password": "hunter2"}, "metadata": {}}}`))
+		case "/v1/kv/db":
+			w.Write([]byte(`{"data": {"password": "hunter3"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	if s, err := VaultSecret(server.URL, "token", "secret/data/db", "password")(ctx); err != nil || s != "hunter2" {
+		t.Errorf("expected hunter2, got %q, %v", s, err)
+	}
+	if s, err := VaultSecret(server.URL, "token", "kv/db", "password")(ctx); err != nil || s != "hunter3" {
+		t.Errorf("expected hunter3, got %q, %v", s, err)
+	}
+	if _, err := VaultSecret(server.URL, "token", "kv/db", "user")(ctx); err == nil {
+		t.Error("expected error for missing field")
+	}
+	if _, err := VaultSecret(server.URL, "wrong", "kv/db", "password")(ctx); err == nil {
+		t.Error("expected error for bad token")
+	}
+}
@@ -0,0 +1,210 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Set is a list of migrations that are versioned together. Applications will
+// usually have a single set, but libraries that need their own tables can
+// export a Set with its own Table, so its versions are tracked separately
+// from the application's and the two can be combined with Combine.
+//
+// Large applications can also use a set to assemble migrations from several
+// packages with Add and Merge, instead of listing them all in one slice. The
+// order packages add migrations isn't predictable, so migrations added this
+// way must specify their Version, and Sorted checks that the versions are
+// complete.
+type Set struct {
+	// Name identifies the set in log messages and errors. This would usually
+	// be the name of the package that owns the migrations.
+	Name string
+
+	// Table is the name of the table used to track versions for the set. If
+	// it's empty, the adapter's table is used.
+	Table string
+
+	// Migrations is the list of migrations in the set.
+	Migrations []Migration
+}
+
+// Add adds a migration to the set.
+func (s *Set) Add(m Migration) {
+	s.Migrations = append(s.Migrations, m)
+}
+
+// Merge adds all the migrations from another set to this set. The Name and
+// Table of the other set are ignored.
+func (s *Set) Merge(other Set) {
+	s.Migrations = append(s.Migrations, other.Migrations...)
+}
+
+// Sorted returns the migrations in the set ordered by version. If none of the
+// migrations specify a version, they are returned in the order they were
+// added. Otherwise, every migration must have a version, and the versions
+// must run from 1 to the number of migrations without gaps or duplicates.
+func (s Set) Sorted() ([]Migration, error) {
+	migrations := make([]Migration, len(s.Migrations))
+	copy(migrations, s.Migrations)
+	versioned := 0
+	for _, m := range migrations {
+		if m.Version != 0 {
+			versioned++
+		}
+	}
+	if versioned == 0 {
+		return migrations, nil
+	}
+	if versioned != len(migrations) {
+		return nil, fmt.Errorf("set %s has %d migrations without a version", s.Name, len(migrations)-versioned)
+	}
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if i > 0 && m.Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("set %s has more than one migration with version %d", s.Name, m.Version)
+		}
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("set %s is missing migration version %d", s.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Combined is a group of sets that are migrated together. It's returned by
+// Combine.
+type Combined []Set
+
+// Combine groups sets so they can be migrated with a single call. The sets
+// are migrated in the order they are passed, so libraries should generally
+// be passed before the application that depends on them.
+func Combine(sets ...Set) Combined {
+	return Combined(sets)
+}
+
+// Up upgrades each of the sets to their latest version, including any
+// migrations in PhasePostDeploy. The passed adapter must be a *TableAdapter
+// if any of the sets specify a Table, so that it can be copied with a
+// different table name for each set.
+func (c Combined) Up(ctx context.Context, db *sql.DB, adapter Adapter) error {
+	adapters, err := c.adapters(adapter)
+	if err != nil {
+		return err
+	}
+	sorted := make([][]Migration, len(c))
+	for i, s := range c {
+		if sorted[i], err = s.Sorted(); err != nil {
+			return err
+		}
+	}
+	for i, s := range c {
+		adapters[i].Log("Migrating set %s", s.Name)
+		if err := UpToVersion(ctx, db, adapters[i], len(sorted[i]), sorted[i]); err != nil {
+			return fmt.Errorf("error migrating set %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetStatus is the status of one of the sets in a CombinedStatus.
+type SetStatus struct {
+	// Name is the name of the set.
+	Name string
+
+	Status
+}
+
+// SetRecord is a row in the version table of one of the sets in a
+// CombinedStatus.
+type SetRecord struct {
+	// Set is the name of the set the row belongs to.
+	Set string
+
+	VersionRecord
+}
+
+// CombinedStatus is returned by Combined.StatusAll.
+type CombinedStatus struct {
+	// Sets is the status of each set, in the order they were combined. Each
+	// set's versions are counted separately.
+	Sets []SetStatus
+
+	// History is the rows from the version tables of all the sets, merged
+	// from oldest to newest. Rows inserted at the same time are ordered by
+	// set, and then by their order in the set's table.
+	History []SetRecord
+}
+
+// StatusAll returns the status of each of the sets, and their histories
+// merged into a single chronological view, so operators can see how the
+// sets sharing a database have changed together. The passed adapter must be
+// a *TableAdapter, since the histories are read with a VersionStore. The
+// version tables aren't created if they don't exist.
+func (c Combined) StatusAll(ctx context.Context, db *sql.DB, adapter Adapter) (*CombinedStatus, error) {
+	adapters, err := c.adapters(adapter)
+	if err != nil {
+		return nil, err
+	}
+	status := &CombinedStatus{}
+	for i, s := range c {
+		t, ok := adapters[i].(*TableAdapter)
+		if !ok {
+			return nil, errors.New("adapter must be a *TableAdapter to query the status of sets")
+		}
+		migrations, err := s.Sorted()
+		if err != nil {
+			return nil, err
+		}
+		current, err := t.QuerySchemaVersion(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("error querying version of set %s: %w", s.Name, err)
+		}
+		ss := SetStatus{Name: s.Name, Status: Status{CurrentVersion: current, LatestVersion: len(migrations)}}
+		if current < ss.LatestVersion {
+			ss.Pending = ss.LatestVersion - current
+		}
+		status.Sets = append(status.Sets, ss)
+
+		records, err := NewVersionStore(db, t).List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing versions of set %s: %w", s.Name, err)
+		}
+		for _, r := range records {
+			status.History = append(status.History, SetRecord{Set: s.Name, VersionRecord: r})
+		}
+	}
+	sort.SliceStable(status.History, func(i, j int) bool {
+		return status.History[i].CreatedAt.Before(status.History[j].CreatedAt)
+	})
+	return status, nil
+}
+
+// adapters returns the adapter to use for each set.
+func (c Combined) adapters(adapter Adapter) ([]Adapter, error) {
+	adapters := make([]Adapter, len(c))
+	tables := make(map[string]string, len(c))
+	for i, s := range c {
+		a := adapter
+		if s.Table != "" {
+			t, ok := adapter.(*TableAdapter)
+			if !ok {
+				return nil, errors.New("adapter must be a *TableAdapter to use sets with custom tables")
+			}
+			a = t.WithTableName(s.Table)
+		}
+		table := s.Table
+		if t, ok := a.(*TableAdapter); ok {
+			table = t.table()
+		}
+		if other, ok := tables[table]; ok {
+			return nil, fmt.Errorf("sets %s and %s both use version table %s", other, s.Name, table)
+		}
+		tables[table] = s.Name
+		adapters[i] = a
+	}
+	return adapters, nil
+}
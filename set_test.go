@@ -0,0 +1,203 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinedUp(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	lib := Set{
+		Name:       "lib",
+		Table:      "lib_schema_versions",
+		Migrations: []Migration{{Comment: "lib comment", UpQueries: []string{"lib query"}}},
+	}
+	app := Set{
+		Name:       "app",
+		Migrations: []Migration{{Comment: "app comment", UpQueries: []string{"app query"}}},
+	}
+	adapter := NewMySQLAdapter(t.Logf)
+	adapter.CreateTableOptions = ""
+	if err := Combine(lib, app).Up(WithoutQueryComments(ctx), db, adapter); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expectedCreateSQL := `
+		CREATE TABLE IF NOT EXISTS %s (
+			version INT NOT NULL PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			upgrade TINYINT NOT NULL,
+			comment TEXT NOT NULL
+		)
+	`
+	expectedInsertSQL := `
+		INSERT INTO %s (version, upgrade, comment) VALUES (?, ?, ?)
+	`
+	md.Check(t, MockData{
+		ExecLogs: []MockQueryLog{
+			{Query: fmt.Sprintf(expectedCreateSQL, "lib_schema_versions")},
+			{Query: "lib query"},
+			{Query: fmt.Sprintf(expectedInsertSQL, "lib_schema_versions"), Args: []driver.NamedValue{
+				{Ordinal: 1, Value: int64(1)},
+				{Ordinal: 2, Value: true},
+				{Ordinal: 3, Value: "lib comment"},
+			}},
+			{Query: fmt.Sprintf(expectedCreateSQL, "schema_versions")},
+			{Query: "app query"},
+			{Query: fmt.Sprintf(expectedInsertSQL, "schema_versions"), Args: []driver.NamedValue{
+				{Ordinal: 1, Value: int64(1)},
+				{Ordinal: 2, Value: true},
+				{Ordinal: 3, Value: "app comment"},
+			}},
+		},
+		QueryLogs: []MockQueryLog{
+			{Query: "SELECT version FROM lib_schema_versions ORDER BY created_at DESC LIMIT 1"},
+			{Query: "SELECT version FROM schema_versions ORDER BY created_at DESC LIMIT 1"},
+		},
+	})
+	if adapter.TableName != "" {
+		t.Errorf("expected adapter to be unchanged, got TableName %q", adapter.TableName)
+	}
+}
+
+func TestCombinedUpPostDeploy(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	app := Set{
+		Name: "app",
+		Migrations: []Migration{
+			{Comment: "add column", UpQueries: []string{"add query"}},
+			{Comment: "drop column", UpQueries: []string{"drop query"}, Phase: PhasePostDeploy},
+		},
+	}
+	if err := Combine(app).Up(WithoutQueryComments(ctx), db, NewSQLiteAdapter(t.Logf)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		if strings.HasSuffix(l.Query, "query") {
+			queries = append(queries, l.Query)
+		}
+	}
+	if !reflect.DeepEqual(queries, []string{"add query", "drop query"}) {
+		t.Errorf("expected both migrations to be applied, got %q", queries)
+	}
+}
+
+func TestCombinedStatusAll(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2, t3 := t1.Add(time.Minute), t1.Add(2*time.Minute)
+	cols := []string{"0", "version", "created_at", "upgrade", "comment"}
+	md.QueryResults = []MockQueryResult{
+		{Pattern: `SELECT version FROM lib_schema_versions`, Rows: MockRows{Version: 1}},
+		{Pattern: `SELECT version FROM schema_versions`, Rows: MockRows{Version: 2}},
+		{Pattern: `FROM lib_schema_versions`, Rows: MockRows{Cols: cols, Values: [][]driver.Value{
+			{int64(0), int64(1), t2, int64(1), "lib comment"},
+		}}},
+		{Pattern: `FROM schema_versions`, Rows: MockRows{Cols: cols, Values: [][]driver.Value{
+			{int64(0), int64(1), t1, int64(1), "app comment 1"},
+			{int64(0), int64(2), t3, int64(1), "app comment 2"},
+		}}},
+	}
+	lib := Set{Name: "lib", Table: "lib_schema_versions", Migrations: []Migration{{}, {}}}
+	app := Set{Name: "app", Migrations: []Migration{{}, {}}}
+	status, err := Combine(lib, app).StatusAll(ctx, db, NewSQLiteAdapter(t.Logf))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := &CombinedStatus{
+		Sets: []SetStatus{
+			{Name: "lib", Status: Status{CurrentVersion: 1, LatestVersion: 2, Pending: 1}},
+			{Name: "app", Status: Status{CurrentVersion: 2, LatestVersion: 2}},
+		},
+		History: []SetRecord{
+			{Set: "app", VersionRecord: VersionRecord{Version: 1, CreatedAt: t1, Direction: DirectionApplied, Comment: "app comment 1"}},
+			{Set: "lib", VersionRecord: VersionRecord{Version: 1, CreatedAt: t2, Direction: DirectionApplied, Comment: "lib comment"}},
+			{Set: "app", VersionRecord: VersionRecord{Version: 2, CreatedAt: t3, Direction: DirectionApplied, Comment: "app comment 2"}},
+		},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected status to be %#v, got %#v", expected, status)
+	}
+
+	md.Reset()
+	md.QueryErr = errors.New("mock error")
+	_, err = Combine(lib, app).StatusAll(ctx, db, NewSQLiteAdapter(t.Logf))
+	if err == nil || err.Error() != "error querying version of set lib: mock error" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCombinedUpErrors(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	err := Combine(Set{Name: "a"}, Set{Name: "b"}).Up(ctx, db, NewSQLiteAdapter(t.Logf))
+	expectedErr := errors.New("sets a and b both use version table schema_versions")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+
+	md.ExecErr = errors.New("mock error")
+	err = Combine(Set{Name: "a", Table: "a_versions"}).Up(ctx, db, NewSQLiteAdapter(t.Logf))
+	expectedErr = errors.New("error migrating set a: error preparing schema versions: mock error")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+func TestSetSorted(t *testing.T) {
+	var s Set
+	s.Name = "app"
+	s.Add(Migration{Version: 2, Comment: "two"})
+	s.Merge(Set{Name: "other", Migrations: []Migration{
+		{Version: 3, Comment: "three"},
+		{Version: 1, Comment: "one"},
+	}})
+	migrations, err := s.Sorted()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("expected migrations[%d] to have version %d, got %d", i, i+1, m.Version)
+		}
+	}
+	if s.Migrations[0].Version != 2 {
+		t.Error("expected Sorted not to modify the set")
+	}
+
+	tests := []struct {
+		Name        string
+		Migrations  []Migration
+		ExpectedErr string
+	}{
+		{"Unversioned", []Migration{{Comment: "a"}, {Comment: "b"}}, ""},
+		{"Mixed", []Migration{{Version: 1}, {Comment: "b"}}, "set app has 1 migrations without a version"},
+		{"Duplicate", []Migration{{Version: 1}, {Version: 2}, {Version: 2}}, "set app has more than one migration with version 2"},
+		{"Gap", []Migration{{Version: 1}, {Version: 3}}, "set app is missing migration version 2"},
+		{"Zero", []Migration{{Version: 2}}, "set app is missing migration version 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := Set{Name: "app", Migrations: tt.Migrations}.Sorted()
+			if tt.ExpectedErr == "" {
+				if err != nil {
+					t.Errorf("unexpected err: %v", err)
+				}
+			} else if err == nil || err.Error() != tt.ExpectedErr {
+				t.Errorf("expected error %q, got %v", tt.ExpectedErr, err)
+			}
+		})
+	}
+}
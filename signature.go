@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrUnsignedMigration is returned by VerifyMigrations when a migration
+	// doesn't have a Signature.
+	ErrUnsignedMigration = errors.New("migration is not signed")
+
+	// ErrInvalidSignature is returned by VerifyMigrations when a
+	// migration's Signature doesn't match its SQL.
+	ErrInvalidSignature = errors.New("migration has an invalid signature")
+
+	// ErrUnverifiableMigration is returned by SignMigrations and
+	// VerifyMigrations for migrations that use Up or Down functions, since
+	// only SQL can be signed.
+	ErrUnverifiableMigration = errors.New("migration uses functions, which can't be signed")
+)
+
+// Checksum returns a hex encoded SHA-256 checksum of the migration's Comment,
+// UpQueries and DownQueries. It doesn't cover Up and Down functions, so it
+// only identifies the contents of SQL migrations.
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(strconv.Itoa(len(s))))
+		h.Write([]byte{':'})
+		h.Write([]byte(s))
+	}
+	write(m.Comment)
+	for _, queries := range [][]string{m.UpQueries, m.DownQueries} {
+		write(strconv.Itoa(len(queries)))
+		for _, q := range queries {
+			write(q)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// signedMessage returns the message that is signed for a migration. It
+// includes the version, so that signed migrations can't be reordered.
+func signedMessage(version int, m Migration) []byte {
+	return []byte(fmt.Sprintf("migrate:v%d:%s", version, m.Checksum()))
+}
+
+// SignMigrations returns a copy of the migrations with the Signature of each
+// one set, using an Ed25519 private key. The version of each migration is its
+// position in the list, like for a Migrator. This is intended for a release
+// process that has access to the key, which then generates code or files with
+// the signatures for the application to verify with VerifyKey.
+func SignMigrations(key ed25519.PrivateKey, migrations []Migration) ([]Migration, error) {
+	signed := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		if m.Up != nil || m.Down != nil {
+			return nil, fmt.Errorf("error signing migration %d: %w", i+1, ErrUnverifiableMigration)
+		}
+		m.Signature = ed25519.Sign(key, signedMessage(i+1, m))
+		signed[i] = m
+	}
+	return signed, nil
+}
+
+// VerifyMigrations returns an error if any of the migrations don't have a
+// valid Signature for the Ed25519 public key, or use Up or Down functions.
+func VerifyMigrations(key ed25519.PublicKey, migrations []Migration) error {
+	for i, m := range migrations {
+		var err error
+		switch {
+		case m.Up != nil || m.Down != nil:
+			err = ErrUnverifiableMigration
+		case m.Signature == nil:
+			err = ErrUnsignedMigration
+		case !ed25519.Verify(key, signedMessage(i+1, m), m.Signature):
+			err = ErrInvalidSignature
+		}
+		if err != nil {
+			return fmt.Errorf("error verifying migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestSignMigrations(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	migrations := []Migration{
+		{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+		{Comment: "example comment 2", UpQueries: []string{"example query 2"}, DownQueries: []string{"example query 3"}},
+	}
+	if err := VerifyMigrations(public, migrations); !errors.Is(err, ErrUnsignedMigration) {
+		t.Errorf("expected ErrUnsignedMigration, got %v", err)
+	}
+	signed, err := SignMigrations(private, migrations)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if migrations[0].Signature != nil {
+		t.Error("expected the migrations not to be modified")
+	}
+	if err := VerifyMigrations(public, signed); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+
+	tampered := append([]Migration(nil), signed...)
+	tampered[1].UpQueries = []string{"DROP TABLE users"}
+	if err := VerifyMigrations(public, tampered); err == nil || err.Error() != "error verifying migration 2: migration has an invalid signature" {
+		t.Errorf("expected an invalid signature error, got %v", err)
+	}
+	reordered := []Migration{signed[1], signed[0]}
+	if err := VerifyMigrations(public, reordered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected reordered migrations to be invalid, got %v", err)
+	}
+
+	withFunc := []Migration{{Up: func(ctx context.Context, db *sql.DB) error { return nil }}}
+	if _, err := SignMigrations(private, withFunc); !errors.Is(err, ErrUnverifiableMigration) {
+		t.Errorf("expected ErrUnverifiableMigration, got %v", err)
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	m := Migration{Comment: "a", UpQueries: []string{"b"}}
+	if m.Checksum() != (Migration{Comment: "a", UpQueries: []string{"b"}}).Checksum() {
+		t.Error("expected the checksum to be stable")
+	}
+	for _, other := range []Migration{
+		{Comment: "ab"},
+		{Comment: "a", DownQueries: []string{"b"}},
+		{Comment: "a", UpQueries: []string{"b", ""}},
+	} {
+		if m.Checksum() == other.Checksum() {
+			t.Errorf("expected %#v to have a different checksum", other)
+		}
+	}
+}
+
+func TestMigratorVerifyKey(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	public, private, _ := ed25519.GenerateKey(nil)
+	migrations := []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}}
+	m := &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf), Migrations: migrations, VerifyKey: public}
+	if err := m.Up(ctx); !errors.Is(err, ErrUnsignedMigration) {
+		t.Errorf("expected ErrUnsignedMigration, got %v", err)
+	}
+	if len(md.ExecLogs) != 0 {
+		t.Errorf("expected no queries to be run, got %#v", md.ExecLogs)
+	}
+	m.Migrations, _ = SignMigrations(private, migrations)
+	if err := m.Up(ctx); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
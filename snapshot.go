@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Snapshot is a dump of the schema created by the first Version migrations,
+// such as the output of pg_dump --schema-only or the SQLite .schema command.
+// It can be used to create a new database much faster than applying each of
+// the migrations, which is mostly useful for tests.
+type Snapshot struct {
+	// Version is the version of the last migration included in the snapshot.
+	Version int
+
+	// Script contains the SQL statements to create the schema, separated by
+	// semicolons.
+	Script string
+}
+
+// UpFromSnapshot upgrades the database to the latest migration, using a
+// snapshot to skip the migrations it covers. See Migrator.UpFromSnapshot.
+func UpFromSnapshot(ctx context.Context, db *sql.DB, adapter Adapter, snapshot Snapshot, migrations []Migration) error {
+	m := &Migrator{DB: db, Adapter: adapter, Migrations: migrations}
+	return m.UpFromSnapshot(ctx, snapshot)
+}
+
+// UpFromSnapshot upgrades the database to the latest migration. If the
+// database is empty, the snapshot is loaded first, and its version is
+// recorded with DirectionBaseline (or as an upgrade, if the adapter doesn't
+// record directions). The versions before it aren't recorded. Only the
+// migrations that are newer than the snapshot are then run. If the database
+// already has a version, the snapshot is ignored. Otherwise it's run like
+// UpToVersion with the latest version, so the plan passed to Approve only
+// includes the migrations after the snapshot.
+//
+// The snapshot must have been created from the same migrations, or the
+// database will end up with a different schema than Up would create.
+func (m *Migrator) UpFromSnapshot(ctx context.Context, snapshot Snapshot) error {
+	if snapshot.Version < 0 || snapshot.Version > len(m.Migrations) {
+		return fmt.Errorf("snapshot version %d is out of range", snapshot.Version)
+	}
+	_, _, err := m.migrateUp(ctx, len(m.Migrations), PhasePostDeploy, &snapshot)
+	return err
+}
+
+// loadSnapshot runs the snapshot script and records its version.
+func (m *Migrator) loadSnapshot(ctx context.Context, db *sql.DB, snapshot Snapshot) error {
+	m.Adapter.Log("Loading snapshot of database version %d", snapshot.Version)
+	for i, q := range splitStatements(snapshot.Script, dialectOf(m.Adapter)) {
+		if _, err := db.ExecContext(ctx, rewriteQuery(ctx, q)); err != nil {
+			return fmt.Errorf("error loading snapshot with query %d: %w", i, err)
+		}
+	}
+	// Only the snapshot's version is recorded. The rows for earlier versions
+	// would have the same created_at unless the adapter uses IDColumn, so the
+	// latest of them couldn't be told apart from the others.
+	mi := m.Migrations[snapshot.Version-1]
+	if err := m.insertVersion(ctx, db, mi, snapshot.Version, DirectionBaseline); err != nil {
+		return fmt.Errorf("error inserting schema version for version %d: %w", snapshot.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUpFromSnapshot(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	migrations := []Migration{
+		{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+		{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+		{Comment: "example comment 3", UpQueries: []string{"example query 3"}},
+	}
+	snapshot := Snapshot{Version: 2, Script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n"}
+	ctx = WithoutQueryComments(ctx)
+	if err := UpFromSnapshot(ctx, db, NewSQLiteAdapter(t.Logf), snapshot, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	insert := "INSERT INTO schema_versions (version, upgrade, comment) VALUES (?, ?, ?)"
+	if len(md.ExecLogs) != 6 {
+		t.Fatalf("expected 6 queries, got %#v", md.ExecLogs)
+	}
+	expected := []MockQueryLog{
+		{Query: "CREATE TABLE a (id INT)"},
+		{Query: "CREATE TABLE b (id INT)"},
+		{Query: insert, Args: []driver.NamedValue{
+			{Ordinal: 1, Value: int64(2)},
+			{Ordinal: 2, Value: true},
+			{Ordinal: 3, Value: "example comment 2"},
+		}},
+		{Query: "example query 3"},
+	}
+	logs := md.ExecLogs[1:5]
+	for i := range logs {
+		logs[i].Query = normalizeQuery(logs[i].Query)
+	}
+	checkLogs(t, "md.ExecLogs", logs, expected)
+
+	// The snapshot is ignored if the database already has a version.
+	md.Reset()
+	md.QueryRows.Version = 1
+	if err := UpFromSnapshot(ctx, db, NewSQLiteAdapter(t.Logf), snapshot, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 5 || md.ExecLogs[1].Query != "example query 2" {
+		t.Errorf("expected migrations to be applied, got %#v", md.ExecLogs)
+	}
+}
+
+func TestUpFromSnapshotApprove(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var approved *Plan
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2"}},
+		},
+		Approve: func(ctx context.Context, plan *Plan) error {
+			approved = plan
+			return errors.New("rejected")
+		},
+	}
+	err := m.UpFromSnapshot(ctx, Snapshot{Version: 1, Script: "CREATE TABLE a (id INT);"})
+	if err == nil || err.Error() != "migrations were not approved: rejected" {
+		t.Errorf("expected approval error, got %v", err)
+	}
+	if approved == nil || approved.CurrentVersion != 0 || len(approved.Steps) != 1 || approved.Steps[0].Version != 2 {
+		t.Errorf("expected a plan for version 2 from version 0, got %+v", approved)
+	}
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "CREATE TABLE a") {
+			t.Errorf("expected the snapshot not to be loaded, got %#v", md.ExecLogs)
+		}
+	}
+}
+
+func TestUpFromSnapshotOutOfRange(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	err := UpFromSnapshot(ctx, db, NewSQLiteAdapter(t.Logf), Snapshot{Version: 2}, []Migration{{UpQueries: []string{}}})
+	if err == nil || err.Error() != "snapshot version 2 is out of range" {
+		t.Errorf("expected out of range error, got %v", err)
+	}
+	md.Check(t, MockData{})
+}
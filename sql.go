@@ -0,0 +1,139 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// normalizeQuery prepares a query for simple pattern matching. It strips
+// comments, collapses whitespace and removes a trailing semicolon. String
+// literals are left untouched.
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	space := false
+	writeSpace := func() {
+		if !space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = true
+	}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+			b.WriteString(query[i : j+1])
+			space = false
+			i = j
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			writeSpace()
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+			writeSpace()
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			writeSpace()
+		default:
+			b.WriteByte(c)
+			space = false
+		}
+	}
+	return strings.TrimRight(strings.TrimSpace(b.String()), "; ")
+}
+
+// delimiterCommand matches a MySQL client DELIMITER command at the start of a
+// line, which changes the string that ends each statement.
+var delimiterCommand = regexp.MustCompile(`(?i)^[ \t]*DELIMITER[ \t]+(\S+)[ \t]*(?:\r?\n|$)`)
+
+// splitStatements splits a SQL script into individual statements on
+// semicolons. Semicolons inside quotes, comments and PostgreSQL dollar quoted
+// strings (like function bodies) are ignored. MySQL DELIMITER commands change
+// the string that ends statements until the next DELIMITER command, so
+// scripts can define triggers and procedures the same way they would for the
+// mysql client. Quotes inside quoted strings and identifiers are escaped by
+// doubling them, and for dialects that allow it, like MySQL, by backslashes
+// in strings. Empty statements are dropped, and the trailing delimiter and
+// DELIMITER commands are not included.
+func splitStatements(script string, dialect Dialect) []string {
+	backslash := dialect == DialectMySQL || dialect == DialectClickHouse
+	var statements []string
+	start := 0
+	delimiter := ";"
+	add := func(end, next int) {
+		if s := strings.TrimSpace(script[start:end]); s != "" && normalizeQuery(s) != "" {
+			statements = append(statements, s)
+		}
+		start = next
+	}
+	for i := 0; i < len(script); i++ {
+		if i == 0 || script[i-1] == '\n' {
+			if m := delimiterCommand.FindStringSubmatch(script[i:]); m != nil {
+				add(i, i+len(m[0]))
+				delimiter = m[1]
+				i += len(m[0]) - 1
+				continue
+			}
+		}
+		switch c := script[i]; {
+		case strings.HasPrefix(script[i:], delimiter):
+			add(i, i+len(delimiter))
+			i += len(delimiter) - 1
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(script); i++ {
+				if script[i] == c {
+					if i+1 < len(script) && script[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+				if script[i] == '\\' && c == '\'' && backslash {
+					i++
+				}
+			}
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case c == '$':
+			if tag := dollarQuoteTag.FindString(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end < 0 {
+					i = len(script)
+				} else {
+					i += len(tag) + end + len(tag) - 1
+				}
+			}
+		}
+	}
+	if start < len(script) {
+		add(len(script), len(script))
+	}
+	return statements
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	query := "-- comment\nALTER  TABLE\n\tusers /* a\nb */ ADD name TEXT DEFAULT 'a  -- b';\n"
+	expected := "ALTER TABLE users ADD name TEXT DEFAULT 'a  -- b'"
+	if actual := normalizeQuery(query); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+		-- create the table; with a comment
+		CREATE TABLE users (name TEXT DEFAULT 'a;b');
+		/* an index; */
+		CREATE INDEX users_name ON users (name);
+
+		INSERT INTO users VALUES ('it''s; "quoted"')
+	`
+	expected := []string{
+		"-- create the table; with a comment\n\t\tCREATE TABLE users (name TEXT DEFAULT 'a;b')",
+		"/* an index; */\n\t\tCREATE INDEX users_name ON users (name)",
+		`INSERT INTO users VALUES ('it''s; "quoted"')`,
+	}
+	actual := splitStatements(script, DialectUnknown)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if actual := splitStatements("  ;\n-- nothing\n;", DialectUnknown); len(actual) != 0 {
+		t.Errorf("expected no statements, got %q", actual)
+	}
+}
+
+func TestSplitStatementsDollarQuotes(t *testing.T) {
+	script := `
+		CREATE FUNCTION touch() RETURNS trigger AS $$
+		BEGIN
+			NEW.updated_at = now();
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE FUNCTION greet() RETURNS text AS $body$ SELECT 'a;$$b' $body$ LANGUAGE sql;
+		SELECT $1;
+	`
+	expected := []string{
+		"CREATE FUNCTION touch() RETURNS trigger AS $$\n\t\tBEGIN\n\t\t\tNEW.updated_at = now();\n\t\t\tRETURN NEW;\n\t\tEND;\n\t\t$$ LANGUAGE plpgsql",
+		"CREATE FUNCTION greet() RETURNS text AS $body$ SELECT 'a;$$b' $body$ LANGUAGE sql",
+		"SELECT $1",
+	}
+	actual := splitStatements(script, DialectPostgreSQL)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestSplitStatementsBackslashes(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Script   string
+		Expected []string
+	}{
+		{DialectPostgreSQL, `SELECT 'C:\'; SELECT 2;`, []string{`SELECT 'C:\'`, "SELECT 2"}},
+		{DialectSQLite, `SELECT 'C:\'; SELECT 2;`, []string{`SELECT 'C:\'`, "SELECT 2"}},
+		{DialectSQLite, `SELECT 'it''s\'; SELECT "a""b;";`, []string{`SELECT 'it''s\'`, `SELECT "a""b;"`}},
+		{DialectMySQL, `SELECT 'it\'s;'; SELECT 2;`, []string{`SELECT 'it\'s;'`, "SELECT 2"}},
+		{DialectMySQL, `SELECT 'C:\\'; SELECT 'it''s;';`, []string{`SELECT 'C:\\'`, `SELECT 'it''s;'`}},
+	}
+	for _, tt := range tests {
+		if actual := splitStatements(tt.Script, tt.Dialect); !reflect.DeepEqual(actual, tt.Expected) {
+			t.Errorf("expected %q for %s, got %q", tt.Expected, tt.Dialect, actual)
+		}
+	}
+}
+
+func TestSplitStatementsDelimiter(t *testing.T) {
+	script := "CREATE TABLE users (id INT);\n" +
+		"DELIMITER //\n" +
+		"CREATE TRIGGER users_insert BEFORE INSERT ON users FOR EACH ROW\n" +
+		"BEGIN\n  SET NEW.id = NEW.id + 1;\nEND//\n" +
+		"delimiter ;\n" +
+		"DROP TABLE old_users;\n"
+	expected := []string{
+		"CREATE TABLE users (id INT)",
+		"CREATE TRIGGER users_insert BEFORE INSERT ON users FOR EACH ROW\nBEGIN\n  SET NEW.id = NEW.id + 1;\nEND",
+		"DROP TABLE old_users",
+	}
+	actual := splitStatements(script, DialectMySQL)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+)
+
+// SQLiteMemoryDSN returns a data source name for a named SQLite in-memory
+// database with a shared cache, like "file:name?mode=memory&cache=shared".
+// By default, each connection to ":memory:" opens a separate empty database,
+// so migrations applied on one pooled connection aren't visible on the
+// others. With a shared cache, every connection in the pool that uses the
+// same name sees the same database.
+//
+// The database is deleted when its last connection is closed, so the pool
+// should keep at least one idle connection open for as long as the database
+// is needed. Migrations can also be run with Migrator.SingleConnection, which
+// keeps them on one connection while they're running.
+func SQLiteMemoryDSN(name string) string {
+	return "file:" + url.PathEscape(name) + "?mode=memory&cache=shared"
+}
+
+// UserVersionAdapter implements Adapter for SQLite by storing the version in
+// the database's user_version pragma, instead of in a table. It's intended
+// for embedded applications that don't want any extra tables. The pragma
+// only holds the current version, so the comments and history of the
+// migrations are only kept if HistoryTableName is set.
+type UserVersionAdapter struct {
+	// LogFunc is the function to use for adapter logging.
+	LogFunc LogFunc
+
+	// HistoryTableName is the name of a table to record each version in,
+	// like the table used by a TableAdapter, so it can be read with
+	// VersionStore. If it's empty, no history is kept.
+	HistoryTableName string
+}
+
+// NewUserVersionAdapter creates a UserVersionAdapter. The log parameter can be
+// set to log.Printf or a compatible function, or nil if you don't want to log.
+func NewUserVersionAdapter(log LogFunc) *UserVersionAdapter {
+	return &UserVersionAdapter{LogFunc: log}
+}
+
+// Log is used to log information about migrations. It calls the underlying
+// LogFunc, if it is not nil.
+func (a *UserVersionAdapter) Log(format string, v ...interface{}) {
+	if a.LogFunc != nil {
+		a.LogFunc(format, v...)
+	}
+}
+
+// History returns a TableAdapter for the history table, for use with
+// VersionStore, or nil if HistoryTableName isn't set.
+func (a *UserVersionAdapter) History() *TableAdapter {
+	if a.HistoryTableName == "" {
+		return nil
+	}
+	return NewSQLiteAdapter(a.LogFunc).WithTableName(a.HistoryTableName)
+}
+
+// PrepareSchemaVersions creates the history table, if HistoryTableName is
+// set. The pragma always exists, so there's nothing else to prepare.
+func (a *UserVersionAdapter) PrepareSchemaVersions(ctx context.Context, db *sql.DB) error {
+	if h := a.History(); h != nil {
+		return h.PrepareSchemaVersions(ctx, db)
+	}
+	return nil
+}
+
+// QuerySchemaVersion returns the value of the user_version pragma.
+func (a *UserVersionAdapter) QuerySchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// InsertSchemaVersion sets the user_version pragma to reflect that the
+// migration was applied or reverted.
+func (a *UserVersionAdapter) InsertSchemaVersion(ctx context.Context, db *sql.DB, version int, upgrade bool, comment string) error {
+	direction := DirectionApplied
+	if !upgrade {
+		direction = DirectionReverted
+	}
+	return a.InsertSchemaVersionDirection(ctx, db, version, direction, comment)
+}
+
+// InsertSchemaVersionDirection sets the user_version pragma to the version,
+// or to the version before it if the migration was reverted, and records the
+// version in the history table, if HistoryTableName is set.
+func (a *UserVersionAdapter) InsertSchemaVersionDirection(ctx context.Context, db *sql.DB, version int, direction Direction, comment string) error {
+	current := version
+	if !direction.upgrade() {
+		current--
+	}
+	// The pragma can't be set with a placeholder, but the version is an
+	// integer, so it's safe to format into the query.
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", current)); err != nil {
+		return err
+	}
+	if h := a.History(); h != nil {
+		return h.InsertSchemaVersionDirection(ctx, db, version, direction, comment)
+	}
+	return nil
+}
+
+// VerifySchemaVersion checks that the user_version pragma was set for the
+// version.
+func (a *UserVersionAdapter) VerifySchemaVersion(ctx context.Context, db *sql.DB, version int, direction Direction) error {
+	expected := version
+	if !direction.upgrade() {
+		expected--
+	}
+	actual, err := a.QuerySchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%w: user_version is %d, not %d", ErrVersionNotVisible, actual, expected)
+	}
+	return nil
+}
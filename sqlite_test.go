@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSQLiteMemoryDSN(t *testing.T) {
+	if dsn := SQLiteMemoryDSN("test db"); dsn != "file:test%20db?mode=memory&cache=shared" {
+		t.Errorf("unexpected dsn %q", dsn)
+	}
+}
+
+func TestUserVersionAdapter(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewUserVersionAdapter(t.Logf)
+	migrations := []Migration{
+		{Comment: "example comment 1", UpQueries: []string{"example query 1"}, DownQueries: []string{"example down 1"}},
+		{Comment: "example comment 2", UpQueries: []string{"example query 2"}, DownQueries: []string{"example down 2"}},
+	}
+	md.QueryRows.Version = 1
+	if err := Up(WithoutQueryComments(ctx), db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs:  []MockQueryLog{{Query: "example query 2"}, {Query: "PRAGMA user_version = 2"}},
+		QueryLogs: []MockQueryLog{{Query: "PRAGMA user_version"}},
+	})
+
+	md.Reset()
+	md.QueryRows.Version = 2
+	if err := DownToVersion(WithoutQueryComments(ctx), db, adapter, 1, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	md.Check(t, MockData{
+		ExecLogs:  []MockQueryLog{{Query: "example down 2"}, {Query: "PRAGMA user_version = 1"}},
+		QueryLogs: []MockQueryLog{{Query: "PRAGMA user_version"}},
+	})
+	if d := dialectOf(adapter); d != DialectSQLite {
+		t.Errorf("expected dialect %q, got %q", DialectSQLite, d)
+	}
+}
+
+func TestUserVersionAdapterHistory(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewUserVersionAdapter(t.Logf)
+	adapter.HistoryTableName = "migration_history"
+	migrations := []Migration{{Comment: "example comment 1", UpQueries: []string{"example query 1"}}}
+	if err := Up(WithoutQueryComments(ctx), db, adapter, migrations); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	for _, l := range md.ExecLogs {
+		queries = append(queries, normalizeQuery(l.Query))
+	}
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS migration_history ( version INT NOT NULL PRIMARY KEY, created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, upgrade TINYINT NOT NULL, comment TEXT NOT NULL )",
+		"example query 1",
+		"PRAGMA user_version = 1",
+		"INSERT INTO migration_history (version, upgrade, comment) VALUES (?, ?, ?)",
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries %q, got %q", expected, queries)
+	}
+}
@@ -0,0 +1,234 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// VersionRecord is a row in a TableAdapter's version table.
+type VersionRecord struct {
+	// ID is the id of the row, or zero if the adapter doesn't use IDColumn.
+	ID int64
+
+	// Version is the version of the migration.
+	Version int
+
+	// CreatedAt is when the row was inserted.
+	CreatedAt time.Time
+
+	// Direction is how the migration changed the version. If the adapter
+	// doesn't use DirectionColumn, this is either DirectionApplied or
+	// DirectionReverted.
+	Direction Direction
+
+	// Comment is the comment for the migration.
+	Comment string
+
+	// Team is the team that owns the migration, if the adapter uses
+	// TeamColumn.
+	Team string
+
+	// Metadata is the metadata of the run that inserted the row, if the
+	// adapter uses MetadataColumn.
+	Metadata map[string]string
+
+	// Checksum is the Checksum of the migration when the row was inserted,
+	// if the adapter uses ChecksumColumn. It's empty for rows inserted
+	// before the column was added, until BackfillChecksums is run.
+	Checksum string
+}
+
+// VersionStore provides access to the rows in a TableAdapter's version table,
+// for tools like dashboards and cleanup jobs that need to work with the
+// history directly. It reads and writes the columns used by the adapter's
+// options, so it keeps working if those change. With MySQL, the connection
+// must use parseTime=true so that created_at can be read.
+type VersionStore struct {
+	// DB is the database containing the version table.
+	DB *sql.DB
+
+	// Adapter is the adapter that owns the version table.
+	Adapter *TableAdapter
+}
+
+// NewVersionStore creates a VersionStore for the adapter's version table.
+func NewVersionStore(db *sql.DB, adapter *TableAdapter) *VersionStore {
+	return &VersionStore{DB: db, Adapter: adapter}
+}
+
+// List returns the rows in the version table, from oldest to newest.
+func (s *VersionStore) List(ctx context.Context) ([]VersionRecord, error) {
+	t := s.Adapter
+	id := "0"
+	if t.IDColumn {
+		id = t.orderColumn()
+	}
+	direction := "upgrade"
+	if t.DirectionColumn {
+		direction = "direction"
+	}
+	extra := ""
+	if t.TeamColumn {
+		extra += ", team"
+	}
+	if t.MetadataColumn {
+		extra += ", metadata"
+	}
+	if t.ChecksumColumn {
+		extra += ", checksum"
+	}
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, version, created_at, %s, comment%s FROM %s ORDER BY %s
+	`, id, direction, extra, t.table(), t.orderColumn()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []VersionRecord
+	for rows.Next() {
+		var r VersionRecord
+		var upgrade bool
+		dest := []interface{}{&r.ID, &r.Version, &r.CreatedAt, &upgrade, &r.Comment}
+		if t.DirectionColumn {
+			dest[3] = &r.Direction
+		}
+		if t.TeamColumn {
+			dest = append(dest, &r.Team)
+		}
+		var metadata sql.NullString
+		if t.MetadataColumn {
+			dest = append(dest, &metadata)
+		}
+		if t.ChecksumColumn {
+			dest = append(dest, &r.Checksum)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if metadata.String != "" {
+			if err := json.Unmarshal([]byte(metadata.String), &r.Metadata); err != nil {
+				return nil, fmt.Errorf("error decoding metadata for version %d: %w", r.Version, err)
+			}
+		}
+		if t.CommentCodec != nil {
+			if r.Comment, err = t.CommentCodec.DecodeComment(r.Comment); err != nil {
+				return nil, fmt.Errorf("error decoding comment for version %d: %w", r.Version, err)
+			}
+		}
+		if !t.DirectionColumn {
+			r.Direction = DirectionApplied
+			if !upgrade {
+				r.Direction = DirectionReverted
+			}
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Insert inserts a row into the version table. The ID and CreatedAt fields of
+// the record are ignored, and are set by the database (or by the adapter's
+// Now function).
+func (s *VersionStore) Insert(ctx context.Context, r VersionRecord) error {
+	ctx = withMetadata(withChecksum(withTeam(ctx, r.Team), r.Checksum), r.Metadata)
+	return s.Adapter.InsertSchemaVersionDirection(ctx, s.DB, r.Version, r.Direction, r.Comment)
+}
+
+// DeleteBelow deletes the rows in the version table for versions less than
+// version, and returns the number of rows deleted.
+func (s *VersionStore) DeleteBelow(ctx context.Context, version int) (int64, error) {
+	t := s.Adapter
+	result, err := s.DB.ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s WHERE version < %s
+	`, t.table(), t.PlaceholderVersion), version)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TeamSummary is the schema churn attributed to a team, returned by
+// SummarizeTeams.
+type TeamSummary struct {
+	// Team is the name of the team, or an empty string for rows without one.
+	Team string `json:"team"`
+
+	// Applied is the number of rows recording a migration being applied,
+	// including baselines and skipped migrations.
+	Applied int `json:"applied"`
+
+	// Reverted is the number of rows recording a migration being reverted.
+	Reverted int `json:"reverted"`
+
+	// Last is when the team's most recent row was inserted.
+	Last time.Time `json:"last"`
+}
+
+// SummarizeTeams aggregates the rows from a version table by the team that
+// owns each migration, so platform teams can see who is changing the schema
+// and how often. The summaries are sorted by team. The rows must have been
+// listed from an adapter using TeamColumn to have teams.
+func SummarizeTeams(records []VersionRecord) []TeamSummary {
+	index := map[string]int{}
+	var summaries []TeamSummary
+	for _, r := range records {
+		i, ok := index[r.Team]
+		if !ok {
+			i = len(summaries)
+			index[r.Team] = i
+			summaries = append(summaries, TeamSummary{Team: r.Team})
+		}
+		s := &summaries[i]
+		if r.Direction.upgrade() {
+			s.Applied++
+		} else {
+			s.Reverted++
+		}
+		if r.CreatedAt.After(s.Last) {
+			s.Last = r.CreatedAt
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Team < summaries[j].Team
+	})
+	return summaries
+}
+
+// PruneHistory deletes all but the newest keepLast rows from the adapter's
+// version table, and returns the number of rows deleted. The version table is
+// only ever appended to, so it can grow large in long-lived databases that
+// are deployed frequently. Since the current version is read from the newest
+// row, keepLast must be at least 1. If the adapter doesn't use IDColumn, rows
+// are ordered by created_at, and rows with the same created_at as the oldest
+// row being kept are also kept.
+func PruneHistory(ctx context.Context, db *sql.DB, adapter *TableAdapter, keepLast int) (int64, error) {
+	if keepLast < 1 {
+		return 0, fmt.Errorf("keepLast must be at least 1, got %d", keepLast)
+	}
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) <= keepLast {
+		return 0, nil
+	}
+	oldest := records[len(records)-keepLast]
+	var value interface{} = oldest.CreatedAt
+	if adapter.IDColumn {
+		value = oldest.ID
+	}
+	// The query has a single argument, so it uses the placeholder for the
+	// first one, whichever column is compared.
+	result, err := db.ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s WHERE %s < %s
+	`, adapter.table(), adapter.orderColumn(), adapter.PlaceholderVersion), value)
+	if err != nil {
+		return 0, err
+	}
+	adapter.Log("Pruned version history to the last %d rows", keepLast)
+	return result.RowsAffected()
+}
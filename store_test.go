@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVersionStoreList(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	md.QueryRows = MockRows{
+		Cols: []string{"0", "version", "created_at", "upgrade", "comment"},
+		Values: [][]driver.Value{
+			{int64(0), int64(1), t1, int64(1), "example comment 1"},
+			{int64(0), int64(1), t2, int64(0), "example comment 1"},
+		},
+	}
+	records, err := NewVersionStore(db, NewSQLiteAdapter(t.Logf)).List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []VersionRecord{
+		{Version: 1, CreatedAt: t1, Direction: DirectionApplied, Comment: "example comment 1"},
+		{Version: 1, CreatedAt: t2, Direction: DirectionReverted, Comment: "example comment 1"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records to be %#v, got %#v", expected, records)
+	}
+	if q := normalizeQuery(md.QueryLogs[0].Query); q != "SELECT 0, version, created_at, upgrade, comment FROM schema_versions ORDER BY created_at" {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+func TestVersionStoreListOptions(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	md.QueryRows = MockRows{
+		Cols:   []string{"id", "version", "created_at", "direction", "comment"},
+		Values: [][]driver.Value{{int64(7), int64(3), t1, "baseline", "example comment 3"}},
+	}
+	adapter := NewPostgreSQLAdapter(t.Logf)
+	adapter.IDColumn = true
+	adapter.DirectionColumn = true
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []VersionRecord{{ID: 7, Version: 3, CreatedAt: t1, Direction: DirectionBaseline, Comment: "example comment 3"}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records to be %#v, got %#v", expected, records)
+	}
+	if q := normalizeQuery(md.QueryLogs[0].Query); q != "SELECT id, version, created_at, direction, comment FROM schema_versions ORDER BY id" {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+func TestVersionStoreListTeam(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	md.QueryRows = MockRows{
+		Cols:   []string{"0", "version", "created_at", "upgrade", "comment", "team"},
+		Values: [][]driver.Value{{int64(0), int64(1), t1, int64(1), "example comment 1", "payments"}},
+	}
+	adapter := NewSQLiteAdapter(t.Logf)
+	adapter.TeamColumn = true
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []VersionRecord{{Version: 1, CreatedAt: t1, Direction: DirectionApplied, Comment: "example comment 1", Team: "payments"}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records to be %#v, got %#v", expected, records)
+	}
+	if q := normalizeQuery(md.QueryLogs[0].Query); q != "SELECT 0, version, created_at, upgrade, comment, team FROM schema_versions ORDER BY created_at" {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+func TestVersionStoreListMetadata(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	md.QueryRows = MockRows{
+		Cols: []string{"0", "version", "created_at", "upgrade", "comment", "team", "metadata"},
+		Values: [][]driver.Value{
+			{int64(0), int64(1), t1, int64(1), "example comment 1", "payments", `{"deploy":"42"}`},
+			{int64(0), int64(2), t1, int64(1), "example comment 2", "", nil},
+		},
+	}
+	adapter := NewSQLiteAdapter(t.Logf)
+	adapter.TeamColumn = true
+	adapter.MetadataColumn = true
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []VersionRecord{
+		{Version: 1, CreatedAt: t1, Direction: DirectionApplied, Comment: "example comment 1", Team: "payments", Metadata: map[string]string{"deploy": "42"}},
+		{Version: 2, CreatedAt: t1, Direction: DirectionApplied, Comment: "example comment 2"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records to be %#v, got %#v", expected, records)
+	}
+	if q := normalizeQuery(md.QueryLogs[0].Query); q != "SELECT 0, version, created_at, upgrade, comment, team, metadata FROM schema_versions ORDER BY created_at" {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+func TestSummarizeTeams(t *testing.T) {
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2, t3 := t1.Add(time.Minute), t1.Add(2*time.Minute)
+	records := []VersionRecord{
+		{Version: 1, CreatedAt: t1, Direction: DirectionBaseline},
+		{Version: 2, CreatedAt: t1, Direction: DirectionApplied, Team: "search"},
+		{Version: 3, CreatedAt: t2, Direction: DirectionApplied, Team: "payments"},
+		{Version: 3, CreatedAt: t3, Direction: DirectionReverted, Team: "payments"},
+	}
+	expected := []TeamSummary{
+		{Team: "", Applied: 1, Last: t1},
+		{Team: "payments", Applied: 1, Reverted: 1, Last: t3},
+		{Team: "search", Applied: 1, Last: t1},
+	}
+	if summaries := SummarizeTeams(records); !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("expected summaries to be %#v, got %#v", expected, summaries)
+	}
+}
+
+func TestVersionStoreDeleteBelow(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	if _, err := NewVersionStore(db, NewPostgreSQLAdapter(t.Logf)).DeleteBelow(ctx, 5); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 || normalizeQuery(md.ExecLogs[0].Query) != "DELETE FROM schema_versions WHERE version < $1" ||
+		md.ExecLogs[0].Args[0].Value != int64(5) {
+		t.Errorf("unexpected queries %#v", md.ExecLogs)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	md.QueryRows = MockRows{
+		Cols: []string{"rowid", "version", "created_at", "upgrade", "comment"},
+		Values: [][]driver.Value{
+			{int64(1), int64(1), t1, int64(1), ""},
+			{int64(2), int64(2), t1, int64(1), ""},
+			{int64(3), int64(3), t1, int64(1), ""},
+		},
+	}
+	adapter := NewSQLiteAdapter(t.Logf)
+	adapter.IDColumn = true
+	if _, err := PruneHistory(ctx, db, adapter, 2); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 || normalizeQuery(md.ExecLogs[0].Query) != "DELETE FROM schema_versions WHERE rowid < ?" ||
+		md.ExecLogs[0].Args[0].Value != int64(2) {
+		t.Errorf("unexpected queries %#v", md.ExecLogs)
+	}
+
+	if _, err := PruneHistory(ctx, db, adapter, 0); err == nil {
+		t.Error("expected error when keeping no rows")
+	}
+}
+
+func TestPruneHistoryCreatedAt(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	md.QueryRows = MockRows{
+		Cols: []string{"0", "version", "created_at", "upgrade", "comment"},
+		Values: [][]driver.Value{
+			{int64(0), int64(1), t1, int64(1), ""},
+			{int64(0), int64(2), t2, int64(1), ""},
+			{int64(0), int64(3), t2, int64(1), ""},
+		},
+	}
+	if _, err := PruneHistory(ctx, db, NewPostgreSQLAdapter(t.Logf), 2); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(md.ExecLogs) != 1 || normalizeQuery(md.ExecLogs[0].Query) != "DELETE FROM schema_versions WHERE created_at < $1" ||
+		md.ExecLogs[0].Args[0].Value != t2 {
+		t.Errorf("unexpected queries %#v", md.ExecLogs)
+	}
+}
@@ -0,0 +1,205 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// Store executes statements against a database that doesn't have a
+// database/sql driver, like Cassandra. It's the lower level interface a
+// database needs to implement to be migrated, and OpenStore turns it into a
+// *sql.DB, so a Migrator can run migrations against it with an Adapter for
+// its version table.
+type Store interface {
+	// Exec executes a statement that doesn't return rows.
+	Exec(ctx context.Context, query string, args ...interface{}) error
+
+	// Query executes a statement that returns rows.
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+}
+
+// Rows are the rows returned by a Store's Query.
+type Rows interface {
+	// Columns returns the names of the columns.
+	Columns() []string
+
+	// Next reads the next row into values, which has an element for each
+	// column, and returns false if there are no more rows. The values should
+	// be types that database/sql can scan, like int64, float64, bool,
+	// []byte, string or time.Time.
+	Next(values []interface{}) bool
+
+	// Close closes the rows, and returns any error that stopped Next from
+	// reading them.
+	Close() error
+}
+
+// errStoreTx is returned when a transaction is started on a *sql.DB that was
+// opened by OpenStore.
+var errStoreTx = errors.New("transactions are not supported by stores")
+
+// OpenStore returns a *sql.DB that executes its statements with the store.
+// This lets a Migrator, and the migration functions it runs, use a store in
+// the same way as any other database, with Up and Down functions that take
+// the *sql.DB, or with UpQueries and DownQueries. The Migrator's Adapter must
+// use statements the store understands.
+//
+// Statement arguments are passed to the store without being converted, so
+// they can be any type the store supports. Exec results don't have a number
+// of rows affected, so helpers that need it, like ExecBatches, can't be used
+// with a store. Stores don't support transactions, so Prepare, Checkpoints
+// and helpers that use transactions can't be used either.
+func OpenStore(s Store) *sql.DB {
+	return sql.OpenDB(storeConnector{store: s})
+}
+
+// storeConnector is a driver.Connector that opens connections to a Store.
+type storeConnector struct {
+	store Store
+}
+
+func (c storeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &storeConn{store: c.store}, nil
+}
+
+func (c storeConnector) Driver() driver.Driver {
+	return storeDriver{}
+}
+
+// storeDriver is the driver.Driver for storeConnector. Stores can't be opened
+// by name, so it's only used by database/sql to identify the driver.
+type storeDriver struct{}
+
+func (storeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("stores must be opened with OpenStore")
+}
+
+// storeConn is a driver.Conn that executes statements with a Store.
+type storeConn struct {
+	store Store
+}
+
+func (c *storeConn) Prepare(query string) (driver.Stmt, error) {
+	return &storeStmt{conn: c, query: query}, nil
+}
+
+func (c *storeConn) Close() error {
+	return nil
+}
+
+func (c *storeConn) Begin() (driver.Tx, error) {
+	return nil, errStoreTx
+}
+
+func (c *storeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return nil, errStoreTx
+}
+
+// CheckNamedValue accepts any argument, so that it's passed to the store
+// as is.
+func (c *storeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return nil
+}
+
+func (c *storeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.store.Exec(ctx, query, storeArgs(args)...); err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
+
+func (c *storeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.store.Query(ctx, query, storeArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return &storeRows{rows: rows}, nil
+}
+
+// storeArgs returns the values of the arguments.
+func storeArgs(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
+
+// storeStmt is a driver.Stmt for statements prepared on a storeConn. The
+// statement isn't prepared by the store, it's just executed with the
+// arguments.
+type storeStmt struct {
+	conn  *storeConn
+	query string
+}
+
+func (s *storeStmt) Close() error {
+	return nil
+}
+
+func (s *storeStmt) NumInput() int {
+	return -1
+}
+
+func (s *storeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *storeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *storeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *storeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+// namedValues returns the values as ordinal arguments.
+func namedValues(values []driver.Value) []driver.NamedValue {
+	args := make([]driver.NamedValue, len(values))
+	for i, v := range values {
+		args[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return args
+}
+
+// storeRows is a driver.Rows that reads the rows returned by a Store.
+type storeRows struct {
+	rows   Rows
+	closed bool
+	err    error
+}
+
+func (r *storeRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *storeRows) Next(dest []driver.Value) error {
+	values := make([]interface{}, len(dest))
+	if !r.rows.Next(values) {
+		// The error that stopped the rows is returned here, rather than
+		// only by Close, so that it's returned by the sql.Rows' Err.
+		if err := r.Close(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, v := range values {
+		dest[i] = v
+	}
+	return nil
+}
+
+func (r *storeRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.err = r.rows.Close()
+	}
+	return r.err
+}
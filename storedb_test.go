@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeStore is a Store that records the statements it executes, and returns
+// rows from a list for each query.
+type fakeStore struct {
+	execs   []Query
+	rows    [][]interface{}
+	rowsErr error
+}
+
+func (s *fakeStore) Exec(ctx context.Context, query string, args ...interface{}) error {
+	s.execs = append(s.execs, Query{SQL: query, Args: args})
+	return nil
+}
+
+func (s *fakeStore) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return &fakeRows{rows: s.rows, err: s.rowsErr}, nil
+}
+
+type fakeRows struct {
+	rows [][]interface{}
+	err  error
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"version"}
+}
+
+func (r *fakeRows) Next(values []interface{}) bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	copy(values, r.rows[0])
+	r.rows = r.rows[1:]
+	return true
+}
+
+func (r *fakeRows) Close() error {
+	return r.err
+}
+
+// storeID is an argument type that database/sql drivers wouldn't accept.
+type storeID struct {
+	hi, lo uint64
+}
+
+func TestOpenStore(t *testing.T) {
+	s := &fakeStore{}
+	db := OpenStore(s)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "create users", UpQueries: []string{"CREATE TABLE users (id uuid PRIMARY KEY)"}},
+			{Comment: "insert admin", Up: ExecQueriesWithArgs([]Query{
+				{SQL: "INSERT INTO users (id) VALUES (?)", Args: []interface{}{storeID{1, 2}}},
+			})},
+		},
+	}
+	if err := m.Up(WithoutQueryComments(context.Background())); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var queries []string
+	var versions int
+	for _, q := range s.execs {
+		if strings.Contains(q.SQL, "INSERT INTO schema_versions") {
+			versions++
+		} else if !strings.Contains(q.SQL, "schema_versions") {
+			queries = append(queries, q.SQL)
+			if strings.HasPrefix(q.SQL, "INSERT INTO users") && !reflect.DeepEqual(q.Args, []interface{}{storeID{1, 2}}) {
+				t.Errorf("expected the argument to be passed as is, got %#v", q.Args)
+			}
+		}
+	}
+	expected := []string{"CREATE TABLE users (id uuid PRIMARY KEY)", "INSERT INTO users (id) VALUES (?)"}
+	if !reflect.DeepEqual(queries, expected) || versions != 2 {
+		t.Errorf("expected queries %q and 2 versions, got %q and %d", expected, queries, versions)
+	}
+
+	s.rows = [][]interface{}{{int64(2)}}
+	if version, err := m.Adapter.QuerySchemaVersion(context.Background(), db); err != nil || version != 2 {
+		t.Errorf("expected version 2, got %d, %v", version, err)
+	}
+
+	s.rows, s.rowsErr = nil, errors.New("mock error")
+	if _, err := m.Adapter.QuerySchemaVersion(context.Background(), db); err == nil || err.Error() != "mock error" {
+		t.Errorf("expected the rows' error, got %v", err)
+	}
+
+	if _, err := db.Begin(); err != errStoreTx {
+		t.Errorf("expected %v, got %v", errStoreTx, err)
+	}
+}
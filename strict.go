@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// UnknownVersionError is returned when the Migrator's Strict option is set
+// and the database has an applied version that doesn't match the migrations.
+type UnknownVersionError struct {
+	// Version is the applied version.
+	Version int
+
+	// Comment is the comment the version was recorded with.
+	Comment string
+
+	// MigrationComment is the comment of the migration with the version, or
+	// empty if there isn't one.
+	MigrationComment string
+
+	// LatestVersion is the version of the last migration.
+	LatestVersion int
+}
+
+func (e *UnknownVersionError) Error() string {
+	if e.Version > e.LatestVersion {
+		return fmt.Sprintf("version %d (%q) is applied, but the latest migration version is %d", e.Version, e.Comment, e.LatestVersion)
+	}
+	return fmt.Sprintf("version %d was applied with comment %q, but the migration's comment is %q", e.Version, e.Comment, e.MigrationComment)
+}
+
+// checkStrict returns an error if Strict is set and the database has applied
+// versions that don't match the migrations. The database's current version
+// is checked for any adapter, and the history is checked if the adapter is a
+// TableAdapter.
+func (m *Migrator) checkStrict(ctx context.Context, db *sql.DB, currentVersion int) error {
+	if !m.Strict {
+		return nil
+	}
+	if currentVersion > len(m.Migrations) {
+		return &VersionSkewError{DatabaseVersion: currentVersion, LatestVersion: len(m.Migrations)}
+	}
+	adapter := tableAdapterOf(m.Adapter)
+	if adapter == nil {
+		return nil
+	}
+	records, err := NewVersionStore(db, adapter).List(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing versions: %w", err)
+	}
+	latest := latestRecords(records)
+	versions := make([]int, 0, len(latest))
+	for v, r := range latest {
+		if r.Direction.upgrade() {
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+	for _, v := range versions {
+		r := latest[v]
+		if v < 1 || v > len(m.Migrations) {
+			return &UnknownVersionError{Version: v, Comment: r.Comment, LatestVersion: len(m.Migrations)}
+		}
+		// The comments are compared as they're read from the history, since
+		// the adapter's CommentCodec may not be reversible.
+		comment := m.Migrations[v-1].Comment
+		stored, err := adapter.storedComment(comment)
+		if err != nil {
+			return fmt.Errorf("error checking version %d: %w", v, err)
+		}
+		if r.Comment != stored {
+			return &UnknownVersionError{Version: v, Comment: r.Comment, MigrationComment: comment, LatestVersion: len(m.Migrations)}
+		}
+	}
+	return nil
+}
+
+// tableAdapterOf returns the TableAdapter for the adapter, unwrapping
+// adapters that wrap another one, or nil if it isn't one.
+func tableAdapterOf(adapter Adapter) *TableAdapter {
+	for {
+		switch a := adapter.(type) {
+		case *TableAdapter:
+			return a
+		case interface{ Unwrap() Adapter }:
+			adapter = a.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigratorStrict(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	history := func(rows ...[]driver.Value) {
+		md.QueryResults = []MockQueryResult{{
+			Pattern: "SELECT 0, version",
+			Rows:    MockRows{Cols: []string{"0", "version", "created_at", "upgrade", "comment"}, Values: rows},
+		}}
+	}
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "create users", UpQueries: []string{"example query 1"}},
+			{Comment: "add name", UpQueries: []string{"example query 2"}},
+		},
+		Strict: true,
+	}
+
+	md.QueryRows.Version = 2
+	history(
+		[]driver.Value{int64(0), int64(1), t1, int64(1), "create users"},
+		[]driver.Value{int64(0), int64(2), t1, int64(1), "add names"},
+	)
+	err := m.Up(ctx)
+	var ue *UnknownVersionError
+	expected := `version 2 was applied with comment "add names", but the migration's comment is "add name"`
+	if !errors.As(err, &ue) || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	history(
+		[]driver.Value{int64(0), int64(1), t1, int64(1), "create users"},
+		[]driver.Value{int64(0), int64(2), t1, int64(1), "add name"},
+		[]driver.Value{int64(0), int64(4), t1, int64(1), "add email"},
+	)
+	expected = `version 4 ("add email") is applied, but the latest migration version is 2`
+	if err := m.Up(ctx); !errors.As(err, &ue) || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	history(
+		[]driver.Value{int64(0), int64(1), t1, int64(1), "create users"},
+		[]driver.Value{int64(0), int64(2), t1, int64(1), "add name"},
+		[]driver.Value{int64(0), int64(3), t1, int64(1), "add email"},
+		[]driver.Value{int64(0), int64(3), t1, int64(0), "add email"},
+	)
+	if err := m.Up(ctx); err != nil {
+		t.Errorf("expected reverted versions to be ignored, got %v", err)
+	}
+
+	md.QueryRows.Version = 3
+	var se *VersionSkewError
+	if err := m.Up(ctx); !errors.As(err, &se) {
+		t.Errorf("expected a *VersionSkewError, got %v", err)
+	}
+
+	m.Strict = false
+	if err := m.Up(ctx); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestMigratorStrictCommentCodec(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	codec := HashCommentCodec{}
+	hash := func(comment string) string {
+		s, _ := codec.EncodeComment(comment)
+		return s
+	}
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	adapter := NewSQLiteAdapter(t.Logf)
+	adapter.CommentCodec = codec
+	m := &Migrator{
+		DB:      db,
+		Adapter: adapter,
+		Migrations: []Migration{
+			{Comment: "create users", UpQueries: []string{"example query 1"}},
+			{Comment: "add name", UpQueries: []string{"example query 2"}},
+		},
+		Strict: true,
+	}
+	md.QueryRows.Version = 2
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "SELECT 0, version",
+		Rows: MockRows{Cols: []string{"0", "version", "created_at", "upgrade", "comment"}, Values: [][]driver.Value{
+			{int64(0), int64(1), t1, int64(1), hash("create users")},
+			{int64(0), int64(2), t1, int64(1), hash("add name")},
+		}},
+	}}
+	if err := m.Up(ctx); err != nil {
+		t.Errorf("expected hashed comments to match, got %v", err)
+	}
+
+	m.Migrations[1].Comment = "add names"
+	var ue *UnknownVersionError
+	if err := m.Up(ctx); !errors.As(err, &ue) || ue.Version != 2 {
+		t.Errorf("expected an *UnknownVersionError for version 2, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Summary describes a run of a Migrator. It's written to the Migrator's
+// SummaryOutput.
+type Summary struct {
+	// Direction is "up" for Up, UpToVersion, UpPhase and UpFromSnapshot,
+	// or "down" for DownToVersion.
+	Direction string `json:"direction"`
+
+	// FromVersion is the version of the database before the run.
+	FromVersion int `json:"from_version"`
+
+	// ToVersion is the version of the database after the run.
+	ToVersion int `json:"to_version"`
+
+	// Count is the number of migrations that were applied or reverted.
+	Count int `json:"count"`
+
+	// DurationMS is how long the run took, in milliseconds.
+	DurationMS int64 `json:"duration_ms"`
+
+	// Error is the error that caused the run to fail, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// writeSummary writes a Summary to SummaryOutput, if it's set. It takes
+// pointers so it can be deferred. A from version of -1 means the version
+// was never queried.
+func (m *Migrator) writeSummary(direction string, start time.Time, from, to *int, err *error) {
+	if m.SummaryOutput == nil {
+		return
+	}
+	s := Summary{Direction: direction, FromVersion: *from, ToVersion: *to, DurationMS: int64(time.Since(start) / time.Millisecond)}
+	if s.FromVersion < 0 {
+		s.FromVersion, s.ToVersion = 0, 0
+	}
+	if s.Count = s.ToVersion - s.FromVersion; s.Count < 0 {
+		s.Count = -s.Count
+	}
+	if *err != nil {
+		s.Error = (*err).Error()
+	}
+	if encodeErr := json.NewEncoder(m.SummaryOutput).Encode(s); encodeErr != nil {
+		m.Adapter.Log("Error writing summary: %s", encodeErr)
+	}
+}
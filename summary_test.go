@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigratorSummaryOutput(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	var out bytes.Buffer
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewSQLiteAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}, DownQueries: []string{"example query 2"}},
+			{Comment: "example comment 2", Up: func(ctx context.Context, db *sql.DB) error {
+				return errors.New("mock error")
+			}},
+		},
+		SummaryOutput: &out,
+	}
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	md.QueryRows.Version = 1
+	if err := m.DownToVersion(ctx, 0); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []Summary{
+		{Direction: "up", FromVersion: 0, ToVersion: 1, Count: 1, Error: "error upgrading database to version 2: mock error"},
+		{Direction: "down", FromVersion: 1, ToVersion: 0, Count: 1},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), out.String())
+	}
+	for i, line := range lines {
+		var s Summary
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		s.DurationMS = 0
+		if s != expected[i] {
+			t.Errorf("expected summary %#v, got %#v", expected[i], s)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TargetError is returned by ResolveTarget when a target doesn't match
+// exactly one migration.
+type TargetError struct {
+	// Target is the target that was being resolved.
+	Target string
+
+	// Matches are the versions of the migrations that matched, if there was
+	// more than one.
+	Matches []int
+}
+
+func (e *TargetError) Error() string {
+	if len(e.Matches) == 0 {
+		return fmt.Sprintf("no migration matches %q", e.Target)
+	}
+	versions := make([]string, len(e.Matches))
+	for i, v := range e.Matches {
+		versions[i] = strconv.Itoa(v)
+	}
+	return fmt.Sprintf("%q matches more than one migration (versions %s)", e.Target, strings.Join(versions, ", "))
+}
+
+// TargetVersionError is returned when a target version is out of range,
+// because it's negative or greater than the latest version.
+type TargetVersionError struct {
+	// Version is the target version.
+	Version int
+
+	// Latest is the latest version, which is the number of migrations.
+	Latest int
+}
+
+func (e *TargetVersionError) Error() string {
+	return fmt.Sprintf("version %d is out of range, the latest version is %d", e.Version, e.Latest)
+}
+
+// checkTarget returns a *TargetVersionError if the target version is out of
+// range for the migrations.
+func checkTarget(migrations []Migration, targetVersion int) error {
+	if targetVersion < 0 || targetVersion > len(migrations) {
+		return &TargetVersionError{Version: targetVersion, Latest: len(migrations)}
+	}
+	return nil
+}
+
+// PendingMigration describes a migration that a run didn't apply, because it
+// was after the target version or in a later phase.
+type PendingMigration struct {
+	// Version is the version of the migration.
+	Version int `json:"version"`
+
+	// Comment is the comment for the migration.
+	Comment string `json:"comment"`
+}
+
+// pendingMigrations returns the migrations after version.
+func pendingMigrations(migrations []Migration, version int) []PendingMigration {
+	var pending []PendingMigration
+	for i := version; i < len(migrations); i++ {
+		pending = append(pending, PendingMigration{Version: i + 1, Comment: migrations[i].Comment})
+	}
+	return pending
+}
+
+// ResolveTarget returns the version of the migration a target refers to. The
+// target can be a version number, or words from the migration's comment,
+// which are matched case insensitively and in any order, so "user app join"
+// matches "Add join table for users and apps". A comment that contains the
+// whole target is preferred over one that only contains its words. If no
+// migration or more than one migration matches, a *TargetError is returned,
+// and if a version number is out of range, a *TargetVersionError is.
+// It's intended for tools that let operators pick a migration by name,
+// which is less error-prone than typing a version number.
+func ResolveTarget(migrations []Migration, target string) (int, error) {
+	if v, err := strconv.Atoi(target); err == nil {
+		if err := checkTarget(migrations, v); err != nil {
+			return 0, err
+		}
+		return v, nil
+	}
+	query := strings.ToLower(strings.TrimSpace(target))
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return 0, &TargetError{Target: target}
+	}
+	var exact, matches []int
+	for i, m := range migrations {
+		comment := strings.ToLower(m.Comment)
+		if strings.Contains(comment, query) {
+			exact = append(exact, i+1)
+		}
+		if containsAll(comment, words) {
+			matches = append(matches, i+1)
+		}
+	}
+	if len(exact) > 0 {
+		matches = exact
+	}
+	if len(matches) != 1 {
+		return 0, &TargetError{Target: target, Matches: matches}
+	}
+	return matches[0], nil
+}
+
+// containsAll returns true if s contains each of the words.
+func containsAll(s string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(s, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// TargetCompletions returns the versions and comments of the migrations that
+// match a partial target, formatted as "version\tcomment", for use by shell
+// completion scripts. The versions are sorted with the most recent first.
+func TargetCompletions(migrations []Migration, partial string) []string {
+	words := strings.Fields(strings.ToLower(partial))
+	var completions []string
+	for i := len(migrations) - 1; i >= 0; i-- {
+		version := strconv.Itoa(i + 1)
+		if comment := migrations[i].Comment; strings.HasPrefix(version, partial) || containsAll(strings.ToLower(comment), words) {
+			completions = append(completions, version+"\t"+comment)
+		}
+	}
+	return completions
+}
+
+// PromptConfirm returns a function for RunConfig.ConfirmTarget that asks for
+// confirmation on out, and reads a yes or no answer from in.
+func PromptConfirm(in io.Reader, out io.Writer) func(version int, comment string) bool {
+	r := bufio.NewReader(in)
+	return func(version int, comment string) bool {
+		fmt.Fprintf(out, "Migrate to version %d (%s)? [y/N] ", version, comment)
+		answer, _ := r.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		}
+		return false
+	}
+}
@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var targetMigrations = []Migration{
+	{Comment: "Create users"},
+	{Comment: "Create apps"},
+	{Comment: "Add join table for users and apps"},
+	{Comment: "Add index to users and apps join table"},
+}
+
+func TestResolveTarget(t *testing.T) {
+	tests := []struct {
+		Target   string
+		Expected int
+	}{
+		{"2", 2},
+		{"create USERS", 1},
+		{"user app join", 0},
+		{"join table for", 3},
+		{"index", 4},
+	}
+	for _, tt := range tests {
+		v, err := ResolveTarget(targetMigrations, tt.Target)
+		if tt.Expected == 0 {
+			var te *TargetError
+			if !errors.As(err, &te) || !reflect.DeepEqual(te.Matches, []int{3, 4}) {
+				t.Errorf("expected %q to be ambiguous, got %v", tt.Target, err)
+			}
+		} else if err != nil || v != tt.Expected {
+			t.Errorf("expected %q to resolve to %d, got %d (err %v)", tt.Target, tt.Expected, v, err)
+		}
+	}
+	expected := `no migration matches "drop"`
+	if _, err := ResolveTarget(targetMigrations, "drop"); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestTargetCompletions(t *testing.T) {
+	expected := []string{"4\tAdd index to users and apps join table", "3\tAdd join table for users and apps"}
+	if c := TargetCompletions(targetMigrations, "join"); !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %q, got %q", expected, c)
+	}
+}
+
+func TestRunTargetComment(t *testing.T) {
+	db, _, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{DB: db, Adapter: NewSQLiteAdapter(t.Logf)}
+	for _, mi := range targetMigrations {
+		mi.UpQueries = []string{"example query"}
+		m.Migrations = append(m.Migrations, mi)
+	}
+	var out bytes.Buffer
+	cfg := RunConfig{
+		Migrator:      m,
+		TargetComment: "create apps",
+		ConfirmTarget: PromptConfirm(strings.NewReader("y\n"), &out),
+	}
+	if result := runResult(ctx, cfg); result.Status != "applied" || result.ToVersion != 2 {
+		t.Errorf("expected to migrate to version 2, got %#v", result)
+	}
+	if out.String() != "Migrate to version 2 (Create apps)? [y/N] " {
+		t.Errorf("unexpected prompt %q", out.String())
+	}
+
+	cfg.ConfirmTarget = PromptConfirm(strings.NewReader("\n"), &out)
+	if result := runResult(ctx, cfg); result.Status != "failed" || result.Error != "migration to version 2 was not confirmed" {
+		t.Errorf("expected the run to fail without confirmation, got %#v", result)
+	}
+}
@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func init() {
+	sql.Register("migrate_test_traced", &tracingDriver{Driver: &MockDriver{}})
+}
+
+// tracingDriver wraps another driver the way instrumentation libraries like
+// otelsql do, recording each call made through its connections.
+type tracingDriver struct {
+	driver.Driver
+}
+
+func (d *tracingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracingConn{conn.(*MockConn)}, nil
+}
+
+type tracingConn struct {
+	*MockConn
+}
+
+func trace(ctx context.Context, span string) {
+	md := MockDataFromContext(ctx)
+	mockMu.Lock()
+	md.QueryLogs = append(md.QueryLogs, MockQueryLog{Query: "trace: " + span})
+	mockMu.Unlock()
+}
+
+func (c *tracingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	trace(ctx, "begin")
+	return c.MockConn.BeginTx(ctx, opts)
+}
+
+func (c *tracingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	trace(ctx, query)
+	return c.MockConn.ExecContext(ctx, query, args)
+}
+
+func (c *tracingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	trace(ctx, query)
+	return c.MockConn.QueryContext(ctx, query, args)
+}
+
+func TestTracingDriver(t *testing.T) {
+	db, err := sql.Open("migrate_test_traced", "")
+	if err != nil {
+		t.Fatal("error opening mock db")
+	}
+	defer db.Close()
+	md, ctx := WithMockData(context.Background())
+	ctx = WithoutQueryComments(ctx)
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query"}},
+			{Comment: "example comment 2", Checkpoints: []CheckpointFunc{
+				func(ctx context.Context, tx *sql.Tx) error {
+					_, err := tx.ExecContext(ctx, "example step")
+					return err
+				},
+			}},
+		},
+		LockName: "migrate",
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := m.Prepare(ctx, 1, func(ctx context.Context, db *sql.DB) error { return nil }); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	traced := map[string]bool{}
+	for _, l := range md.QueryLogs {
+		traced[strings.TrimPrefix(l.Query, "trace: ")] = true
+	}
+	for _, l := range md.ExecLogs {
+		if !traced[l.Query] {
+			t.Errorf("expected query %q to be traced", l.Query)
+		}
+	}
+	for _, q := range []string{"SELECT pg_advisory_lock($1)", "begin", "example step", "BEGIN", "COMMIT"} {
+		if !traced[q] {
+			t.Errorf("expected %q to be traced", q)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// txRule matches a query that can't be run inside a transaction.
+type txRule struct {
+	pattern *regexp.Regexp
+	reason  string
+}
+
+var postgresTxRules = []txRule{
+	{regexp.MustCompile(`(?i)^(?:CREATE (?:UNIQUE )?|DROP )INDEX CONCURRENTLY `), "CONCURRENTLY can't be used inside a transaction"},
+	{regexp.MustCompile(`(?i)^REINDEX .*CONCURRENTLY`), "CONCURRENTLY can't be used inside a transaction"},
+	{regexp.MustCompile(`(?i)^(?:CREATE|DROP) (?:DATABASE|TABLESPACE) `), "databases and tablespaces can't be created or dropped inside a transaction"},
+	{regexp.MustCompile(`(?i)^ALTER DATABASE \S+ SET TABLESPACE `), "a database's tablespace can't be changed inside a transaction"},
+	{regexp.MustCompile(`(?i)^ALTER SYSTEM `), "ALTER SYSTEM can't be run inside a transaction"},
+	{regexp.MustCompile(`(?i)^VACUUM\b`), "VACUUM can't be run inside a transaction"},
+	{regexp.MustCompile(`(?i)^ALTER TYPE \S+ ADD VALUE `), "enum values can't be added inside a transaction before PostgreSQL 12, or used until it commits"},
+}
+
+var sqliteTxRules = []txRule{
+	{regexp.MustCompile(`(?i)^VACUUM\b`), "VACUUM can't be run inside a transaction"},
+}
+
+// checkTransactional returns an error for the first migration after
+// currentVersion, up to and including targetVersion, whose UpQueries can't be
+// run inside a transaction for the dialect. It's used by Prepare, so that
+// these fail before anything is applied, rather than with a driver error
+// partway through.
+func (m *Migrator) checkTransactional(currentVersion, targetVersion int) error {
+	var rules []txRule
+	switch dialectOf(m.Adapter) {
+	case DialectPostgreSQL:
+		rules = postgresTxRules
+	case DialectSQLite:
+		rules = sqliteTxRules
+	}
+	for i := currentVersion; i < targetVersion && i < len(m.Migrations); i++ {
+		mi := m.Migrations[i]
+		if mi.Up != nil {
+			continue
+		}
+		for j, q := range mi.UpQueries {
+			nq := normalizeQuery(q)
+			for _, r := range rules {
+				if r.pattern.MatchString(nq) {
+					err := fmt.Errorf("query %d can't be run by Prepare: %s; apply this migration with Up or UpToVersion instead", j, r.reason)
+					return &MigrationError{Version: i + 1, Upgrade: true, Comment: mi.Comment, Err: err}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// txConn is the part of *sql.Tx, and of *sql.DB, used by helpers that run
+// their statements in a transaction.
+type txConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// runInTx calls f with a transaction begun on db, and commits it if f
+// succeeds. If the migrations are already being run inside a transaction, as
+// they are by Prepare, f is called with db instead, since it's pinned to the
+// connection running that transaction, and beginning another would commit it
+// early.
+func runInTx(ctx context.Context, db *sql.DB, f func(conn txConn) error) error {
+	if inTransaction(ctx) {
+		return f(db)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
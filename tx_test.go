@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigratorPrepareTransactional(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	m := &Migrator{
+		DB:      db,
+		Adapter: NewPostgreSQLAdapter(t.Logf),
+		Migrations: []Migration{
+			{Comment: "example comment 1", UpQueries: []string{"example query 1"}},
+			{Comment: "example comment 2", UpQueries: []string{"example query 2", "create index\n\tconcurrently users_name ON users (name)"}},
+		},
+	}
+	confirm := func(ctx context.Context, db *sql.DB) error { return nil }
+	err := m.Prepare(ctx, 2, confirm)
+	expectedErr := errors.New("error upgrading database to version 2: query 1 can't be run by Prepare: " +
+		"CONCURRENTLY can't be used inside a transaction; apply this migration with Up or UpToVersion instead")
+	if err == nil || err.Error() != expectedErr.Error() {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+	for _, l := range md.ExecLogs {
+		if strings.Contains(l.Query, "example query") {
+			t.Errorf("expected no migrations to be applied, got %q", l.Query)
+		}
+	}
+
+	md.Reset()
+	m.Migrations[1].UpQueries = []string{"ALTER TYPE status ADD VALUE 'deleted'"}
+	if err := m.Prepare(ctx, 2, confirm); err == nil || !strings.Contains(err.Error(), "enum values can't be added") {
+		t.Errorf("expected adding an enum value to fail, got %v", err)
+	}
+
+	md.Reset()
+	md.QueryRows.Version = 1
+	if err := m.Prepare(ctx, 1, confirm); err != nil {
+		t.Errorf("expected migrations before the target not to be checked, got %v", err)
+	}
+
+	m.Adapter = NewSQLiteAdapter(t.Logf)
+	m.Migrations[1].UpQueries = []string{"VACUUM"}
+	if err := m.Prepare(ctx, 2, confirm); err == nil {
+		t.Error("expected VACUUM to fail for SQLite")
+	}
+}
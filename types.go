@@ -0,0 +1,104 @@
+package migrate
+
+import "fmt"
+
+// Type is an abstract column type, for migrations that must support several
+// dialects. Use SQL to convert it to the column type for a dialect.
+type Type string
+
+// These are the types known to the package.
+const (
+	// TypeBool is a true or false value.
+	TypeBool Type = "bool"
+
+	// TypeInt is a 32 bit integer.
+	TypeInt Type = "int"
+
+	// TypeBigInt is a 64 bit integer.
+	TypeBigInt Type = "bigint"
+
+	// TypeText is a string of unlimited length.
+	TypeText Type = "text"
+
+	// TypeTimestamp is a point in time, with at least microsecond precision.
+	// It's stored with the time zone in PostgreSQL, and as UTC elsewhere.
+	TypeTimestamp Type = "timestamp"
+
+	// TypeUUID is a UUID. It's stored as text in dialects without a native
+	// UUID type.
+	TypeUUID Type = "uuid"
+
+	// TypeJSON is a JSON document. It's stored as text in dialects without a
+	// native JSON type.
+	TypeJSON Type = "json"
+
+	// TypeBigAutoID is an auto incrementing 64 bit primary key. The SQL
+	// includes PRIMARY KEY, since SQLite only allows AUTOINCREMENT on the
+	// primary key.
+	TypeBigAutoID Type = "bigautoid"
+)
+
+var typeSQL = map[Type]map[Dialect]string{
+	TypeBool: {
+		DialectClickHouse: "Bool",
+		DialectMySQL:      "BOOLEAN",
+		DialectPostgreSQL: "BOOLEAN",
+		DialectSQLite:     "BOOLEAN",
+	},
+	TypeInt: {
+		DialectClickHouse: "Int32",
+		DialectMySQL:      "INT",
+		DialectPostgreSQL: "INTEGER",
+		DialectSQLite:     "INTEGER",
+	},
+	TypeBigInt: {
+		DialectClickHouse: "Int64",
+		DialectMySQL:      "BIGINT",
+		DialectPostgreSQL: "BIGINT",
+		DialectSQLite:     "INTEGER",
+	},
+	TypeText: {
+		DialectClickHouse: "String",
+		DialectMySQL:      "LONGTEXT",
+		DialectPostgreSQL: "TEXT",
+		DialectSQLite:     "TEXT",
+	},
+	TypeTimestamp: {
+		DialectClickHouse: "DateTime64(6)",
+		DialectMySQL:      "DATETIME(6)",
+		DialectPostgreSQL: "TIMESTAMP WITH TIME ZONE",
+		DialectSQLite:     "TIMESTAMP",
+	},
+	TypeUUID: {
+		DialectClickHouse: "UUID",
+		DialectMySQL:      "CHAR(36)",
+		DialectPostgreSQL: "UUID",
+		DialectSQLite:     "TEXT",
+	},
+	TypeJSON: {
+		DialectClickHouse: "String",
+		DialectMySQL:      "JSON",
+		DialectPostgreSQL: "JSONB",
+		DialectSQLite:     "TEXT",
+	},
+	TypeBigAutoID: {
+		DialectMySQL:      "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+		DialectPostgreSQL: "BIGSERIAL PRIMARY KEY",
+		DialectSQLite:     "INTEGER PRIMARY KEY AUTOINCREMENT",
+	},
+}
+
+// SQL returns the column type for the dialect, or an error if the type isn't
+// supported for it. It can be added to the Funcs of an FSLoader to use types
+// in templates.
+func (t Type) SQL(dialect Dialect) (string, error) {
+	types, ok := typeSQL[t]
+	if !ok {
+		return "", fmt.Errorf("unknown type %q", t)
+	}
+	s, ok := types[dialect]
+	if !ok {
+		return "", fmt.Errorf("type %s is not supported for dialect %q", t, dialect)
+	}
+	return s, nil
+}
@@ -0,0 +1,32 @@
+package migrate
+
+import "testing"
+
+func TestTypeSQL(t *testing.T) {
+	tests := []struct {
+		Type        Type
+		Dialect     Dialect
+		Expected    string
+		ExpectedErr string
+	}{
+		{TypeBool, DialectMySQL, "BOOLEAN", ""},
+		{TypeTimestamp, DialectPostgreSQL, "TIMESTAMP WITH TIME ZONE", ""},
+		{TypeJSON, DialectSQLite, "TEXT", ""},
+		{TypeBigAutoID, DialectSQLite, "INTEGER PRIMARY KEY AUTOINCREMENT", ""},
+		{TypeBigAutoID, DialectClickHouse, "", `type bigautoid is not supported for dialect "clickhouse"`},
+		{TypeText, DialectUnknown, "", `type text is not supported for dialect ""`},
+		{Type("money"), DialectPostgreSQL, "", `unknown type "money"`},
+	}
+	for _, tt := range tests {
+		s, err := tt.Type.SQL(tt.Dialect)
+		if tt.ExpectedErr != "" {
+			if err == nil || err.Error() != tt.ExpectedErr {
+				t.Errorf("expected error %q, got %v", tt.ExpectedErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected err: %v", err)
+		} else if s != tt.Expected {
+			t.Errorf("expected %s for %s to be %q, got %q", tt.Type, tt.Dialect, tt.Expected, s)
+		}
+	}
+}
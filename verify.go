@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrVersionNotVisible is returned when the Migrator's VerifyInserts option
+// is set, and a version that was inserted can't be read back.
+var ErrVersionNotVisible = errors.New("inserted version is not visible")
+
+// verifyInsertInterval is how often a version that isn't visible yet is
+// queried again, until VerifyInsertTimeout.
+var verifyInsertInterval = 100 * time.Millisecond
+
+// VersionVerifier is an optional interface for adapters that can check that
+// a version they inserted can be read back. It's used by the Migrator's
+// VerifyInserts option. It should return an error wrapping
+// ErrVersionNotVisible if the version isn't visible yet.
+type VersionVerifier interface {
+	VerifySchemaVersion(ctx context.Context, db *sql.DB, version int, direction Direction) error
+}
+
+// versionVerifier returns the VersionVerifier for the adapter, unwrapping
+// adapters that wrap another one, or nil if it doesn't have one.
+func versionVerifier(adapter Adapter) VersionVerifier {
+	for {
+		if v, ok := adapter.(VersionVerifier); ok {
+			return v
+		}
+		u, ok := adapter.(interface{ Unwrap() Adapter })
+		if !ok {
+			return nil
+		}
+		adapter = u.Unwrap()
+	}
+}
+
+// VerifySchemaVersion checks that the most recent row for the version has the
+// direction.
+func (t *TableAdapter) VerifySchemaVersion(ctx context.Context, db *sql.DB, version int, direction Direction) error {
+	column := "upgrade"
+	if t.DirectionColumn {
+		column = "direction"
+	}
+	row := db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM %s WHERE version = %s ORDER BY %s DESC LIMIT 1
+	`, column, t.table(), t.PlaceholderVersion, t.orderColumn()), version)
+	var actual Direction
+	var err error
+	if t.DirectionColumn {
+		err = row.Scan(&actual)
+	} else {
+		var upgrade bool
+		if err = row.Scan(&upgrade); err == nil {
+			actual = DirectionApplied
+			if !upgrade {
+				actual = DirectionReverted
+			}
+			// Without the direction column, baseline and skipped rows are
+			// stored the same way as applied ones.
+			if direction.upgrade() {
+				direction = DirectionApplied
+			}
+		}
+	}
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: no rows for version %d", ErrVersionNotVisible, version)
+	} else if err != nil {
+		return err
+	}
+	if actual != direction {
+		return fmt.Errorf("%w: version %d is %s, not %s", ErrVersionNotVisible, version, actual, direction)
+	}
+	return nil
+}
+
+// insertVersion inserts a version for the migration, and then verifies it if
+// VerifyInserts is set.
+func (m *Migrator) insertVersion(ctx context.Context, db *sql.DB, mi Migration, version int, direction Direction) error {
+	if err := insertVersion(withVersionValues(ctx, mi), db, m.Adapter, version, direction, mi.Comment); err != nil {
+		return err
+	}
+	if !m.VerifyInserts {
+		return nil
+	}
+	verifier := versionVerifier(m.Adapter)
+	deadline := time.Now().Add(m.VerifyInsertTimeout)
+	for {
+		err := verifier.VerifySchemaVersion(ctx, db, version, direction)
+		if err == nil || !errors.Is(err, ErrVersionNotVisible) || time.Now().After(deadline) {
+			return err
+		}
+		if err := Sleep(ctx, verifyInsertInterval); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigratorVerifyInserts(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	verifyQuery := "SELECT upgrade FROM schema_versions WHERE version = $1 ORDER BY created_at DESC LIMIT 1"
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "SELECT upgrade FROM",
+		Rows:    MockRows{Cols: []string{"upgrade"}, Values: [][]driver.Value{{int64(1)}}},
+	}}
+	m := &Migrator{
+		DB:            db,
+		Adapter:       wrappedAdapter{NewPostgreSQLAdapter(t.Logf)},
+		Migrations:    []Migration{{Comment: "example comment", UpQueries: []string{"example query"}}},
+		VerifyInserts: true,
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	l := md.QueryLogs[len(md.QueryLogs)-1]
+	if q := normalizeQuery(l.Query); q != verifyQuery || len(l.Args) != 1 || l.Args[0].Value != int64(1) {
+		t.Errorf("expected version 1 to be verified, got %q with %#v", q, l.Args)
+	}
+
+	md.Reset()
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "SELECT upgrade FROM",
+		Rows:    MockRows{Cols: []string{"upgrade"}},
+	}}
+	err := m.Up(ctx)
+	if !errors.Is(err, ErrVersionNotVisible) || !strings.Contains(err.Error(), "no rows for version 1") {
+		t.Errorf("expected version 1 not to be visible, got %v", err)
+	}
+
+	m.Adapter = struct{ Adapter }{NewPostgreSQLAdapter(t.Logf)}
+	if err := m.Up(ctx); err == nil || err.Error() != "adapter must implement VersionVerifier to verify inserts" {
+		t.Errorf("expected an unsupported adapter error, got %v", err)
+	}
+}
+
+func TestTableAdapterVerifySchemaVersion(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewMySQLAdapter(t.Logf)
+	adapter.DirectionColumn = true
+	md.QueryResults = []MockQueryResult{{
+		Pattern: "SELECT direction FROM",
+		Rows:    MockRows{Cols: []string{"direction"}, Values: [][]driver.Value{{"applied"}}},
+	}}
+	if err := adapter.VerifySchemaVersion(ctx, db, 2, DirectionApplied); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	err := adapter.VerifySchemaVersion(ctx, db, 2, DirectionReverted)
+	if !errors.Is(err, ErrVersionNotVisible) || !strings.Contains(err.Error(), "version 2 is applied, not reverted") {
+		t.Errorf("expected a mismatched direction, got %v", err)
+	}
+}
+
+func TestUserVersionAdapterVerifySchemaVersion(t *testing.T) {
+	db, md, ctx := setupMockDB(t)
+	defer db.Close()
+
+	adapter := NewUserVersionAdapter(t.Logf)
+	md.QueryRows.Version = 2
+	if err := adapter.VerifySchemaVersion(ctx, db, 3, DirectionReverted); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := adapter.VerifySchemaVersion(ctx, db, 3, DirectionApplied); !errors.Is(err, ErrVersionNotVisible) {
+		t.Errorf("expected user_version not to be visible, got %v", err)
+	}
+}